@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	gohttp "net/http"
+
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// apiTLSConfig returns the TLS configuration needed to reach the API of the
+// daemon running on the repo at repoPath, or nil if it serves plain HTTP.
+func apiTLSConfig(repoPath string) (*tls.Config, error) {
+	if !fsrepo.IsInitialized(repoPath) {
+		// no config to read, e.g. when only --api was given
+		return nil, nil
+	}
+	cfg, err := fsrepo.ConfigAt(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.API.TLS.Enabled() {
+		return nil, nil
+	}
+	if err := cfg.API.TLS.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.API.ClientTLS.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.API.TLS.ClientCAFile != "" && !cfg.API.ClientTLS.Enabled() {
+		return nil, errors.New("the API requires client certificates (ClientCAFile is set), but API.ClientTLS has no CertFile and KeyFile")
+	}
+	return corehttp.ClientTLSConfig(
+		repoFilePath(repoPath, cfg.API.TLS.CertFile),
+		repoFilePath(repoPath, cfg.API.ClientTLS.CertFile),
+		repoFilePath(repoPath, cfg.API.ClientTLS.KeyFile),
+	)
+}
+
+// httpsTransport sends the requests for host over TLS. The command client
+// always builds plain http:// URLs, so this upgrades its requests to the API.
+type httpsTransport struct {
+	host string
+	tpt  gohttp.RoundTripper
+	next gohttp.RoundTripper
+}
+
+func (t *httpsTransport) RoundTrip(req *gohttp.Request) (*gohttp.Response, error) {
+	if req.URL.Scheme != "http" || req.URL.Host != t.host {
+		return t.next.RoundTrip(req)
+	}
+
+	u := *req.URL
+	u.Scheme = "https"
+	r := *req
+	r.URL = &u
+	return t.tpt.RoundTrip(&r)
+}
+
+// apiHTTPClient returns an HTTP client that makes the requests to the API at
+// host go over TLS with cfg. Other requests use the default transport.
+func apiHTTPClient(host string, cfg *tls.Config) *gohttp.Client {
+	return &gohttp.Client{
+		Transport: &httpsTransport{
+			host: host,
+			tpt: &gohttp.Transport{
+				Proxy:           gohttp.ProxyFromEnvironment,
+				TLSClientConfig: cfg,
+			},
+			next: gohttp.DefaultTransport,
+		},
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	_ "expvar"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 
@@ -18,6 +21,7 @@ import (
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 
@@ -44,12 +48,14 @@ const (
 	routingOptionDHTClientKwd = "dhtclient"
 	routingOptionDHTKwd       = "dht"
 	routingOptionNoneKwd      = "none"
+	routingOptionDelegatedKwd = "delegated"
 	unencryptTransportKwd     = "disable-transport-encryption"
 	unrestrictedApiAccessKwd  = "unrestricted-api"
 	writableKwd               = "writable"
 	enableFloodSubKwd         = "enable-pubsub-experiment"
 	enableIPNSPubSubKwd       = "enable-namesys-pubsub"
 	enableMultiplexKwd        = "enable-mplex-experiment"
+	keystorePassphraseFileKwd = "keystore-passphrase-file"
 	// apiAddrKwd    = "address-api"
 	// swarmAddrKwd  = "address-swarm"
 )
@@ -131,8 +137,19 @@ can be enabled by running the daemon as:
 
   ipfs daemon --routing=dhtclient
 
-This will later be transitioned into a config option once it gets out of the
-'experimental' stage.
+Lightweight nodes can instead delegate routing to an HTTP endpoint, set in
+Routing.Delegated.Endpoint, optionally along with a DHT client:
+
+  ipfs daemon --routing=delegated
+
+The routing used without --routing is set by Routing.Type in the config.
+
+Encrypted keystore
+
+Once the keystore has been encrypted with 'ipfs repo encrypt-keystore', the
+daemon needs its passphrase to start. It is read from the file given with
+--keystore-passphrase-file, from the $IPFS_KEYSTORE_PASSPHRASE environment
+variable, or prompted for on the terminal, in that order.
 
 DEPRECATION NOTICE
 
@@ -148,7 +165,7 @@ Headers.
 
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(initOptionKwd, "Initialize ipfs with default settings if not already initialized"),
-		cmdkit.StringOption(routingOptionKwd, "Overrides the routing option").WithDefault("dht"),
+		cmdkit.StringOption(routingOptionKwd, "Overrides the routing option. Default: Routing.Type from the config, or dht."),
 		cmdkit.BoolOption(mountKwd, "Mounts IPFS to the filesystem"),
 		cmdkit.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
 		cmdkit.StringOption(ipfsMountKwd, "Path to the mountpoint for IPFS (if using --mount). Defaults to config setting."),
@@ -162,6 +179,7 @@ Headers.
 		cmdkit.BoolOption(enableFloodSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
 		cmdkit.BoolOption(enableIPNSPubSubKwd, "Enable IPNS record distribution through pubsub; enables pubsub."),
 		cmdkit.BoolOption(enableMultiplexKwd, "Add the experimental 'go-multiplex' stream muxer to libp2p on construction.").WithDefault(true),
+		cmdkit.StringOption(keystorePassphraseFileKwd, "File holding the passphrase of an encrypted keystore. Defaults to $IPFS_KEYSTORE_PASSPHRASE, or prompting for it."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmdkit.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -271,6 +289,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		break
 	}
 
+	passFile, _ := req.Options[keystorePassphraseFileKwd].(string)
+	if err := unlockKeystore(repo, passFile); err != nil {
+		re.SetError(err, cmdkit.ErrNormal)
+		return
+	}
+
 	cfg, err := cctx.GetConfig()
 	if err != nil {
 		re.SetError(err, cmdkit.ErrNormal)
@@ -297,6 +321,8 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 
 	routingOption, _ := req.Options[routingOptionKwd].(string)
 	switch routingOption {
+	case "":
+		// left to Routing.Type
 	case routingOptionSupernodeKwd:
 		re.SetError(errors.New("supernode routing was never fully implemented and has been removed"), cmdkit.ErrNormal)
 		return
@@ -306,6 +332,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		ncfg.Routing = core.DHTOption
 	case routingOptionNoneKwd:
 		ncfg.Routing = core.NilRouterOption
+	case routingOptionDelegatedKwd:
+		ncfg.Routing, err = core.DelegatedRoutingOption(cfg.Routing.Delegated)
+		if err != nil {
+			re.SetError(err, cmdkit.ErrNormal)
+			return
+		}
 	default:
 		re.SetError(fmt.Errorf("unrecognized routing option: %s", routingOption), cmdkit.ErrNormal)
 		return
@@ -370,6 +402,20 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		return
 	}
 
+	// resume the pins interrupted by the last shutdown
+	if cfg.Bitswap.PersistWants && !offline {
+		maxAge, err := core.PersistedWantsMaxAge(cfg.Bitswap)
+		if err != nil {
+			re.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		go func() {
+			if err := corerepo.ResumePins(node, maxAge); err != nil {
+				log.Errorf("error resuming pins: %s", err)
+			}
+		}()
+	}
+
 	// construct http gateway - if it is set in the config
 	var gwErrc <-chan error
 	if len(cfg.Addresses.Gateway) > 0 {
@@ -417,7 +463,18 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 	}
 	// we might have listened to /tcp/0 - lets see what we are listing on
 	apiMaddr = apiLis.Multiaddr()
-	fmt.Printf("API server listening on %s\n", apiMaddr)
+
+	var apiTLS *tls.Config
+	if cfg.API.TLS.Enabled() {
+		apiTLS, err = loadTLSConfig(cctx.ConfigRoot, cfg.API.TLS)
+		if err != nil {
+			apiLis.Close()
+			return nil, fmt.Errorf("serveHTTPApi: %s", err)
+		}
+		fmt.Printf("API server listening on %s (TLS)\n", apiMaddr)
+	} else {
+		fmt.Printf("API server listening on %s\n", apiMaddr)
+	}
 
 	// by default, we don't let you load arbitrary ipfs objects through the api,
 	// because this would open up the api to scripting vulnerabilities.
@@ -457,7 +514,11 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 
 	errc := make(chan error)
 	go func() {
-		errc <- corehttp.Serve(node, apiLis.NetListener(), opts...)
+		if apiTLS != nil {
+			errc <- corehttp.ServeTLS(node, apiLis.NetListener(), apiTLS, opts...)
+		} else {
+			errc <- corehttp.Serve(node, apiLis.NetListener(), opts...)
+		}
 		close(errc)
 	}()
 	return errc, nil
@@ -518,20 +579,51 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	// we might have listened to /tcp/0 - lets see what we are listing on
 	gatewayMaddr = gwLis.Multiaddr()
 
+	var gwTLS *tls.Config
+	suffix := ""
+	if cfg.Gateway.TLS.Enabled() {
+		gwTLS, err = loadTLSConfig(cctx.ConfigRoot, cfg.Gateway.TLS)
+		if err != nil {
+			gwLis.Close()
+			return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+		}
+		suffix = " (TLS)"
+	}
+
 	if writable {
-		fmt.Printf("Gateway (writable) server listening on %s\n", gatewayMaddr)
+		fmt.Printf("Gateway (writable) server listening on %s%s\n", gatewayMaddr, suffix)
 	} else {
-		fmt.Printf("Gateway (readonly) server listening on %s\n", gatewayMaddr)
+		fmt.Printf("Gateway (readonly) server listening on %s%s\n", gatewayMaddr, suffix)
+	}
+
+	var accessLog io.Writer
+	var logFile *os.File
+	if cfg.Gateway.AccessLog != "" {
+		logPath := repoFilePath(cctx.ConfigRoot, cfg.Gateway.AccessLog)
+		logFile, err = os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			gwLis.Close()
+			return nil, fmt.Errorf("serveHTTPGateway: opening access log failed: %s", err)
+		}
+		accessLog = logFile
 	}
 
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
+		corehttp.GatewayMetricsOption(accessLog),
+	}
+
+	if cfg.Gateway.RateLimit != (config.GatewayRateLimit{}) {
+		opts = append(opts, corehttp.RateLimitOption(cfg.Gateway.RateLimit))
+	}
+
+	opts = append(opts,
 		corehttp.CheckVersionOption(),
 		corehttp.CommandsROOption(*cctx),
 		corehttp.VersionOption(),
 		corehttp.IPNSHostnameOption(),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
-	}
+	)
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
@@ -544,12 +636,37 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 
 	errc := make(chan error)
 	go func() {
-		errc <- corehttp.Serve(node, gwLis.NetListener(), opts...)
+		if gwTLS != nil {
+			errc <- corehttp.ServeTLS(node, gwLis.NetListener(), gwTLS, opts...)
+		} else {
+			errc <- corehttp.Serve(node, gwLis.NetListener(), opts...)
+		}
+		if logFile != nil {
+			logFile.Close()
+		}
 		close(errc)
 	}()
 	return errc, nil
 }
 
+// loadTLSConfig builds the TLS configuration for an HTTP listener, resolving
+// relative certificate paths against the repo root.
+func loadTLSConfig(repoRoot string, c config.TLS) (*tls.Config, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return corehttp.TLSConfig(repoFilePath(repoRoot, c.CertFile), repoFilePath(repoRoot, c.KeyFile), repoFilePath(repoRoot, c.ClientCAFile))
+}
+
+// repoFilePath resolves a path from the config against the repo root, unless
+// it is empty or absolute.
+func repoFilePath(repoRoot, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(repoRoot, p)
+}
+
 //collects options and opens the fuse mountpoint
 func mountFuse(req *cmds.Request, cctx *oldcmds.Context) error {
 	cfg, err := cctx.GetConfig()
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	repo "github.com/ipfs/go-ipfs/repo"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	passphrase "github.com/ipfs/go-ipfs/thirdparty/passphrase"
+)
+
+// unlockKeystore unlocks the repo's keystore if it is encrypted, with the
+// passphrase in passFile, in $IPFS_KEYSTORE_PASSPHRASE, or typed in on the
+// terminal.
+func unlockKeystore(r repo.Repo, passFile string) error {
+	fsr, ok := r.(*fsrepo.FSRepo)
+	if !ok || !fsr.KeystoreLocked() {
+		return nil
+	}
+
+	pass, err := passphrase.Read(passFile, keystore.EnvPassphrase, "Enter the keystore passphrase: ")
+	if err != nil {
+		return fmt.Errorf("the keystore is encrypted: %s (set $%s or use --%s)", err, keystore.EnvPassphrase, keystorePassphraseFileKwd)
+	}
+
+	return fsr.UnlockKeystore(pass)
+}
@@ -3,11 +3,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	gohttp "net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -128,6 +130,11 @@ func mainRet() int {
 					return nil, err
 				}
 
+				if err := unlockKeystore(r, ""); err != nil {
+					r.Close()
+					return nil, err
+				}
+
 				// ok everything is good. set it on the invocation (for ownership)
 				// and return it.
 				n, err = core.NewNode(ctx, &core.BuildCfg{
@@ -467,15 +474,32 @@ func getApiClient(repoPath, apiAddrStr string) (http.Client, error) {
 	if len(addr.Protocols()) == 0 {
 		return nil, fmt.Errorf(apiErrorFmt, repoPath, "multiaddr doesn't provide any protocols")
 	}
-	return apiClientForAddr(addr)
+
+	tlsCfg, err := apiTLSConfig(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("API.TLS: %s", err)
+	}
+	return apiClientForAddr(addr, tlsCfg)
 }
 
-func apiClientForAddr(addr ma.Multiaddr) (http.Client, error) {
+func apiClientForAddr(addr ma.Multiaddr, tlsCfg *tls.Config) (http.Client, error) {
 	_, host, err := manet.DialArgs(addr)
 	if err != nil {
 		return nil, err
 	}
 
+	if tlsCfg == nil {
+		return http.NewClient(host, http.ClientWithAPIPrefix(corehttp.APIPath)), nil
+	}
+
+	// The command client has no option to pass it an *http.Client and uses
+	// whatever gohttp.DefaultClient points to when it is created, so swap in
+	// a TLS client just for its construction instead of changing the
+	// transport of the shared default client.
+	defaultClient := gohttp.DefaultClient
+	gohttp.DefaultClient = apiHTTPClient(host, tlsCfg)
+	defer func() { gohttp.DefaultClient = defaultClient }()
+
 	return http.NewClient(host, http.ClientWithAPIPrefix(corehttp.APIPath)), nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"os"
 	"syscall"
 	"time"
@@ -77,6 +78,19 @@ func (cfg *BuildCfg) fillDefaults() error {
 		cfg.Repo = r
 	}
 
+	// routing is only used online, don't fail offline nodes over its config
+	if cfg.Routing == nil && cfg.Online {
+		conf, err := cfg.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		cfg.Routing, err = RoutingOptionFromConfig(conf.Routing)
+		if err != nil {
+			return err
+		}
+	}
+
 	if cfg.Routing == nil {
 		cfg.Routing = DHTOption
 	}
@@ -88,6 +102,23 @@ func (cfg *BuildCfg) fillDefaults() error {
 	return nil
 }
 
+// RoutingOptionFromConfig returns the RoutingOption for the routing type c
+// configures, the DHT if none.
+func RoutingOptionFromConfig(c cfg.Routing) (RoutingOption, error) {
+	switch c.Type {
+	case "", "dht":
+		return DHTOption, nil
+	case "dhtclient":
+		return DHTClientOption, nil
+	case "none":
+		return NilRouterOption, nil
+	case "delegated":
+		return DelegatedRoutingOption(c.Delegated)
+	default:
+		return nil, fmt.Errorf("unknown Routing.Type %q", c.Type)
+	}
+}
+
 func defaultRepo(dstore repo.Datastore) (repo.Repo, error) {
 	c := cfg.Config{}
 	priv, pub, err := ci.GenerateKeyPairWithReader(ci.RSA, 1024, rand.Reader)
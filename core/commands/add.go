@@ -43,6 +43,7 @@ const (
 	fstoreCacheOptionName = "fscache"
 	cidVersionOptionName  = "cid-version"
 	hashOptionName        = "hash"
+	mimeTypeOptionName    = "mime-type"
 )
 
 const adderOutChanSize = 8
@@ -96,6 +97,13 @@ You can now check what blocks have been created by:
   QmY6yj1GsermExDXoosVE3aSPxdMNYr6aKuw3nA8LoWPRS 2059
   QmerURi9k4XzKCaaPbsK6BL5pMEjF7PGphjDvkkjDtsVf3 868
   QmQB28iwSriSUSMqG2nXDTLtdPHgWb4rebBrU7Q1j4vxPv 338
+
+The mime-type option, '--mime-type', wraps every added file in a unixfs
+metadata node recording its MIME type. The gateway serves such files with
+that Content-Type instead of guessing it from the file name. Pass 'auto' to
+detect the type from each file's extension or content.
+
+  > ipfs add --mime-type=auto index.html
 `,
 	},
 
@@ -119,6 +127,7 @@ You can now check what blocks have been created by:
 		cmdkit.BoolOption(fstoreCacheOptionName, "Check the filestore for pre-existing blocks. (experimental)"),
 		cmdkit.IntOption(cidVersionOptionName, "CID version. Defaults to 0 unless an option that depends on CIDv1 is passed. (experimental)"),
 		cmdkit.StringOption(hashOptionName, "Hash function to use. Implies CIDv1 if not sha2-256. (experimental)").WithDefault("sha2-256"),
+		cmdkit.StringOption(mimeTypeOptionName, "Wrap files in a metadata node with the given MIME type, or 'auto' to detect it. (experimental)"),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		quiet, _ := req.Options[quietOptionName].(bool)
@@ -172,6 +181,7 @@ You can now check what blocks have been created by:
 		fscache, _ := req.Options[fstoreCacheOptionName].(bool)
 		cidVer, cidVerSet := req.Options[cidVersionOptionName].(int)
 		hashFunStr, _ := req.Options[hashOptionName].(string)
+		mimeType, _ := req.Options[mimeTypeOptionName].(string)
 
 		// The arguments are subject to the following constraints.
 		//
@@ -280,6 +290,7 @@ You can now check what blocks have been created by:
 		fileAdder.RawLeaves = rawblks
 		fileAdder.NoCopy = nocopy
 		fileAdder.Prefix = &prefix
+		fileAdder.MimeType = mimeType
 
 		if hash {
 			md := dagtest.Mock()
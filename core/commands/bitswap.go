@@ -2,14 +2,19 @@ package commands
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"sort"
+	"text/tabwriter"
 
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	lgc "github.com/ipfs/go-ipfs/commands/legacy"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
+	bstrace "github.com/ipfs/go-ipfs/exchange/bitswap/trace"
+	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
 
 	"gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
@@ -30,6 +35,8 @@ var BitswapCmd = &cmds.Command{
 		"unwant":    lgc.NewCommand(unwantCmd),
 		"ledger":    lgc.NewCommand(ledgerCmd),
 		"reprovide": lgc.NewCommand(reprovideCmd),
+		"allowlist": bitswapAllowlistCmd,
+		"trace":     bitswapTraceCmd,
 	},
 }
 
@@ -83,10 +90,13 @@ var showWantlistCmd = &oldcmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Show blocks currently on the wantlist.",
 		ShortDescription: `
-Print out all blocks currently on the bitswap wantlist for the local peer.`,
+Print out all blocks currently on the bitswap wantlist for the local peer.
+With --verbose, the priority of each block and its priority class are shown
+as well, highest priority first.`,
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("peer", "p", "Specify which peer to show wantlist for. Default: self."),
+		cmdkit.BoolOption("verbose", "v", "Show the priority of each block."),
 	},
 	Type: KeyList{},
 	Run: func(req oldcmds.Request, res oldcmds.Response) {
@@ -112,31 +122,88 @@ Print out all blocks currently on the bitswap wantlist for the local peer.`,
 			res.SetError(err, cmdkit.ErrNormal)
 			return
 		}
+		pid := nd.Identity
 		if found {
-			pid, err := peer.IDB58Decode(pstr)
+			pid, err = peer.IDB58Decode(pstr)
 			if err != nil {
 				res.SetError(err, cmdkit.ErrNormal)
 				return
 			}
+		}
+
+		verbose, _, _ := req.Option("verbose").Bool()
+		if !verbose {
 			if pid == nd.Identity {
 				res.SetOutput(&KeyList{bs.GetWantlist()})
-				return
+			} else {
+				res.SetOutput(&KeyList{bs.WantlistForPeer(pid)})
 			}
+			return
+		}
 
-			res.SetOutput(&KeyList{bs.WantlistForPeer(pid)})
+		var entries []*wantlist.Entry
+		if pid == nd.Identity {
+			entries = bs.WantlistEntries()
 		} else {
-			res.SetOutput(&KeyList{bs.GetWantlist()})
+			entries = bs.WantlistEntriesForPeer(pid)
+		}
+		out := &WantlistOutput{Entries: make([]WantlistEntry, 0, len(entries))}
+		for _, e := range entries {
+			out.Entries = append(out.Entries, WantlistEntry{
+				Cid:      e.Cid.String(),
+				Priority: e.Priority,
+				Class:    bitswap.PriorityClassOf(e.Priority).String(),
+			})
 		}
+		res.SetOutput(out)
 	},
 	Marshalers: oldcmds.MarshalerMap{
-		oldcmds.Text: KeyListTextMarshaler,
+		oldcmds.Text: func(res oldcmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+
+			buf := new(bytes.Buffer)
+			switch out := v.(type) {
+			case *KeyList:
+				for _, k := range out.Keys {
+					buf.WriteString(k.String() + "\n")
+				}
+			case *WantlistOutput:
+				for _, e := range out.Entries {
+					fmt.Fprintf(buf, "%s %d %s\n", e.Cid, e.Priority, e.Class)
+				}
+			default:
+				return nil, e.TypeErr((*KeyList)(nil), v)
+			}
+			return buf, nil
+		},
 	},
 }
 
+// WantlistOutput is the verbose output of 'ipfs bitswap wantlist'.
+type WantlistOutput struct {
+	Entries []WantlistEntry
+}
+
+// WantlistEntry is a wanted block along with its priority.
+type WantlistEntry struct {
+	Cid      string
+	Priority int
+	Class    string
+}
+
 var bitswapStatCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
-		Tagline:          "Show some diagnostic information on the bitswap agent.",
-		ShortDescription: ``,
+		Tagline: "Show some diagnostic information on the bitswap agent.",
+		ShortDescription: `
+With --verbose, also shows the duplicate blocks received by each open session
+and from each peer.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("verbose", "v", "Show duplicate blocks per session and per peer."),
 	},
 	Type: bitswap.Stat{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) {
@@ -163,6 +230,11 @@ var bitswapStatCmd = &cmds.Command{
 			return
 		}
 
+		if verbose, _ := req.Options["verbose"].(bool); verbose {
+			st.Sessions = bs.SessionStats()
+			st.DupPeers = bs.DupPeers()
+		}
+
 		cmds.EmitOnce(res, st)
 	},
 	Encoders: cmds.EncoderMap{
@@ -180,6 +252,8 @@ var bitswapStatCmd = &cmds.Command{
 			fmt.Fprintf(w, "\tdata sent: %d\n", out.DataSent)
 			fmt.Fprintf(w, "\tdup blocks received: %d\n", out.DupBlksReceived)
 			fmt.Fprintf(w, "\tdup data received: %s\n", humanize.Bytes(out.DupDataReceived))
+			fmt.Fprintf(w, "\tthrottled sends: %d\n", out.ThrottledSends)
+			fmt.Fprintf(w, "\tthrottled time: %s\n", out.ThrottledTime)
 			fmt.Fprintf(w, "\twantlist [%d keys]\n", len(out.Wantlist))
 			for _, k := range out.Wantlist {
 				fmt.Fprintf(w, "\t\t%s\n", k.String())
@@ -189,6 +263,29 @@ var bitswapStatCmd = &cmds.Command{
 				fmt.Fprintf(w, "\t\t%s\n", p)
 			}
 
+			if verbose, _ := req.Options["verbose"].(bool); !verbose {
+				return nil
+			}
+
+			fmt.Fprintf(w, "\tsessions [%d]\n", len(out.Sessions))
+			for _, s := range out.Sessions {
+				fmt.Fprintf(w, "\t\tsession %d: %d blocks, %d dup blocks, %s dup data\n",
+					s.ID, s.Fetched, s.DupBlocks, humanize.Bytes(s.DupData))
+				for _, p := range s.Peers {
+					wasteful := ""
+					if p.Wasteful {
+						wasteful = " (no redundant wants)"
+					}
+					fmt.Fprintf(w, "\t\t\t%s: %d blocks, %d dup blocks, %s dup data%s\n",
+						p.Peer, p.Blocks, p.DupBlocks, humanize.Bytes(p.DupData), wasteful)
+				}
+			}
+			fmt.Fprintf(w, "\tduplicates by peer [%d]\n", len(out.DupPeers))
+			for _, r := range out.DupPeers {
+				fmt.Fprintf(w, "\t\t%s: %d dup blocks, %s dup data\n",
+					r.Peer, r.DupBlocks, humanize.Bytes(r.DupData))
+			}
+
 			return nil
 		}),
 	},
@@ -249,9 +346,12 @@ prints the ledger associated with a given peer.
 				"Debt ratio:\t%f\n"+
 				"Exchanges:\t%d\n"+
 				"Bytes sent:\t%d\n"+
-				"Bytes received:\t%d\n\n",
+				"Bytes received:\t%d\n"+
+				"Dup blocks received:\t%d\n"+
+				"Dup bytes received:\t%d\n\n",
 				out.Peer, out.Value, out.Exchanged,
-				out.Sent, out.Recv)
+				out.Sent, out.Recv,
+				out.DupBlocks, out.DupData)
 			return buf, nil
 		},
 	},
@@ -285,3 +385,299 @@ Trigger reprovider to announce our data to network.
 		res.SetOutput(nil)
 	},
 }
+
+// AllowlistOutput describes the peers served in private mode.
+type AllowlistOutput struct {
+	Enabled bool
+	Tag     string
+	Peers   []string
+}
+
+var bitswapAllowlistCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the peers bitswap serves blocks to in private mode.",
+		ShortDescription: `
+In private mode, bitswap ignores the wants of peers that are neither in the
+allowlist nor carry the allowlist tag, so that blocks are only sent to them.
+Blocks are still fetched from any peer.
+
+Changes made with these commands only last until the daemon is restarted. Set
+Bitswap.Private, Bitswap.AllowedPeers and Bitswap.AllowedPeerTag in the config
+to make them permanent.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"ls":      bitswapAllowlistLsCmd,
+		"add":     bitswapAllowlistAddCmd,
+		"rm":      bitswapAllowlistRmCmd,
+		"enable":  bitswapAllowlistEnableCmd,
+		"disable": bitswapAllowlistDisableCmd,
+		"tag":     bitswapAllowlistTagCmd,
+	},
+}
+
+var bitswapAllowlistLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show whether private mode is enabled, and who is allowed.",
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+var bitswapAllowlistAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Allow peers to be served in private mode.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("peer", true, true, "The PeerID (B58) of the peers to allow."),
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		peers, err := decodePeerArgs(req.Arguments)
+		if err != nil {
+			return err
+		}
+		al.Add(peers...)
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+var bitswapAllowlistRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stop serving peers in private mode.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("peer", true, true, "The PeerID (B58) of the peers to remove."),
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		peers, err := decodePeerArgs(req.Arguments)
+		if err != nil {
+			return err
+		}
+		al.Remove(peers...)
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+var bitswapAllowlistEnableCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Only serve blocks to allowed peers.",
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		al.SetEnabled(true)
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+var bitswapAllowlistDisableCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Serve blocks to every peer.",
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		al.SetEnabled(false)
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+var bitswapAllowlistTagCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Allow the peers carrying a connection manager tag.",
+		ShortDescription: `
+Peers carrying the given connection manager tag are served in private mode. An
+empty tag only allows the peers added by ID.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("tag", true, false, "The tag allowed peers carry."),
+	},
+	Type: AllowlistOutput{},
+	Run: allowlistRun(func(req *cmds.Request, al *decision.Allowlist) error {
+		al.SetTag(req.Arguments[0])
+		return nil
+	}),
+	Encoders: allowlistEncoders,
+}
+
+// allowlistRun returns a Run function applying update to the bitswap
+// allowlist and emitting its resulting state.
+func allowlistRun(update func(*cmds.Request, *decision.Allowlist) error) func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) {
+	return func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) {
+		nd, err := GetNode(env)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmdkit.ErrClient)
+			return
+		}
+
+		bs, ok := nd.Exchange.(*bitswap.Bitswap)
+		if !ok {
+			res.SetError(e.TypeErr(bs, nd.Exchange), cmdkit.ErrNormal)
+			return
+		}
+
+		al := bs.Allowlist()
+		if err := update(req, al); err != nil {
+			res.SetError(err, cmdkit.ErrClient)
+			return
+		}
+
+		out := &AllowlistOutput{
+			Enabled: al.Enabled(),
+			Tag:     al.Tag(),
+		}
+		for _, p := range al.Peers() {
+			out.Peers = append(out.Peers, p.Pretty())
+		}
+		sort.Strings(out.Peers)
+
+		cmds.EmitOnce(res, out)
+	}
+}
+
+var allowlistEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeEncoder(func(req *cmds.Request, w io.Writer, v interface{}) error {
+		out, ok := v.(*AllowlistOutput)
+		if !ok {
+			return e.TypeErr(out, v)
+		}
+
+		if out.Enabled {
+			fmt.Fprintln(w, "private mode: enabled")
+		} else {
+			fmt.Fprintln(w, "private mode: disabled")
+		}
+		if out.Tag != "" {
+			fmt.Fprintf(w, "allowed tag: %s\n", out.Tag)
+		}
+		fmt.Fprintf(w, "allowed peers [%d]\n", len(out.Peers))
+		for _, p := range out.Peers {
+			fmt.Fprintf(w, "\t%s\n", p)
+		}
+		return nil
+	}),
+}
+
+// priorityOption lets commands that fetch blocks choose how urgently bitswap
+// wants them.
+func priorityOption(def string) cmdkit.Option {
+	return cmdkit.StringOption("priority", "Bitswap priority class of the fetched blocks: background, normal or interactive.").WithDefault(def)
+}
+
+// withPriority returns a context fetching blocks with the named bitswap
+// priority class.
+func withPriority(ctx context.Context, class interface{}) (context.Context, error) {
+	name, _ := class.(string)
+	pc, err := bitswap.ParsePriorityClass(name)
+	if err != nil {
+		return nil, err
+	}
+	return bitswap.ContextWithPriority(ctx, pc), nil
+}
+
+func decodePeerArgs(args []string) ([]peer.ID, error) {
+	peers := make([]peer.ID, 0, len(args))
+	for _, arg := range args {
+		p, err := peer.IDB58Decode(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q: %s", arg, err)
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+var bitswapTraceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Summarize a bitswap message trace.",
+		ShortDescription: `
+'ipfs bitswap trace' reads a trace written by a node with Bitswap.TraceFile
+set and summarizes it: the messages exchanged with each peer, the wanted
+blocks that never arrived along with the peers they were asked from, and the
+blocks that took the longest to arrive.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("trace", true, false, "The trace to summarize.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("slowest", "n", "Number of slowest fetches to list.").WithDefault(10),
+	},
+	Type: bstrace.Summary{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) {
+		slowest, _ := req.Options["slowest"].(int)
+		if slowest < 0 {
+			res.SetError(fmt.Errorf("slowest must not be negative"), cmdkit.ErrClient)
+			return
+		}
+
+		file, err := req.Files.NextFile()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		defer file.Close()
+
+		events, err := bstrace.Read(file)
+		if err != nil {
+			res.SetError(fmt.Errorf("reading trace: %s", err), cmdkit.ErrNormal)
+			return
+		}
+
+		cmds.EmitOnce(res, bstrace.Summarize(events, slowest))
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeEncoder(func(req *cmds.Request, w io.Writer, v interface{}) error {
+			out, ok := v.(*bstrace.Summary)
+			if !ok {
+				return e.TypeErr(out, v)
+			}
+
+			fmt.Fprintf(w, "%d messages over %s\n", out.Messages, out.End.Sub(out.Start))
+
+			fmt.Fprintf(w, "peers [%d]\n", len(out.Peers))
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "\tpeer\tmsgs in/out\twants in/out\tblocks in/out\tdata in/out\tdup blocks\tdont haves")
+			for _, p := range out.Peers {
+				fmt.Fprintf(tw, "\t%s\t%d/%d\t%d/%d\t%d/%d\t%s/%s\t%d\t%d\n", p.Peer,
+					p.MessagesIn, p.MessagesOut,
+					p.WantsIn, p.WantsOut,
+					p.BlocksIn, p.BlocksOut,
+					humanize.Bytes(uint64(p.BytesIn)), humanize.Bytes(uint64(p.BytesOut)),
+					p.DupBlocksIn, p.DontHavesIn)
+			}
+			tw.Flush()
+
+			fmt.Fprintf(w, "unanswered wants [%d]\n", len(out.Unanswered))
+			for _, st := range out.Unanswered {
+				fmt.Fprintf(w, "\t%s (wanted %s)\n", st.Cid, st.Wanted.Sub(out.Start))
+				for _, p := range st.Asked {
+					fmt.Fprintf(w, "\t\tasked %s\n", p)
+				}
+				for _, p := range st.DontHaves {
+					fmt.Fprintf(w, "\t\tdont have %s\n", p)
+				}
+			}
+
+			fmt.Fprintf(w, "slowest fetches [%d]\n", len(out.Slowest))
+			for _, f := range out.Slowest {
+				fmt.Fprintf(w, "\t%s %s from %s\n", f.Cid, f.Latency, f.From)
+			}
+			return nil
+		}),
+	},
+}
@@ -27,6 +27,7 @@ var CatCmd = &cmds.Command{
 	Options: []cmdkit.Option{
 		cmdkit.IntOption("offset", "o", "Byte offset to begin reading from."),
 		cmdkit.IntOption("length", "l", "Maximum number of bytes to read."),
+		priorityOption("interactive"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) {
 		node, err := GetNode(env)
@@ -67,7 +68,13 @@ var CatCmd = &cmds.Command{
 			return
 		}
 
-		readers, length, err := cat(req.Context, node, req.Arguments, int64(offset), int64(max))
+		ctx, err := withPriority(req.Context, req.Options["priority"])
+		if err != nil {
+			res.SetError(err, cmdkit.ErrClient)
+			return
+		}
+
+		readers, length, err := cat(ctx, node, req.Arguments, int64(offset), int64(max))
 		if err != nil {
 			res.SetError(err, cmdkit.ErrNormal)
 			return
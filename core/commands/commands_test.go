@@ -70,6 +70,14 @@ func TestCommands(t *testing.T) {
 	list := []string{
 		"/add",
 		"/bitswap",
+		"/bitswap/allowlist",
+		"/bitswap/allowlist/add",
+		"/bitswap/allowlist/disable",
+		"/bitswap/allowlist/enable",
+		"/bitswap/allowlist/ls",
+		"/bitswap/allowlist/rm",
+		"/bitswap/allowlist/tag",
+		"/bitswap/trace",
 		"/bitswap/ledger",
 		"/bitswap/reprovide",
 		"/bitswap/stat",
@@ -132,6 +140,8 @@ func TestCommands(t *testing.T) {
 		"/id",
 		"/key",
 		"/key/gen",
+		"/key/export",
+		"/key/import",
 		"/key/list",
 		"/key/rename",
 		"/key/rm",
@@ -143,10 +153,18 @@ func TestCommands(t *testing.T) {
 		"/mount",
 		"/name",
 		"/name/publish",
+		"/name/export",
+		"/name/import",
+		"/name/inspect",
+		"/name/history",
+		"/name/rollback",
+		"/name/republish",
+		"/name/republish/status",
 		"/name/pubsub",
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
 		"/name/pubsub/cancel",
+		"/name/pubsub/add",
 		"/name/resolve",
 		"/object",
 		"/object/data",
@@ -185,6 +203,7 @@ func TestCommands(t *testing.T) {
 		"/refs",
 		"/refs/local",
 		"/repo",
+		"/repo/encrypt-keystore",
 		"/repo/fsck",
 		"/repo/gc",
 		"/repo/stat",
@@ -390,17 +390,24 @@ func replaceConfig(r repo.Repo, file io.Reader) error {
 		return errors.New("setting private key with API is not supported")
 	}
 
-	keyF, err := getConfig(r, config.PrivKeySelector)
+	keyF, err := getConfig(r, config.IdentityTag)
 	if err != nil {
 		return fmt.Errorf("Failed to get PrivKey")
 	}
 
-	pkstr, ok := keyF.Value.(string)
+	identity, ok := keyF.Value.(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("private key in config was not a string")
+		return fmt.Errorf("identity in config was not a map")
 	}
 
-	cfg.Identity.PrivKey = pkstr
+	// the private key is not in the config once the keystore is encrypted
+	if pk, ok := identity[config.PrivKeyTag]; ok {
+		pkstr, ok := pk.(string)
+		if !ok {
+			return fmt.Errorf("private key in config was not a string")
+		}
+		cfg.Identity.PrivKey = pkstr
+	}
 
 	return r.SetConfig(&cfg)
 }
@@ -53,9 +53,21 @@ The resolver can recursively resolve:
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 
+		cfg, err := req.InvocContext().GetConfig()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
 		recursive, _, _ := req.Option("recursive").Bool()
 		name := req.Arguments()[0]
-		resolver := namesys.NewDNSResolver()
+		resolver, err := namesys.NewDNSResolverWithConfig(req.Context(), namesys.DNSResolverConfig{
+			Resolvers: cfg.DNS.Resolvers,
+		})
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
 
 		depth := 1
 		if recursive {
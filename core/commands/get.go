@@ -47,6 +47,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmdkit.BoolOption("archive", "a", "Output a TAR archive."),
 		cmdkit.BoolOption("compress", "C", "Compress the output with GZIP compression."),
 		cmdkit.IntOption("compression-level", "l", "The level of compression (1-9)."),
+		priorityOption("interactive"),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		_, err := getCompressOptions(req)
@@ -69,7 +70,11 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 		p := path.Path(req.Arguments[0])
-		ctx := req.Context
+		ctx, err := withPriority(req.Context, req.Options["priority"])
+		if err != nil {
+			res.SetError(err, cmdkit.ErrClient)
+			return
+		}
 		dn, err := core.Resolve(ctx, node.Namesys, node.Resolver, p)
 		if err != nil {
 			res.SetError(err, cmdkit.ErrNormal)
@@ -91,7 +91,11 @@ Resolve the value of a dnslink:
 		}
 
 		if nocache {
-			resolver = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0)
+			resolver, err = n.NewNameSystem(0)
+			if err != nil {
+				res.SetError(err, cmdkit.ErrNormal)
+				return
+			}
 		}
 
 		var name string
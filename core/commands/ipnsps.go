@@ -28,6 +28,12 @@ var IpnsPubsubCmd = &cmds.Command{
 		ShortDescription: `
 Manage and inspect the state of the IPNS pubsub resolver.
 
+The resolver subscribes to the topic of a name the first time the name is
+resolved, or when asked to with 'ipfs name pubsub add'. Subscriptions, and the
+records received through them, are kept across restarts until canceled with
+'ipfs name pubsub cancel'. When peers join the topic of a name, the resolver
+sends them the latest record it has for it.
+
 Note: this command is experimental and subject to change as the system is refined
 `,
 	},
@@ -35,6 +41,7 @@ Note: this command is experimental and subject to change as the system is refine
 		"state":  ipnspsStateCmd,
 		"subs":   ipnspsSubsCmd,
 		"cancel": ipnspsCancelCmd,
+		"add":    ipnspsAddCmd,
 	},
 }
 
@@ -108,6 +115,42 @@ var ipnspsSubsCmd = &cmds.Command{
 	},
 }
 
+var ipnspsAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Subscribe to a name",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		r, ok := n.Namesys.GetResolver("pubsub")
+		if !ok {
+			res.SetError(errors.New("IPNS pubsub subsystem is not enabled"), cmdkit.ErrClient)
+			return
+		}
+
+		psr, ok := r.(*ns.PubsubResolver)
+		if !ok {
+			res.SetError(fmt.Errorf("unexpected resolver type: %v", r), cmdkit.ErrNormal)
+			return
+		}
+
+		err = psr.Subscribe(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(nil)
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, false, "Name to subscribe to."),
+	},
+}
+
 var ipnspsCancelCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Cancel a name subscription",
@@ -0,0 +1,233 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+
+	"gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit"
+)
+
+var nameExportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Sign an IPNS record without publishing it.",
+		ShortDescription: `
+'ipfs name export' signs a record pointing a name at <ipfs-path> and writes it
+to stdout, without touching the network. This lets records be signed on an
+offline machine, then published from an online node with 'ipfs name import'.
+
+A record only replaces the current one if its sequence number is higher, so
+--sequence must be past the sequence number of the name's current record, as
+shown by 'ipfs name inspect'.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, false, "ipfs path the record points to."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("sequence", "s", "Sequence number of the record."),
+		cmdkit.StringOption("lifetime", "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
+		cmdkit.StringOption("key", "k", "Name of the key to sign the record with or a valid PeerID, as listed by 'ipfs key list -l'. Default: <<default>>.").WithDefault("self"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		seq, found, err := req.Option("sequence").Int()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		if !found || seq < 0 {
+			res.SetError(errors.New("a non-negative --sequence is required"), cmdkit.ErrClient)
+			return
+		}
+
+		validtime, _, _ := req.Option("lifetime").String()
+		d, err := time.ParseDuration(validtime)
+		if err != nil {
+			res.SetError(fmt.Errorf("error parsing lifetime option: %s", err), cmdkit.ErrNormal)
+			return
+		}
+
+		p, err := coreapi.ParsePath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		kname, _, _ := req.Option("key").String()
+
+		api := coreapi.NewCoreAPI(n).Name()
+		record, err := api.CreateRecord(req.Context(), p, uint64(seq), api.WithKey(kname), api.WithValidTime(d))
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(bytes.NewReader(record))
+	},
+}
+
+var nameImportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Publish an IPNS record signed elsewhere.",
+		ShortDescription: `
+'ipfs name import' publishes a record created with 'ipfs name export',
+possibly on another machine, under <name>. The record must have been signed
+with the key of <name>, must not have expired, and must not be older than the
+name's current record.
+
+The public key of <name> is needed to check the record. It is taken from the
+name itself for ed25519 keys, and otherwise looked up in the node's keys, the
+peers it knows, and routing.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, false, "The IPNS name the record is for."),
+		cmdkit.FileArg("record", true, false, "The record to publish.").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		record, err := readRecordFile(req)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		api := coreapi.NewCoreAPI(n).Name()
+		entry, err := api.Import(req.Context(), req.Arguments()[0], record)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&IpnsEntry{
+			Name:  entry.Name(),
+			Value: entry.Value().String(),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+			entry, ok := v.(*IpnsEntry)
+			if !ok {
+				return nil, e.TypeErr(entry, v)
+			}
+
+			s := fmt.Sprintf("Published to %s: %s\n", entry.Name, entry.Value)
+			return strings.NewReader(s), nil
+		},
+	},
+	Type: IpnsEntry{},
+}
+
+var nameInspectCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the contents of an IPNS record.",
+		ShortDescription: `
+'ipfs name inspect' decodes a record created with 'ipfs name export' and shows
+the path it points to, its sequence number and how long it is valid for. With
+--verify, it also checks that the record was signed with the key of the given
+name.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("record", true, false, "The record to inspect.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("verify", "Check the record's signature against the key of this name."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		record, err := readRecordFile(req)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		api := coreapi.NewCoreAPI(n).Name()
+		name, _, _ := req.Option("verify").String()
+		out, err := api.Inspect(req.Context(), record, api.WithVerify(name))
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+			out, ok := v.(*coreiface.IpnsRecord)
+			if !ok {
+				return nil, e.TypeErr(out, v)
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Value:\t%s\n", out.Value)
+			fmt.Fprintf(buf, "Sequence:\t%d\n", out.Sequence)
+			fmt.Fprintf(buf, "Valid until:\t%s", out.EOL.Format(time.RFC3339))
+			if out.Expired {
+				fmt.Fprint(buf, " (expired)")
+			}
+			fmt.Fprintln(buf)
+			if out.TTL != 0 {
+				fmt.Fprintf(buf, "TTL:\t%s\n", out.TTL)
+			}
+			if out.Name != "" {
+				if out.SignatureValid {
+					fmt.Fprintf(buf, "Signature:\tvalid for %s\n", out.Name)
+				} else {
+					fmt.Fprintf(buf, "Signature:\tINVALID for %s\n", out.Name)
+				}
+			}
+			return buf, nil
+		},
+	},
+	Type: coreiface.IpnsRecord{},
+}
+
+func readRecordFile(req cmds.Request) ([]byte, error) {
+	file, err := req.Files().NextFile()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
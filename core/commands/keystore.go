@@ -5,12 +5,16 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"sort"
 	"strings"
 	"text/tabwriter"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	passphrase "github.com/ipfs/go-ipfs/thirdparty/passphrase"
 
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
@@ -32,10 +36,18 @@ publish'.
   > ipfs key list
   self
   mykey
+
+'ipfs key export' and 'ipfs key import' move keys between nodes, or to and
+from other tools using PEM encoded PKCS#8 keys.
+
+  > ipfs key export --format=pem-pkcs8 mykey > mykey.pem
+  > ipfs key import mykey mykey.pem
 		`,
 	},
 	Subcommands: map[string]*cmds.Command{
 		"gen":    keyGenCmd,
+		"export": keyExportCmd,
+		"import": keyImportCmd,
 		"list":   keyListCmd,
 		"rename": keyRenameCmd,
 		"rm":     keyRmCmd,
@@ -383,6 +395,156 @@ var keyRmCmd = &cmds.Command{
 	Type: KeyOutputList{},
 }
 
+// keyPasswordOption carries the password of key export and import from the
+// client to the node running the command. It isn't a flag, so that passwords
+// don't end up in shell histories or process lists: PreRun sets it from
+// --password-file or $IPFS_KEY_PASSWORD, or by prompting for it.
+const keyPasswordOption = "password"
+
+var keyExportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Export a keypair",
+		ShortDescription: `
+'ipfs key export' writes the private key with the given name to stdout. Keys
+are encoded in the libp2p protobuf format by default, or as PEM encoded
+PKCS#8 with --format=pem-pkcs8, which other tools like OpenSSL understand.
+
+PEM keys can be encrypted with a password with --encrypt. The password is
+read from --password-file, from $IPFS_KEY_PASSWORD, or prompted for. Anyone
+holding an unencrypted key can publish IPNS records under its name.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, false, "name of key to export"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("format", "f", "format of the exported key [libp2p-protobuf, pem-pkcs8]").WithDefault(keystore.FormatLibp2p),
+		cmdkit.BoolOption("encrypt", "e", "encrypt the key with a password (pem-pkcs8 only)"),
+		cmdkit.StringOption("password-file", "file holding the password to encrypt the key with, implies --encrypt"),
+	},
+	PreRun: func(req cmds.Request) error {
+		encrypt, _, _ := req.Option("encrypt").Bool()
+		passFile, _, _ := req.Option("password-file").String()
+		if !encrypt && passFile == "" {
+			return nil
+		}
+
+		password, err := newPassphrase(passFile, keystore.EnvKeyPassword, "key password")
+		if err != nil {
+			return err
+		}
+		req.SetOption(keyPasswordOption, string(password))
+		return nil
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		format, _, _ := req.Option("format").String()
+		password, _ := req.Options()[keyPasswordOption].(string)
+
+		api := coreapi.NewCoreAPI(n).Key()
+		data, err := api.Export(req.Context(), req.Arguments()[0], api.WithFormat(format), api.WithPassword(password))
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(bytes.NewReader(data))
+	},
+}
+
+var keyImportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Import a keypair",
+		ShortDescription: `
+'ipfs key import' stores a private key exported with 'ipfs key export', or
+by another tool as PEM encoded PKCS#8, under the given name. The format of
+the key is guessed unless given with --format.
+
+Encrypted keys need --encrypted, or --password-file. Their password is read
+from --password-file, from $IPFS_KEY_PASSWORD, or prompted for.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, false, "name to store the key under"),
+		cmdkit.FileArg("key", true, false, "the key to import").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("format", "f", "format of the key [libp2p-protobuf, pem-pkcs8]"),
+		cmdkit.BoolOption("encrypted", "e", "the key is encrypted with a password"),
+		cmdkit.StringOption("password-file", "file holding the password the key is encrypted with, implies --encrypted"),
+	},
+	PreRun: func(req cmds.Request) error {
+		encrypted, _, _ := req.Option("encrypted").Bool()
+		passFile, _, _ := req.Option("password-file").String()
+		if !encrypted && passFile == "" {
+			return nil
+		}
+
+		password, err := passphrase.Read(passFile, keystore.EnvKeyPassword, "Enter the key password: ")
+		if err != nil {
+			return err
+		}
+		req.SetOption(keyPasswordOption, string(password))
+		return nil
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		format, _, _ := req.Option("format").String()
+		password, _ := req.Options()[keyPasswordOption].(string)
+
+		api := coreapi.NewCoreAPI(n).Key()
+		k, err := api.Import(req.Context(), req.Arguments()[0], data, api.WithFormat(format), api.WithPassword(password))
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&KeyOutput{
+			Name: k.Name(),
+			Id:   strings.TrimPrefix(k.Path().String(), "/ipns/"),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+
+			k, ok := v.(*KeyOutput)
+			if !ok {
+				return nil, e.TypeErr(k, v)
+			}
+
+			return strings.NewReader(k.Id + "\n"), nil
+		},
+	},
+	Type: KeyOutput{},
+}
+
 func keyOutputListMarshaler(res cmds.Response) (io.Reader, error) {
 	withId, _, _ := res.Request().Option("l").Bool()
 
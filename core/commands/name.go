@@ -9,6 +9,8 @@ import (
 type IpnsEntry struct {
 	Name  string
 	Value string
+	// Error ends the output of a publication that failed part way
+	Error string `json:",omitempty"`
 }
 
 var NameCmd = &cmds.Command{
@@ -57,12 +59,29 @@ Resolve the value of a dnslink:
   > ipfs name resolve ipfs.io
   /ipfs/QmaBvfZooxWkrv7D3r8LS9moNjzD2o525XMZze69hhoxf5
 
+Sign a record on an offline machine, and publish it from an online node:
+
+  > ipfs name export --key=mykey --sequence=5 /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy > record
+  > ipfs name import QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd record
+  Published to QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
+Go back to the previous value of your name:
+
+  > ipfs name rollback
+  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
 `,
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"publish": PublishCmd,
-		"resolve": IpnsCmd,
-		"pubsub":  IpnsPubsubCmd,
+		"publish":   PublishCmd,
+		"resolve":   IpnsCmd,
+		"pubsub":    IpnsPubsubCmd,
+		"export":    nameExportCmd,
+		"import":    nameImportCmd,
+		"inspect":   nameInspectCmd,
+		"republish": nameRepublishCmd,
+		"history":   nameHistoryCmd,
+		"rollback":  nameRollbackCmd,
 	},
 }
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+
+	"gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit"
+)
+
+type ipnsHistory struct {
+	Entries []*coreiface.IpnsHistoryEntry
+}
+
+var nameHistoryCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the records published for a name.",
+		ShortDescription: `
+'ipfs name history' lists the last records this node published for the name of
+<key>, newest first, with their sequence number, when they expire and when
+they were published. Only the last few records of each name are kept.
+
+Any of them can be published again with 'ipfs name rollback'.
+`,
+	},
+
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("key", false, false, "Name of the key or a valid PeerID, as listed by 'ipfs key list -l'. Default: self."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		kname := "self"
+		if len(req.Arguments()) > 0 {
+			kname = req.Arguments()[0]
+		}
+
+		entries, err := coreapi.NewCoreAPI(n).Name().History(req.Context(), kname)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&ipnsHistory{entries})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+			out, ok := v.(*ipnsHistory)
+			if !ok {
+				return nil, e.TypeErr(out, v)
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			fmt.Fprintln(w, "Sequence\tValue\tExpires\tPublished")
+			for _, entry := range out.Entries {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", entry.Sequence, entry.Value,
+					entry.EOL.Format(time.RFC3339), entry.Published.Format(time.RFC3339))
+			}
+			w.Flush()
+
+			return buf, nil
+		},
+	},
+	Type: ipnsHistory{},
+}
+
+var nameRollbackCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Publish a previous value of a name again.",
+		ShortDescription: `
+'ipfs name rollback' publishes again a value from the history of a name, as
+listed by 'ipfs name history'. The new record gets a higher sequence number
+than the current one, so it replaces it everywhere.
+
+By default the name goes back to the last value that differs from its current
+one. --sequence picks the record of the history to go back to instead.
+`,
+	},
+
+	Options: []cmdkit.Option{
+		cmdkit.IntOption("sequence", "s", "Sequence number of the record to go back to."),
+		cmdkit.StringOption("lifetime", "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
+		cmdkit.StringOption("key", "k", "Name of the key to roll back or a valid PeerID, as listed by 'ipfs key list -l'. Default: <<default>>.").WithDefault("self"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		seq, found, err := req.Option("sequence").Int()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		if found && seq <= 0 {
+			res.SetError(errors.New("--sequence must be positive"), cmdkit.ErrClient)
+			return
+		}
+
+		validtime, _, _ := req.Option("lifetime").String()
+		d, err := time.ParseDuration(validtime)
+		if err != nil {
+			res.SetError(fmt.Errorf("error parsing lifetime option: %s", err), cmdkit.ErrNormal)
+			return
+		}
+
+		kname, _, _ := req.Option("key").String()
+
+		api := coreapi.NewCoreAPI(n).Name()
+		entry, err := api.Rollback(req.Context(), uint64(seq), api.WithKey(kname), api.WithValidTime(d))
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&IpnsEntry{
+			Name:  entry.Name(),
+			Value: entry.Value().String(),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v, err := unwrapOutput(res.Output())
+			if err != nil {
+				return nil, err
+			}
+			entry, ok := v.(*IpnsEntry)
+			if !ok {
+				return nil, e.TypeErr(entry, v)
+			}
+
+			s := fmt.Sprintf("Published to %s: %s\n", entry.Name, entry.Value)
+			return strings.NewReader(s), nil
+		},
+	},
+	Type: IpnsEntry{},
+}
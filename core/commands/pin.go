@@ -60,6 +60,7 @@ var addPinCmd = &cmds.Command{
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption("recursive", "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmdkit.BoolOption("progress", "Show progress"),
+		priorityOption("background"),
 	},
 	Type: AddPinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -79,8 +80,15 @@ var addPinCmd = &cmds.Command{
 		}
 		showProgress, _, _ := req.Option("progress").Bool()
 
+		priority, _, _ := req.Option("priority").String()
+		pctx, err := withPriority(req.Context(), priority)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrClient)
+			return
+		}
+
 		if !showProgress {
-			added, err := corerepo.Pin(n, req.Context(), req.Arguments(), recursive)
+			added, err := corerepo.Pin(n, pctx, req.Arguments(), recursive)
 			if err != nil {
 				res.SetError(err, cmdkit.ErrNormal)
 				return
@@ -92,7 +100,7 @@ var addPinCmd = &cmds.Command{
 		out := make(chan interface{})
 		res.SetOutput((<-chan interface{})(out))
 		v := new(dag.ProgressTracker)
-		ctx := v.DeriveContext(req.Context())
+		ctx := v.DeriveContext(pctx)
 
 		type pinResult struct {
 			pins []*cid.Cid
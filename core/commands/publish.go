@@ -12,6 +12,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 	path "github.com/ipfs/go-ipfs/path"
 
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
@@ -58,6 +59,16 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
  > ipfs name publish --key=QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+Publish an <ipfs-path> with several names at once, separated by commas. Either
+all of the names are updated, or none is: if publishing one of them fails,
+the others are published again with their previous value. Names that had no
+previous value, or whose previous value couldn't be published again, keep the
+new one and are listed before the error.
+
+  > ipfs name publish --key=self,mykey /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  Published to QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
 `,
 	},
 
@@ -71,7 +82,7 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
     This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
     "ns", "us" (or "µs"), "ms", "s", "m", "h".`).WithDefault("24h"),
 		cmdkit.StringOption("ttl", "Time duration this record should be cached for (caution: experimental)."),
-		cmdkit.StringOption("key", "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'. Default: <<default>>.").WithDefault("self"),
+		cmdkit.StringOption("key", "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'. Several keys can be given, separated by commas. Default: <<default>>.").WithDefault("self"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -125,10 +136,14 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 		}
 
 		kname, _, _ := req.Option("key").String()
-		k, err := keylookup(n, kname)
-		if err != nil {
-			res.SetError(err, cmdkit.ErrNormal)
-			return
+		var keys []crypto.PrivKey
+		for _, name := range strings.Split(kname, ",") {
+			k, err := keylookup(n, name)
+			if err != nil {
+				res.SetError(err, cmdkit.ErrNormal)
+				return
+			}
+			keys = append(keys, k)
 		}
 
 		pth, err := path.ParsePath(pstr)
@@ -137,12 +152,32 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 			return
 		}
 
-		output, err := publish(ctx, n, k, pth, popts)
-		if err != nil {
+		if len(keys) == 1 {
+			output, err := publish(ctx, n, keys[0], pth, popts)
+			if err != nil {
+				res.SetError(err, cmdkit.ErrNormal)
+				return
+			}
+			res.SetOutput(output)
+			return
+		}
+
+		entries, err := publishAll(ctx, n, keys, pth, popts)
+		if err != nil && len(entries) == 0 {
 			res.SetError(err, cmdkit.ErrNormal)
 			return
 		}
-		res.SetOutput(output)
+
+		outChan := make(chan interface{}, len(entries)+1)
+		for _, entry := range entries {
+			outChan <- entry
+		}
+		if err != nil {
+			// the entries are the names left with the new value
+			outChan <- &IpnsEntry{Error: err.Error()}
+		}
+		close(outChan)
+		res.SetOutput((<-chan interface{})(outChan))
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -154,6 +189,9 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 			if !ok {
 				return nil, e.TypeErr(entry, v)
 			}
+			if entry.Error != "" {
+				return nil, errors.New(entry.Error)
+			}
 
 			s := fmt.Sprintf("Published to %s: %s\n", entry.Name, entry.Value)
 			return strings.NewReader(s), nil
@@ -194,6 +232,48 @@ func publish(ctx context.Context, n *core.IpfsNode, k crypto.PrivKey, ref path.P
 	}, nil
 }
 
+// publishAll publishes ref with all the keys, or with none of them. If
+// publishing fails but some keys could not be rolled back, their entries are
+// returned along with the error.
+func publishAll(ctx context.Context, n *core.IpfsNode, keys []crypto.PrivKey, ref path.Path, opts *publishOpts) ([]*IpnsEntry, error) {
+	if opts.verifyExists {
+		// verify the path exists
+		_, err := core.Resolve(ctx, n.Namesys, n.Resolver, ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	eol := time.Now().Add(opts.pubValidTime)
+	err := namesys.PublishAll(ctx, n.Namesys, keys, ref, eol)
+	if rerr, ok := err.(*namesys.RollbackError); ok {
+		entries := make([]*IpnsEntry, len(rerr.Unrestored))
+		for i, id := range rerr.Unrestored {
+			entries[i] = &IpnsEntry{
+				Name:  id.Pretty(),
+				Value: ref.String(),
+			}
+		}
+		return entries, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*IpnsEntry, len(keys))
+	for i, k := range keys {
+		pid, err := peer.IDFromPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = &IpnsEntry{
+			Name:  pid.Pretty(),
+			Value: ref.String(),
+		}
+	}
+	return entries, nil
+}
+
 func keylookup(n *core.IpfsNode, k string) (crypto.PrivKey, error) {
 
 	res, err := n.GetKey(k)
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,9 +14,11 @@ import (
 	lgc "github.com/ipfs/go-ipfs/commands/legacy"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	passphrase "github.com/ipfs/go-ipfs/thirdparty/passphrase"
 
 	bstore "gx/ipfs/QmTVDM4LCSUMFNQzbDLL9zQwp8usE6QHymFdh3h8vL9v6b/go-ipfs-blockstore"
 	cmds "gx/ipfs/QmabLouZTZwhfALuBcssPvkzhbYGMb4394huT7HY4LQ6d3/go-ipfs-cmds"
@@ -41,6 +44,8 @@ var RepoCmd = &cmds.Command{
 		"fsck":    lgc.NewCommand(RepoFsckCmd),
 		"version": lgc.NewCommand(repoVersionCmd),
 		"verify":  lgc.NewCommand(repoVerifyCmd),
+
+		"encrypt-keystore": lgc.NewCommand(repoEncryptKeystoreCmd),
 	},
 }
 
@@ -264,6 +269,78 @@ daemons are running.
 	},
 }
 
+var repoEncryptKeystoreCmd = &oldcmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Encrypt the keystore with a passphrase.",
+		ShortDescription: `
+'ipfs repo encrypt-keystore' encrypts the keys in the keystore with a key
+derived from a passphrase, and moves the node's private key from the config
+into the keystore. This command can only run when no ipfs daemons are running.
+
+Afterwards, the passphrase is needed to start the daemon or to run commands
+without one. It is read from $IPFS_KEYSTORE_PASSPHRASE, or prompted for.
+There is no way to recover the keys if the passphrase is lost.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("passphrase-file", "File holding the new passphrase. Defaults to $IPFS_KEYSTORE_PASSPHRASE, or prompting for it."),
+	},
+	Run: func(req oldcmds.Request, res oldcmds.Response) {
+		passFile, _, _ := req.Option("passphrase-file").String()
+		pass, err := newPassphrase(passFile, keystore.EnvPassphrase, "keystore passphrase")
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		r, err := fsrepo.Open(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+		defer r.Close()
+
+		fsr, ok := r.(*fsrepo.FSRepo)
+		if !ok {
+			res.SetError(errors.New("repo does not support keystore encryption"), cmdkit.ErrNormal)
+			return
+		}
+
+		if err := fsr.EncryptKeystore(pass); err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&MessageOutput{"Keystore encrypted.\n"})
+	},
+	Type: MessageOutput{},
+	Marshalers: oldcmds.MarshalerMap{
+		oldcmds.Text: MessageTextMarshaler,
+	},
+}
+
+// newPassphrase reads a new passphrase from passFile, or the environment
+// variable env, asking for it twice when it has to be typed in. what names the
+// passphrase in the prompts.
+func newPassphrase(passFile, env, what string) ([]byte, error) {
+	if passFile != "" || os.Getenv(env) != "" {
+		return passphrase.Read(passFile, env, "")
+	}
+
+	pass, err := passphrase.Prompt("New " + what + ": ")
+	if err != nil {
+		return nil, err
+	}
+	again, err := passphrase.Prompt("Repeat the " + what + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
+
 type VerifyProgress struct {
 	Msg      string
 	Progress int
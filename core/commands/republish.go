@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	republisher "github.com/ipfs/go-ipfs/namesys/republisher"
+
+	"gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit"
+)
+
+type republishStatus struct {
+	Keys []republisher.KeyStatus
+}
+
+var nameRepublishCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Republish IPNS records now.",
+		ShortDescription: `
+The daemon republishes the records of all its keys every Ipns.RepublishPeriod,
+so they don't expire. 'ipfs name republish' does it right away, for the key
+given by --key or for all keys.
+
+Keys listed in Ipns.RepublishExclude are left out of automatic republishing,
+and out of 'ipfs name republish' without --key. They are still republished
+when named with --key.
+`,
+	},
+
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("key", "k", "Name of the key to republish, as listed by 'ipfs key list'. Default: all keys that aren't excluded."),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": nameRepublishStatusCmd,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		if n.IpnsRepub == nil {
+			res.SetError(errNotOnline, cmdkit.ErrClient)
+			return
+		}
+
+		kname, found, _ := req.Option("key").String()
+		if found {
+			err = n.IpnsRepub.RepublishKey(req.Context(), kname)
+		} else {
+			err = n.IpnsRepub.Republish(req.Context())
+		}
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		keys, err := n.IpnsRepub.Status()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		// only report on what was republished
+		out := &republishStatus{}
+		for _, k := range keys {
+			if found && k.Name != kname {
+				continue
+			}
+			if !found && (k.Excluded || !k.Published) {
+				continue
+			}
+			out.Keys = append(out.Keys, k)
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: republishStatusMarshaler,
+	},
+	Type: republishStatus{},
+}
+
+var nameRepublishStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show how republishing IPNS records is going.",
+		ShortDescription: `
+'ipfs name republish status' lists the keys of the node, with the sequence
+number and expiry of their current record, when a new record was last
+published with 'ipfs name publish', when the daemon last republished it, and
+the error it got the last time republishing failed. Keys excluded from
+automatic republishing are marked as such.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		if n.IpnsRepub == nil {
+			res.SetError(errNotOnline, cmdkit.ErrClient)
+			return
+		}
+
+		keys, err := n.IpnsRepub.Status()
+		if err != nil {
+			res.SetError(err, cmdkit.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&republishStatus{keys})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: republishStatusMarshaler,
+	},
+	Type: republishStatus{},
+}
+
+func republishStatusMarshaler(res cmds.Response) (io.Reader, error) {
+	v, err := unwrapOutput(res.Output())
+	if err != nil {
+		return nil, err
+	}
+
+	out, ok := v.(*republishStatus)
+	if !ok {
+		return nil, e.TypeErr(out, v)
+	}
+
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+	fmt.Fprintln(w, "Name\tID\tSequence\tExpires\tPublished\tRepublished\tStatus")
+	for _, k := range out.Keys {
+		seq, eol := "-", "-"
+		if k.Published {
+			seq = fmt.Sprint(k.Sequence)
+			eol = k.EOL.Format(time.RFC3339)
+		}
+
+		published, last := "never", "never"
+		if !k.LastPublish.IsZero() {
+			published = k.LastPublish.Format(time.RFC3339)
+		}
+		if !k.LastRepublish.IsZero() {
+			last = k.LastRepublish.Format(time.RFC3339)
+		}
+
+		var status []string
+		if k.Excluded {
+			status = append(status, "excluded")
+		}
+		if !k.Published {
+			status = append(status, "not published")
+		}
+		if k.LastError != "" {
+			status = append(status, "failed: "+k.LastError)
+		}
+		if len(status) == 0 {
+			status = append(status, "ok")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.Name, k.ID, seq, eol, published, last, strings.Join(status, ", "))
+	}
+	w.Flush()
+
+	return buf, nil
+}
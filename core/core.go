@@ -18,16 +18,20 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	exchange "github.com/ipfs/go-ipfs/exchange"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
 	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+	bstrace "github.com/ipfs/go-ipfs/exchange/bitswap/trace"
 	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	mfs "github.com/ipfs/go-ipfs/mfs"
 	namesys "github.com/ipfs/go-ipfs/namesys"
@@ -37,6 +41,8 @@ import (
 	pin "github.com/ipfs/go-ipfs/pin"
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
+	compose "github.com/ipfs/go-ipfs/routing/compose"
+	delegated "github.com/ipfs/go-ipfs/routing/delegated"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 
 	addrutil "gx/ipfs/QmNSWW3Sb4eju4o2djPQ1L1c2Zj9XN9sMYJL8r1cbxdc6b/go-addr-util"
@@ -81,6 +87,7 @@ const IpnsValidatorTag = "ipns"
 
 const kReprovideFrequency = time.Hour * 12
 const discoveryConnTimeout = time.Second * 30
+const kPersistedWantsMaxAge = time.Hour * 24
 
 var log = logging.Logger("core")
 
@@ -137,6 +144,9 @@ type IpfsNode struct {
 	Floodsub *floodsub.PubSub
 	P2P      *p2p.P2P
 
+	// bitswapTrace records bitswap messages if Bitswap.TraceFile is set
+	bitswapTrace io.Closer
+
 	proc goprocess.Process
 	ctx  context.Context
 
@@ -452,9 +462,31 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	n.PeerHost = rhost.Wrap(host, n.Routing)
 
 	// setup exchange service
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	bsopts, err := bitswapOptions(cfg.Bitswap, n.Repo.Datastore())
+	if err != nil {
+		return err
+	}
+	if tracePath := cfg.Bitswap.TraceFile; tracePath != "" {
+		// relative paths are relative to the repo root, like other files
+		// named in the config
+		if r, ok := n.Repo.(interface{ Path() string }); ok && !filepath.IsAbs(tracePath) {
+			tracePath = filepath.Join(r.Path(), tracePath)
+		}
+		f, err := os.OpenFile(tracePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("opening bitswap trace file: %s", err)
+		}
+		tw := bstrace.NewWriter(f)
+		n.bitswapTrace = tw
+		bsopts = append(bsopts, bitswap.WithTracer(tw))
+	}
 	const alwaysSendToPeer = true // use YesManStrategy
 	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
-	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer)
+	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer, bsopts...)
 
 	size, err := n.getCacheSize()
 	if err != nil {
@@ -462,12 +494,85 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	}
 
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	n.Namesys, err = n.NewNameSystem(size)
+	if err != nil {
+		return err
+	}
 
 	// setup ipns republishing
 	return n.setupIpnsRepublisher()
 }
 
+// bitswapOptions translates the Bitswap config section into bitswap options
+func bitswapOptions(cfg config.Bitswap, d ds.Datastore) ([]bitswap.Option, error) {
+	var strategy decision.Strategy
+	switch cfg.Strategy {
+	case "", "round-robin":
+		strategy = decision.RoundRobin
+	case "debt-ratio":
+		if cfg.MaxDebtRatio < 0 {
+			return nil, fmt.Errorf("config setting Bitswap.MaxDebtRatio cannot be negative")
+		}
+		strategy = decision.DebtRatioStrategy(cfg.MaxDebtRatio, cfg.DebtGraceBytes)
+	case "priority-peers":
+		peers := make([]peer.ID, 0, len(cfg.PriorityPeers))
+		for _, s := range cfg.PriorityPeers {
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID in config setting Bitswap.PriorityPeers: %s", s)
+			}
+			peers = append(peers, p)
+		}
+		strategy = decision.PriorityPeersStrategy(peers)
+	default:
+		return nil, fmt.Errorf("unknown bitswap strategy %q", cfg.Strategy)
+	}
+
+	if cfg.SendRateLimit < 0 || cfg.PeerSendRateLimit < 0 {
+		return nil, fmt.Errorf("config settings Bitswap.SendRateLimit and Bitswap.PeerSendRateLimit cannot be negative")
+	}
+
+	opts := []bitswap.Option{
+		bitswap.WithStrategy(strategy),
+		bitswap.WithSendRateLimits(cfg.SendRateLimit, cfg.PeerSendRateLimit),
+	}
+
+	if cfg.Private {
+		allowed := make([]peer.ID, 0, len(cfg.AllowedPeers))
+		for _, s := range cfg.AllowedPeers {
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID in config setting Bitswap.AllowedPeers: %s", s)
+			}
+			allowed = append(allowed, p)
+		}
+		opts = append(opts, bitswap.WithPrivateMode(allowed, cfg.AllowedPeerTag))
+	}
+
+	if cfg.PersistWants {
+		maxAge, err := PersistedWantsMaxAge(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, bitswap.WithPersistentWants(d, maxAge))
+	}
+
+	return opts, nil
+}
+
+// PersistedWantsMaxAge returns how long the wants and pins interrupted by a
+// restart are resumed for, 0 meaning forever.
+func PersistedWantsMaxAge(cfg config.Bitswap) (time.Duration, error) {
+	if cfg.PersistedWantsMaxAge == "" {
+		return kPersistedWantsMaxAge, nil
+	}
+	maxAge, err := time.ParseDuration(cfg.PersistedWantsMaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("failure to parse config setting Bitswap.PersistedWantsMaxAge: %s", err)
+	}
+	return maxAge, nil
+}
+
 // getCacheSize returns cache life and cache size
 func (n *IpfsNode) getCacheSize() (int, error) {
 	cfg, err := n.Repo.Config()
@@ -515,6 +620,13 @@ func (n *IpfsNode) setupIpnsRepublisher() error {
 		n.IpnsRepub.RecordLifetime = d
 	}
 
+	if len(cfg.Ipns.RepublishExclude) > 0 {
+		n.IpnsRepub.Exclude = make(map[string]bool)
+		for _, name := range cfg.Ipns.RepublishExclude {
+			n.IpnsRepub.Exclude[name] = true
+		}
+	}
+
 	n.Process().Go(n.IpnsRepub.Run)
 
 	return nil
@@ -558,6 +670,10 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.Exchange)
 	}
 
+	if n.bitswapTrace != nil {
+		closers = append(closers, n.bitswapTrace)
+	}
+
 	if n.Mounts.Ipfs != nil && !n.Mounts.Ipfs.IsActive() {
 		closers = append(closers, mount.Closer(n.Mounts.Ipfs))
 	}
@@ -708,7 +824,13 @@ func (n *IpfsNode) LoadPrivateKey() error {
 		return err
 	}
 
-	sk, err := loadPrivateKey(&cfg.Identity, n.Identity)
+	var sk ic.PrivKey
+	if cfg.Identity.PrivKey == "" {
+		// the key has been moved into an encrypted keystore
+		sk, err = loadKeystoreIdentity(n.Repo.Keystore(), n.Identity)
+	} else {
+		sk, err = loadPrivateKey(&cfg.Identity, n.Identity)
+	}
 	if err != nil {
 		return err
 	}
@@ -798,9 +920,40 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 		return err
 	}
 
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	n.Namesys, err = n.NewNameSystem(size)
+	return err
+}
 
-	return nil
+// NewNameSystem returns a name system using the node's routing, which looks
+// up DNS records with the resolvers of the DNS config. Up to cachesize IPNS
+// names and DNS domains are cached.
+func (n *IpfsNode) NewNameSystem(cachesize int) (namesys.NameSystem, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	dnscfg := namesys.DNSResolverConfig{
+		Resolvers: cfg.DNS.Resolvers,
+		CacheSize: cachesize,
+	}
+	if cfg.DNS.MaxCacheTTL != "" {
+		dnscfg.MaxCacheTTL, err = time.ParseDuration(cfg.DNS.MaxCacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failure to parse config setting DNS.MaxCacheTTL: %s", err)
+		}
+	}
+
+	dns, err := namesys.NewDNSResolverWithConfig(n.Context(), dnscfg)
+	if err != nil {
+		return nil, fmt.Errorf("config setting DNS.Resolvers is invalid: %s", err)
+	}
+
+	ns := namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), cachesize)
+	if err := namesys.SetDNSResolver(ns, dns); err != nil {
+		return nil, err
+	}
+	return ns, nil
 }
 
 func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
@@ -821,6 +974,33 @@ func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
 	return sk, nil
 }
 
+func loadKeystoreIdentity(ks keystore.Keystore, id peer.ID) (ic.PrivKey, error) {
+	is, ok := ks.(keystore.IdentityStore)
+	if !ok {
+		return nil, errors.New("private key not found in config")
+	}
+
+	sk, err := is.Identity()
+	switch err {
+	case nil:
+	case keystore.ErrNoSuchKey:
+		return nil, errors.New("private key not found in config or keystore")
+	default:
+		return nil, err
+	}
+
+	id2, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	if id2 != id {
+		return nil, fmt.Errorf("private key in keystore does not match id: %s != %s", id, id2)
+	}
+
+	return sk, nil
+}
+
 func listenAddresses(cfg *config.Config) ([]ma.Multiaddr, error) {
 	var listen []ma.Multiaddr
 	for _, addr := range cfg.Addresses.Swarm {
@@ -968,3 +1148,57 @@ type DiscoveryOption func(context.Context, p2phost.Host) (discovery.Service, err
 var DHTOption RoutingOption = constructDHTRouting
 var DHTClientOption RoutingOption = constructClientDHTRouting
 var NilRouterOption RoutingOption = nilrouting.ConstructNilRouting
+
+// DelegatedRoutingOption returns a RoutingOption delegating lookups to the
+// HTTP endpoint configured in c, along with a DHT client if c.Compose says so.
+func DelegatedRoutingOption(c config.DelegatedRouting) (RoutingOption, error) {
+	if c.Endpoint == "" {
+		return nil, errors.New("delegated routing needs Routing.Delegated.Endpoint to be set")
+	}
+
+	var timeout time.Duration
+	if c.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Routing.Delegated.Timeout: %s", err)
+		}
+	}
+
+	switch c.Compose {
+	case "", "parallel", "fallback":
+	default:
+		return nil, fmt.Errorf("unknown Routing.Delegated.Compose %q: it must be empty, \"parallel\" or \"fallback\"", c.Compose)
+	}
+
+	return func(ctx context.Context, host p2phost.Host, dstore ds.Batching) (routing.IpfsRouting, error) {
+		client, err := delegated.NewClient(c.Endpoint, host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if c.Compose == "" {
+			return client, nil
+		}
+
+		dhtRouting, err := constructClientDHTRouting(ctx, host, dstore)
+		if err != nil {
+			return nil, err
+		}
+		if c.Compose == "parallel" {
+			return compose.Parallel{
+				Routers:  []routing.IpfsRouting{dhtRouting, client},
+				Selector: selectRoutingValue,
+			}, nil
+		}
+		return compose.Fallback{client, dhtRouting}, nil
+	}, nil
+}
+
+// selectRoutingValue picks the newest of the IPNS records found by several
+// routers. Other values are the same wherever they are found.
+func selectRoutingValue(key string, vals [][]byte) (int, error) {
+	if strings.HasPrefix(key, "/"+IpnsValidatorTag+"/") {
+		return namesys.IpnsSelectorFunc(key, vals)
+	}
+	return 0, nil
+}
@@ -26,7 +26,7 @@ func NewCoreAPI(n *core.IpfsNode) coreiface.CoreAPI {
 
 // Unixfs returns the UnixfsAPI interface backed by the go-ipfs node
 func (api *CoreAPI) Unixfs() coreiface.UnixfsAPI {
-	return (*UnixfsAPI)(api)
+	return &UnixfsAPI{api, nil}
 }
 
 func (api *CoreAPI) Block() coreiface.BlockAPI {
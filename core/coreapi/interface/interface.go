@@ -45,6 +45,32 @@ type IpnsEntry interface {
 	Value() Path
 }
 
+// IpnsRecord describes a signed IPNS record
+type IpnsRecord struct {
+	Value    string
+	Sequence uint64
+	EOL      time.Time
+	TTL      time.Duration
+
+	// Name is the name the record was verified against, if any, in which
+	// case SignatureValid tells whether it was signed with Name's key
+	Name           string
+	SignatureValid bool
+
+	// Expired is set once EOL has passed
+	Expired bool
+}
+
+// IpnsHistoryEntry is a record the node published for one of its names
+type IpnsHistoryEntry struct {
+	Value    string
+	Sequence uint64
+	EOL      time.Time
+
+	// Published is when the node published the record
+	Published time.Time
+}
+
 // Key specifies the interface to Keys in KeyAPI Keystore
 type Key interface {
 	// Key returns key name
@@ -120,7 +146,16 @@ type UnixfsAPI interface {
 	Add(context.Context, io.Reader) (Path, error)
 
 	// Cat returns a reader for the file
-	Cat(context.Context, Path) (Reader, error)
+	Cat(context.Context, Path, ...options.UnixfsCatOption) (Reader, error)
+
+	// WithPriority is an option for Cat which sets the bitswap priority class
+	// of the blocks fetched while reading the file
+	//
+	// Supported values:
+	// * "background"
+	// * "normal"
+	// * "interactive" (default)
+	WithPriority(string) options.UnixfsCatOption
 
 	// Ls returns the list of links in a directory
 	Ls(context.Context, Path) ([]*Link, error)
@@ -227,6 +262,36 @@ type NameAPI interface {
 	// WithCache is an option for Resolve which specifies if cache should be used.
 	// Default value is true
 	WithCache(cache bool) options.NameResolveOption
+
+	// CreateRecord signs a record pointing a name at path, without touching
+	// the network, and returns it serialized. The record can be published
+	// later with Import, on this node or another one. WithKey and
+	// WithValidTime apply as for Publish. The sequence number must be higher
+	// than that of the name's current record for the new one to replace it.
+	CreateRecord(ctx context.Context, path Path, seq uint64, opts ...options.NamePublishOption) ([]byte, error)
+
+	// Import publishes a record created elsewhere, for instance by
+	// CreateRecord on an offline machine, after checking that it was signed
+	// with name's key and hasn't expired
+	Import(ctx context.Context, name string, record []byte) (IpnsEntry, error)
+
+	// Inspect decodes a serialized record
+	Inspect(ctx context.Context, record []byte, opts ...options.NameInspectOption) (*IpnsRecord, error)
+
+	// WithVerify is an option for Inspect which checks the record's signature
+	// against the key of the given name
+	WithVerify(name string) options.NameInspectOption
+
+	// History lists the last records the node published for the name of key,
+	// newest first. The key parameter must be either PeerID or keystore key
+	// alias.
+	History(ctx context.Context, key string) ([]*IpnsHistoryEntry, error)
+
+	// Rollback publishes again the value of the record with sequence number
+	// seq from the history of a name, in a new record with a higher sequence
+	// number. A seq of 0 picks the last value that differs from the current
+	// one. WithKey and WithValidTime apply as for Publish.
+	Rollback(ctx context.Context, seq uint64, opts ...options.NamePublishOption) (IpnsEntry, error)
 }
 
 // KeyAPI specifies the interface to Keystore
@@ -263,6 +328,28 @@ type KeyAPI interface {
 
 	// Remove removes keys from keystore. Returns ipns path of the removed key
 	Remove(ctx context.Context, name string) (Path, error)
+
+	// Export returns the private key with the given name, encoded in the
+	// libp2p protobuf format by default
+	Export(ctx context.Context, name string, opts ...options.KeyEncodingOption) ([]byte, error)
+
+	// Import stores an encoded private key in the keystore under the given
+	// name
+	Import(ctx context.Context, name string, data []byte, opts ...options.KeyEncodingOption) (Key, error)
+
+	// WithFormat is an option for Export and Import which specifies the
+	// encoding of the key. Export defaults to keystore.FormatLibp2p, Import
+	// guesses it from the key
+	//
+	// Supported formats:
+	// * keystore.FormatLibp2p
+	// * keystore.FormatPEM
+	WithFormat(format string) options.KeyEncodingOption
+
+	// WithPassword is an option for Export and Import which encrypts, or
+	// decrypts, the key with the given password. Only keystore.FormatPEM
+	// keys can be encrypted
+	WithPassword(password string) options.KeyEncodingOption
 }
 
 // ObjectAPI specifies the interface to MerkleDAG and contains useful utilities
@@ -360,6 +447,11 @@ type PinAPI interface {
 	// object tree or just one object. Default: true
 	WithRecursive(bool) options.PinAddOption
 
+	// WithPriority is an option for Add which sets the bitswap priority class
+	// of the blocks fetched to pin the object. Supported values are
+	// "background" (default), "normal" and "interactive"
+	WithPriority(string) options.PinAddOption
+
 	// Ls returns list of pinned objects on this node
 	Ls(context.Context, ...options.PinLsOption) ([]Pin, error)
 
@@ -16,8 +16,14 @@ type KeyRenameSettings struct {
 	Force bool
 }
 
+type KeyEncodingSettings struct {
+	Format   string
+	Password string
+}
+
 type KeyGenerateOption func(*KeyGenerateSettings) error
 type KeyRenameOption func(*KeyRenameSettings) error
+type KeyEncodingOption func(*KeyEncodingSettings) error
 
 func KeyGenerateOptions(opts ...KeyGenerateOption) (*KeyGenerateSettings, error) {
 	options := &KeyGenerateSettings{
@@ -48,6 +54,21 @@ func KeyRenameOptions(opts ...KeyRenameOption) (*KeyRenameSettings, error) {
 	return options, nil
 }
 
+func KeyEncodingOptions(opts ...KeyEncodingOption) (*KeyEncodingSettings, error) {
+	options := &KeyEncodingSettings{
+		Format:   "",
+		Password: "",
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
 type KeyOptions struct{}
 
 func (api *KeyOptions) WithType(algorithm string) KeyGenerateOption {
@@ -70,3 +91,17 @@ func (api *KeyOptions) WithForce(force bool) KeyRenameOption {
 		return nil
 	}
 }
+
+func (api *KeyOptions) WithFormat(format string) KeyEncodingOption {
+	return func(settings *KeyEncodingSettings) error {
+		settings.Format = format
+		return nil
+	}
+}
+
+func (api *KeyOptions) WithPassword(password string) KeyEncodingOption {
+	return func(settings *KeyEncodingSettings) error {
+		settings.Password = password
+		return nil
+	}
+}
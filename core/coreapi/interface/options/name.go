@@ -19,8 +19,13 @@ type NameResolveSettings struct {
 	Cache     bool
 }
 
+type NameInspectSettings struct {
+	Verify string
+}
+
 type NamePublishOption func(*NamePublishSettings) error
 type NameResolveOption func(*NameResolveSettings) error
+type NameInspectOption func(*NameInspectSettings) error
 
 func NamePublishOptions(opts ...NamePublishOption) (*NamePublishSettings, error) {
 	options := &NamePublishSettings{
@@ -55,6 +60,19 @@ func NameResolveOptions(opts ...NameResolveOption) (*NameResolveSettings, error)
 	return options, nil
 }
 
+func NameInspectOptions(opts ...NameInspectOption) (*NameInspectSettings, error) {
+	options := &NameInspectSettings{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
 type NameOptions struct{}
 
 func (api *NameOptions) WithValidTime(validTime time.Duration) NamePublishOption {
@@ -91,3 +109,10 @@ func (api *NameOptions) WithCache(cache bool) NameResolveOption {
 		return nil
 	}
 }
+
+func (api *NameOptions) WithVerify(name string) NameInspectOption {
+	return func(settings *NameInspectSettings) error {
+		settings.Verify = name
+		return nil
+	}
+}
@@ -2,6 +2,7 @@ package options
 
 type PinAddSettings struct {
 	Recursive bool
+	Priority  string
 }
 
 type PinLsSettings struct {
@@ -19,6 +20,7 @@ type PinUpdateOption func(*PinUpdateSettings) error
 func PinAddOptions(opts ...PinAddOption) (*PinAddSettings, error) {
 	options := &PinAddSettings{
 		Recursive: true,
+		Priority:  "background",
 	}
 
 	for _, opt := range opts {
@@ -70,6 +72,13 @@ func (api *PinOptions) WithRecursive(recucsive bool) PinAddOption {
 	}
 }
 
+func (api *PinOptions) WithPriority(priority string) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.Priority = priority
+		return nil
+	}
+}
+
 func (api *PinOptions) WithType(t string) PinLsOption {
 	return func(settings *PinLsSettings) error {
 		settings.Type = t
@@ -0,0 +1,31 @@
+package options
+
+type UnixfsCatSettings struct {
+	Priority string
+}
+
+type UnixfsCatOption func(*UnixfsCatSettings) error
+
+func UnixfsCatOptions(opts ...UnixfsCatOption) (*UnixfsCatSettings, error) {
+	options := &UnixfsCatSettings{
+		Priority: "interactive",
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+type UnixfsOptions struct{}
+
+func (api *UnixfsOptions) WithPriority(priority string) UnixfsCatOption {
+	return func(settings *UnixfsCatSettings) error {
+		settings.Priority = priority
+		return nil
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	ipfspath "github.com/ipfs/go-ipfs/path"
 
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
@@ -204,6 +205,68 @@ func (api *KeyAPI) Remove(ctx context.Context, name string) (coreiface.Path, err
 	return (&key{"", pid.Pretty()}).Path(), nil
 }
 
+// Export returns the private key with the given name, encoded in the
+// requested format.
+func (api *KeyAPI) Export(ctx context.Context, name string, opts ...caopts.KeyEncodingOption) ([]byte, error) {
+	options, err := caopts.KeyEncodingOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	format := options.Format
+	if format == "" {
+		format = keystore.FormatLibp2p
+	}
+
+	var sk crypto.PrivKey
+	if name == "self" {
+		sk = api.node.PrivateKey
+	} else {
+		sk, err = api.node.Repo.Keystore().Get(name)
+		if err == keystore.ErrNoSuchKey {
+			return nil, fmt.Errorf("no key named %s was found", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keystore.EncodeKey(sk, format, []byte(options.Password))
+}
+
+// Import decodes a private key and stores it in the keystore under the
+// given name.
+func (api *KeyAPI) Import(ctx context.Context, name string, data []byte, opts ...caopts.KeyEncodingOption) (coreiface.Key, error) {
+	options, err := caopts.KeyEncodingOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "self" {
+		return nil, fmt.Errorf("cannot overwrite key with name 'self'")
+	}
+
+	sk, err := keystore.DecodeKey(data, options.Format, []byte(options.Password))
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.node.Repo.Keystore().Put(name, sk)
+	if err == keystore.ErrKeyExists {
+		return nil, fmt.Errorf("key with name '%s' already exists", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &key{name, pid.Pretty()}, nil
+}
+
 func (api *KeyAPI) core() coreiface.CoreAPI {
 	return api.CoreAPI
 }
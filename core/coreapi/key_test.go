@@ -414,3 +414,60 @@ func TestRemove(t *testing.T) {
 		t.Errorf("expected the key to be called 'self', got '%s'", l[0].Name())
 	}
 }
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := api.Key().Generate(ctx, "foo", api.Key().WithType(opts.Ed25519Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"libp2p-protobuf", "pem-pkcs8"} {
+		data, err := api.Key().Export(ctx, "foo", api.Key().WithFormat(format))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := api.Key().Import(ctx, "bar-"+format, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if imported.Path().String() != k.Path().String() {
+			t.Errorf("imported %s key should have path '%s', got '%s'", format, k.Path().String(), imported.Path().String())
+		}
+	}
+
+	data, err := api.Key().Export(ctx, "foo", api.Key().WithFormat("pem-pkcs8"), api.Key().WithPassword("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.Key().Import(ctx, "baz", data, api.Key().WithPassword("hunter3"))
+	if err == nil {
+		t.Fatal("expected import with the wrong password to fail")
+	}
+
+	imported, err := api.Key().Import(ctx, "baz", data, api.Key().WithPassword("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Path().String() != k.Path().String() {
+		t.Errorf("expected path '%s', got '%s'", k.Path().String(), imported.Path().String())
+	}
+
+	_, err = api.Key().Import(ctx, "baz", data, api.Key().WithPassword("hunter2"))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+
+	_, err = api.Key().Import(ctx, "self", data, api.Key().WithPassword("hunter2"))
+	if err == nil {
+		t.Fatal("expected importing over self to fail")
+	}
+}
@@ -12,8 +12,11 @@ import (
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	keystore "github.com/ipfs/go-ipfs/keystore"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
 	ipath "github.com/ipfs/go-ipfs/path"
 
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 	offline "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/offline"
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 	crypto "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
@@ -114,7 +117,10 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 	}
 
 	if !options.Cache {
-		resolver = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), 0)
+		resolver, err = n.NewNameSystem(0)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	depth := 1
@@ -134,6 +140,224 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 	return &path{path: output}, nil
 }
 
+// CreateRecord signs a record pointing a name at p without publishing it.
+func (api *NameAPI) CreateRecord(ctx context.Context, p coreiface.Path, seq uint64, opts ...caopts.NamePublishOption) ([]byte, error) {
+	options, err := caopts.NamePublishOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pth, err := ipath.ParsePath(p.String())
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := keylookup(api.node, options.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := namesys.CreateRoutingEntryData(k, pth, seq, time.Now().Add(options.ValidTime))
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(entry)
+}
+
+// Import publishes a record signed elsewhere under name.
+func (api *NameAPI) Import(ctx context.Context, name string, record []byte) (coreiface.IpnsEntry, error) {
+	n := api.node
+
+	if !n.OnlineMode() {
+		err := n.SetupOfflineRouting()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if n.Mounts.Ipns != nil && n.Mounts.Ipns.IsActive() {
+		return nil, errors.New("cannot manually publish while IPNS is mounted")
+	}
+
+	entry, err := unmarshalRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := parseIpnsName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := api.publicKey(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := ipath.ParsePath(string(entry.GetValue()))
+	if err != nil {
+		return nil, err
+	}
+
+	err = namesys.PublishSignedEntry(ctx, n.Routing, n.Repo.Datastore(), pid, pk, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ipnsEntry{
+		name:  pid.Pretty(),
+		value: &path{path: value},
+	}, nil
+}
+
+// Inspect decodes a record, and checks its signature if asked to.
+func (api *NameAPI) Inspect(ctx context.Context, record []byte, opts ...caopts.NameInspectOption) (*coreiface.IpnsRecord, error) {
+	options, err := caopts.NameInspectOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := unmarshalRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	eol, err := namesys.EntryEOL(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &coreiface.IpnsRecord{
+		Value:    string(entry.GetValue()),
+		Sequence: entry.GetSequence(),
+		EOL:      eol,
+		TTL:      time.Duration(entry.GetTtl()),
+		Expired:  time.Now().After(eol),
+	}
+
+	if options.Verify != "" {
+		pid, err := parseIpnsName(options.Verify)
+		if err != nil {
+			return nil, err
+		}
+
+		pk, err := api.publicKey(ctx, pid)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Name = pid.Pretty()
+		out.SignatureValid = namesys.VerifyEntrySignature(pk, entry) == nil
+	}
+
+	return out, nil
+}
+
+// History lists the records published for the name of key, newest first.
+func (api *NameAPI) History(ctx context.Context, key string) ([]*coreiface.IpnsHistoryEntry, error) {
+	k, err := keylookup(api.node, key)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := peer.IDFromPrivateKey(k)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := namesys.History(api.node.Repo.Datastore(), pid)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*coreiface.IpnsHistoryEntry, len(history))
+	for i, e := range history {
+		out[i] = &coreiface.IpnsHistoryEntry{
+			Value:     e.Value.String(),
+			Sequence:  e.Sequence,
+			EOL:       e.EOL,
+			Published: e.Published,
+		}
+	}
+	return out, nil
+}
+
+// Rollback publishes a value from the history of a name again.
+func (api *NameAPI) Rollback(ctx context.Context, seq uint64, opts ...caopts.NamePublishOption) (coreiface.IpnsEntry, error) {
+	options, err := caopts.NamePublishOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := api.History(ctx, options.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("no record was published for %s", options.Key)
+	}
+
+	var target *coreiface.IpnsHistoryEntry
+	for _, e := range history {
+		if seq == 0 && e.Value != history[0].Value || seq != 0 && e.Sequence == seq {
+			target = e
+			break
+		}
+	}
+	if target == nil {
+		if seq == 0 {
+			return nil, errors.New("no earlier value to roll back to in the history")
+		}
+		return nil, fmt.Errorf("no record with sequence number %d in the history", seq)
+	}
+
+	p, err := ParsePath(target.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.Publish(ctx, p, opts...)
+}
+
+// publicKey finds the public key of an IPNS name in the name itself, our
+// keys, the peerstore or, failing that, routing.
+func (api *NameAPI) publicKey(ctx context.Context, pid peer.ID) (crypto.PubKey, error) {
+	if pk := pid.ExtractPublicKey(); pk != nil {
+		return pk, nil
+	}
+
+	if sk, err := keylookup(api.node, pid.Pretty()); err == nil {
+		return sk.GetPublic(), nil
+	}
+
+	if pk := api.node.Peerstore.PubKey(pid); pk != nil {
+		return pk, nil
+	}
+
+	if api.node.Routing == nil {
+		return nil, fmt.Errorf("public key of %s not found", pid.Pretty())
+	}
+
+	return routing.GetPublicKey(api.node.Routing, ctx, []byte(pid))
+}
+
+func parseIpnsName(name string) (peer.ID, error) {
+	pid, err := peer.IDB58Decode(strings.TrimPrefix(name, "/ipns/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid IPNS name %q: %s", name, err)
+	}
+	return pid, nil
+}
+
+func unmarshalRecord(record []byte) (*pb.IpnsEntry, error) {
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(record, entry); err != nil {
+		return nil, namesys.ErrBadRecord
+	}
+	return entry, nil
+}
+
 func (api *NameAPI) core() coreiface.CoreAPI {
 	return api.CoreAPI
 }
@@ -142,3 +142,65 @@ func TestBasicPublishResolveTimeout(t *testing.T) {
 }
 
 //TODO: When swarm api is created, add multinode tests
+
+func TestPublishHistoryRollback(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPIIdent(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []coreiface.Path
+	for i := 0; i < 2; i++ {
+		p, err := addTestObject(ctx, api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.Name().Publish(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	history, err := api.Name().History(ctx, "self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 records in the history, got %d", len(history))
+	}
+	if history[0].Value != paths[1].String() || history[1].Value != paths[0].String() {
+		t.Fatal("expected the history to list the newest record first")
+	}
+	if history[0].Sequence <= history[1].Sequence {
+		t.Fatal("expected sequence numbers to increase")
+	}
+
+	e, err := api.Name().Rollback(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value().String() != paths[0].String() {
+		t.Errorf("expected rollback to '%s', got '%s'", paths[0].String(), e.Value().String())
+	}
+
+	history, err = api.Name().History(ctx, "self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Value != paths[0].String() || history[0].Sequence <= history[1].Sequence {
+		t.Fatal("expected the rollback to be published with a higher sequence number")
+	}
+
+	resPath, err := api.Name().Resolve(ctx, e.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resPath.String() != paths[0].String() {
+		t.Errorf("expected paths to match, '%s'!='%s'", resPath.String(), paths[0].String())
+	}
+
+	if _, err := api.Name().Rollback(ctx, 42); err == nil {
+		t.Error("expected rolling back to an unknown sequence number to fail")
+	}
+}
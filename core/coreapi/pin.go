@@ -8,6 +8,7 @@ import (
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	pin "github.com/ipfs/go-ipfs/pin"
@@ -27,6 +28,12 @@ func (api *PinAPI) Add(ctx context.Context, p coreiface.Path, opts ...caopts.Pin
 		return err
 	}
 
+	pc, err := bitswap.ParsePriorityClass(settings.Priority)
+	if err != nil {
+		return err
+	}
+	ctx = bitswap.ContextWithPriority(ctx, pc)
+
 	defer api.node.Blockstore.PinLock().Unlock()
 
 	_, err = corerepo.Pin(api.node, ctx, []string{p.String()}, settings.Recursive)
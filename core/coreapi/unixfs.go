@@ -5,14 +5,19 @@ import (
 	"io"
 
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 
 	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
 	ipld "gx/ipfs/Qme5bWv7wtjUNGsK2BNGVUFPKiuxWrsqrtvYwCLRw8YFES/go-ipld-format"
 )
 
-type UnixfsAPI CoreAPI
+type UnixfsAPI struct {
+	*CoreAPI
+	*caopts.UnixfsOptions
+}
 
 // Add builds a merkledag node from a reader, adds it to the blockstore,
 // and returns the key representing that node.
@@ -29,7 +34,18 @@ func (api *UnixfsAPI) Add(ctx context.Context, r io.Reader) (coreiface.Path, err
 }
 
 // Cat returns the data contained by an IPFS or IPNS object(s) at path `p`.
-func (api *UnixfsAPI) Cat(ctx context.Context, p coreiface.Path) (coreiface.Reader, error) {
+func (api *UnixfsAPI) Cat(ctx context.Context, p coreiface.Path, opts ...caopts.UnixfsCatOption) (coreiface.Reader, error) {
+	settings, err := caopts.UnixfsCatOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := bitswap.ParsePriorityClass(settings.Priority)
+	if err != nil {
+		return nil, err
+	}
+	ctx = bitswap.ContextWithPriority(ctx, pc)
+
 	dget := api.node.DAG // TODO: use a session here once routing perf issues are resolved
 
 	dagnode, err := resolveNode(ctx, dget, api.node.Namesys, p)
@@ -77,5 +93,5 @@ func (api *UnixfsAPI) Ls(ctx context.Context, p coreiface.Path) ([]*coreiface.Li
 }
 
 func (api *UnixfsAPI) core() coreiface.CoreAPI {
-	return (*CoreAPI)(api)
+	return api.CoreAPI
 }
@@ -116,6 +116,36 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestCatWithPriority(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.Unixfs().Add(ctx, strings.NewReader(helloStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := api.Unixfs().Cat(ctx, hello, api.Unixfs().WithPriority("background"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(helloStr))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != helloStr {
+		t.Fatalf("expected [%s], got [%s]", helloStr, string(buf))
+	}
+
+	_, err = api.Unixfs().Cat(ctx, hello, api.Unixfs().WithPriority("urgent"))
+	if err == nil {
+		t.Fatal("expected an error for an unknown priority class")
+	}
+}
+
 func TestAddEmptyFile(t *testing.T) {
 	ctx := context.Background()
 	_, api, err := makeAPI(ctx)
@@ -1,8 +1,11 @@
 package corehttp
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -17,6 +20,8 @@ import (
 
 	cmds "gx/ipfs/QmabLouZTZwhfALuBcssPvkzhbYGMb4394huT7HY4LQ6d3/go-ipfs-cmds"
 	cmdsHttp "gx/ipfs/QmabLouZTZwhfALuBcssPvkzhbYGMb4394huT7HY4LQ6d3/go-ipfs-cmds/http"
+	cmdkit "gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit"
+	files "gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit/files"
 )
 
 var (
@@ -40,6 +45,12 @@ or
 // APIPath is the path at which the API is mounted.
 const APIPath = "/api/v0"
 
+// WebSocketPath is the path under which commands can be run over a
+// WebSocket, e.g. /api/v0/ws/pubsub/sub?arg=topic. Every value the command
+// emits is sent as a separate message. Commands taking a file, like add, read
+// the binary messages sent by the client, see websocketHandler.
+const WebSocketPath = APIPath + "/ws"
+
 var defaultLocalhostOrigins = []string{
 	"http://127.0.0.1:<port>",
 	"https://127.0.0.1:<port>",
@@ -134,6 +145,7 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
 
 		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
 		mux.Handle(APIPath+"/", cmdHandler)
+		mux.Handle(WebSocketPath+"/", &websocketHandler{env: &cctx, root: command, cfg: cfg})
 		return mux, nil
 	}
 }
@@ -178,3 +190,171 @@ func CheckVersionOption() ServeOption {
 		return mux, nil
 	})
 }
+
+// websocketHandler runs commands for clients connected over a WebSocket.
+// Emitted values are sent as JSON encoded text messages, except for streams of
+// bytes which are sent as binary messages. The connection is closed with
+// status 1000 once the command is done. If the command fails, the error is
+// sent as a JSON encoded cmdkit.Error and the connection is closed with
+// status 1011. Closing the connection cancels the command.
+//
+// Commands with a file argument get a single file, named by the filename
+// query parameter, whose content is the binary messages the client sends. An
+// empty binary message ends the file.
+type websocketHandler struct {
+	env  cmds.Environment
+	root *cmds.Command
+	cfg  *cmdsHttp.ServerConfig
+}
+
+func (h *websocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers don't apply the same-origin policy to WebSockets, so without
+	// this check any website could run commands on the node.
+	if !h.originAllowed(r.Header.Get("Origin")) {
+		http.Error(w, "403 - Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	pth := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, WebSocketPath), "/"), "/")
+	query := r.URL.Query()
+	opts := make(cmdkit.OptMap, len(query))
+	for k, v := range query {
+		if k != "arg" && k != "filename" && len(v) > 0 {
+			opts[k] = v[0]
+		}
+	}
+
+	req, err := cmds.NewRequest(ctx, pth, opts, query["arg"], nil, h.root)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Command.NoRemote {
+		http.Error(w, "command not available over the API", http.StatusNotFound)
+		return
+	}
+
+	var file *io.PipeWriter
+	if hasFileArg(req.Command) {
+		var pr *io.PipeReader
+		pr, file = io.Pipe()
+		// unblocks the read loop if the command returns without reading
+		// the whole file
+		defer pr.Close()
+
+		name := query.Get("filename")
+		req.Files = files.NewSliceFile("", "", []files.File{
+			files.NewReaderFile(name, name, pr, nil),
+		})
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Debugf("websocket upgrade failed: %s", err)
+		return
+	}
+
+	go func() {
+		conn.readLoop(file)
+		cancel()
+	}()
+
+	re := &wsResponseEmitter{conn: conn, cancel: cancel}
+	h.root.Call(req, re, h.env)
+	re.Close()
+}
+
+// hasFileArg returns true if cmd takes a file argument.
+func hasFileArg(cmd *cmds.Command) bool {
+	for _, arg := range cmd.Arguments {
+		if arg.Type == cmdkit.ArgFile {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *websocketHandler) originAllowed(origin string) bool {
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	for _, o := range h.cfg.AllowedOrigins() {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// wsResponseEmitter implements cmds.ResponseEmitter on top of a WebSocket.
+type wsResponseEmitter struct {
+	conn   *wsConn
+	cancel context.CancelFunc
+}
+
+func (re *wsResponseEmitter) SetLength(_ uint64) {}
+
+func (re *wsResponseEmitter) SetError(err interface{}, code cmdkit.ErrorType) {
+	e := cmdkit.Error{Message: fmt.Sprint(err), Code: code}
+	if b, err := json.Marshal(e); err == nil {
+		re.conn.WriteMessage(wsOpText, b)
+	}
+	re.conn.Close(wsCloseInternalError, e.Message)
+}
+
+func (re *wsResponseEmitter) Close() error {
+	return re.conn.Close(wsCloseNormal, "")
+}
+
+func (re *wsResponseEmitter) Emit(v interface{}) error {
+	err := re.emit(v)
+	if err != nil {
+		// the client is gone, stop the command
+		re.cancel()
+	}
+	return err
+}
+
+func (re *wsResponseEmitter) emit(v interface{}) error {
+	switch v := v.(type) {
+	case io.Reader:
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := v.Read(buf)
+			if n > 0 {
+				if werr := re.conn.WriteMessage(wsOpBinary, buf[:n]); werr != nil {
+					return werr
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case chan interface{}:
+		return re.emitChan(v)
+	case <-chan interface{}:
+		return re.emitChan(v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return re.conn.WriteMessage(wsOpText, b)
+}
+
+func (re *wsResponseEmitter) emitChan(ch <-chan interface{}) error {
+	for v := range ch {
+		if err := re.emit(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -182,6 +182,7 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		webError(w, "ipfs resolve -r "+escapedURLPath, err, http.StatusNotFound)
 		return
 	}
+	recordRequestPath(r, requestNamespace(urlPath), resolvedPath.Root())
 
 	dr, err := i.api.Unixfs().Cat(ctx, resolvedPath)
 	dir := false
@@ -388,6 +389,13 @@ func (s *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	// prefer the MIME type the file was added with over guessing it
+	if mr, ok := content.(uio.MetadataReader); ok {
+		if mt := mr.Metadata().MimeType; mt != "" {
+			w.Header().Set("Content-Type", mt)
+		}
+	}
+
 	if sp, ok := content.(sizeReadSeeker); ok {
 		content = &sizeSeeker{
 			sizeReadSeeker: sp,
@@ -0,0 +1,190 @@
+package corehttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+// GatewayMetricsOption records the time to first byte and the total duration
+// of every request in Prometheus histograms, labelled by namespace and status
+// code. If accessLog is not nil, one JSON object describing each request is
+// written to it per line.
+func GatewayMetricsOption(accessLog io.Writer) ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		var enc *json.Encoder
+		var mu sync.Mutex
+		if accessLog != nil {
+			enc = json.NewEncoder(accessLog)
+		}
+
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			st := &requestStats{
+				start:     time.Now(),
+				namespace: requestNamespace(r.URL.Path),
+			}
+			sw := &statsResponseWriter{ResponseWriter: w, stats: st}
+
+			childMux.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestStatsKey{}, st)))
+
+			duration := time.Since(st.start)
+			status := st.status
+			if status == 0 {
+				// nothing was written, net/http will reply with 200
+				status = http.StatusOK
+				st.firstByte = duration
+			}
+			code := strconv.Itoa(status)
+
+			gatewayFirstByteSeconds.WithLabelValues(st.namespace, code).Observe(st.firstByte.Seconds())
+			gatewayDurationSeconds.WithLabelValues(st.namespace, code).Observe(duration.Seconds())
+
+			if enc == nil {
+				return
+			}
+
+			entry := accessLogEntry{
+				Time:      st.start.UTC(),
+				Remote:    r.RemoteAddr,
+				Method:    r.Method,
+				Host:      r.Host,
+				Path:      r.URL.RequestURI(),
+				Namespace: st.namespace,
+				Status:    status,
+				Bytes:     st.bytes,
+				FirstByte: st.firstByte.Seconds(),
+				Duration:  duration.Seconds(),
+				UserAgent: r.UserAgent(),
+				Referer:   r.Referer(),
+			}
+			if st.root != nil {
+				entry.Root = st.root.String()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err := enc.Encode(&entry); err != nil {
+				log.Errorf("writing gateway access log: %s", err)
+			}
+		})
+		return childMux, nil
+	}
+}
+
+// accessLogEntry is a single line of the gateway access log.
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Namespace string    `json:"namespace"`
+	Root      string    `json:"root,omitempty"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	FirstByte float64   `json:"ttfb"`
+	Duration  float64   `json:"duration"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+}
+
+type requestStatsKey struct{}
+
+// requestStats is filled in while a request is being served.
+type requestStats struct {
+	start     time.Time
+	firstByte time.Duration
+	status    int
+	bytes     int64
+	namespace string
+	root      *cid.Cid
+}
+
+// recordRequestPath notes the namespace and the resolved root of the content
+// served for r, if r is being measured by GatewayMetricsOption.
+func recordRequestPath(r *http.Request, namespace string, root *cid.Cid) {
+	st, ok := r.Context().Value(requestStatsKey{}).(*requestStats)
+	if !ok {
+		return
+	}
+	st.namespace = namespace
+	st.root = root
+}
+
+// requestNamespace returns the label used for requests on urlPath.
+func requestNamespace(urlPath string) string {
+	switch {
+	case strings.HasPrefix(urlPath, ipfsPathPrefix):
+		return "ipfs"
+	case strings.HasPrefix(urlPath, ipnsPathPrefix):
+		return "ipns"
+	default:
+		return "other"
+	}
+}
+
+type statsResponseWriter struct {
+	http.ResponseWriter
+	stats *requestStats
+}
+
+func (w *statsResponseWriter) WriteHeader(status int) {
+	if w.stats.status == 0 {
+		w.stats.status = status
+		w.stats.firstByte = time.Since(w.stats.start)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statsResponseWriter) Write(b []byte) (int, error) {
+	if w.stats.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.stats.bytes += int64(n)
+	return n, err
+}
+
+// Hijack implements http.Hijacker, which the WebSocket upgrade relies on. The
+// request is recorded as switching protocols, as nothing is written through
+// the ResponseWriter afterwards.
+func (w *statsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && w.stats.status == 0 {
+		w.stats.status = http.StatusSwitchingProtocols
+		w.stats.firstByte = time.Since(w.stats.start)
+	}
+	return conn, rw, err
+}
+
+func (w *statsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify implements http.CloseNotifier, which the gateway handler uses to
+// cancel requests whose client went away.
+func (w *statsResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
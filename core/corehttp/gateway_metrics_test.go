@@ -0,0 +1,148 @@
+package corehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+func TestGatewayAccessLog(t *testing.T) {
+	c := cid.NewCidV0(u.Hash([]byte("root")))
+
+	var buf bytes.Buffer
+	root := http.NewServeMux()
+	mux, err := GatewayMetricsOption(&buf)(nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/ipns/", func(w http.ResponseWriter, r *http.Request) {
+		recordRequestPath(r, "ipns", c)
+		w.Write([]byte("hello"))
+	})
+
+	for _, uri := range []string{"/ipns/example.com/a?b=c", "/missing"} {
+		r := httptest.NewRequest("GET", uri, nil)
+		r.RemoteAddr = "1.2.3.4:5678"
+		root.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	dec := json.NewDecoder(&buf)
+	var found accessLogEntry
+	if err := dec.Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Path != "/ipns/example.com/a?b=c" || found.Namespace != "ipns" || found.Root != c.String() {
+		t.Fatalf("unexpected entry: %#v", found)
+	}
+	if found.Status != http.StatusOK || found.Bytes != 5 || found.Remote != "1.2.3.4:5678" {
+		t.Fatalf("unexpected entry: %#v", found)
+	}
+	if found.FirstByte > found.Duration {
+		t.Fatalf("time to first byte (%f) exceeds duration (%f)", found.FirstByte, found.Duration)
+	}
+
+	var missing accessLogEntry
+	if err := dec.Decode(&missing); err != nil {
+		t.Fatal(err)
+	}
+	if missing.Status != http.StatusNotFound || missing.Namespace != "other" || missing.Root != "" {
+		t.Fatalf("unexpected entry: %#v", missing)
+	}
+}
+
+// scrapeMetric returns the value of the sample called name in the Prometheus
+// text exposition, or "" if it is missing.
+func scrapeMetric(t *testing.T, name string) string {
+	root := http.NewServeMux()
+	if _, err := MetricsScrapingOption("/metrics")(nil, nil, root); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	root.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" ")
+		}
+	}
+	return ""
+}
+
+func TestGatewayLatencyHistograms(t *testing.T) {
+	root := http.NewServeMux()
+	mux, err := GatewayMetricsOption(nil)(nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/ipns/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	for i := 0; i < 3; i++ {
+		root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ipns/example.com", nil))
+	}
+
+	labels := `{code="418",namespace="ipns"}`
+	if v := scrapeMetric(t, "ipfs_http_gw_first_byte_seconds_count"+labels); v != "3" {
+		t.Fatalf("expected 3 first byte observations, got %q", v)
+	}
+	if v := scrapeMetric(t, "ipfs_http_gw_duration_seconds_count"+labels); v != "3" {
+		t.Fatalf("expected 3 duration observations, got %q", v)
+	}
+}
+
+func TestGatewayMetricsHijack(t *testing.T) {
+	root := http.NewServeMux()
+	mux, err := GatewayMetricsOption(nil)(nil, nil, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/ipfs/", func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("the metrics ResponseWriter should implement http.Hijacker")
+			http.Error(w, "no hijacking", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the metrics ResponseWriter should implement http.Flusher")
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
+
+	ts := httptest.NewServer(root)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/ipfs/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hijacked" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	labels := `{code="101",namespace="ipfs"}`
+	if v := scrapeMetric(t, "ipfs_http_gw_duration_seconds_count"+labels); v != "1" {
+		t.Fatalf("expected the hijacked request to be observed once, got %q", v)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	ds2 "github.com/ipfs/go-ipfs/thirdparty/datastore2"
+	ft "github.com/ipfs/go-ipfs/unixfs"
 
 	id "gx/ipfs/QmNh1kGFFdsPu79KNSaL4NUKUPb4Eiz4KHdMtFY6664RDp/go-libp2p/p2p/protocol/identify"
 	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
@@ -177,6 +178,41 @@ func TestGatewayGet(t *testing.T) {
 	}
 }
 
+func TestGatewayMetadataMimeType(t *testing.T) {
+	ts, n := newTestServerAndNode(t, mockNamesys{})
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mk, err := coreunix.AddMetadataTo(n, k, &ft.Metadata{MimeType: "application/x-fnord"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, ct := range map[string]string{
+		"/ipfs/" + k:  "text/plain; charset=utf-8",
+		"/ipfs/" + mk: "application/x-fnord",
+	} {
+		res, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "fnord" {
+			t.Fatalf("unexpected body for %s: %q", p, body)
+		}
+		if got := res.Header.Get("Content-Type"); got != ct {
+			t.Fatalf("expected Content-Type %q for %s, got %q", ct, p, got)
+		}
+	}
+}
+
 func TestIPNSHostnameRedirect(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -30,8 +30,51 @@ var (
 	peersTotalMetric = prometheus.NewDesc(
 		prometheus.BuildFQName("ipfs", "p2p", "peers_total"),
 		"Number of connected peers", []string{"transport"}, nil)
+
+	gatewayRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gw_rejected_total",
+		Help:      "Number of gateway requests rejected by the rate limiter",
+	}, []string{"reason"})
+
+	gatewayInFlightFetches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gw_inflight_fetches",
+		Help:      "Number of /ipfs and /ipns gateway requests being served",
+	})
+
+	gatewayFirstByteSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gw_first_byte_seconds",
+		Help:      "Time until the first byte of a gateway response was written",
+		Buckets:   gatewayLatencyBuckets,
+	}, []string{"namespace", "code"})
+
+	gatewayDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "http",
+		Name:      "gw_duration_seconds",
+		Help:      "Time until a gateway response was complete",
+		Buckets:   gatewayLatencyBuckets,
+	}, []string{"namespace", "code"})
 )
 
+// gatewayLatencyBuckets span from 5ms to about 80s, as fetching content from
+// the network can be very slow.
+var gatewayLatencyBuckets = prometheus.ExponentialBuckets(0.005, 2, 15)
+
+func init() {
+	prometheus.MustRegister(
+		gatewayRejectedTotal,
+		gatewayInFlightFetches,
+		gatewayFirstByteSeconds,
+		gatewayDurationSeconds,
+	)
+}
+
 type IpfsNodeCollector struct {
 	Node *core.IpfsNode
 }
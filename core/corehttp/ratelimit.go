@@ -0,0 +1,152 @@
+package corehttp
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// clientSweepInterval is how often idle client entries are dropped from the
+// rate limiter.
+const clientSweepInterval = time.Minute
+
+// RateLimitOption limits the request rate and concurrency of every client, as
+// well as the total number of /ipfs and /ipns requests in flight. Requests
+// over a limit are rejected with 429 Too Many Requests.
+func RateLimitOption(cfg config.GatewayRateLimit) ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		childMux := http.NewServeMux()
+		mux.Handle("/", newRateLimiter(cfg, childMux))
+		return childMux, nil
+	}
+}
+
+type clientLimit struct {
+	tokens float64
+	last   time.Time
+	active int
+}
+
+type rateLimiter struct {
+	cfg  config.GatewayRateLimit
+	next http.Handler
+	now  func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimit
+	fetches   int
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg config.GatewayRateLimit, next http.Handler) *rateLimiter {
+	return &rateLimiter{
+		cfg:     cfg,
+		next:    next,
+		now:     time.Now,
+		clients: make(map[string]*clientLimit),
+	}
+}
+
+func (rl *rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	fetch := strings.HasPrefix(r.URL.Path, ipfsPathPrefix) ||
+		strings.HasPrefix(r.URL.Path, ipnsPathPrefix)
+
+	if reason, retry := rl.acquire(ip, fetch); reason != "" {
+		gatewayRejectedTotal.WithLabelValues(reason).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	defer rl.release(ip, fetch)
+
+	rl.next.ServeHTTP(w, r)
+}
+
+// acquire accounts for a new request from ip. If the request must be
+// rejected, it returns the name of the exceeded limit and the number of
+// seconds after which the client should retry.
+func (rl *rateLimiter) acquire(ip string, fetch bool) (string, int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.lastSweep) > clientSweepInterval {
+		rl.sweep(now)
+	}
+
+	c, ok := rl.clients[ip]
+	if !ok {
+		c = &clientLimit{tokens: rl.burst(), last: now}
+		rl.clients[ip] = c
+	}
+
+	if rl.cfg.MaxConcurrentPerClient > 0 && c.active >= rl.cfg.MaxConcurrentPerClient {
+		return "client_concurrency", 1
+	}
+	if fetch && rl.cfg.MaxInFlightFetches > 0 && rl.fetches >= rl.cfg.MaxInFlightFetches {
+		return "inflight_fetches", 1
+	}
+
+	if rate := rl.cfg.RequestsPerSecond; rate > 0 {
+		c.tokens = math.Min(rl.burst(), c.tokens+now.Sub(c.last).Seconds()*rate)
+		c.last = now
+		if c.tokens < 1 {
+			return "client_rate", int(math.Ceil((1 - c.tokens) / rate))
+		}
+		c.tokens--
+	}
+
+	c.active++
+	if fetch {
+		rl.fetches++
+		gatewayInFlightFetches.Inc()
+	}
+	return "", 0
+}
+
+func (rl *rateLimiter) release(ip string, fetch bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if c, ok := rl.clients[ip]; ok {
+		c.active--
+	}
+	if fetch {
+		rl.fetches--
+		gatewayInFlightFetches.Dec()
+	}
+}
+
+// burst returns the size of a client's token bucket.
+func (rl *rateLimiter) burst() float64 {
+	if rl.cfg.Burst > 0 {
+		return float64(rl.cfg.Burst)
+	}
+	return 1
+}
+
+// sweep forgets clients that have no requests in flight and whose bucket has
+// refilled, as they are indistinguishable from new clients.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for ip, c := range rl.clients {
+		if c.active > 0 {
+			continue
+		}
+		if rate := rl.cfg.RequestsPerSecond; rate > 0 && c.tokens+now.Sub(c.last).Seconds()*rate < rl.burst() {
+			continue
+		}
+		delete(rl.clients, ip)
+	}
+	rl.lastSweep = now
+}
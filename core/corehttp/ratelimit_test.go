@@ -0,0 +1,95 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+func doLimited(h http.Handler, remote, uri string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", uri, nil)
+	r.RemoteAddr = remote
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitRequestRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rl := newRateLimiter(config.GatewayRateLimit{
+		RequestsPerSecond: 0.5,
+		Burst:             2,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if w := doLimited(rl, "1.2.3.4:1000", "/ipfs/foo"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	w := doLimited(rl, "1.2.3.4:1001", "/ipfs/foo")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "2" {
+		t.Fatalf("expected Retry-After of 2, got %q", ra)
+	}
+
+	// other clients have their own bucket
+	if w := doLimited(rl, "5.6.7.8:1000", "/ipfs/foo"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for another client, got %d", w.Code)
+	}
+
+	now = now.Add(2 * time.Second)
+	if w := doLimited(rl, "1.2.3.4:1000", "/ipfs/foo"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after refill, got %d", w.Code)
+	}
+}
+
+func TestRateLimitConcurrency(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+	rl := newRateLimiter(config.GatewayRateLimit{
+		MaxConcurrentPerClient: 1,
+		MaxInFlightFetches:     2,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-block
+	}))
+
+	done := make(chan int)
+	for _, remote := range []string{"1.1.1.1:1", "2.2.2.2:1"} {
+		go func(remote string) {
+			done <- doLimited(rl, remote, "/ipns/foo").Code
+		}(remote)
+		<-started
+	}
+
+	if w := doLimited(rl, "1.1.1.1:2", "/version"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected per client limit to apply, got %d", w.Code)
+	}
+	if w := doLimited(rl, "3.3.3.3:1", "/ipfs/foo"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected global fetch limit to apply, got %d", w.Code)
+	}
+
+	// non fetch requests are not subject to the global limit
+	go func() {
+		done <- doLimited(rl, "3.3.3.3:1", "/version").Code
+	}()
+	<-started
+
+	close(block)
+	for i := 0; i < 3; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+	}
+
+	if rl.fetches != 0 {
+		t.Fatalf("expected no fetches in flight, got %d", rl.fetches)
+	}
+}
@@ -0,0 +1,83 @@
+package corehttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// TLSConfig builds a server side TLS configuration from a PEM encoded
+// certificate and key. If clientCAFile is non-empty, clients are required to
+// present a certificate signed by one of the CAs it contains.
+func TLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS key pair: %s", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA file")
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// ServeTLS is like Serve, but terminates TLS on every connection accepted
+// from lis using the given configuration.
+func ServeTLS(node *core.IpfsNode, lis net.Listener, cfg *tls.Config, options ...ServeOption) error {
+	return Serve(node, tls.NewListener(lis, cfg), options...)
+}
+
+// ClientTLSConfig builds a client side TLS configuration that trusts the PEM
+// encoded certificates in caFile, in addition to the system roots. It lets
+// the command line client talk to an API served with a self-signed
+// certificate. If certFile and keyFile are set, the client presents that
+// certificate to servers that require one.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS certificate: %s", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in TLS certificate file")
+	}
+
+	cfg := &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client TLS certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
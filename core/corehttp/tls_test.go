@@ -0,0 +1,224 @@
+package corehttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate valid for 127.0.0.1 and its
+// key into dir, returning their paths.
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certPath, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func serveTLSForTest(t *testing.T, cfg *tls.Config) (string, net.Listener) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(tls.NewListener(lis, cfg), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	return "https://" + lis.Addr().String() + "/", lis
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corehttp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey := writeTestCert(t, dir, "server")
+	clientCert, clientKey := writeTestCert(t, dir, "client")
+
+	if _, err := TLSConfig(filepath.Join(dir, "missing.crt"), serverKey, ""); err == nil {
+		t.Fatal("expected an error for a missing certificate")
+	}
+	if _, err := TLSConfig(serverCert, serverKey, serverKey); err == nil {
+		t.Fatal("expected an error for a client CA file without certificates")
+	}
+
+	cfg, err := TLSConfig(serverCert, serverKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.NoClientCert {
+		t.Fatal("client certificates should not be required without a client CA")
+	}
+
+	serverPem, err := ioutil.ReadFile(serverCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverPem)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+	url, lis := serveTLSForTest(t, cfg)
+	defer lis.Close()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// now require a client certificate
+	cfg, err = TLSConfig(serverCert, serverKey, clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Fatal("expected client certificates to be required")
+	}
+	url, lis = serveTLSForTest(t, cfg)
+	defer lis.Close()
+
+	if res, err := client.Get(url); err == nil {
+		res.Body.Close()
+		t.Fatal("request without a client certificate should fail")
+	}
+
+	if _, err := ClientTLSConfig(serverCert, clientCert, ""); err == nil {
+		t.Fatal("expected an error for a client certificate without a key")
+	}
+	clientCfg, err := ClientTLSConfig(serverCert, clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+	res, err = client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+func TestServeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corehttp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey := writeTestCert(t, dir, "server")
+	cfg, err := TLSConfig(serverCert, serverKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeTLS(n, lis, cfg, VersionOption())
+	}()
+
+	clientCfg, err := ClientTLSConfig(serverCert, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+	res, err := client.Get("https://" + lis.Addr().String() + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "Client Version:") {
+		t.Fatalf("unexpected response over TLS: %d %q", res.StatusCode, body)
+	}
+	if res.TLS == nil {
+		t.Fatal("response was not received over TLS")
+	}
+
+	// plain HTTP must not be served on the TLS listener
+	plain := &http.Client{Timeout: 5 * time.Second}
+	if res, err := plain.Get("http://" + lis.Addr().String() + "/version"); err == nil {
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			t.Fatal("plain HTTP request was served by the TLS listener")
+		}
+	}
+
+	// the default roots don't trust the self-signed certificate
+	if res, err := http.Get("https://" + lis.Addr().String() + "/version"); err == nil {
+		res.Body.Close()
+		t.Fatal("expected the self-signed certificate to be rejected")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeTLS did not return after the node was closed")
+	}
+}
@@ -0,0 +1,269 @@
+package corehttp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// This file implements the subset of the WebSocket protocol (RFC 6455)
+// needed to stream command output to clients: the server side of the
+// handshake, unfragmented outgoing messages and enough of the incoming frame
+// parsing to answer pings, notice when the client goes away and receive the
+// file a command reads.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// WebSocket close status codes.
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseInternalError = 1011
+)
+
+// wsMaxControlPayload is the largest payload allowed in a control frame.
+const wsMaxControlPayload = 125
+
+// wsMaxIncomingPayload bounds the size of frames accepted from clients.
+// Files are expected to be sent in chunks no larger than this.
+const wsMaxIncomingPayload = 1 << 16
+
+var errWSClosed = errors.New("websocket connection closed")
+
+// isWebSocketUpgrade returns true if r asks to be upgraded to a WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn is a server side WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wlk    sync.Mutex
+	closed bool
+}
+
+// upgradeWebSocket performs the server side of the opening handshake and
+// takes over the underlying connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != "GET" {
+		http.Error(w, "websocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method not GET")
+	}
+	if !isWebSocketUpgrade(r) {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not implement http.Hijacker")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	brw.WriteString("Upgrade: websocket\r\n")
+	brw.WriteString("Connection: Upgrade\r\n")
+	brw.WriteString("Sec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// WriteMessage sends payload as a single, unfragmented frame.
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+
+	if c.closed {
+		return errWSClosed
+	}
+	return c.writeFrame(opcode, payload)
+}
+
+// Close sends a close frame with the given status and reason and closes the
+// connection.
+func (c *wsConn) Close(status int, reason string) error {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if len(reason) > wsMaxControlPayload-2 {
+		reason = reason[:wsMaxControlPayload-2]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(status))
+	payload = append(payload, reason...)
+
+	c.writeFrame(wsOpClose, payload)
+	return c.conn.Close()
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = hdr[:4]
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = hdr[:10]
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+
+	if _, err := c.conn.Write(hdr); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// readFrame reads a single frame sent by the client and returns its opcode
+// and unmasked payload.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := hdr[0] & 0x0f
+	if hdr[1]&0x80 == 0 {
+		return 0, nil, errors.New("websocket: client frame is not masked")
+	}
+
+	var length uint64
+	switch l := hdr[1] & 0x7f; l {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	default:
+		length = uint64(l)
+	}
+	if length > wsMaxIncomingPayload {
+		return 0, nil, errors.New("websocket: frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// readLoop consumes frames sent by the client, answering pings, until the
+// client closes the connection or an error occurs. If file is set, the
+// payloads of binary messages are written to it until an empty binary
+// message marks the end of the file. Other data frames are ignored.
+func (c *wsConn) readLoop(file *io.PipeWriter) error {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			c.Close(wsCloseProtocolError, "")
+			if file != nil {
+				file.CloseWithError(err)
+			}
+			return err
+		}
+
+		switch opcode {
+		case wsOpBinary, wsOpContinuation:
+			if file == nil {
+				break
+			}
+			if opcode == wsOpBinary && len(payload) == 0 {
+				file.Close()
+				file = nil
+				break
+			}
+			if _, err := file.Write(payload); err != nil {
+				// the command is done with the file
+				file = nil
+			}
+		case wsOpPing:
+			if len(payload) <= wsMaxControlPayload {
+				c.WriteMessage(wsOpPong, payload)
+			}
+		case wsOpClose:
+			c.Close(wsCloseNormal, "")
+			if file != nil {
+				file.CloseWithError(errWSClosed)
+			}
+			return errWSClosed
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package corehttp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cmds "gx/ipfs/QmabLouZTZwhfALuBcssPvkzhbYGMb4394huT7HY4LQ6d3/go-ipfs-cmds"
+	cmdsHttp "gx/ipfs/QmabLouZTZwhfALuBcssPvkzhbYGMb4394huT7HY4LQ6d3/go-ipfs-cmds/http"
+	cmdkit "gx/ipfs/QmceUdzxkimdYsgtX733uNgzf1DLHyBKN6ehGSp85ayppM/go-ipfs-cmdkit"
+)
+
+// dialWebSocket performs a client handshake for path against srv and returns
+// the raw connection.
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", res.StatusCode)
+	}
+	// example from RFC 6455, section 1.3
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept header: %q", accept)
+	}
+	return conn, br
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	if hdr[1]&0x80 != 0 {
+		t.Fatal("server frames must not be masked")
+	}
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+func writeClientFrame(conn net.Conn, opcode byte, payload []byte) error {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	return err
+}
+
+func TestWebSocket(t *testing.T) {
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgradeWebSocket(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+		c.WriteMessage(wsOpText, []byte("hello"))
+		c.WriteMessage(wsOpBinary, make([]byte, 70000))
+		done <- c.readLoop(nil)
+	}))
+	defer srv.Close()
+
+	conn, br := dialWebSocket(t, srv, "/ws")
+	defer conn.Close()
+
+	if op, payload := readServerFrame(t, br); op != wsOpText || string(payload) != "hello" {
+		t.Fatalf("unexpected frame %d %q", op, payload)
+	}
+	if op, payload := readServerFrame(t, br); op != wsOpBinary || len(payload) != 70000 {
+		t.Fatalf("unexpected frame %d of length %d", op, len(payload))
+	}
+
+	if err := writeClientFrame(conn, wsOpPing, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if op, payload := readServerFrame(t, br); op != wsOpPong || string(payload) != "ping" {
+		t.Fatalf("expected pong, got %d %q", op, payload)
+	}
+
+	if err := writeClientFrame(conn, wsOpClose, []byte{0x03, 0xe8}); err != nil {
+		t.Fatal(err)
+	}
+	op, payload := readServerFrame(t, br)
+	if op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Fatalf("expected normal close, got %d %v", op, payload)
+	}
+	if err := <-done; err != errWSClosed {
+		t.Fatalf("expected read loop to end with errWSClosed, got %v", err)
+	}
+}
+
+func TestWebSocketRejectsPlainRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgradeWebSocket(w, r)
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.StatusCode)
+	}
+}
+
+// newWebSocketTestServer serves root over WebSocketPath, allowing requests
+// from http://localhost:5001 only.
+func newWebSocketTestServer(root *cmds.Command) *httptest.Server {
+	cfg := cmdsHttp.NewServerConfig()
+	cfg.SetAllowedOrigins("http://localhost:5001")
+
+	mux := http.NewServeMux()
+	mux.Handle(WebSocketPath+"/", &websocketHandler{root: root, cfg: cfg})
+	return httptest.NewServer(mux)
+}
+
+func TestWebSocketHandlerRunsCommand(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.StringArg("text", true, false, "Text to echo."),
+				},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+					re.Emit(req.Arguments[0])
+				},
+			},
+			"fail": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+					re.SetError(errors.New("it broke"), cmdkit.ErrNormal)
+				},
+			},
+		},
+	}
+	srv := newWebSocketTestServer(root)
+	defer srv.Close()
+
+	conn, br := dialWebSocket(t, srv, WebSocketPath+"/echo?arg=hello")
+	defer conn.Close()
+
+	if op, payload := readServerFrame(t, br); op != wsOpText || string(payload) != `"hello"` {
+		t.Fatalf("unexpected frame %d %q", op, payload)
+	}
+	op, payload := readServerFrame(t, br)
+	if op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Fatalf("expected normal close, got %d %v", op, payload)
+	}
+
+	conn, br = dialWebSocket(t, srv, WebSocketPath+"/fail")
+	defer conn.Close()
+
+	op, payload = readServerFrame(t, br)
+	var e cmdkit.Error
+	if op != wsOpText || json.Unmarshal(payload, &e) != nil || e.Message != "it broke" {
+		t.Fatalf("expected error message, got %d %q", op, payload)
+	}
+	op, payload = readServerFrame(t, br)
+	if op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseInternalError {
+		t.Fatalf("expected internal error close, got %d %v", op, payload)
+	}
+}
+
+func TestWebSocketHandlerChecksOrigin(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"echo": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+					t.Error("command ran for a disallowed origin")
+				},
+			},
+		},
+	}
+	srv := newWebSocketTestServer(root)
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+WebSocketPath+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://evil.example.com")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", res.StatusCode)
+	}
+}
+
+func TestWebSocketHandlerCancelsOnClose(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"wait": {
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+					close(started)
+					<-req.Context.Done()
+					close(cancelled)
+				},
+			},
+		},
+	}
+	srv := newWebSocketTestServer(root)
+	defer srv.Close()
+
+	conn, _ := dialWebSocket(t, srv, WebSocketPath+"/wait")
+	<-started
+	conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command wasn't cancelled when the connection closed")
+	}
+}
+
+func TestWebSocketHandlerReadsFile(t *testing.T) {
+	root := &cmds.Command{
+		Subcommands: map[string]*cmds.Command{
+			"cat": {
+				Arguments: []cmdkit.Argument{
+					cmdkit.FileArg("data", true, false, "The file to read."),
+				},
+				Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) {
+					f, err := req.Files.NextFile()
+					if err != nil {
+						re.SetError(err, cmdkit.ErrNormal)
+						return
+					}
+					data, err := ioutil.ReadAll(f)
+					if err != nil {
+						re.SetError(err, cmdkit.ErrNormal)
+						return
+					}
+					re.Emit(f.FileName() + ": " + string(data))
+				},
+			},
+		},
+	}
+	srv := newWebSocketTestServer(root)
+	defer srv.Close()
+
+	conn, br := dialWebSocket(t, srv, WebSocketPath+"/cat?filename=a.txt")
+	defer conn.Close()
+
+	for _, chunk := range []string{"hello ", "world", ""} {
+		if err := writeClientFrame(conn, wsOpBinary, []byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if op, payload := readServerFrame(t, br); op != wsOpText || string(payload) != `"a.txt: hello world"` {
+		t.Fatalf("unexpected frame %d %q", op, payload)
+	}
+	op, payload := readServerFrame(t, br)
+	if op != wsOpClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Fatalf("expected normal close, got %d %v", op, payload)
+	}
+}
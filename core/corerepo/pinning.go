@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/ipfs/go-ipfs/core"
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	path "github.com/ipfs/go-ipfs/path"
 	resolver "github.com/ipfs/go-ipfs/path/resolver"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
@@ -25,8 +26,29 @@ import (
 	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
 )
 
-func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool) ([]*cid.Cid, error) {
-	out := make([]*cid.Cid, len(paths))
+func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool) (out []*cid.Cid, err error) {
+	// pins can take a long time to fetch, let them carry on after a restart
+	ctx, forget := bitswap.ContextWithPersistentWants(ctx)
+	resumable := pinsAreResumable(n)
+
+	var pending []*cid.Cid
+	defer func() {
+		if err != nil && n.Context().Err() != nil {
+			// the node is shutting down, the pins resume once it restarts
+			return
+		}
+		if err != nil {
+			// don't refetch the blocks of a failed or cancelled pin
+			forget()
+		}
+		for _, c := range pending {
+			if err := removePendingPin(n, c); err != nil {
+				log.Errorf("error removing pending pin: %s", err)
+			}
+		}
+	}()
+
+	out = make([]*cid.Cid, len(paths))
 
 	r := &resolver.Resolver{
 		DAG:         n.DAG,
@@ -43,6 +65,13 @@ func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool)
 		if err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
 		}
+		if resumable {
+			if err := recordPendingPin(n, dagnode.Cid(), recursive); err != nil {
+				log.Errorf("error recording pending pin: %s", err)
+			} else {
+				pending = append(pending, dagnode.Cid())
+			}
+		}
 		err = n.Pinning.Pin(ctx, dagnode, recursive)
 		if err != nil {
 			return nil, fmt.Errorf("pin: %s", err)
@@ -50,7 +79,7 @@ func Pin(n *core.IpfsNode, ctx context.Context, paths []string, recursive bool)
 		out[i] = dagnode.Cid()
 	}
 
-	err := n.Pinning.Flush()
+	err = n.Pinning.Flush()
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,112 @@
+package corerepo
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	dsns "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/namespace"
+	dsq "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/query"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
+)
+
+// pendingPinsPrefix is where the roots of pins still being fetched are kept
+// in the datastore, so that they can be resumed after a restart.
+var pendingPinsPrefix = ds.NewKey("/local/pins/pending")
+
+type pendingPin struct {
+	Recursive bool
+	Added     time.Time
+}
+
+// pinsAreResumable returns true if the node is configured to resume the pins
+// interrupted by a restart.
+func pinsAreResumable(n *core.IpfsNode) bool {
+	cfg, err := n.Repo.Config()
+	return err == nil && cfg.Bitswap.PersistWants
+}
+
+func pendingPins(n *core.IpfsNode) ds.Datastore {
+	return dsns.Wrap(n.Repo.Datastore(), pendingPinsPrefix)
+}
+
+// recordPendingPin records a pin of c, unless it is already, in which case it
+// keeps its original time.
+func recordPendingPin(n *core.IpfsNode, c *cid.Cid, recursive bool) error {
+	d := pendingPins(n)
+	k := dshelp.CidToDsKey(c)
+	if has, err := d.Has(k); err != nil || has {
+		return err
+	}
+	b, err := json.Marshal(&pendingPin{Recursive: recursive, Added: time.Now()})
+	if err != nil {
+		return err
+	}
+	return d.Put(k, b)
+}
+
+func removePendingPin(n *core.IpfsNode, c *cid.Cid) error {
+	err := pendingPins(n).Delete(dshelp.CidToDsKey(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// ResumePins pins again the objects whose pinning was interrupted by the node
+// shutting down, fetching what is still missing of them. Pins recorded longer
+// than maxAge ago are dropped instead, unless maxAge is 0.
+func ResumePins(n *core.IpfsNode, maxAge time.Duration) error {
+	d := pendingPins(n)
+	res, err := d.Query(dsq.Query{})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		c, err := dshelp.DsKeyToCid(k)
+		if err != nil {
+			log.Errorf("decoding pending pin %s: %s", e.Key, err)
+			continue
+		}
+		var pp pendingPin
+		data, _ := e.Value.([]byte)
+		if err := json.Unmarshal(data, &pp); err != nil {
+			log.Errorf("decoding pending pin %s: %s", c, err)
+			continue
+		}
+
+		if maxAge > 0 && time.Since(pp.Added) >= maxAge {
+			log.Infof("giving up on pending pin of %s", c)
+			if err := d.Delete(k); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Infof("resuming pin of %s", c)
+		if err := resumePin(n, c, pp.Recursive); err != nil {
+			if n.Context().Err() != nil {
+				return nil
+			}
+			log.Errorf("resuming pin of %s: %s", c, err)
+		}
+	}
+	return nil
+}
+
+func resumePin(n *core.IpfsNode, c *cid.Cid, recursive bool) error {
+	defer n.Blockstore.PinLock().Unlock()
+	if _, err := Pin(n, n.Context(), []string{"/ipfs/" + c.String()}, recursive); err != nil {
+		return err
+	}
+	return removePendingPin(n, c)
+}
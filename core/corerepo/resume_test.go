@@ -0,0 +1,53 @@
+package corerepo
+
+import (
+	"testing"
+	"time"
+
+	coremock "github.com/ipfs/go-ipfs/core/mock"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+
+	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
+)
+
+func TestResumePins(t *testing.T) {
+	n, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*dag.ProtoNode{child, root} {
+		if err := n.DAG.Add(n.Context(), nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := dag.NodeWithData([]byte("stale"))
+
+	// a pin interrupted by a restart, and one recorded too long ago
+	if err := recordPendingPin(n, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	b := []byte(`{"Recursive":true,"Added":"2000-01-01T00:00:00Z"}`)
+	if err := pendingPins(n).Put(dshelp.CidToDsKey(stale.Cid()), b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ResumePins(n, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if mode, pinned, err := n.Pinning.IsPinned(root.Cid()); err != nil || !pinned || mode != "recursive" {
+		t.Fatalf("expected the interrupted pin to be resumed, got %q %t %v", mode, pinned, err)
+	}
+	for _, nd := range []*dag.ProtoNode{root, stale} {
+		if has, _ := pendingPins(n).Has(dshelp.CidToDsKey(nd.Cid())); has {
+			t.Fatalf("pending pin of %s should have been removed", nd.Cid())
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package coreunix
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"net/http"
 	"os"
 	gopath "path"
 	"strconv"
@@ -38,6 +41,10 @@ const progressReaderIncrement = 1024 * 256
 
 var liveCacheSize = uint64(256 << 10)
 
+// sniffLen is the number of bytes considered when detecting the MIME type of
+// a file from its content.
+const sniffLen = 512
+
 type Link struct {
 	Name, Hash string
 	Size       uint64
@@ -88,7 +95,12 @@ func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCBlockstore, ds ipld
 	}, nil
 }
 
-// Adder holds the switches passed to the `add` command.
+// DetectMimeType can be used as Adder.MimeType to wrap every file with the
+// MIME type guessed from its name or, failing that, its content.
+const DetectMimeType = "auto"
+
+// Adder holds the switches passed to the `add` command. If MimeType is set,
+// regular files are wrapped in a unixfs Metadata node carrying it.
 type Adder struct {
 	ctx        context.Context
 	pinning    pin.Pinner
@@ -104,6 +116,7 @@ type Adder struct {
 	Wrap       bool
 	NoCopy     bool
 	Chunker    string
+	MimeType   string
 	root       ipld.Node
 	mroot      *mfs.Root
 	unlocker   bstore.Unlocker
@@ -492,15 +505,79 @@ func (adder *Adder) addFile(file files.File) error {
 		}
 	}
 
+	mimeType := adder.MimeType
+	if mimeType == DetectMimeType {
+		mimeType, reader = detectMimeType(file.FileName(), reader)
+	}
+
 	dagnode, err := adder.add(reader)
 	if err != nil {
 		return err
 	}
 
+	if mimeType != "" {
+		dagnode, err = adder.wrapMetadata(dagnode, mimeType)
+		if err != nil {
+			return err
+		}
+	}
+
 	// patch it into the root
 	return adder.addNode(dagnode, file.FileName())
 }
 
+// wrapMetadata wraps the file nd in a unixfs Metadata node with the given
+// MIME type.
+func (adder *Adder) wrapMetadata(nd ipld.Node, mimeType string) (ipld.Node, error) {
+	if pi, ok := nd.(*posinfo.FilestoreNode); ok {
+		nd = pi.Node
+	}
+
+	var size uint64
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		size = uint64(len(nd.RawData()))
+	case *dag.ProtoNode:
+		fsn, err := unixfs.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+		size = fsn.FileSize()
+	}
+
+	mdata, err := unixfs.BytesForMetadata(&unixfs.Metadata{
+		MimeType: mimeType,
+		Size:     size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mdnode := dag.NodeWithData(mdata)
+	mdnode.SetPrefix(adder.Prefix)
+	if err := mdnode.AddNodeLinkClean("file", nd); err != nil {
+		return nil, err
+	}
+
+	if err := adder.dagService.Add(adder.ctx, mdnode); err != nil {
+		return nil, err
+	}
+	return mdnode, nil
+}
+
+// detectMimeType guesses the MIME type of a file from its extension, or by
+// sniffing the beginning of its content. It returns a reader yielding the
+// complete content.
+func detectMimeType(name string, r io.Reader) (string, io.Reader) {
+	if mt := mime.TypeByExtension(gopath.Ext(name)); mt != "" {
+		return mt, r
+	}
+
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	return http.DetectContentType(head), br
+}
+
 func (adder *Adder) addDir(dir files.File) error {
 	log.Infof("adding directory: %s", dir.FileName())
 
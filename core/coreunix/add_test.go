@@ -269,3 +269,67 @@ func (fi *dummyFileInfo) Mode() os.FileMode  { return 0 }
 func (fi *dummyFileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *dummyFileInfo) IsDir() bool        { return false }
 func (fi *dummyFileInfo) Sys() interface{}   { return nil }
+
+func TestAddMimeType(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: ds2.ThreadSafeCloserMapDatastore(),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		mimeType string
+		name     string
+		content  string
+		expected string
+	}{
+		{"image/png", "a", "not really a png", "image/png"},
+		{DetectMimeType, "b.html", "plain text", "text/html; charset=utf-8"},
+		{DetectMimeType, "c", "%PDF-1.4 ...", "application/pdf"},
+	}
+
+	for _, tc := range cases {
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Out = make(chan interface{}, 10)
+		adder.MimeType = tc.mimeType
+
+		data := ioutil.NopCloser(bytes.NewBufferString(tc.content))
+		if err := adder.AddFile(files.NewReaderFile(tc.name, tc.name, data, nil)); err != nil {
+			t.Fatal(err)
+		}
+		nd, err := adder.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md, err := Metadata(node, nd.Cid().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.MimeType != tc.expected {
+			t.Fatalf("%s: expected mime type %q, got %q", tc.name, tc.expected, md.MimeType)
+		}
+
+		rdr, err := Cat(context.Background(), node, "/ipfs/"+nd.Cid().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.content {
+			t.Fatalf("%s: expected content %q, got %q", tc.name, tc.content, out)
+		}
+	}
+}
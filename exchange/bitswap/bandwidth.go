@@ -0,0 +1,170 @@
+package bitswap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// peerBucketSweepInterval is how often the buckets of peers that haven't been
+// sent anything lately are dropped.
+const peerBucketSweepInterval = time.Minute
+
+// tokenBucket allows rate bytes per second, with bursts of up to one second
+// worth of bytes. Sends larger than the bucket drive it into debt, which
+// later sends have to wait out.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+// reserve takes n tokens and returns how long to wait before using them.
+func (tb *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	tb.refill(now)
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.rate {
+		tb.tokens = tb.rate
+	}
+	tb.last = now
+}
+
+// bandwidthLimiter caps the rate at which blocks are sent, both overall and
+// to each peer. A zero rate means no limit.
+type bandwidthLimiter struct {
+	globalRate float64
+	peerRate   float64
+	now        func() time.Time
+
+	lk        sync.Mutex
+	global    *tokenBucket
+	peers     map[peer.ID]*tokenBucket
+	lastSweep time.Time
+
+	// throttled counts the sends that had to wait, and for how long in total
+	throttled     uint64
+	throttledTime time.Duration
+}
+
+func newBandwidthLimiter(globalRate, peerRate int64) *bandwidthLimiter {
+	bl := &bandwidthLimiter{
+		globalRate: float64(globalRate),
+		peerRate:   float64(peerRate),
+		now:        time.Now,
+		peers:      make(map[peer.ID]*tokenBucket),
+	}
+	if globalRate > 0 {
+		bl.global = newTokenBucket(bl.globalRate, bl.now())
+	}
+	return bl
+}
+
+// limited returns whether any limit is configured.
+func (bl *bandwidthLimiter) limited() bool {
+	return bl.global != nil || bl.peerRate > 0
+}
+
+// reservePeer accounts for sending n bytes to p against its own limit, and
+// returns how long the send must be delayed to stay within it.
+func (bl *bandwidthLimiter) reservePeer(p peer.ID, n int) time.Duration {
+	if bl.peerRate <= 0 {
+		return 0
+	}
+
+	bl.lk.Lock()
+	defer bl.lk.Unlock()
+
+	now := bl.now()
+	if now.Sub(bl.lastSweep) > peerBucketSweepInterval {
+		bl.sweep(now)
+	}
+	tb, ok := bl.peers[p]
+	if !ok {
+		tb = newTokenBucket(bl.peerRate, now)
+		bl.peers[p] = tb
+	}
+	return tb.reserve(n, now)
+}
+
+// reserveGlobal accounts for sending n bytes against the overall limit, and
+// returns how long the send must be delayed to stay within it.
+func (bl *bandwidthLimiter) reserveGlobal(n int) time.Duration {
+	if bl.global == nil {
+		return 0
+	}
+
+	bl.lk.Lock()
+	defer bl.lk.Unlock()
+	return bl.global.reserve(n, bl.now())
+}
+
+// wait blocks until n bytes may be sent to p, or the context is cancelled.
+// The overall allowance is only taken once p's own allowance is available,
+// so that a slow peer doesn't hold bandwidth other peers could use.
+func (bl *bandwidthLimiter) wait(ctx context.Context, p peer.ID, n int) error {
+	d := bl.reservePeer(p, n)
+	if err := sleepCtx(ctx, d); err != nil {
+		return err
+	}
+
+	dg := bl.reserveGlobal(n)
+	bl.recordWait(d + dg)
+	return sleepCtx(ctx, dg)
+}
+
+func (bl *bandwidthLimiter) recordWait(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	bl.lk.Lock()
+	defer bl.lk.Unlock()
+	bl.throttled++
+	bl.throttledTime += d
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sweep forgets peers whose bucket has refilled, as they are
+// indistinguishable from new ones.
+func (bl *bandwidthLimiter) sweep(now time.Time) {
+	for p, tb := range bl.peers {
+		tb.refill(now)
+		if tb.tokens >= tb.rate {
+			delete(bl.peers, p)
+		}
+	}
+	bl.lastSweep = now
+}
+
+func (bl *bandwidthLimiter) stats() (uint64, time.Duration) {
+	bl.lk.Lock()
+	defer bl.lk.Unlock()
+	return bl.throttled, bl.throttledTime
+}
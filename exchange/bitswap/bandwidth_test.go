@@ -0,0 +1,178 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+func newTestLimiter(global, perPeer int64) (*bandwidthLimiter, *time.Time) {
+	now := time.Unix(1000, 0)
+	bl := newBandwidthLimiter(global, perPeer)
+	bl.now = func() time.Time { return now }
+	if bl.global != nil {
+		bl.global.last = now
+	}
+	return bl, &now
+}
+
+func TestBandwidthLimiterUnlimited(t *testing.T) {
+	bl, _ := newTestLimiter(0, 0)
+	if bl.limited() {
+		t.Fatal("expected no limits")
+	}
+	for i := 0; i < 10; i++ {
+		if err := bl.wait(context.Background(), peer.ID("a"), 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := bl.stats(); n != 0 {
+		t.Fatalf("expected no throttled sends, got %d", n)
+	}
+}
+
+func TestBandwidthLimiterGlobal(t *testing.T) {
+	bl, now := newTestLimiter(1000, 0)
+
+	if d := bl.reserveGlobal(1000); d != 0 {
+		t.Fatalf("first second worth of bytes should not wait, got %s", d)
+	}
+	if d := bl.reserveGlobal(500); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms delay, got %s", d)
+	}
+	if d := bl.reservePeer(peer.ID("a"), 1000); d != 0 {
+		t.Fatalf("no per-peer limit is set, got %s", d)
+	}
+
+	*now = now.Add(2 * time.Second)
+	if d := bl.reserveGlobal(1000); d != 0 {
+		t.Fatalf("bucket should have refilled, got %s", d)
+	}
+}
+
+func TestBandwidthLimiterPerPeer(t *testing.T) {
+	bl, now := newTestLimiter(0, 100)
+
+	bl.reservePeer(peer.ID("a"), 100)
+	if d := bl.reservePeer(peer.ID("a"), 100); d != time.Second {
+		t.Fatalf("expected 1s delay for a, got %s", d)
+	}
+	if d := bl.reservePeer(peer.ID("b"), 100); d != 0 {
+		t.Fatalf("b has its own bucket, got %s", d)
+	}
+
+	*now = now.Add(peerBucketSweepInterval + time.Second)
+	bl.reservePeer(peer.ID("c"), 1)
+	if len(bl.peers) != 1 {
+		t.Fatalf("expected idle peers to be swept, have %d buckets", len(bl.peers))
+	}
+}
+
+func TestBandwidthLimiterThrottledPeerKeepsGlobalAllowance(t *testing.T) {
+	bl, _ := newTestLimiter(1000, 100)
+	bl.reservePeer(peer.ID("a"), 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bl.wait(ctx, peer.ID("a"), 100); err == nil {
+		t.Fatal("expected the wait for a's allowance to be cancelled")
+	}
+
+	if d := bl.reserveGlobal(1000); d != 0 {
+		t.Fatalf("a send still waiting on its peer should not use the global allowance, got %s", d)
+	}
+	if n, _ := bl.stats(); n != 0 {
+		t.Fatalf("expected no completed throttled sends, got %d", n)
+	}
+}
+
+func TestPeerSendQueuesDontBlockOtherPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	sent := make(chan peer.ID, 10)
+	sq := newPeerSendQueues(func(ctx context.Context, env *decision.Envelope) {
+		if env.Peer == peer.ID("slow") {
+			<-release
+		}
+		sent <- env.Peer
+	})
+
+	sq.push(ctx, &decision.Envelope{Peer: peer.ID("slow")})
+	sq.push(ctx, &decision.Envelope{Peer: peer.ID("slow")})
+	sq.push(ctx, &decision.Envelope{Peer: peer.ID("fast")})
+
+	select {
+	case p := <-sent:
+		if p != peer.ID("fast") {
+			t.Fatalf("expected the fast peer to be served first, got %s", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow peer held up sends to another peer")
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-sent:
+			if p != peer.ID("slow") {
+				t.Fatalf("unexpected send to %s", p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the slow peer was never served")
+		}
+	}
+}
+
+func TestThrottledPeerSendQueueIsBounded(t *testing.T) {
+	sg := NewTestSessionGenerator(getVirtualNetwork())
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	// the client's allowance only covers a block every few seconds
+	server := sg.NextWithOptions(WithSendRateLimits(0, 10))
+	client := sg.Next()
+	defer server.Exchange.Close()
+	defer client.Exchange.Close()
+
+	if err := client.Exchange.network.ConnectTo(context.Background(), server.Peer); err != nil {
+		t.Fatal(err)
+	}
+
+	blks := bg.Blocks(10 * sendQueueSize)
+	var keys []*cid.Cid
+	for _, b := range blks {
+		if err := server.Exchange.HasBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, b.Cid())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := client.Exchange.GetBlocks(ctx, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	sq := server.Exchange.sendQueues
+	deadline := time.Now().Add(500 * time.Millisecond)
+	queued := 0
+	for time.Now().Before(deadline) {
+		sq.lk.Lock()
+		queued = len(sq.queues[client.Peer])
+		sq.lk.Unlock()
+		if queued > sendQueueSize {
+			t.Fatalf("%d blocks loaded for a throttled peer, expected at most %d", queued, sendQueueSize)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if queued == 0 {
+		t.Fatal("expected blocks to be queued for the throttled peer")
+	}
+}
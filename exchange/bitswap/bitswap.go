@@ -15,7 +15,9 @@ import (
 	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
 	notifications "github.com/ipfs/go-ipfs/exchange/bitswap/notifications"
+	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
 
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
 	delay "gx/ipfs/QmRJVNatYJwTAHgdSM1Xef9QVQ1Ch3XHdmcrykjP5Y4soL/go-ipfs-delay"
 	flags "gx/ipfs/QmRMGdC6HKdLsPDABL9aXPDidrpmEHzJqFWSvshkbn9Hj8/go-ipfs-flags"
 	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
@@ -48,6 +50,10 @@ var (
 	provideKeysBufferSize = 2048
 	provideWorkerMax      = 512
 
+	// sendQueueSize is the most blocks loaded for a peer while upload limits
+	// make it wait for its allowance
+	sendQueueSize = 16
+
 	// the 1<<18+15 is to observe old file chunks that are 1<<18 + 14 in size
 	metricsBuckets = []float64{1 << 6, 1 << 10, 1 << 14, 1 << 18, 1<<18 + 15, 1 << 22}
 )
@@ -57,17 +63,91 @@ func init() {
 		HasBlockBufferSize = 64
 		provideKeysBufferSize = 512
 		provideWorkerMax = 16
+		sendQueueSize = 4
 	}
 }
 
 var rebroadcastDelay = delay.Fixed(time.Minute)
 
+// Option configures a Bitswap instance created by New.
+type Option func(*options)
+
+type options struct {
+	strategy     decision.Strategy
+	sendRate     int64
+	peerSendRate int64
+
+	private      bool
+	allowedPeers []peer.ID
+	allowedTag   string
+
+	wantStore   ds.Datastore
+	wantsMaxAge time.Duration
+
+	tracer bsnet.Tracer
+}
+
+// WithStrategy sets the strategy the decision engine uses to decide which
+// peers to send blocks to first, and which not to serve at all. Defaults to
+// decision.RoundRobin.
+func WithStrategy(s decision.Strategy) Option {
+	return func(o *options) {
+		o.strategy = s
+	}
+}
+
+// WithSendRateLimits caps the rate at which blocks are sent, in bytes per
+// second, to all peers together and to any single peer. Zero means no limit.
+func WithSendRateLimits(global, perPeer int64) Option {
+	return func(o *options) {
+		o.sendRate = global
+		o.peerSendRate = perPeer
+	}
+}
+
+// WithPrivateMode only serves blocks to the given peers, and to the peers
+// carrying tag in the connection manager if tag is not empty. Blocks are
+// still fetched from anyone. The allowlist can be changed at runtime through
+// Bitswap.Allowlist.
+func WithPrivateMode(peers []peer.ID, tag string) Option {
+	return func(o *options) {
+		o.private = true
+		o.allowedPeers = peers
+		o.allowedTag = tag
+	}
+}
+
+// WithPersistentWants records the wants made with a context returned by
+// ContextWithPersistentWants in the given datastore, and fetches them again
+// when bitswap is next started. Wants are forgotten once their block arrives,
+// or after maxAge if it isn't 0.
+func WithPersistentWants(d ds.Datastore, maxAge time.Duration) Option {
+	return func(o *options) {
+		o.wantStore = d
+		o.wantsMaxAge = maxAge
+	}
+}
+
+// WithTracer reports every message sent and received to t.
+func WithTracer(t bsnet.Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
 // New initializes a BitSwap instance that communicates over the provided
 // BitSwapNetwork. This function registers the returned instance as the network
 // delegate.
 // Runs until context is cancelled.
 func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
-	bstore blockstore.Blockstore, nice bool) exchange.Interface {
+	bstore blockstore.Blockstore, nice bool, opts ...Option) exchange.Interface {
+
+	o := options{
+		strategy: decision.RoundRobin,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	// important to use provided parent context (since it may include important
 	// loggable data). It's probably not a good idea to allow bitswap to be
@@ -83,6 +163,10 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 	allHist := metrics.NewCtx(ctx, "recv_all_blocks_bytes", "Summary of all"+
 		" data blocks recived").Histogram(metricsBuckets)
 
+	if o.tracer != nil {
+		network = bsnet.NewTracingNetwork(network, o.tracer)
+	}
+
 	notif := notifications.New()
 	px := process.WithTeardown(func() error {
 		notif.Shutdown()
@@ -92,24 +176,58 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 	bs := &Bitswap{
 		blockstore:    bstore,
 		notifications: notif,
-		engine:        decision.NewEngine(ctx, bstore), // TODO close the engine with Close() method
+		engine:        decision.NewEngineWithStrategy(ctx, bstore, o.strategy), // TODO close the engine with Close() method
 		network:       network,
 		findKeys:      make(chan *blockRequest, sizeBatchRequestChan),
 		process:       px,
+		ctx:           ctx,
 		newBlocks:     make(chan *cid.Cid, HasBlockBufferSize),
 		provideKeys:   make(chan *cid.Cid, provideKeysBufferSize),
 		wm:            NewWantManager(ctx, network),
+		sendLimiter:   newBandwidthLimiter(o.sendRate, o.peerSendRate),
+		tracer:        o.tracer,
 		counters:      new(counters),
 
 		dupMetric: dupHist,
 		allMetric: allHist,
 	}
+
+	bs.sendQueues = newPeerSendQueues(bs.sendBlock)
+	if bs.sendLimiter.limited() {
+		// leave the requests of throttled peers in the engine, rather than
+		// loading all their blocks into the send queues
+		bs.engine.SetMaxActivePerPeer(sendQueueSize)
+	}
+
+	allowlist := bs.engine.Allowlist()
+	allowlist.SetTagLookup(func(p peer.ID, tag string) bool {
+		ti := network.ConnectionManager().GetTagInfo(p)
+		if ti == nil {
+			return false
+		}
+		_, ok := ti.Tags[tag]
+		return ok
+	})
+	if o.private {
+		allowlist.Add(o.allowedPeers...)
+		allowlist.SetTag(o.allowedTag)
+		allowlist.SetEnabled(true)
+	}
+
+	if o.wantStore != nil {
+		bs.wantStore = newWantStore(o.wantStore)
+	}
+
 	go bs.wm.Run()
 	network.SetDelegate(bs)
 
 	// Start up bitswaps async worker routines
 	bs.startWorkers(px, ctx)
 
+	if bs.wantStore != nil {
+		go bs.resumeWants(ctx, o.wantsMaxAge)
+	}
+
 	// bind the context and process.
 	// do it over here to avoid closing before all setup is done.
 	go func() {
@@ -152,6 +270,20 @@ type Bitswap struct {
 
 	process process.Process
 
+	// ctx is cancelled when bitswap shuts down
+	ctx context.Context
+
+	// sendLimiter keeps outgoing blocks within the configured rate limits
+	sendLimiter *bandwidthLimiter
+	// sendQueues sends the blocks of each peer while upload limits are set
+	sendQueues *peerSendQueues
+
+	// wantStore persists long-lived wants across restarts, if enabled
+	wantStore *wantStore
+
+	// tracer, if set, is told about every message
+	tracer bsnet.Tracer
+
 	// Counters for various statistics
 	counterLk sync.Mutex
 	counters  *counters
@@ -197,10 +329,27 @@ func (bs *Bitswap) WantlistForPeer(p peer.ID) []*cid.Cid {
 	return out
 }
 
+// WantlistEntries returns the entries of our wantlist, highest priority
+// first.
+func (bs *Bitswap) WantlistEntries() []*wantlist.Entry {
+	return bs.wm.wl.SortedEntries()
+}
+
+// WantlistEntriesForPeer returns the entries of the wantlist p sent us,
+// highest priority first.
+func (bs *Bitswap) WantlistEntriesForPeer(p peer.ID) []*wantlist.Entry {
+	return bs.engine.WantlistForPeer(p)
+}
+
 func (bs *Bitswap) LedgerForPeer(p peer.ID) *decision.Receipt {
 	return bs.engine.LedgerForPeer(p)
 }
 
+// Allowlist returns the peers we serve blocks to while in private mode.
+func (bs *Bitswap) Allowlist() *decision.Allowlist {
+	return bs.engine.Allowlist()
+}
+
 // GetBlocks returns a channel where the caller may receive blocks that
 // correspond to the provided |keys|. Returns an error if BitSwap is unable to
 // begin this request within the deadline enforced by the context.
@@ -226,6 +375,8 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []*cid.Cid) (<-chan block
 		log.Event(ctx, "Bitswap.GetBlockRequest.Start", k)
 	}
 
+	bs.persistWants(ctx, keys)
+
 	mses := bs.getNextSessionID()
 
 	bs.wm.WantBlocks(ctx, keys, nil, mses)
@@ -280,6 +431,71 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []*cid.Cid) (<-chan block
 	}
 }
 
+// persistWants records keys in the want store if ctx asks for it.
+func (bs *Bitswap) persistWants(ctx context.Context, keys []*cid.Cid) {
+	pw := persistentWantsFrom(ctx)
+	if bs.wantStore == nil || pw == nil {
+		return
+	}
+	if err := bs.wantStore.add(keys, time.Now()); err != nil {
+		log.Errorf("error persisting wants: %s", err)
+		return
+	}
+	pw.add(bs, keys)
+}
+
+// shuttingDown returns true once bitswap has been asked to stop.
+func (bs *Bitswap) shuttingDown() bool {
+	select {
+	case <-bs.ctx.Done():
+		return true
+	case <-bs.process.Closing():
+		return true
+	default:
+		return false
+	}
+}
+
+// resumeWants fetches the persisted wants left over from before a restart.
+func (bs *Bitswap) resumeWants(ctx context.Context, maxAge time.Duration) {
+	keys, until, err := bs.wantStore.load(maxAge, time.Now())
+	if err != nil {
+		log.Errorf("error loading persisted wants: %s", err)
+		return
+	}
+
+	var missing []*cid.Cid
+	for _, k := range keys {
+		has, err := bs.blockstore.Has(k)
+		if err == nil && has {
+			bs.wantStore.remove(k)
+			continue
+		}
+		missing = append(missing, k)
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	if !until.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, until)
+		defer cancel()
+	}
+
+	log.Infof("resuming %d persisted wants", len(missing))
+	ctx, forget := ContextWithPersistentWants(ctx)
+	// forget the wants that expired before their block arrived
+	defer forget()
+	blks, err := bs.GetBlocks(ContextWithPriority(ctx, PriorityBackground), missing)
+	if err != nil {
+		log.Errorf("error resuming persisted wants: %s", err)
+		return
+	}
+	for range blks {
+	}
+}
+
 func (bs *Bitswap) getNextSessionID() uint64 {
 	bs.sessIDLk.Lock()
 	defer bs.sessIDLk.Unlock()
@@ -318,6 +534,12 @@ func (bs *Bitswap) receiveBlockFrom(blk blocks.Block, from peer.ID) error {
 		return err
 	}
 
+	if bs.wantStore != nil {
+		if err := bs.wantStore.remove(blk.Cid()); err != nil {
+			log.Errorf("error removing persisted want: %s", err)
+		}
+	}
+
 	// NOTE: There exists the possiblity for a race condition here.  If a user
 	// creates a node, then adds it to the dagservice while another goroutine
 	// is waiting on a GetBlock for that object, they will receive a reference
@@ -360,12 +582,22 @@ func (bs *Bitswap) SessionsForBlock(c *cid.Cid) []*Session {
 func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg.BitSwapMessage) {
 	atomic.AddUint64(&bs.counters.messagesRecvd, 1)
 
+	if bs.tracer != nil {
+		bs.tracer.MessageReceived(p, incoming)
+	}
+
 	// This call records changes to wantlists, blocks received,
 	// and number of bytes transfered.
 	bs.engine.MessageReceived(p, incoming)
 	// TODO: this is bad, and could be easily abused.
 	// Should only track *useful* messages in ledger
 
+	for _, bp := range incoming.BlockPresences() {
+		for _, s := range bs.SessionsForBlock(bp.Cid) {
+			s.receivePresenceFrom(p, bp)
+		}
+	}
+
 	iblocks := incoming.Blocks()
 
 	if len(iblocks) == 0 {
@@ -378,7 +610,7 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 		go func(b blocks.Block) { // TODO: this probably doesnt need to be a goroutine...
 			defer wg.Done()
 
-			bs.updateReceiveCounters(b)
+			bs.updateReceiveCounters(p, b)
 
 			log.Debugf("got block %s from %s", b, p)
 
@@ -393,7 +625,7 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 
 var ErrAlreadyHaveBlock = errors.New("already have block")
 
-func (bs *Bitswap) updateReceiveCounters(b blocks.Block) {
+func (bs *Bitswap) updateReceiveCounters(from peer.ID, b blocks.Block) {
 	blkLen := len(b.RawData())
 	has, err := bs.blockstore.Has(b.Cid())
 	if err != nil {
@@ -404,6 +636,7 @@ func (bs *Bitswap) updateReceiveCounters(b blocks.Block) {
 	bs.allMetric.Observe(float64(blkLen))
 	if has {
 		bs.dupMetric.Observe(float64(blkLen))
+		bs.engine.DuplicateReceived(from, blkLen)
 	}
 
 	bs.counterLk.Lock()
@@ -672,3 +672,52 @@ func TestBitswapLedgerTwoWay(t *testing.T) {
 		}
 	}
 }
+
+func TestDebtRatioStrategyDeniesFreeloaders(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	server := sg.NextWithOptions(WithStrategy(decision.DebtRatioStrategy(0.5, 0)))
+	client := sg.Next()
+	defer server.Exchange.Close()
+	defer client.Exchange.Close()
+
+	if err := client.Exchange.network.ConnectTo(context.Background(), server.Peer); err != nil {
+		t.Fatal(err)
+	}
+
+	served := bg.Blocks(2)
+	for _, b := range served {
+		if err := server.Exchange.HasBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first block is free
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := client.Exchange.GetBlock(ctx, served[0].Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// after that, the client has to give something back
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel2()
+	if _, err := client.Exchange.GetBlock(ctx2, served[1].Cid()); err != context.DeadlineExceeded {
+		t.Fatalf("expected freeloader not to be served, got %v", err)
+	}
+
+	given := blocks.NewBlock(bytes.Repeat([]byte("x"), len(served[0].RawData())*2))
+	if err := client.Exchange.HasBlock(given); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Exchange.GetBlock(ctx, given.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Exchange.GetBlock(ctx, served[1].Cid()); err != nil {
+		t.Fatalf("expected client to be served after reciprocating: %s", err)
+	}
+}
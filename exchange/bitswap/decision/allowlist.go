@@ -0,0 +1,105 @@
+package decision
+
+import (
+	"sync"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// Allowlist restricts which partners the engine sends blocks to. While it is
+// enabled, wants are only honoured from peers that were added to it or that
+// carry its tag. It does not affect which peers we fetch blocks from.
+type Allowlist struct {
+	lk      sync.RWMutex
+	enabled bool
+	peers   map[peer.ID]struct{}
+	tag     string
+	hasTag  func(p peer.ID, tag string) bool
+}
+
+func newAllowlist() *Allowlist {
+	return &Allowlist{
+		peers: make(map[peer.ID]struct{}),
+	}
+}
+
+// Allowed returns true if the engine may serve p.
+func (a *Allowlist) Allowed(p peer.ID) bool {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+
+	if !a.enabled {
+		return true
+	}
+	if _, ok := a.peers[p]; ok {
+		return true
+	}
+	return a.tag != "" && a.hasTag != nil && a.hasTag(p, a.tag)
+}
+
+// Enabled returns true if the allowlist is being enforced.
+func (a *Allowlist) Enabled() bool {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+	return a.enabled
+}
+
+// SetEnabled turns enforcement of the allowlist on or off.
+func (a *Allowlist) SetEnabled(enabled bool) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.enabled = enabled
+}
+
+// Add allows the given peers.
+func (a *Allowlist) Add(peers ...peer.ID) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	for _, p := range peers {
+		a.peers[p] = struct{}{}
+	}
+}
+
+// Remove disallows the given peers, unless they carry the tag.
+func (a *Allowlist) Remove(peers ...peer.ID) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	for _, p := range peers {
+		delete(a.peers, p)
+	}
+}
+
+// Peers returns the peers that were added to the allowlist.
+func (a *Allowlist) Peers() []peer.ID {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+
+	out := make([]peer.ID, 0, len(a.peers))
+	for p := range a.peers {
+		out = append(out, p)
+	}
+	return out
+}
+
+// Tag returns the tag that allows the peers carrying it, or "" if none is
+// set.
+func (a *Allowlist) Tag() string {
+	a.lk.RLock()
+	defer a.lk.RUnlock()
+	return a.tag
+}
+
+// SetTag allows the peers carrying tag. An empty tag allows no one.
+func (a *Allowlist) SetTag(tag string) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.tag = tag
+}
+
+// SetTagLookup sets the function used to find out whether a peer carries a
+// tag. Until it is set, peers are only allowed by ID.
+func (a *Allowlist) SetTagLookup(hasTag func(p peer.ID, tag string) bool) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.hasTag = hasTag
+}
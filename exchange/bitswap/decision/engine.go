@@ -62,6 +62,10 @@ type Envelope struct {
 	// Block is the payload
 	Block blocks.Block
 
+	// Presence is sent instead of a block when the peer only asked whether we
+	// have it, or asked to be told when we don't
+	Presence *bsmsg.BlockPresence
+
 	// A callback to notify the decision queue that the task is complete
 	Sent func()
 }
@@ -89,14 +93,25 @@ type Engine struct {
 	// ledgerMap lists Ledgers by their Partner key.
 	ledgerMap map[peer.ID]*ledger
 
+	// allowlist decides which partners we are willing to serve
+	allowlist *Allowlist
+
 	ticker *time.Ticker
 }
 
+// NewEngine creates an engine serving partners round robin
 func NewEngine(ctx context.Context, bs bstore.Blockstore) *Engine {
+	return NewEngineWithStrategy(ctx, bs, RoundRobin)
+}
+
+// NewEngineWithStrategy creates an engine that lets the given strategy
+// decide which partners to serve, and in which order
+func NewEngineWithStrategy(ctx context.Context, bs bstore.Blockstore, strategy Strategy) *Engine {
 	e := &Engine{
 		ledgerMap:        make(map[peer.ID]*ledger),
+		allowlist:        newAllowlist(),
 		bs:               bs,
-		peerRequestQueue: newPRQ(),
+		peerRequestQueue: newPRQWithStrategy(strategy),
 		outbox:           make(chan (<-chan *Envelope), outboxChanBuffer),
 		workSignal:       make(chan struct{}, 1),
 		ticker:           time.NewTicker(time.Millisecond * 100),
@@ -105,6 +120,19 @@ func NewEngine(ctx context.Context, bs bstore.Blockstore) *Engine {
 	return e
 }
 
+// SetMaxActivePerPeer bounds the envelopes handed out for a partner that
+// haven't been sent yet. The partner's other requests wait in the engine until
+// some are, rather than having their blocks loaded. 0 removes the bound.
+func (e *Engine) SetMaxActivePerPeer(n int) {
+	e.peerRequestQueue.SetMaxActive(n)
+}
+
+// Allowlist returns the list of partners the engine is allowed to serve when
+// running in private mode.
+func (e *Engine) Allowlist() *Allowlist {
+	return e.allowlist
+}
+
 func (e *Engine) WantlistForPeer(p peer.ID) (out []*wl.Entry) {
 	partner := e.findOrCreate(p)
 	partner.lk.Lock()
@@ -124,9 +152,20 @@ func (e *Engine) LedgerForPeer(p peer.ID) *Receipt {
 		Sent:      ledger.Accounting.BytesSent,
 		Recv:      ledger.Accounting.BytesRecv,
 		Exchanged: ledger.ExchangeCount(),
+		DupBlocks: ledger.dupBlocksRecv,
+		DupData:   ledger.dupBytesRecv,
 	}
 }
 
+// DuplicateReceived records that p sent us a block of n bytes we already
+// had.
+func (e *Engine) DuplicateReceived(p peer.ID, n int) {
+	l := e.findOrCreate(p)
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	l.ReceivedDuplicate(n)
+}
+
 func (e *Engine) taskWorker(ctx context.Context) {
 	defer close(e.outbox) // because taskWorker uses the channel exclusively
 	for {
@@ -165,10 +204,31 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 			}
 		}
 
+		// the partner may have been disallowed since its request was queued
+		if !e.allowlist.Allowed(nextTask.Target) {
+			nextTask.Done()
+			continue
+		}
+
 		// with a task in hand, we're ready to prepare the envelope...
 
+		if nextTask.Entry.WantType == wl.WantHave {
+			has, err := e.bs.Has(nextTask.Entry.Cid)
+			if err != nil {
+				log.Errorf("tried to execute a task and errored checking for block: %s", err)
+			}
+			if !has && !nextTask.Entry.SendDontHave {
+				nextTask.Done()
+				continue
+			}
+			return e.presenceEnvelope(nextTask, has), nil
+		}
+
 		block, err := e.bs.Get(nextTask.Entry.Cid)
 		if err != nil {
+			if nextTask.Entry.SendDontHave {
+				return e.presenceEnvelope(nextTask, false), nil
+			}
 			log.Errorf("tried to execute a task and errored fetching block: %s", err)
 			// If we don't have the block, don't hold that against the peer
 			// make sure to update that the task has been 'completed'
@@ -179,19 +239,34 @@ func (e *Engine) nextEnvelope(ctx context.Context) (*Envelope, error) {
 		return &Envelope{
 			Peer:  nextTask.Target,
 			Block: block,
-			Sent: func() {
-				nextTask.Done()
-				select {
-				case e.workSignal <- struct{}{}:
-					// work completing may mean that our queue will provide new
-					// work to be done.
-				default:
-				}
-			},
+			Sent:  e.taskSent(nextTask),
 		}, nil
 	}
 }
 
+func (e *Engine) presenceEnvelope(task *peerRequestTask, have bool) *Envelope {
+	return &Envelope{
+		Peer: task.Target,
+		Presence: &bsmsg.BlockPresence{
+			Cid:  task.Entry.Cid,
+			Have: have,
+		},
+		Sent: e.taskSent(task),
+	}
+}
+
+func (e *Engine) taskSent(task *peerRequestTask) func() {
+	return func() {
+		task.Done()
+		select {
+		case e.workSignal <- struct{}{}:
+			// work completing may mean that our queue will provide new
+			// work to be done.
+		default:
+		}
+	}
+}
+
 // Outbox returns a channel of one-time use Envelope channels.
 func (e *Engine) Outbox() <-chan (<-chan *Envelope) {
 	return e.outbox
@@ -213,7 +288,7 @@ func (e *Engine) Peers() []peer.ID {
 // MessageReceived performs book-keeping. Returns error if passed invalid
 // arguments.
 func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
-	if len(m.Wantlist()) == 0 && len(m.Blocks()) == 0 {
+	if m.Empty() {
 		log.Debugf("received empty message from %s", p)
 	}
 
@@ -229,17 +304,40 @@ func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
 	defer l.lk.Unlock()
 	if m.Full() {
 		l.wantList = wl.New()
+		l.wantHaves = wl.New()
+	}
+
+	// in private mode, wants from peers outside the allowlist are ignored,
+	// but we still keep track of the blocks they send us
+	wants := m.Wantlist()
+	if !e.allowlist.Allowed(p) {
+		if len(wants) > 0 {
+			log.Debugf("ignoring wants from %s, not in allowlist", p)
+		}
+		wants = nil
 	}
 
-	for _, entry := range m.Wantlist() {
+	for _, entry := range wants {
 		if entry.Cancel {
 			log.Debugf("%s cancel %s", p, entry.Cid)
 			l.CancelWant(entry.Cid)
 			e.peerRequestQueue.Remove(entry.Cid, p)
+		} else if entry.WantType == wl.WantHave {
+			// want-haves are answered from what we have right now. The ones
+			// we can't satisfy yet are kept, to send a HAVE once we can.
+			log.Debugf("wants to know if we have %s", entry.Cid)
+			exists, err := e.bs.Has(entry.Cid)
+			if err != nil || !exists {
+				l.WantsHave(entry.Cid, entry.Priority)
+			}
+			if (err == nil && exists) || entry.SendDontHave {
+				e.peerRequestQueue.Push(entry.Entry, p)
+				newWorkExists = true
+			}
 		} else {
 			log.Debugf("wants %s - %d", entry.Cid, entry.Priority)
 			l.Wants(entry.Cid, entry.Priority)
-			if exists, err := e.bs.Has(entry.Cid); err == nil && exists {
+			if exists, err := e.bs.Has(entry.Cid); (err == nil && exists) || entry.SendDontHave {
 				e.peerRequestQueue.Push(entry.Entry, p)
 				newWorkExists = true
 			}
@@ -250,6 +348,11 @@ func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
 		log.Debugf("got block %s %d bytes", block, len(block.RawData()))
 		l.ReceivedBytes(len(block.RawData()))
 	}
+	if len(m.Blocks()) > 0 {
+		e.peerRequestQueue.UpdateAccounting(p, l.Accounting.BytesSent, l.Accounting.BytesRecv)
+		// the strategy may now be willing to serve this partner
+		newWorkExists = true
+	}
 	return nil
 }
 
@@ -257,10 +360,16 @@ func (e *Engine) addBlock(block blocks.Block) {
 	work := false
 
 	for _, l := range e.ledgerMap {
+		if !e.allowlist.Allowed(l.Partner) {
+			continue
+		}
 		l.lk.Lock()
 		if entry, ok := l.WantListContains(block.Cid()); ok {
 			e.peerRequestQueue.Push(entry, l.Partner)
 			work = true
+		} else if entry, ok := l.TakeWantHave(block.Cid()); ok {
+			e.peerRequestQueue.Push(entry, l.Partner)
+			work = true
 		}
 		l.lk.Unlock()
 	}
@@ -293,6 +402,9 @@ func (e *Engine) MessageSent(p peer.ID, m bsmsg.BitSwapMessage) error {
 		l.wantList.Remove(block.Cid())
 		e.peerRequestQueue.Remove(block.Cid(), p)
 	}
+	if len(m.Blocks()) > 0 {
+		e.peerRequestQueue.UpdateAccounting(p, l.Accounting.BytesSent, l.Accounting.BytesRecv)
+	}
 
 	return nil
 }
@@ -8,8 +8,10 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	message "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	wl "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
 
 	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
 	dssync "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/sync"
@@ -169,6 +171,196 @@ func TestPartnerWantsThenCancels(t *testing.T) {
 	}
 }
 
+func TestPartnerWantsPresences(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := bs.Put(blocks.NewBlock([]byte("a"))); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(ctx, bs)
+	partner := testutil.RandPeerIDFatal(t)
+
+	m := message.New(false)
+	m.AddWant(blocks.NewBlock([]byte("a")).Cid(), 4, wl.WantHave, true)
+	m.AddWant(blocks.NewBlock([]byte("b")).Cid(), 3, wl.WantHave, true)
+	m.AddWant(blocks.NewBlock([]byte("c")).Cid(), 2, wl.WantHave, false)
+	m.AddWant(blocks.NewBlock([]byte("d")).Cid(), 1, wl.WantBlock, true)
+	e.MessageReceived(partner, m)
+
+	expected := []struct {
+		letter string
+		have   bool
+	}{{"a", true}, {"b", false}, {"d", false}}
+	for _, exp := range expected {
+		envelope := <-<-e.Outbox()
+		if envelope.Block != nil || envelope.Presence == nil {
+			t.Fatal("expected a block presence")
+		}
+		c := blocks.NewBlock([]byte(exp.letter)).Cid()
+		if !envelope.Presence.Cid.Equals(c) || envelope.Presence.Have != exp.have {
+			t.Fatalf("expected presence of %s to be %t", exp.letter, exp.have)
+		}
+		envelope.Sent()
+	}
+
+	next := <-e.Outbox()
+	select {
+	case envelope := <-next:
+		t.Fatalf("unexpected envelope for %v", envelope.Presence)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// only the want-block is in the peer's wantlist
+	wants := e.WantlistForPeer(partner)
+	if len(wants) != 1 || !wants[0].Cid.Equals(blocks.NewBlock([]byte("d")).Cid()) {
+		t.Fatalf("unexpected wantlist for partner: %v", wants)
+	}
+}
+
+func TestPartnerToldOnceBlockArrivesAfterDontHave(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	e := NewEngine(ctx, bs)
+	partner := testutil.RandPeerIDFatal(t)
+	block := blocks.NewBlock([]byte("a"))
+
+	m := message.New(false)
+	m.AddWant(block.Cid(), 1, wl.WantHave, true)
+	e.MessageReceived(partner, m)
+
+	envelope := <-<-e.Outbox()
+	if envelope.Presence == nil || envelope.Presence.Have {
+		t.Fatal("expected a DONT_HAVE")
+	}
+	envelope.Sent()
+
+	if err := bs.Put(block); err != nil {
+		t.Fatal(err)
+	}
+	e.AddBlock(block)
+
+	next := <-e.Outbox()
+	select {
+	case envelope := <-next:
+		if envelope.Presence == nil || !envelope.Presence.Have || !envelope.Presence.Cid.Equals(block.Cid()) {
+			t.Fatal("expected a HAVE once the block arrived")
+		}
+		envelope.Sent()
+	case <-time.After(time.Second):
+		t.Fatal("partner wasn't told we got the block")
+	}
+
+	// the partner is only told once
+	e.AddBlock(block)
+	next = <-e.Outbox()
+	select {
+	case envelope := <-next:
+		t.Fatalf("unexpected envelope for %v", envelope.Presence)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAllowlistIgnoresStrangers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	for _, letter := range []string{"a", "b"} {
+		if err := bs.Put(blocks.NewBlock([]byte(letter))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEngine(ctx, bs)
+	friend := testutil.RandPeerIDFatal(t)
+	tagged := testutil.RandPeerIDFatal(t)
+	stranger := testutil.RandPeerIDFatal(t)
+
+	e.Allowlist().SetEnabled(true)
+	e.Allowlist().Add(friend)
+	e.Allowlist().SetTag("friends")
+	e.Allowlist().SetTagLookup(func(p peer.ID, tag string) bool {
+		return p == tagged && tag == "friends"
+	})
+
+	partnerWants(e, []string{"a"}, stranger)
+	if len(e.WantlistForPeer(stranger)) != 0 {
+		t.Fatal("wants of peers outside the allowlist should be ignored")
+	}
+
+	partnerWants(e, []string{"a"}, friend)
+	partnerWants(e, []string{"b"}, tagged)
+	for i := 0; i < 2; i++ {
+		envelope := <-<-e.Outbox()
+		if envelope.Peer == stranger {
+			t.Fatal("sent a block to a peer outside the allowlist")
+		}
+		envelope.Sent()
+	}
+
+	// peers removed at runtime are ignored again
+	e.Allowlist().Remove(friend)
+	partnerWants(e, []string{"b"}, friend)
+	next := <-e.Outbox()
+	select {
+	case envelope := <-next:
+		t.Fatalf("unexpected envelope for %s", envelope.Peer)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMaxActivePerPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	keys := strings.Split("abcdef", "")
+	for _, letter := range keys {
+		if err := bs.Put(blocks.NewBlock([]byte(letter))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := NewEngine(ctx, bs)
+	e.SetMaxActivePerPeer(2)
+	slow := testutil.RandPeerIDFatal(t)
+	other := testutil.RandPeerIDFatal(t)
+
+	partnerWants(e, keys, slow)
+	var pending []*Envelope
+	for i := 0; i < 2; i++ {
+		pending = append(pending, <-<-e.Outbox())
+	}
+
+	// the slow peer is at its bound, but others are still served
+	partnerWants(e, []string{"a"}, other)
+	if envelope := <-<-e.Outbox(); envelope.Peer != other {
+		t.Fatalf("expected an envelope for the other peer, got one for %s", envelope.Peer)
+	} else {
+		envelope.Sent()
+	}
+
+	next := <-e.Outbox()
+	select {
+	case envelope := <-next:
+		t.Fatalf("unexpected envelope for %s over the bound", envelope.Peer)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// sending one makes room for the next
+	pending[0].Sent()
+	select {
+	case envelope := <-next:
+		if envelope.Peer != slow {
+			t.Fatalf("unexpected envelope for %s", envelope.Peer)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the next envelope once one was sent")
+	}
+}
+
 func partnerWants(e *Engine, keys []string, partner peer.ID) {
 	add := message.New(false)
 	for i, letter := range keys {
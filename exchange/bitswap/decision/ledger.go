@@ -13,6 +13,7 @@ import (
 func newLedger(p peer.ID) *ledger {
 	return &ledger{
 		wantList:   wl.New(),
+		wantHaves:  wl.New(),
 		Partner:    p,
 		sentToPeer: make(map[string]time.Time),
 	}
@@ -33,9 +34,18 @@ type ledger struct {
 	// exchangeCount is the number of exchanges with this peer
 	exchangeCount uint64
 
+	// dupBlocksRecv and dupBytesRecv count the blocks Partner sent us that
+	// we already had
+	dupBlocksRecv uint64
+	dupBytesRecv  uint64
+
 	// wantList is a (bounded, small) set of keys that Partner desires.
 	wantList *wl.Wantlist
 
+	// wantHaves are the keys Partner asked about that we don't have yet. It
+	// is told once we get them.
+	wantHaves *wl.Wantlist
+
 	// sentToPeer is a set of keys to ensure we dont send duplicate blocks
 	// to a given peer
 	sentToPeer map[string]time.Time
@@ -53,6 +63,8 @@ type Receipt struct {
 	Sent      uint64
 	Recv      uint64
 	Exchanged uint64
+	DupBlocks uint64
+	DupData   uint64
 }
 
 type debtRatio struct {
@@ -76,13 +88,42 @@ func (l *ledger) ReceivedBytes(n int) {
 	l.Accounting.BytesRecv += uint64(n)
 }
 
+func (l *ledger) ReceivedDuplicate(n int) {
+	l.dupBlocksRecv++
+	l.dupBytesRecv += uint64(n)
+}
+
 func (l *ledger) Wants(k *cid.Cid, priority int) {
 	log.Debugf("peer %s wants %s", l.Partner, k)
+	l.wantHaves.Remove(k)
 	l.wantList.Add(k, priority)
 }
 
+// WantsHave records that Partner wants to know once we have k.
+func (l *ledger) WantsHave(k *cid.Cid, priority int) {
+	if _, ok := l.wantList.Contains(k); ok {
+		return
+	}
+	l.wantHaves.AddEntry(&wl.Entry{
+		Cid:      k,
+		Priority: priority,
+		WantType: wl.WantHave,
+	})
+}
+
 func (l *ledger) CancelWant(k *cid.Cid) {
 	l.wantList.Remove(k)
+	l.wantHaves.Remove(k)
+}
+
+// TakeWantHave returns Partner's want-have for k, and forgets it as
+// Partner is about to be told.
+func (l *ledger) TakeWantHave(k *cid.Cid) (*wl.Entry, bool) {
+	e, ok := l.wantHaves.Contains(k)
+	if ok {
+		l.wantHaves.Remove(k)
+	}
+	return e, ok
 }
 
 func (l *ledger) WantListContains(k *cid.Cid) (*wl.Entry, bool) {
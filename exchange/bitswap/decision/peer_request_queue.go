@@ -16,45 +16,82 @@ type peerRequestQueue interface {
 	Pop() *peerRequestTask
 	Push(entry *wantlist.Entry, to peer.ID)
 	Remove(k *cid.Cid, p peer.ID)
+	// UpdateAccounting records the bytes exchanged with a partner, for the
+	// strategy to take into account.
+	UpdateAccounting(p peer.ID, sent, recv uint64)
 
 	// NB: cannot expose simply expose taskQueue.Len because trashed elements
 	// may exist. These trashed elements should not contribute to the count.
 }
 
 func newPRQ() *prq {
-	return &prq{
+	return newPRQWithStrategy(RoundRobin)
+}
+
+func newPRQWithStrategy(strategy Strategy) *prq {
+	tl := &prq{
 		taskMap:  make(map[string]*peerRequestTask),
 		partners: make(map[peer.ID]*activePartner),
 		frozen:   make(map[peer.ID]*activePartner),
-		pQueue:   pq.New(partnerCompare),
+		strategy: strategy,
 	}
+	tl.pQueue = pq.New(tl.partnerCompare)
+	return tl
 }
 
 // verify interface implementation
 var _ peerRequestQueue = &prq{}
 
-// TODO: at some point, the strategy needs to plug in here
-// to help decide how to sort tasks (on add) and how to select
-// tasks (on getnext). For now, we are assuming a dumb/nice strategy.
+// prq consults its strategy to decide which partner to serve next. Tasks of
+// a given partner are sorted by the partner's priorities.
 type prq struct {
 	lock     sync.Mutex
 	pQueue   pq.PQ
 	taskMap  map[string]*peerRequestTask
 	partners map[peer.ID]*activePartner
+	strategy Strategy
+
+	// maxActive bounds the tasks popped for a partner that aren't done yet,
+	// if it isn't 0
+	maxActive int
 
 	frozen map[peer.ID]*activePartner
 }
 
-// Push currently adds a new peerRequestTask to the end of the list
-func (tl *prq) Push(entry *wantlist.Entry, to peer.ID) {
+// SetMaxActive stops Pop from returning tasks for a partner that already has
+// n tasks in progress, until some of them are done. 0 removes the bound.
+func (tl *prq) SetMaxActive(n int) {
 	tl.lock.Lock()
 	defer tl.lock.Unlock()
-	partner, ok := tl.partners[to]
+	tl.maxActive = n
+}
+
+// canServe returns true if the strategy lets a partner be served and the
+// partner has room for another task. Must be called with the lock held.
+func (tl *prq) canServe(ps *PartnerStats) bool {
+	if tl.maxActive > 0 && ps.Active >= tl.maxActive {
+		return false
+	}
+	return tl.strategy.ShouldServe(ps)
+}
+
+// partner returns the activePartner for p, creating it if needed. Must be
+// called with the lock held.
+func (tl *prq) partner(p peer.ID) *activePartner {
+	partner, ok := tl.partners[p]
 	if !ok {
-		partner = newActivePartner()
+		partner = newActivePartner(p)
 		tl.pQueue.Push(partner)
-		tl.partners[to] = partner
+		tl.partners[p] = partner
 	}
+	return partner
+}
+
+// Push currently adds a new peerRequestTask to the end of the list
+func (tl *prq) Push(entry *wantlist.Entry, to peer.ID) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	partner := tl.partner(to)
 
 	partner.activelk.Lock()
 	defer partner.activelk.Unlock()
@@ -64,6 +101,11 @@ func (tl *prq) Push(entry *wantlist.Entry, to peer.ID) {
 
 	if task, ok := tl.taskMap[taskKey(to, entry.Cid)]; ok {
 		task.Entry.Priority = entry.Priority
+		if task.Entry.WantType == wantlist.WantHave && entry.WantType == wantlist.WantBlock {
+			// the peer now wants the block itself
+			task.Entry.WantType = wantlist.WantBlock
+			task.Entry.SendDontHave = entry.SendDontHave
+		}
 		partner.taskQueue.Update(task.index)
 		return
 	}
@@ -96,7 +138,7 @@ func (tl *prq) Pop() *peerRequestTask {
 	partner := tl.pQueue.Pop().(*activePartner)
 
 	var out *peerRequestTask
-	for partner.taskQueue.Len() > 0 && partner.freezeVal == 0 {
+	for partner.taskQueue.Len() > 0 && partner.freezeVal == 0 && tl.canServe(partner.stats()) {
 		out = partner.taskQueue.Pop().(*peerRequestTask)
 		delete(tl.taskMap, out.Key())
 		if out.trash {
@@ -141,6 +183,17 @@ func (tl *prq) Remove(k *cid.Cid, p peer.ID) {
 	tl.lock.Unlock()
 }
 
+// UpdateAccounting records the bytes exchanged with a partner
+func (tl *prq) UpdateAccounting(p peer.ID, sent, recv uint64) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+
+	partner := tl.partner(p)
+	partner.bytesSent = sent
+	partner.bytesRecv = recv
+	tl.pQueue.Update(partner.index)
+}
+
 func (tl *prq) fullThaw() {
 	tl.lock.Lock()
 	defer tl.lock.Unlock()
@@ -220,6 +273,12 @@ func wrapCmp(f func(a, b *peerRequestTask) bool) func(a, b pq.Elem) bool {
 }
 
 type activePartner struct {
+	id peer.ID
+
+	// bytesSent and bytesRecv mirror the partner's ledger, they are only
+	// modified under the peerRequestQueue's locks
+	bytesSent uint64
+	bytesRecv uint64
 
 	// Active is the number of blocks this peer is currently being sent
 	// active must be locked around as it will be updated externally
@@ -242,8 +301,9 @@ type activePartner struct {
 	taskQueue pq.PQ
 }
 
-func newActivePartner() *activePartner {
+func newActivePartner(p peer.ID) *activePartner {
 	return &activePartner{
+		id:           p,
 		taskQueue:    pq.New(wrapCmp(V1)),
 		activeBlocks: cid.NewSet(),
 	}
@@ -251,7 +311,7 @@ func newActivePartner() *activePartner {
 
 // partnerCompare implements pq.ElemComparator
 // returns true if peer 'a' has higher priority than peer 'b'
-func partnerCompare(a, b pq.Elem) bool {
+func (tl *prq) partnerCompare(a, b pq.Elem) bool {
 	pa := a.(*activePartner)
 	pb := b.(*activePartner)
 
@@ -264,6 +324,13 @@ func partnerCompare(a, b pq.Elem) bool {
 		return true
 	}
 
+	// partners that can't be served come right after those
+	sa, sb := pa.stats(), pb.stats()
+	serveA, serveB := tl.canServe(sa), tl.canServe(sb)
+	if serveA != serveB {
+		return serveA
+	}
+
 	if pa.freezeVal > pb.freezeVal {
 		return false
 	}
@@ -271,13 +338,18 @@ func partnerCompare(a, b pq.Elem) bool {
 		return true
 	}
 
-	if pa.active == pb.active {
-		// sorting by taskQueue.Len() aids in cleaning out trash entries faster
-		// if we sorted instead by requests, one peer could potentially build up
-		// a huge number of cancelled entries in the queue resulting in a memory leak
-		return pa.taskQueue.Len() > pb.taskQueue.Len()
+	return tl.strategy.Less(sa, sb)
+}
+
+// stats returns what the strategy needs to know about the partner
+func (p *activePartner) stats() *PartnerStats {
+	return &PartnerStats{
+		Peer:      p.id,
+		BytesSent: p.bytesSent,
+		BytesRecv: p.bytesRecv,
+		Active:    p.active,
+		Queued:    p.taskQueue.Len(),
 	}
-	return pa.active < pb.active
 }
 
 // StartTask signals that a task was started for this partner
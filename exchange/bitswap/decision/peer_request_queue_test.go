@@ -11,6 +11,7 @@ import (
 	"github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
 	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
 	"gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
 )
 
@@ -126,3 +127,60 @@ func TestPeerRepeats(t *testing.T) {
 		}
 	}
 }
+
+func TestPriorityPeersServedFirst(t *testing.T) {
+	a := testutil.RandPeerIDFatal(t)
+	b := testutil.RandPeerIDFatal(t)
+	prq := newPRQWithStrategy(PriorityPeersStrategy([]peer.ID{b}))
+
+	for i := 0; i < 3; i++ {
+		elcid := cid.NewCidV0(u.Hash([]byte(fmt.Sprint(i))))
+		prq.Push(&wantlist.Entry{Cid: elcid}, a)
+		prq.Push(&wantlist.Entry{Cid: elcid}, b)
+	}
+
+	for i := 0; i < 3; i++ {
+		if task := prq.Pop(); task.Target != b {
+			t.Fatal("expected priority peer to be served first")
+		}
+	}
+	if task := prq.Pop(); task.Target != a {
+		t.Fatal("expected other peer to be served last")
+	}
+}
+
+func TestDebtRatioStrategy(t *testing.T) {
+	a := testutil.RandPeerIDFatal(t)
+	b := testutil.RandPeerIDFatal(t)
+	prq := newPRQWithStrategy(DebtRatioStrategy(2, 100))
+
+	for i := 0; i < 2; i++ {
+		elcid := cid.NewCidV0(u.Hash([]byte(fmt.Sprint(i))))
+		prq.Push(&wantlist.Entry{Cid: elcid}, a)
+		prq.Push(&wantlist.Entry{Cid: elcid}, b)
+	}
+
+	// a owes us, b doesn't but is still within the grace allowance
+	prq.UpdateAccounting(a, 100, 1000)
+	prq.UpdateAccounting(b, 50, 0)
+	for i := 0; i < 2; i++ {
+		if task := prq.Pop(); task.Target != a {
+			t.Fatal("expected partner with the lowest debt ratio to be served first")
+		}
+	}
+	if task := prq.Pop(); task.Target != b {
+		t.Fatal("expected partner within the grace allowance to be served")
+	}
+
+	// b is now past the grace allowance without giving anything back
+	prq.UpdateAccounting(b, 1000, 0)
+	if task := prq.Pop(); task != nil {
+		t.Fatal("expected freeloading partner not to be served")
+	}
+
+	// once b reciprocates, it is served again
+	prq.UpdateAccounting(b, 1000, 1000)
+	if task := prq.Pop(); task == nil || task.Target != b {
+		t.Fatal("expected b to be served after reciprocating")
+	}
+}
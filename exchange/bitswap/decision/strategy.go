@@ -0,0 +1,118 @@
+package decision
+
+import (
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// PartnerStats is what a Strategy knows about a partner when deciding
+// whether, and in which order, to serve it.
+type PartnerStats struct {
+	Peer peer.ID
+
+	// BytesSent and BytesRecv are the bytes of blocks exchanged with the
+	// partner, as recorded in its ledger.
+	BytesSent uint64
+	BytesRecv uint64
+
+	// Active is the number of blocks currently being sent to the partner.
+	Active int
+
+	// Queued is the number of tasks waiting in the partner's queue.
+	Queued int
+}
+
+// DebtRatio returns the ratio of bytes we sent the partner to bytes it sent
+// us.
+func (ps *PartnerStats) DebtRatio() float64 {
+	return float64(ps.BytesSent) / float64(ps.BytesRecv+1)
+}
+
+// Strategy decides which partners the engine serves, and in which order.
+type Strategy interface {
+	// ShouldServe returns false if the partner's requests should be left
+	// queued rather than served.
+	ShouldServe(ps *PartnerStats) bool
+
+	// Less returns true if partner a should be served before partner b.
+	Less(a, b *PartnerStats) bool
+}
+
+// RoundRobin serves every partner in turn, preferring the ones with the
+// fewest blocks in flight. It is the default strategy.
+var RoundRobin Strategy = roundRobin{}
+
+type roundRobin struct{}
+
+func (roundRobin) ShouldServe(ps *PartnerStats) bool {
+	return true
+}
+
+func (roundRobin) Less(a, b *PartnerStats) bool {
+	if a.Active == b.Active {
+		// sorting by the queue length aids in cleaning out trash entries faster
+		// if we sorted instead by requests, one peer could potentially build up
+		// a huge number of cancelled entries in the queue resulting in a memory leak
+		return a.Queued > b.Queued
+	}
+	return a.Active < b.Active
+}
+
+// DebtRatioStrategy returns a Strategy that serves the partners we owe the
+// most first. Once a partner has been sent more than graceBytes, it is only
+// served while its debt ratio is at most maxRatio; a maxRatio of 0 never
+// denies anyone.
+func DebtRatioStrategy(maxRatio float64, graceBytes uint64) Strategy {
+	return &debtRatioStrategy{
+		maxRatio:   maxRatio,
+		graceBytes: graceBytes,
+	}
+}
+
+type debtRatioStrategy struct {
+	maxRatio   float64
+	graceBytes uint64
+}
+
+func (s *debtRatioStrategy) ShouldServe(ps *PartnerStats) bool {
+	if s.maxRatio <= 0 || ps.BytesSent <= s.graceBytes {
+		return true
+	}
+	return ps.DebtRatio() <= s.maxRatio
+}
+
+func (s *debtRatioStrategy) Less(a, b *PartnerStats) bool {
+	ra, rb := a.DebtRatio(), b.DebtRatio()
+	if ra == rb {
+		return RoundRobin.Less(a, b)
+	}
+	return ra < rb
+}
+
+// PriorityPeersStrategy returns a Strategy that serves the given peers
+// before everyone else. Partners within each group are served round robin.
+func PriorityPeersStrategy(peers []peer.ID) Strategy {
+	s := &priorityPeersStrategy{
+		peers: make(map[peer.ID]struct{}, len(peers)),
+	}
+	for _, p := range peers {
+		s.peers[p] = struct{}{}
+	}
+	return s
+}
+
+type priorityPeersStrategy struct {
+	peers map[peer.ID]struct{}
+}
+
+func (s *priorityPeersStrategy) ShouldServe(ps *PartnerStats) bool {
+	return true
+}
+
+func (s *priorityPeersStrategy) Less(a, b *PartnerStats) bool {
+	_, pa := s.peers[a.Peer]
+	_, pb := s.peers[b.Peer]
+	if pa != pb {
+		return pa
+	}
+	return RoundRobin.Less(a, b)
+}
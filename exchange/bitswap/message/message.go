@@ -25,11 +25,32 @@ type BitSwapMessage interface {
 	// Blocks returns a slice of unique blocks
 	Blocks() []blocks.Block
 
+	// BlockPresences returns the HAVE and DONT_HAVE responses in the
+	// message.
+	BlockPresences() []BlockPresence
+
+	// Haves returns the cids the sender told us it has.
+	Haves() []*cid.Cid
+
+	// DontHaves returns the cids the sender told us it does not have.
+	DontHaves() []*cid.Cid
+
 	// AddEntry adds an entry to the Wantlist.
 	AddEntry(key *cid.Cid, priority int)
 
+	// AddWant adds an entry of the given type to the Wantlist. If
+	// sendDontHave is set, the receiver replies with a DONT_HAVE when it does
+	// not have the block. Both are only understood by bitswap 1.2.0 peers.
+	AddWant(key *cid.Cid, priority int, wantType wantlist.WantType, sendDontHave bool)
+
 	Cancel(key *cid.Cid)
 
+	// AddHave tells the receiver we have the given block.
+	AddHave(key *cid.Cid)
+
+	// AddDontHave tells the receiver we do not have the given block.
+	AddDontHave(key *cid.Cid)
+
 	Empty() bool
 
 	// A full wantlist is an authoritative copy, a 'non-full' wantlist is a patch-set
@@ -44,14 +65,17 @@ type BitSwapMessage interface {
 type Exportable interface {
 	ToProtoV0() *pb.Message
 	ToProtoV1() *pb.Message
+	ToProtoV2() *pb.Message
 	ToNetV0(w io.Writer) error
 	ToNetV1(w io.Writer) error
+	ToNetV2(w io.Writer) error
 }
 
 type impl struct {
-	full     bool
-	wantlist map[string]*Entry
-	blocks   map[string]blocks.Block
+	full      bool
+	wantlist  map[string]*Entry
+	blocks    map[string]blocks.Block
+	presences map[string]BlockPresence
 }
 
 func New(full bool) BitSwapMessage {
@@ -60,9 +84,10 @@ func New(full bool) BitSwapMessage {
 
 func newMsg(full bool) *impl {
 	return &impl{
-		blocks:   make(map[string]blocks.Block),
-		wantlist: make(map[string]*Entry),
-		full:     full,
+		blocks:    make(map[string]blocks.Block),
+		wantlist:  make(map[string]*Entry),
+		presences: make(map[string]BlockPresence),
+		full:      full,
 	}
 }
 
@@ -71,6 +96,12 @@ type Entry struct {
 	Cancel bool
 }
 
+// BlockPresence tells whether the sender of a message has a block.
+type BlockPresence struct {
+	Cid  *cid.Cid
+	Have bool
+}
+
 func newMessageFromProto(pbm pb.Message) (BitSwapMessage, error) {
 	m := newMsg(pbm.GetWantlist().GetFull())
 	for _, e := range pbm.GetWantlist().GetEntries() {
@@ -78,7 +109,11 @@ func newMessageFromProto(pbm pb.Message) (BitSwapMessage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("incorrectly formatted cid in wantlist: %s", err)
 		}
-		m.addEntry(c, int(e.GetPriority()), e.GetCancel())
+		wt := wantlist.WantBlock
+		if e.GetWantType() == pb.Message_Wantlist_Have {
+			wt = wantlist.WantHave
+		}
+		m.addEntry(c, int(e.GetPriority()), e.GetCancel(), wt, e.GetSendDontHave())
 	}
 
 	// deprecated
@@ -108,6 +143,14 @@ func newMessageFromProto(pbm pb.Message) (BitSwapMessage, error) {
 		m.AddBlock(blk)
 	}
 
+	for _, bp := range pbm.GetBlockPresences() {
+		c, err := cid.Cast(bp.GetCid())
+		if err != nil {
+			return nil, fmt.Errorf("incorrectly formatted cid in block presence: %s", err)
+		}
+		m.addBlockPresence(c, bp.GetType() == pb.Message_Have)
+	}
+
 	return m, nil
 }
 
@@ -116,7 +159,7 @@ func (m *impl) Full() bool {
 }
 
 func (m *impl) Empty() bool {
-	return len(m.blocks) == 0 && len(m.wantlist) == 0
+	return len(m.blocks) == 0 && len(m.wantlist) == 0 && len(m.presences) == 0
 }
 
 func (m *impl) Wantlist() []Entry {
@@ -135,32 +178,78 @@ func (m *impl) Blocks() []blocks.Block {
 	return bs
 }
 
+func (m *impl) BlockPresences() []BlockPresence {
+	out := make([]BlockPresence, 0, len(m.presences))
+	for _, bp := range m.presences {
+		out = append(out, bp)
+	}
+	return out
+}
+
+func (m *impl) Haves() []*cid.Cid {
+	return m.presencesOfType(true)
+}
+
+func (m *impl) DontHaves() []*cid.Cid {
+	return m.presencesOfType(false)
+}
+
+func (m *impl) presencesOfType(have bool) []*cid.Cid {
+	var out []*cid.Cid
+	for _, bp := range m.presences {
+		if bp.Have == have {
+			out = append(out, bp.Cid)
+		}
+	}
+	return out
+}
+
 func (m *impl) Cancel(k *cid.Cid) {
 	delete(m.wantlist, k.KeyString())
-	m.addEntry(k, 0, true)
+	m.addEntry(k, 0, true, wantlist.WantBlock, false)
 }
 
 func (m *impl) AddEntry(k *cid.Cid, priority int) {
-	m.addEntry(k, priority, false)
+	m.addEntry(k, priority, false, wantlist.WantBlock, false)
+}
+
+func (m *impl) AddWant(k *cid.Cid, priority int, wantType wantlist.WantType, sendDontHave bool) {
+	m.addEntry(k, priority, false, wantType, sendDontHave)
 }
 
-func (m *impl) addEntry(c *cid.Cid, priority int, cancel bool) {
+func (m *impl) addEntry(c *cid.Cid, priority int, cancel bool, wantType wantlist.WantType, sendDontHave bool) {
 	k := c.KeyString()
 	e, exists := m.wantlist[k]
 	if exists {
 		e.Priority = priority
 		e.Cancel = cancel
+		e.WantType = wantType
+		e.SendDontHave = sendDontHave
 	} else {
 		m.wantlist[k] = &Entry{
 			Entry: &wantlist.Entry{
-				Cid:      c,
-				Priority: priority,
+				Cid:          c,
+				Priority:     priority,
+				WantType:     wantType,
+				SendDontHave: sendDontHave,
 			},
 			Cancel: cancel,
 		}
 	}
 }
 
+func (m *impl) AddHave(k *cid.Cid) {
+	m.addBlockPresence(k, true)
+}
+
+func (m *impl) AddDontHave(k *cid.Cid) {
+	m.addBlockPresence(k, false)
+}
+
+func (m *impl) addBlockPresence(c *cid.Cid, have bool) {
+	m.presences[c.KeyString()] = BlockPresence{Cid: c, Have: have}
+}
+
 func (m *impl) AddBlock(b blocks.Block) {
 	m.blocks[b.Cid().KeyString()] = b
 }
@@ -200,6 +289,9 @@ func (m *impl) ToProtoV0() *pb.Message {
 	return pbm
 }
 
+// ToProtoV1 encodes the message for bitswap 1.1.0 peers. These don't know
+// about want types or block presences: want-haves are sent as plain wants and
+// presences are dropped.
 func (m *impl) ToProtoV1() *pb.Message {
 	pbm := new(pb.Message)
 	pbm.Wantlist = new(pb.Message_Wantlist)
@@ -225,6 +317,34 @@ func (m *impl) ToProtoV1() *pb.Message {
 	return pbm
 }
 
+// ToProtoV2 encodes the message for bitswap 1.2.0 peers, which also
+// understand want types and block presences.
+func (m *impl) ToProtoV2() *pb.Message {
+	pbm := m.ToProtoV1()
+	for _, e := range pbm.Wantlist.Entries {
+		me := m.wantlist[e.GetBlock()]
+		if me.WantType == wantlist.WantHave {
+			e.WantType = pb.Message_Wantlist_Have.Enum()
+		}
+		if me.SendDontHave {
+			e.SendDontHave = proto.Bool(true)
+		}
+	}
+
+	pbm.BlockPresences = make([]*pb.Message_BlockPresence, 0, len(m.presences))
+	for _, bp := range m.presences {
+		t := pb.Message_DontHave
+		if bp.Have {
+			t = pb.Message_Have
+		}
+		pbm.BlockPresences = append(pbm.BlockPresences, &pb.Message_BlockPresence{
+			Cid:  bp.Cid.Bytes(),
+			Type: t.Enum(),
+		})
+	}
+	return pbm
+}
+
 func (m *impl) ToNetV0(w io.Writer) error {
 	pbw := ggio.NewDelimitedWriter(w)
 
@@ -237,13 +357,20 @@ func (m *impl) ToNetV1(w io.Writer) error {
 	return pbw.WriteMsg(m.ToProtoV1())
 }
 
+func (m *impl) ToNetV2(w io.Writer) error {
+	pbw := ggio.NewDelimitedWriter(w)
+
+	return pbw.WriteMsg(m.ToProtoV2())
+}
+
 func (m *impl) Loggable() map[string]interface{} {
 	blocks := make([]string, 0, len(m.blocks))
 	for _, v := range m.blocks {
 		blocks = append(blocks, v.Cid().String())
 	}
 	return map[string]interface{}{
-		"blocks": blocks,
-		"wants":  m.Wantlist(),
+		"blocks":    blocks,
+		"wants":     m.Wantlist(),
+		"presences": m.BlockPresences(),
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	pb "github.com/ipfs/go-ipfs/exchange/bitswap/message/pb"
+	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
 
 	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
 	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
@@ -164,6 +165,60 @@ func TestToAndFromNetMessage(t *testing.T) {
 	}
 }
 
+func TestToNetFromNetPreservesPresences(t *testing.T) {
+	original := New(false)
+	original.AddWant(mkFakeCid("have"), 1, wantlist.WantHave, true)
+	original.AddWant(mkFakeCid("block"), 1, wantlist.WantBlock, true)
+	original.AddHave(mkFakeCid("H"))
+	original.AddDontHave(mkFakeCid("D"))
+
+	buf := new(bytes.Buffer)
+	if err := original.ToNetV2(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := FromNet(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range copied.Wantlist() {
+		if !e.SendDontHave {
+			t.Fatalf("send-dont-have flag got dropped for %s", e.Cid)
+		}
+		if e.Cid.Equals(mkFakeCid("have")) != (e.WantType == wantlist.WantHave) {
+			t.Fatalf("wrong want type for %s", e.Cid)
+		}
+	}
+
+	haves, dontHaves := copied.Haves(), copied.DontHaves()
+	if len(haves) != 1 || !haves[0].Equals(mkFakeCid("H")) {
+		t.Fatalf("unexpected haves: %s", haves)
+	}
+	if len(dontHaves) != 1 || !dontHaves[0].Equals(mkFakeCid("D")) {
+		t.Fatalf("unexpected dont haves: %s", dontHaves)
+	}
+}
+
+func TestToProtoV1DropsPresences(t *testing.T) {
+	m := New(false)
+	m.AddWant(mkFakeCid("have"), 1, wantlist.WantHave, true)
+	m.AddHave(mkFakeCid("H"))
+
+	pbm := m.ToProtoV1()
+	if len(pbm.GetBlockPresences()) != 0 {
+		t.Fatal("block presences must not be sent to bitswap 1.1.0 peers")
+	}
+	for _, e := range pbm.GetWantlist().GetEntries() {
+		if e.WantType != nil || e.SendDontHave != nil {
+			t.Fatal("want types must not be sent to bitswap 1.1.0 peers")
+		}
+	}
+	if !wantlistContains(pbm.GetWantlist(), mkFakeCid("have")) {
+		t.Fatal("want-have should be sent as a plain want")
+	}
+}
+
 func wantlistContains(wantlist *pb.Message_Wantlist, c *cid.Cid) bool {
 	for _, e := range wantlist.GetEntries() {
 		if e.GetBlock() == c.KeyString() {
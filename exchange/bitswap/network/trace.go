@@ -0,0 +1,57 @@
+package network
+
+import (
+	"context"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// Tracer is told about every message bitswap exchanges with its peers. It
+// must not modify the messages.
+type Tracer interface {
+	MessageReceived(from peer.ID, m bsmsg.BitSwapMessage)
+	MessageSent(to peer.ID, m bsmsg.BitSwapMessage)
+}
+
+// NewTracingNetwork wraps a BitSwapNetwork so that the messages successfully
+// sent over it are reported to t.
+func NewTracingNetwork(n BitSwapNetwork, t Tracer) BitSwapNetwork {
+	return &tracingNetwork{BitSwapNetwork: n, tracer: t}
+}
+
+type tracingNetwork struct {
+	BitSwapNetwork
+	tracer Tracer
+}
+
+func (tn *tracingNetwork) SendMessage(ctx context.Context, p peer.ID, m bsmsg.BitSwapMessage) error {
+	if err := tn.BitSwapNetwork.SendMessage(ctx, p, m); err != nil {
+		return err
+	}
+	tn.tracer.MessageSent(p, m)
+	return nil
+}
+
+func (tn *tracingNetwork) NewMessageSender(ctx context.Context, p peer.ID) (MessageSender, error) {
+	ms, err := tn.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &tracingMessageSender{MessageSender: ms, to: p, tracer: tn.tracer}, nil
+}
+
+type tracingMessageSender struct {
+	MessageSender
+	to     peer.ID
+	tracer Tracer
+}
+
+func (ms *tracingMessageSender) SendMsg(ctx context.Context, m bsmsg.BitSwapMessage) error {
+	if err := ms.MessageSender.SendMsg(ctx, m); err != nil {
+		return err
+	}
+	ms.tracer.MessageSent(ms.to, m)
+	return nil
+}
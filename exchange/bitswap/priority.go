@@ -0,0 +1,94 @@
+package bitswap
+
+import (
+	"context"
+	"fmt"
+)
+
+// PriorityClass tells bitswap how urgently blocks are needed. Peers serve
+// our wants of a higher class before those of a lower one.
+type PriorityClass int
+
+const (
+	// PriorityBackground is for fetches nobody is waiting on, like pinning
+	PriorityBackground PriorityClass = iota
+	// PriorityNormal is used when no class is given
+	PriorityNormal
+	// PriorityInteractive is for reads a user is waiting on
+	PriorityInteractive
+)
+
+// priorityBand is the range of wantlist priorities of each class. Within a
+// class, the wants of a batch are prioritized in the order they were asked
+// for.
+const priorityBand = kMaxPriority / 3
+
+func (pc PriorityClass) String() string {
+	switch pc {
+	case PriorityBackground:
+		return "background"
+	case PriorityNormal:
+		return "normal"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return fmt.Sprintf("PriorityClass(%d)", int(pc))
+	}
+}
+
+// ParsePriorityClass parses the name of a priority class.
+func ParsePriorityClass(s string) (PriorityClass, error) {
+	switch s {
+	case "background":
+		return PriorityBackground, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "interactive":
+		return PriorityInteractive, nil
+	default:
+		return 0, fmt.Errorf("unknown priority class %q, must be one of background, normal or interactive", s)
+	}
+}
+
+// PriorityClassOf returns the class a wantlist priority falls into.
+func PriorityClassOf(priority int) PriorityClass {
+	switch {
+	case priority > kMaxPriority-priorityBand:
+		return PriorityInteractive
+	case priority > kMaxPriority-2*priorityBand:
+		return PriorityNormal
+	default:
+		return PriorityBackground
+	}
+}
+
+type priorityKey struct{}
+
+// ContextWithPriority makes the blocks requested with the returned context,
+// including through sessions created with it, wanted with the given priority
+// class.
+func ContextWithPriority(ctx context.Context, pc PriorityClass) context.Context {
+	return context.WithValue(ctx, priorityKey{}, pc)
+}
+
+func priorityFromContext(ctx context.Context) PriorityClass {
+	pc, ok := ctx.Value(priorityKey{}).(PriorityClass)
+	if !ok {
+		return PriorityNormal
+	}
+	return pc
+}
+
+// wantPriority returns the wantlist priority of the i-th want of a batch
+// requested with the given class.
+func wantPriority(pc PriorityClass, i int) int {
+	if pc < PriorityBackground {
+		pc = PriorityBackground
+	} else if pc > PriorityInteractive {
+		pc = PriorityInteractive
+	}
+	if i >= priorityBand {
+		i = priorityBand - 1
+	}
+	return kMaxPriority - int(PriorityInteractive-pc)*priorityBand - i
+}
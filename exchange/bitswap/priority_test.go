@@ -0,0 +1,48 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWantPriorityClasses(t *testing.T) {
+	classes := []PriorityClass{PriorityBackground, PriorityNormal, PriorityInteractive}
+
+	for i, pc := range classes {
+		first, last := wantPriority(pc, 0), wantPriority(pc, 1000)
+		if first <= last {
+			t.Fatalf("%s: wants should be prioritized in order, got %d then %d", pc, first, last)
+		}
+		if PriorityClassOf(first) != pc || PriorityClassOf(last) != pc {
+			t.Fatalf("%s: priorities %d and %d fall into the wrong class", pc, first, last)
+		}
+		if i > 0 && wantPriority(classes[i-1], 0) >= last {
+			t.Fatalf("%s wants should all come before %s wants", pc, classes[i-1])
+		}
+	}
+
+	if wantPriority(PriorityInteractive, 0) != kMaxPriority {
+		t.Fatal("the first interactive want should have the highest priority")
+	}
+	if p := wantPriority(PriorityBackground, kMaxPriority); p <= 0 || PriorityClassOf(p) != PriorityBackground {
+		t.Fatalf("huge batches should stay within their class, got %d", p)
+	}
+
+	if pc := priorityFromContext(context.Background()); pc != PriorityNormal {
+		t.Fatalf("expected wants to be normal by default, got %s", pc)
+	}
+	ctx := ContextWithPriority(context.Background(), PriorityInteractive)
+	if pc := priorityFromContext(ctx); pc != PriorityInteractive {
+		t.Fatalf("expected the context's priority class, got %s", pc)
+	}
+
+	for _, pc := range classes {
+		parsed, err := ParsePriorityClass(pc.String())
+		if err != nil || parsed != pc {
+			t.Fatalf("couldn't parse %s: %v", pc, err)
+		}
+	}
+	if _, err := ParsePriorityClass("urgent"); err == nil {
+		t.Fatal("expected an error parsing an unknown class")
+	}
+}
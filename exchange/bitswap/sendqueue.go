@@ -0,0 +1,64 @@
+package bitswap
+
+import (
+	"context"
+	"sync"
+
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// peerSendQueues sends the blocks for each peer, in order, from a goroutine
+// of its own, so that a peer waiting for its bandwidth allowance doesn't hold
+// up the task workers and, with them, every other peer.
+//
+// The envelopes queued for a peer are only marked sent once they are, so the
+// decision engine keeps counting them as active and serves that peer after
+// the others. The engine hands out at most sendQueueSize of them per peer,
+// which bounds the blocks held in a queue.
+type peerSendQueues struct {
+	send func(context.Context, *decision.Envelope)
+
+	lk sync.Mutex
+	// queues holds the envelopes waiting for each peer; a peer has an entry
+	// exactly while its goroutine runs
+	queues map[peer.ID][]*decision.Envelope
+}
+
+func newPeerSendQueues(send func(context.Context, *decision.Envelope)) *peerSendQueues {
+	return &peerSendQueues{
+		send:   send,
+		queues: make(map[peer.ID][]*decision.Envelope),
+	}
+}
+
+// push queues env to be sent to its peer.
+func (sq *peerSendQueues) push(ctx context.Context, env *decision.Envelope) {
+	sq.lk.Lock()
+	q, running := sq.queues[env.Peer]
+	sq.queues[env.Peer] = append(q, env)
+	sq.lk.Unlock()
+
+	if !running {
+		go sq.run(ctx, env.Peer)
+	}
+}
+
+func (sq *peerSendQueues) run(ctx context.Context, p peer.ID) {
+	for {
+		sq.lk.Lock()
+		q := sq.queues[p]
+		if len(q) == 0 {
+			delete(sq.queues, p)
+			sq.lk.Unlock()
+			return
+		}
+		env := q[0]
+		q[0] = nil
+		sq.queues[p] = q[1:]
+		sq.lk.Unlock()
+
+		sq.send(ctx, env)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 	notifications "github.com/ipfs/go-ipfs/exchange/bitswap/notifications"
 
 	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
@@ -28,19 +29,36 @@ type Session struct {
 
 	bs           *Bitswap
 	incoming     chan blkRecv
+	presences    chan presenceRecv
 	newReqs      chan []*cid.Cid
 	cancelKeys   chan []*cid.Cid
 	interestReqs chan interestReq
+	statReqs     chan chan *SessionStat
+	newpeers     chan peer.ID
 
-	interest  *lru.Cache
-	liveWants map[string]time.Time
+	interest      *lru.Cache
+	liveWants     map[string]time.Time
+	wantPresences map[string]*wantPresence
+	sentWants     map[string]*sentWant
+
+	// scores rates how well each peer served this session, and splitOffset
+	// rotates want-blocks among the best of them
+	scores      map[peer.ID]*peerScore
+	splitOffset int
 
 	tick          *time.Timer
 	baseTickDelay time.Duration
+	// timeouts counts the ticks since we last received a block
+	timeouts int
 
 	latTotal time.Duration
 	fetchcnt int
 
+	// dupBlocks and dupData count the blocks that arrived after the session
+	// already received them
+	dupBlocks uint64
+	dupData   uint64
+
 	notif notifications.PubSub
 
 	uuid logging.Loggable
@@ -55,13 +73,19 @@ func (bs *Bitswap) NewSession(ctx context.Context) *Session {
 	s := &Session{
 		activePeers:   make(map[peer.ID]struct{}),
 		liveWants:     make(map[string]time.Time),
+		wantPresences: make(map[string]*wantPresence),
+		sentWants:     make(map[string]*sentWant),
+		scores:        make(map[peer.ID]*peerScore),
 		newReqs:       make(chan []*cid.Cid),
 		cancelKeys:    make(chan []*cid.Cid),
 		tofetch:       newCidQueue(),
 		interestReqs:  make(chan interestReq),
+		statReqs:      make(chan chan *SessionStat),
 		ctx:           ctx,
 		bs:            bs,
 		incoming:      make(chan blkRecv),
+		presences:     make(chan presenceRecv),
+		newpeers:      make(chan peer.ID, 16),
 		notif:         notifications.New(),
 		uuid:          loggables.Uuid("GetBlockRequest"),
 		baseTickDelay: time.Millisecond * 500,
@@ -115,6 +139,34 @@ func (s *Session) receiveBlockFrom(from peer.ID, blk blocks.Block) {
 	}
 }
 
+type presenceRecv struct {
+	from peer.ID
+	bp   bsmsg.BlockPresence
+}
+
+func (s *Session) receivePresenceFrom(from peer.ID, bp bsmsg.BlockPresence) {
+	select {
+	case s.presences <- presenceRecv{from: from, bp: bp}:
+	case <-s.ctx.Done():
+	}
+}
+
+// wantPresence tracks what peers told the session about one of its live
+// wants.
+type wantPresence struct {
+	// asked is the peer we sent a want-block to after it said it has the
+	// block.
+	asked peer.ID
+	// haves are the other peers that said they have the block, in the order
+	// they told us.
+	haves []peer.ID
+	// dontHaves are the peers that said they don't have the block.
+	dontHaves map[peer.ID]struct{}
+	// searched is set once we looked for providers because nobody we asked
+	// has the block.
+	searched bool
+}
+
 type interestReq struct {
 	c    *cid.Cid
 	resp chan bool
@@ -162,18 +214,20 @@ func (s *Session) addActivePeer(p peer.ID) {
 	}
 }
 
+// resetTick schedules the next rebroadcast of the live wants. Once we know
+// how long blocks take to arrive, the delay doubles with every tick that
+// passes without receiving one, so underperforming peers aren't flooded.
 func (s *Session) resetTick() {
 	if s.latTotal == 0 {
 		s.tick.Reset(provSearchDelay)
 	} else {
 		avLat := s.latTotal / time.Duration(s.fetchcnt)
-		s.tick.Reset(s.baseTickDelay + (3 * avLat))
+		s.tick.Reset((s.baseTickDelay + (3 * avLat)) << backoffShift(s.timeouts))
 	}
 }
 
 func (s *Session) run(ctx context.Context) {
 	s.tick = time.NewTimer(provSearchDelay)
-	newpeers := make(chan peer.ID, 16)
 	for {
 		select {
 		case blk := <-s.incoming:
@@ -183,9 +237,11 @@ func (s *Session) run(ctx context.Context) {
 				s.addActivePeer(blk.from)
 			}
 
-			s.receiveBlock(ctx, blk.blk)
+			s.receiveBlock(ctx, blk.from, blk.blk)
 
 			s.resetTick()
+		case pr := <-s.presences:
+			s.receivePresence(ctx, pr.from, pr.bp)
 		case keys := <-s.newReqs:
 			for _, k := range keys {
 				s.interest.Add(k.KeyString(), nil)
@@ -216,26 +272,26 @@ func (s *Session) run(ctx context.Context) {
 				s.liveWants[c] = now
 			}
 
-			// Broadcast these keys to everyone we're connected to
-			s.bs.wm.WantBlocks(ctx, live, nil, s.id)
+			// Ask everyone we're connected to whether they have these keys,
+			// forgetting what we were told before as it didn't get us the
+			// blocks in time
+			s.wantsTimedOut(now)
+			if len(live) > 0 {
+				s.timeouts++
+			}
+			s.wantPresences = make(map[string]*wantPresence)
+			s.bs.wm.WantHaves(ctx, live, nil, s.id)
 
 			if len(live) > 0 {
-				go func(k *cid.Cid) {
-					// TODO: have a task queue setup for this to:
-					// - rate limit
-					// - manage timeouts
-					// - ensure two 'findprovs' calls for the same block don't run concurrently
-					// - share peers between sessions based on interest set
-					for p := range s.bs.network.FindProvidersAsync(ctx, k, 10) {
-						newpeers <- p
-					}
-				}(live[0])
+				s.findMorePeers(ctx, live[0])
 			}
 			s.resetTick()
-		case p := <-newpeers:
+		case p := <-s.newpeers:
 			s.addActivePeer(p)
 		case lwchk := <-s.interestReqs:
 			lwchk.resp <- s.cidIsWanted(lwchk.c)
+		case resp := <-s.statReqs:
+			resp <- s.makeStat()
 		case <-ctx.Done():
 			s.tick.Stop()
 			s.bs.removeSession(s)
@@ -249,6 +305,106 @@ func (s *Session) run(ctx context.Context) {
 	}
 }
 
+func (s *Session) findMorePeers(ctx context.Context, k *cid.Cid) {
+	go func() {
+		// TODO: have a task queue setup for this to:
+		// - rate limit
+		// - manage timeouts
+		// - ensure two 'findprovs' calls for the same block don't run concurrently
+		// - share peers between sessions based on interest set
+		for p := range s.bs.network.FindProvidersAsync(ctx, k, 10) {
+			select {
+			case s.newpeers <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// receivePresence handles a HAVE or DONT_HAVE for one of our live wants. The
+// block is requested from the first peer that has it, falling back to the
+// next one if that peer turns out not to have it after all. When all the
+// peers a want-block was split to don't have the block, or are bitswap 1.1.0
+// peers which never say so, the next best peer is asked, and once every peer
+// said it doesn't have the block, we look for providers right away instead
+// of waiting for the tick.
+func (s *Session) receivePresence(ctx context.Context, from peer.ID, bp bsmsg.BlockPresence) {
+	ks := bp.Cid.KeyString()
+	if _, ok := s.liveWants[ks]; !ok {
+		return
+	}
+	s.score(from).presence = true
+
+	wp, ok := s.wantPresences[ks]
+	if !ok {
+		wp = &wantPresence{dontHaves: make(map[peer.ID]struct{})}
+		s.wantPresences[ks] = wp
+	}
+
+	if bp.Have {
+		s.addActivePeer(from)
+		delete(wp.dontHaves, from)
+		switch wp.asked {
+		case "":
+			wp.asked = from
+			s.recordSent(bp.Cid, from, time.Now())
+			s.bs.wm.WantBlocksOrDontHave(ctx, []*cid.Cid{bp.Cid}, []peer.ID{from}, s.id)
+		case from:
+		default:
+			wp.haves = append(wp.haves, from)
+		}
+		return
+	}
+
+	wp.dontHaves[from] = struct{}{}
+	if wp.asked == from {
+		wp.asked = ""
+		for len(wp.haves) > 0 && wp.asked == "" {
+			p := wp.haves[0]
+			wp.haves = wp.haves[1:]
+			if _, no := wp.dontHaves[p]; no {
+				continue
+			}
+			wp.asked = p
+			s.recordSent(bp.Cid, p, time.Now())
+			s.bs.wm.WantBlocksOrDontHave(ctx, []*cid.Cid{bp.Cid}, []peer.ID{p}, s.id)
+		}
+	}
+
+	if wp.asked != "" || s.widenWant(ctx, bp.Cid, wp) {
+		return
+	}
+
+	if !wp.searched && s.nobodyHas(wp) {
+		wp.searched = true
+		s.findMorePeers(ctx, bp.Cid)
+	}
+}
+
+// nobodyHas returns true if all the peers a want was sent to said they don't
+// have the block, leaving out those that never sent us a HAVE or DONT_HAVE.
+// Wants go to the active peers, or to everyone we're connected to if there
+// are none.
+func (s *Session) nobodyHas(wp *wantPresence) bool {
+	asked := s.activePeersArr
+	if len(asked) == 0 {
+		asked = s.bs.wm.ConnectedPeers()
+	}
+	if len(asked) == 0 {
+		return false
+	}
+	for _, p := range asked {
+		if ps, ok := s.scores[p]; !ok || !ps.presence {
+			continue
+		}
+		if _, ok := wp.dontHaves[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Session) cidIsWanted(c *cid.Cid) bool {
 	_, ok := s.liveWants[c.KeyString()]
 	if !ok {
@@ -258,14 +414,25 @@ func (s *Session) cidIsWanted(c *cid.Cid) bool {
 	return ok
 }
 
-func (s *Session) receiveBlock(ctx context.Context, blk blocks.Block) {
+func (s *Session) receiveBlock(ctx context.Context, from peer.ID, blk blocks.Block) {
 	c := blk.Cid()
 	if s.cidIsWanted(c) {
 		ks := c.KeyString()
 		tval, ok := s.liveWants[ks]
 		if ok {
 			s.latTotal += time.Since(tval)
+			if from != "" {
+				if sw, ok := s.sentWants[ks]; ok {
+					if at, ok := sw.peers[from]; ok {
+						tval = at
+					}
+				}
+				s.score(from).receivedBlock(time.Since(tval), len(blk.RawData()))
+			}
+			s.timeouts = 0
 			delete(s.liveWants, ks)
+			delete(s.wantPresences, ks)
+			delete(s.sentWants, ks)
 		} else {
 			s.tofetch.Remove(c)
 		}
@@ -275,6 +442,12 @@ func (s *Session) receiveBlock(ctx context.Context, blk blocks.Block) {
 		if next := s.tofetch.Pop(); next != nil {
 			s.wantBlocks(ctx, []*cid.Cid{next})
 		}
+	} else if from != "" && s.interest.Contains(c.KeyString()) {
+		// we asked for this block and it already arrived
+		size := len(blk.RawData())
+		s.dupBlocks++
+		s.dupData += uint64(size)
+		s.score(from).receivedDuplicate(size)
 	}
 }
 
@@ -283,7 +456,12 @@ func (s *Session) wantBlocks(ctx context.Context, ks []*cid.Cid) {
 	for _, c := range ks {
 		s.liveWants[c.KeyString()] = now
 	}
-	s.bs.wm.WantBlocks(ctx, ks, s.activePeersArr, s.id)
+	if len(s.activePeersArr) == 0 {
+		// we don't know who has these yet, ask around first
+		s.bs.wm.WantHaves(ctx, ks, nil, s.id)
+		return
+	}
+	s.splitWants(ctx, ks, now)
 }
 
 func (s *Session) cancel(keys []*cid.Cid) {
@@ -312,6 +490,7 @@ func (s *Session) fetch(ctx context.Context, keys []*cid.Cid) {
 // guaranteed on the returned blocks.
 func (s *Session) GetBlocks(ctx context.Context, keys []*cid.Cid) (<-chan blocks.Block, error) {
 	ctx = logging.ContextWithLoggable(ctx, s.uuid)
+	s.bs.persistWants(ctx, keys)
 	return getBlocksImpl(ctx, keys, s.notif, s.fetch, s.cancelWants)
 }
 
@@ -0,0 +1,278 @@
+package bitswap
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+const (
+	// wantSplitFactor is how many peers each want-block is sent to
+	wantSplitFactor = 2
+
+	// maxSplitPeers is how many of the best peers a session spreads its
+	// want-blocks over
+	maxSplitPeers = 4
+
+	// scoreAlpha is the weight of the latest sample in a peer's moving
+	// averages
+	scoreAlpha = 0.3
+
+	// maxBackoffShift bounds how many times a delay is doubled when peers
+	// keep failing to answer
+	maxBackoffShift = 4
+
+	// dupThreshold is how many duplicate blocks a peer may send a session
+	// before it is no longer sent redundant want-blocks
+	dupThreshold = 4
+)
+
+// peerScore tracks how well a peer has been serving the blocks a session
+// asked it for.
+type peerScore struct {
+	// latency is a moving average of the time between asking the peer for a
+	// block and receiving it
+	latency time.Duration
+	// throughput is a moving average of the bytes per second blocks arrive
+	// at from the peer
+	throughput float64
+	// received is the number of blocks the peer sent us
+	received int
+	// timeouts is the number of times the peer failed to send a block in
+	// time since it last sent one
+	timeouts int
+	// presence is set once the peer sent us a HAVE or DONT_HAVE, which only
+	// bitswap 1.2.0 peers do. Others never tell us they don't have a block.
+	presence bool
+	// dups and dupBytes count the blocks the peer sent us after they
+	// already arrived
+	dups     int
+	dupBytes uint64
+}
+
+func (ps *peerScore) receivedBlock(lat time.Duration, size int) {
+	if lat <= 0 {
+		lat = time.Microsecond
+	}
+	tp := float64(size) / lat.Seconds()
+	if ps.received == 0 {
+		ps.latency = lat
+		ps.throughput = tp
+	} else {
+		ps.latency = time.Duration(scoreAlpha*float64(lat) + (1-scoreAlpha)*float64(ps.latency))
+		ps.throughput = scoreAlpha*tp + (1-scoreAlpha)*ps.throughput
+	}
+	ps.received++
+	ps.timeouts = 0
+}
+
+func (ps *peerScore) timedOut() {
+	ps.timeouts++
+}
+
+func (ps *peerScore) receivedDuplicate(size int) {
+	ps.dups++
+	ps.dupBytes += uint64(size)
+}
+
+// wasteful returns true if the peer sent us more duplicates than useful
+// blocks, which happens when it keeps losing the race against the other
+// peers a want-block was split to.
+func (ps *peerScore) wasteful() bool {
+	return ps.dups >= dupThreshold && ps.dups > ps.received
+}
+
+// expectedLatency estimates how long the peer takes to send a block. Peers
+// we haven't received anything from yet are assumed to take unmeasured, and
+// the estimate doubles every time the peer failed to answer in time.
+func (ps *peerScore) expectedLatency(unmeasured time.Duration) time.Duration {
+	lat := ps.latency
+	if ps.received == 0 {
+		lat = unmeasured
+	}
+	return lat << backoffShift(ps.timeouts)
+}
+
+func backoffShift(n int) uint {
+	if n > maxBackoffShift {
+		n = maxBackoffShift
+	}
+	return uint(n)
+}
+
+// sentWant records which peers a want-block was sent to, and when.
+type sentWant struct {
+	peers map[peer.ID]time.Time
+}
+
+func (s *Session) score(p peer.ID) *peerScore {
+	ps, ok := s.scores[p]
+	if !ok {
+		ps = new(peerScore)
+		s.scores[p] = ps
+	}
+	return ps
+}
+
+func (s *Session) averageLatency() time.Duration {
+	if s.fetchcnt == 0 {
+		return 0
+	}
+	return s.latTotal / time.Duration(s.fetchcnt)
+}
+
+// rankedPeers returns the session's active peers, fastest first. Peers with
+// the same expected latency are ordered by throughput.
+func (s *Session) rankedPeers() []peer.ID {
+	avg := s.averageLatency()
+	peers := make([]peer.ID, len(s.activePeersArr))
+	copy(peers, s.activePeersArr)
+	sort.SliceStable(peers, func(i, j int) bool {
+		a, b := s.score(peers[i]), s.score(peers[j])
+		la, lb := a.expectedLatency(avg), b.expectedLatency(avg)
+		if la != lb {
+			return la < lb
+		}
+		return a.throughput > b.throughput
+	})
+	return peers
+}
+
+// recordSent notes that a want-block for c was sent to p.
+func (s *Session) recordSent(c *cid.Cid, p peer.ID, at time.Time) {
+	ks := c.KeyString()
+	sw, ok := s.sentWants[ks]
+	if !ok {
+		sw = &sentWant{peers: make(map[peer.ID]time.Time)}
+		s.sentWants[ks] = sw
+	}
+	sw.peers[p] = at
+}
+
+// splitWants sends each want-block to wantSplitFactor peers that will tell
+// us if they don't have the block, taking turns among the best maxSplitPeers
+// peers so that no single peer is asked for everything.
+func (s *Session) splitWants(ctx context.Context, ks []*cid.Cid, now time.Time) {
+	top := s.rankedPeers()
+	if len(top) > maxSplitPeers {
+		top = top[:maxSplitPeers]
+	}
+	split := wantSplitFactor
+	if split > len(top) {
+		split = len(top)
+	}
+
+	byPeer := make(map[peer.ID][]*cid.Cid)
+	for i, c := range ks {
+		for _, p := range s.wantTargets(top, s.splitOffset+i, split) {
+			byPeer[p] = append(byPeer[p], c)
+			s.recordSent(c, p, now)
+		}
+	}
+	s.splitOffset += len(ks)
+
+	for p, cs := range byPeer {
+		s.bs.wm.WantBlocksOrDontHave(ctx, cs, []peer.ID{p}, s.id)
+	}
+}
+
+// wantTargets picks peers from top, starting at first, to send a want-block
+// to, until split of them are peers that will say if they don't have the
+// block. Peers that haven't shown they speak bitswap 1.2.0 are asked along
+// the way, but don't count: we can't wait on their DONT_HAVE. Only the first
+// target may be wasteful: there's no point asking a peer for an extra copy
+// when it mostly sends blocks that already arrived from someone else.
+func (s *Session) wantTargets(top []peer.ID, first, split int) []peer.ID {
+	var targets []peer.ID
+	answering := 0
+	for j := 0; j < len(top) && answering < split; j++ {
+		p := top[(first+j)%len(top)]
+		if len(targets) > 0 && s.score(p).wasteful() {
+			continue
+		}
+		targets = append(targets, p)
+		if s.score(p).presence {
+			answering++
+		}
+	}
+	return targets
+}
+
+// widenWant asks the next best peer for c once every peer the want-block was
+// sent to said it doesn't have the block, or never will. It returns true if
+// a peer was asked.
+func (s *Session) widenWant(ctx context.Context, c *cid.Cid, wp *wantPresence) bool {
+	sw, ok := s.sentWants[c.KeyString()]
+	if !ok || s.awaitingDontHave(sw, wp) {
+		return false
+	}
+
+	for _, p := range s.rankedPeers() {
+		if _, no := wp.dontHaves[p]; no {
+			continue
+		}
+		if _, sent := sw.peers[p]; sent {
+			continue
+		}
+		s.recordSent(c, p, time.Now())
+		s.bs.wm.WantBlocksOrDontHave(ctx, []*cid.Cid{c}, []peer.ID{p}, s.id)
+		return true
+	}
+	return false
+}
+
+// awaitingDontHave returns true if one of the peers the want-block was sent
+// to may still tell us it doesn't have the block. Peers that never sent us a
+// HAVE or DONT_HAVE aren't waited on, as bitswap 1.1.0 peers don't.
+func (s *Session) awaitingDontHave(sw *sentWant, wp *wantPresence) bool {
+	for p := range sw.peers {
+		if !s.score(p).presence {
+			continue
+		}
+		if _, no := wp.dontHaves[p]; !no {
+			return true
+		}
+	}
+	return false
+}
+
+// wantDeadline is when a peer sent a want-block at the given time should
+// have sent the block, given how fast it has been so far.
+func (s *Session) wantDeadline(p peer.ID, at time.Time, avg time.Duration) time.Time {
+	return at.Add(s.baseTickDelay + 3*s.score(p).expectedLatency(avg))
+}
+
+// wantsTimedOut penalises the peers that neither sent the blocks they were
+// asked for nor said they don't have them by the deadline of the
+// want-block, and forgets about those want-blocks. Want-blocks that aren't
+// overdue yet are kept, so that ticks coming right after sending them, or
+// while the session is idle, don't count against anyone.
+func (s *Session) wantsTimedOut(now time.Time) {
+	avg := s.averageLatency()
+	timedOut := make(map[peer.ID]struct{})
+	for ks, sw := range s.sentWants {
+		wp := s.wantPresences[ks]
+		for p, at := range sw.peers {
+			if wp != nil {
+				if _, no := wp.dontHaves[p]; no {
+					delete(sw.peers, p)
+					continue
+				}
+			}
+			if now.Before(s.wantDeadline(p, at, avg)) {
+				continue
+			}
+			timedOut[p] = struct{}{}
+			delete(sw.peers, p)
+		}
+		if len(sw.peers) == 0 {
+			delete(s.sentWants, ks)
+		}
+	}
+	for p := range timedOut {
+		s.score(p).timedOut()
+	}
+}
@@ -3,12 +3,17 @@ package bitswap
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
+	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
 
+	delay "gx/ipfs/QmRJVNatYJwTAHgdSM1Xef9QVQ1Ch3XHdmcrykjP5Y4soL/go-ipfs-delay"
 	tu "gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
+	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
 	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
 )
@@ -324,3 +329,258 @@ func TestWantlistClearsOnCancel(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSessionAsksOnePeerThatHasBlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	vnet := getVirtualNetwork()
+	sesgen := NewTestSessionGenerator(vnet)
+	defer sesgen.Close()
+	bgen := blocksutil.NewBlockGenerator()
+
+	block := bgen.Next()
+	inst := sesgen.Instances(4)
+
+	// inst[1] and inst[2] have the block, inst[3] doesn't
+	for _, i := range inst[1:3] {
+		if err := i.Blockstore().Put(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ses := inst[0].Exchange.NewSession(ctx)
+	if _, err := ses.GetBlock(ctx, block.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// give any duplicate a chance to show up
+	time.Sleep(time.Millisecond * 200)
+
+	var sent uint64
+	for _, i := range inst[1:] {
+		i.Exchange.counterLk.Lock()
+		sent += i.Exchange.counters.blocksSent
+		i.Exchange.counterLk.Unlock()
+	}
+	if sent != 1 {
+		t.Fatalf("expected the block to be sent once, got %d", sent)
+	}
+
+	a := inst[0].Exchange
+	a.counterLk.Lock()
+	defer a.counterLk.Unlock()
+	if a.counters.dupBlocksRecvd != 0 {
+		t.Fatalf("expected no duplicate blocks, got %d", a.counters.dupBlocksRecvd)
+	}
+}
+
+func TestSessionRanksPeers(t *testing.T) {
+	fast, slow, unknown, flaky := peer.ID("fast"), peer.ID("slow"), peer.ID("unknown"), peer.ID("flaky")
+	s := &Session{
+		activePeers: make(map[peer.ID]struct{}),
+		scores:      make(map[peer.ID]*peerScore),
+		latTotal:    200 * time.Millisecond,
+		fetchcnt:    4,
+	}
+	for _, p := range []peer.ID{slow, unknown, flaky, fast} {
+		s.activePeers[p] = struct{}{}
+		s.activePeersArr = append(s.activePeersArr, p)
+	}
+
+	s.score(fast).receivedBlock(10*time.Millisecond, 1024)
+	s.score(slow).receivedBlock(100*time.Millisecond, 1024)
+	s.score(flaky).receivedBlock(20*time.Millisecond, 1024)
+	s.score(flaky).timedOut()
+	s.score(flaky).timedOut()
+
+	// unknown peers are assumed to be as fast as the session's average of
+	// 50ms, and each timeout doubles flaky's 20ms
+	expected := []peer.ID{fast, unknown, flaky, slow}
+	ranked := s.rankedPeers()
+	for i, p := range expected {
+		if ranked[i] != p {
+			t.Fatalf("expected %s at rank %d, got %s", p, i, ranked[i])
+		}
+	}
+
+	s.score(flaky).receivedBlock(20*time.Millisecond, 1024)
+	if ranked := s.rankedPeers(); ranked[1] != flaky {
+		t.Fatalf("a block should clear flaky's timeouts, got %v", ranked)
+	}
+}
+
+func TestSessionSkipsWastefulPeers(t *testing.T) {
+	a, b, c := peer.ID("a"), peer.ID("b"), peer.ID("c")
+	s := &Session{scores: make(map[peer.ID]*peerScore)}
+	top := []peer.ID{a, b, c}
+	for _, p := range top {
+		s.score(p).presence = true
+	}
+
+	s.score(b).receivedBlock(10*time.Millisecond, 1024)
+	for i := 0; i < dupThreshold; i++ {
+		s.score(b).receivedDuplicate(1024)
+	}
+	if !s.score(b).wasteful() {
+		t.Fatal("expected b to be wasteful")
+	}
+
+	// b isn't asked for a second copy of a's want-blocks...
+	if targets := s.wantTargets(top, 0, 2); len(targets) != 2 || targets[0] != a || targets[1] != c {
+		t.Fatalf("expected want-blocks to go to a and c, got %v", targets)
+	}
+	// ...but still gets its own share
+	if targets := s.wantTargets(top, 1, 2); len(targets) != 2 || targets[0] != b || targets[1] != c {
+		t.Fatalf("expected want-blocks to go to b and c, got %v", targets)
+	}
+
+	for i := 0; i < dupThreshold; i++ {
+		s.score(b).receivedBlock(10*time.Millisecond, 1024)
+	}
+	if s.score(b).wasteful() {
+		t.Fatal("useful blocks should make up for b's duplicates")
+	}
+}
+
+func TestSessionDoesntWaitOnOldPeers(t *testing.T) {
+	old1, old2, a, b := peer.ID("old1"), peer.ID("old2"), peer.ID("a"), peer.ID("b")
+	s := &Session{scores: make(map[peer.ID]*peerScore)}
+	for _, p := range []peer.ID{a, b} {
+		s.score(p).presence = true
+	}
+
+	// peers that never said whether they have a block are asked too, but
+	// don't count towards the split
+	top := []peer.ID{old1, a, old2, b}
+	targets := s.wantTargets(top, 0, 2)
+	if len(targets) != 4 {
+		t.Fatalf("expected want-blocks to go to all four peers, got %v", targets)
+	}
+	targets = s.wantTargets(top, 1, 2)
+	if len(targets) != 3 || targets[0] != a || targets[2] != b {
+		t.Fatalf("expected want-blocks to go to a, old2 and b, got %v", targets)
+	}
+
+	// nor are they waited on for a DONT_HAVE
+	now := time.Now()
+	sw := &sentWant{peers: map[peer.ID]time.Time{old1: now, a: now}}
+	wp := &wantPresence{dontHaves: make(map[peer.ID]struct{})}
+	if !s.awaitingDontHave(sw, wp) {
+		t.Fatal("should wait for a to answer")
+	}
+	wp.dontHaves[a] = struct{}{}
+	if s.awaitingDontHave(sw, wp) {
+		t.Fatal("shouldn't wait on old1, which never sends DONT_HAVE")
+	}
+}
+
+func TestSessionTimeoutsNeedOverdueWants(t *testing.T) {
+	slow, recent, answered := peer.ID("slow"), peer.ID("recent"), peer.ID("answered")
+	s := &Session{
+		scores:        make(map[peer.ID]*peerScore),
+		sentWants:     make(map[string]*sentWant),
+		wantPresences: make(map[string]*wantPresence),
+		baseTickDelay: 500 * time.Millisecond,
+	}
+
+	// ticks without any want-block out don't count against anyone
+	now := time.Now()
+	s.wantsTimedOut(now)
+	if len(s.scores) != 0 {
+		t.Fatal("idle ticks shouldn't time out peers")
+	}
+
+	c := blocksutil.NewBlockGenerator().Next().Cid()
+	s.recordSent(c, slow, now.Add(-time.Second))
+	s.recordSent(c, recent, now.Add(-100*time.Millisecond))
+	s.recordSent(c, answered, now.Add(-time.Second))
+	s.wantPresences[c.KeyString()] = &wantPresence{
+		dontHaves: map[peer.ID]struct{}{answered: struct{}{}},
+	}
+
+	s.wantsTimedOut(now)
+	if s.score(slow).timeouts != 1 {
+		t.Fatal("slow missed its deadline")
+	}
+	if s.score(recent).timeouts != 0 {
+		t.Fatal("recent isn't overdue yet")
+	}
+	if s.score(answered).timeouts != 0 {
+		t.Fatal("answered said it doesn't have the block")
+	}
+
+	// the want-block that isn't overdue is kept for the next tick
+	sw, ok := s.sentWants[c.KeyString()]
+	if !ok || len(sw.peers) != 1 {
+		t.Fatalf("expected the want-block sent to recent to be kept, got %v", sw)
+	}
+	s.wantsTimedOut(now.Add(time.Second))
+	if s.score(recent).timeouts != 1 || s.score(slow).timeouts != 1 {
+		t.Fatal("only recent should time out on the next tick")
+	}
+	if len(s.sentWants) != 0 {
+		t.Fatal("timed out want-blocks should be forgotten")
+	}
+}
+
+// BenchmarkSessionHeterogeneousPeers fetches blocks that every provider has
+// from providers that answer at very different speeds.
+func BenchmarkSessionHeterogeneousPeers(b *testing.B) {
+	delays := []time.Duration{
+		5 * time.Millisecond,
+		20 * time.Millisecond,
+		50 * time.Millisecond,
+		150 * time.Millisecond,
+	}
+
+	var lk sync.Mutex
+	peerDelays := make(map[peer.ID]delay.D)
+	vnet := tn.VirtualNetworkWithPeerDelays(mockrouting.NewServer(), delay.Fixed(kNetworkDelay), func(p peer.ID) delay.D {
+		lk.Lock()
+		defer lk.Unlock()
+		return peerDelays[p]
+	})
+	sesgen := NewTestSessionGenerator(vnet)
+	defer sesgen.Close()
+	bgen := blocksutil.NewBlockGenerator()
+
+	inst := sesgen.Instances(len(delays) + 1)
+	providers := inst[1:]
+	lk.Lock()
+	for i, d := range delays {
+		peerDelays[providers[i].Peer] = delay.Fixed(d)
+	}
+	lk.Unlock()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		blks := bgen.Blocks(50)
+		var cids []*cid.Cid
+		for _, blk := range blks {
+			cids = append(cids, blk.Cid())
+		}
+		for _, p := range providers {
+			if err := p.Blockstore().PutMany(blks); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		ses := inst[0].Exchange.NewSession(ctx)
+		ch, err := ses.GetBlocks(ctx, cids)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n := 0
+		for range ch {
+			n++
+		}
+		cancel()
+		if n != len(blks) {
+			b.Fatalf("got %d of %d blocks", n, len(blks))
+		}
+	}
+}
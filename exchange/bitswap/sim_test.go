@@ -0,0 +1,215 @@
+package bitswap
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
+
+	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+// simWorkload is a scripted run on a simulated network: the first seeds
+// nodes have every block, and all the others fetch all of them at once.
+type simWorkload struct {
+	nodes     int
+	seeds     int
+	blocks    int
+	blockSize int
+
+	net tn.SimConfig
+
+	// seedUplink, if set, is the profile of the links from the seeds to
+	// everyone else
+	seedUplink *tn.LinkProfile
+
+	// churn takes the seeds but the first offline and back during the run
+	churn bool
+}
+
+type simResult struct {
+	duration       time.Duration
+	blocksReceived uint64
+	dupBlocks      uint64
+	dupData        uint64
+	net            tn.SimStats
+}
+
+func runSimWorkload(t testing.TB, w simWorkload) simResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	net := tn.NewSimNetwork(mockrouting.NewServer(), w.net)
+	sesgen := NewTestSessionGenerator(net)
+	defer sesgen.Close()
+	inst := sesgen.Instances(w.nodes)
+	seeds, leeches := inst[:w.seeds], inst[w.seeds:]
+
+	if w.seedUplink != nil {
+		for _, s := range seeds {
+			for _, l := range leeches {
+				net.SetLink(s.Peer, l.Peer, *w.seedUplink)
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewSource(w.net.Seed))
+	var cids []*cid.Cid
+	var blks []blocks.Block
+	for i := 0; i < w.blocks; i++ {
+		data := make([]byte, w.blockSize)
+		rng.Read(data)
+		b := blocks.NewBlock(data)
+		blks = append(blks, b)
+		cids = append(cids, b.Cid())
+	}
+	for _, s := range seeds {
+		if err := s.Blockstore().PutMany(blks); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if w.churn {
+		for _, s := range seeds[1:] {
+			net.StartChurn(ctx, s.Peer)
+		}
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(leeches))
+	for _, l := range leeches {
+		wg.Add(1)
+		go func(l Instance) {
+			defer wg.Done()
+			ses := l.Exchange.NewSession(ctx)
+			ch, err := ses.GetBlocks(ctx, cids)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for range ch {
+			}
+		}(l)
+	}
+	wg.Wait()
+	res := simResult{duration: time.Since(start)}
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	for _, l := range leeches {
+		st, err := l.Exchange.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.blocksReceived += st.BlocksReceived
+		res.dupBlocks += st.DupBlksReceived
+		res.dupData += st.DupDataReceived
+	}
+	if want := uint64(len(leeches) * w.blocks); res.blocksReceived < want {
+		t.Fatalf("leeches received %d blocks, expected %d", res.blocksReceived, want)
+	}
+	res.net = net.Stats()
+	return res
+}
+
+func TestSimulatedNetwork(t *testing.T) {
+	res := runSimWorkload(t, simWorkload{
+		nodes:     4,
+		seeds:     1,
+		blocks:    20,
+		blockSize: 1024,
+		net: tn.SimConfig{
+			Seed: 1,
+			Link: tn.LinkProfile{
+				Latency:   5 * time.Millisecond,
+				Bandwidth: 1 << 20,
+				Loss:      0.05,
+			},
+		},
+	})
+	if res.net.MessagesSent == 0 || res.net.BytesSent < 3*20*1024 {
+		t.Fatalf("unexpected network stats: %+v", res.net)
+	}
+}
+
+func TestSimulatedNetworkBandwidth(t *testing.T) {
+	// 20 blocks of 10kB down a 100kB/s uplink take at least two seconds
+	res := runSimWorkload(t, simWorkload{
+		nodes:     2,
+		seeds:     1,
+		blocks:    20,
+		blockSize: 10000,
+		net:       tn.SimConfig{Seed: 1},
+		seedUplink: &tn.LinkProfile{
+			Bandwidth: 100000,
+		},
+	})
+	if res.duration < 2*time.Second {
+		t.Fatalf("transfer took %s, faster than the link allows", res.duration)
+	}
+}
+
+var simWorkloads = []struct {
+	name string
+	w    simWorkload
+}{
+	{"ideal", simWorkload{
+		nodes: 8, seeds: 2, blocks: 100, blockSize: 16 << 10,
+		net: tn.SimConfig{Seed: 42},
+	}},
+	{"wan", simWorkload{
+		nodes: 8, seeds: 2, blocks: 100, blockSize: 16 << 10,
+		net: tn.SimConfig{Seed: 42, Link: tn.LinkProfile{
+			Latency: 40 * time.Millisecond, Jitter: 10 * time.Millisecond, Bandwidth: 4 << 20,
+		}},
+	}},
+	{"lossy", simWorkload{
+		nodes: 8, seeds: 2, blocks: 100, blockSize: 16 << 10,
+		net: tn.SimConfig{Seed: 42, Link: tn.LinkProfile{
+			Latency: 20 * time.Millisecond, Bandwidth: 4 << 20, Loss: 0.1,
+		}},
+	}},
+	{"slow-uplinks", simWorkload{
+		nodes: 8, seeds: 2, blocks: 100, blockSize: 16 << 10,
+		net: tn.SimConfig{Seed: 42, Link: tn.LinkProfile{
+			Latency: 20 * time.Millisecond, Bandwidth: 8 << 20,
+		}},
+		seedUplink: &tn.LinkProfile{Latency: 20 * time.Millisecond, Bandwidth: 512 << 10},
+	}},
+	{"churn", simWorkload{
+		nodes: 8, seeds: 4, blocks: 100, blockSize: 16 << 10,
+		net: tn.SimConfig{
+			Seed:  42,
+			Link:  tn.LinkProfile{Latency: 20 * time.Millisecond, Bandwidth: 4 << 20},
+			Churn: tn.ChurnProfile{MeanUptime: 500 * time.Millisecond, MeanDowntime: 200 * time.Millisecond},
+		},
+		churn: true,
+	}},
+}
+
+// BenchmarkSimulation runs scripted workloads on simulated networks and logs
+// the duplicate blocks and network usage of each run. Use -v to see them.
+// The network runs on the wall clock, as bitswap does, so the durations and
+// counts vary between runs even with the same seed.
+func BenchmarkSimulation(b *testing.B) {
+	for _, sw := range simWorkloads {
+		sw := sw
+		b.Run(sw.name, func(b *testing.B) {
+			b.SetBytes(int64(sw.w.blocks * sw.w.blockSize * (sw.w.nodes - sw.w.seeds)))
+			for i := 0; i < b.N; i++ {
+				res := runSimWorkload(b, sw.w)
+				b.Logf("completed in %s: %d dup blocks (%d bytes), %d messages, %d bytes sent, %d retransmissions, %d disconnections",
+					res.duration, res.dupBlocks, res.dupData, res.net.MessagesSent,
+					res.net.BytesSent, res.net.Retransmissions, res.net.Disconnections)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package bitswap
 
 import (
 	"sort"
+	"time"
+
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
 
 	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
 )
@@ -16,6 +19,36 @@ type Stat struct {
 	DataSent        uint64
 	DupBlksReceived uint64
 	DupDataReceived uint64
+	ThrottledSends  uint64
+	ThrottledTime   time.Duration
+
+	// Sessions and DupPeers are only filled in for verbose stats
+	Sessions []*SessionStat      `json:",omitempty"`
+	DupPeers []*decision.Receipt `json:",omitempty"`
+}
+
+// SessionStat describes the blocks a session fetched, and the duplicates it
+// received.
+type SessionStat struct {
+	ID        uint64
+	Fetched   int
+	DupBlocks uint64
+	DupData   uint64
+
+	// Peers are the peers that sent the session blocks, those that sent the
+	// most duplicates first
+	Peers []*SessionPeerStat
+}
+
+// SessionPeerStat counts the blocks a peer sent a session.
+type SessionPeerStat struct {
+	Peer      string
+	Blocks    int
+	DupBlocks int
+	DupData   uint64
+	// Wasteful is set once the session stopped sending the peer redundant
+	// want-blocks because of its duplicates
+	Wasteful bool
 }
 
 func (bs *Bitswap) Stat() (*Stat, error) {
@@ -32,6 +65,8 @@ func (bs *Bitswap) Stat() (*Stat, error) {
 	st.DataReceived = c.dataRecvd
 	bs.counterLk.Unlock()
 
+	st.ThrottledSends, st.ThrottledTime = bs.sendLimiter.stats()
+
 	peers := bs.engine.Peers()
 	st.Peers = make([]string, 0, len(peers))
 
@@ -42,3 +77,89 @@ func (bs *Bitswap) Stat() (*Stat, error) {
 
 	return st, nil
 }
+
+// SessionStats describes the duplicate blocks received by each of the open
+// sessions.
+func (bs *Bitswap) SessionStats() []*SessionStat {
+	bs.sessLk.Lock()
+	sessions := make([]*Session, len(bs.sessions))
+	copy(sessions, bs.sessions)
+	bs.sessLk.Unlock()
+
+	out := make([]*SessionStat, 0, len(sessions))
+	for _, s := range sessions {
+		if st := s.stat(); st != nil {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// DupPeers returns the ledgers of the peers that sent us duplicate blocks,
+// those that sent the most first.
+func (bs *Bitswap) DupPeers() []*decision.Receipt {
+	var out []*decision.Receipt
+	for _, p := range bs.engine.Peers() {
+		r := bs.engine.LedgerForPeer(p)
+		if r.DupBlocks > 0 {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DupBlocks != out[j].DupBlocks {
+			return out[i].DupBlocks > out[j].DupBlocks
+		}
+		return out[i].Peer < out[j].Peer
+	})
+	return out
+}
+
+// stat asks the session's run loop to describe the session. It returns nil
+// if the session is closed.
+func (s *Session) stat() *SessionStat {
+	resp := make(chan *SessionStat, 1)
+	select {
+	case s.statReqs <- resp:
+	case <-s.ctx.Done():
+		return nil
+	}
+
+	select {
+	case st := <-resp:
+		return st
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+func (s *Session) makeStat() *SessionStat {
+	st := &SessionStat{
+		ID:        s.id,
+		Fetched:   s.fetchcnt,
+		DupBlocks: s.dupBlocks,
+		DupData:   s.dupData,
+	}
+	for p, ps := range s.scores {
+		if ps.received == 0 && ps.dups == 0 {
+			continue
+		}
+		st.Peers = append(st.Peers, &SessionPeerStat{
+			Peer:      p.Pretty(),
+			Blocks:    ps.received,
+			DupBlocks: ps.dups,
+			DupData:   ps.dupBytes,
+			Wasteful:  ps.wasteful(),
+		})
+	}
+	sort.Slice(st.Peers, func(i, j int) bool {
+		a, b := st.Peers[i], st.Peers[j]
+		if a.DupBlocks != b.DupBlocks {
+			return a.DupBlocks > b.DupBlocks
+		}
+		return a.Peer < b.Peer
+	})
+	return st
+}
@@ -0,0 +1,94 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a simulated network.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f once d has elapsed
+	AfterFunc(d time.Duration, f func())
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// VirtualClock is a Clock that only moves when Advance is called. It runs
+// the functions that become due one after the other, in order of their
+// deadlines, so that a simulation does not depend on the wall clock or on
+// how goroutines are scheduled.
+type VirtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*virtualTimer
+}
+
+type virtualTimer struct {
+	when time.Time
+	seq  uint64
+	f    func()
+}
+
+// NewVirtualClock returns a VirtualClock set to start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d < 0 {
+		d = 0
+	}
+	c.seq++
+	c.timers = append(c.timers, &virtualTimer{when: c.now.Add(d), seq: c.seq, f: f})
+}
+
+// Advance moves the clock forward by d. The functions due by then run in
+// order of their deadlines, functions with the same deadline in the order
+// they were scheduled, and the clock reads each one's deadline while it
+// runs. Functions they schedule run too if they are due before the end.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		next := -1
+		for i, t := range c.timers {
+			if t.when.After(end) {
+				continue
+			}
+			if next < 0 || t.when.Before(c.timers[next].when) ||
+				(t.when.Equal(c.timers[next].when) && t.seq < c.timers[next].seq) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
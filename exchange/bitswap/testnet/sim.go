@@ -0,0 +1,539 @@
+package bitswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	testutil "gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
+	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	ifconnmgr "gx/ipfs/Qmax8X1Kfahf5WfSB68EWDG3d3qyS3Sqs1v412fjPTfRwx/go-libp2p-interface-connmgr"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+// ErrPeerOffline is returned when sending to or from a peer that the
+// simulated network took offline.
+var ErrPeerOffline = errors.New("peer is offline")
+
+const (
+	// minRetransmitTimeout is the least a lost message is delayed by
+	minRetransmitTimeout = 200 * time.Millisecond
+
+	// maxRetransmissions bounds how many times a message can be lost
+	maxRetransmissions = 8
+
+	// entryWireSize approximates the bytes a wantlist entry, block presence
+	// or block prefix take on the wire
+	entryWireSize = 40
+)
+
+// LinkProfile describes the link carrying messages from one peer to another.
+// Links are one-way: asymmetric connections are modelled by giving each
+// direction its own profile.
+type LinkProfile struct {
+	// Latency is the one-way delay of every message
+	Latency time.Duration
+
+	// Jitter is the most by which a message's latency randomly varies
+	Jitter time.Duration
+
+	// Bandwidth is the link's capacity in bytes per second. Messages queue
+	// up behind each other while the link is busy. 0 means unlimited
+	Bandwidth int64
+
+	// Loss is the probability that a message is lost and has to be
+	// retransmitted, which delays it by a retransmission timeout. Messages
+	// are never dropped altogether, as they travel over reliable streams
+	Loss float64
+}
+
+// ChurnProfile makes peers leave and rejoin the network. The periods they
+// stay online and offline are exponentially distributed around the means.
+type ChurnProfile struct {
+	MeanUptime   time.Duration
+	MeanDowntime time.Duration
+}
+
+// SimConfig configures a simulated network.
+type SimConfig struct {
+	// Seed makes link conditions and churn reproducible. Every link and
+	// every churning peer draws from its own generator derived from it, so
+	// the traffic on one link does not change what happens on another
+	Seed int64
+
+	// Clock is the network's time source. nil means the wall clock
+	Clock Clock
+
+	// Link is the profile of the links not given their own with SetLink
+	Link LinkProfile
+
+	// Churn is used by StartChurn
+	Churn ChurnProfile
+}
+
+// SimStats counts what happened on a simulated network.
+type SimStats struct {
+	MessagesSent    uint64
+	BytesSent       uint64
+	Retransmissions uint64
+	// FailedSends are the messages sent to or from offline peers
+	FailedSends    uint64
+	Disconnections uint64
+}
+
+// SimNetwork is a Network modelling per-link latency, bandwidth and loss,
+// and peer churn, without any real networking.
+//
+// Driven by a VirtualClock, the network is deterministic: the same seed,
+// peers and sends give the same deliveries at the same times. On the wall
+// clock, as when running bitswap nodes, the link conditions and churn are
+// still drawn from the seed, but when messages are sent depends on timing
+// and goroutine scheduling, so runs differ.
+type SimNetwork struct {
+	cfg           SimConfig
+	clock         Clock
+	routingserver mockrouting.Server
+
+	mu       sync.Mutex
+	clients  map[peer.ID]*simClient
+	links    map[simLinkKey]*simLink
+	profiles map[simLinkKey]LinkProfile
+	conns    map[simLinkKey]struct{}
+	offline  map[peer.ID]bool
+	stats    SimStats
+}
+
+type simLinkKey struct {
+	from, to peer.ID
+}
+
+// simLink delivers the messages sent from one peer to another in order.
+type simLink struct {
+	profile   LinkProfile
+	rng       *rand.Rand
+	to        *simClient
+	busyUntil time.Time
+
+	// queue holds the messages in flight, the first one has a delivery
+	// scheduled while scheduled is set
+	queue     []*message
+	scheduled bool
+}
+
+// NewSimNetwork creates an empty simulated network.
+func NewSimNetwork(rs mockrouting.Server, cfg SimConfig) *SimNetwork {
+	clock := cfg.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &SimNetwork{
+		cfg:           cfg,
+		clock:         clock,
+		routingserver: rs,
+		clients:       make(map[peer.ID]*simClient),
+		links:         make(map[simLinkKey]*simLink),
+		profiles:      make(map[simLinkKey]LinkProfile),
+		conns:         make(map[simLinkKey]struct{}),
+		offline:       make(map[peer.ID]bool),
+	}
+}
+
+func (n *SimNetwork) Adapter(p testutil.Identity) bsnet.BitSwapNetwork {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	client := &simClient{
+		local:   p.ID(),
+		index:   len(n.clients),
+		network: n,
+		routing: n.routingserver.Client(p),
+	}
+	n.clients[p.ID()] = client
+	return client
+}
+
+func (n *SimNetwork) HasPeer(p peer.ID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, found := n.clients[p]
+	return found
+}
+
+// SetLink sets the profile of the link carrying messages from one peer to
+// the other. It only applies to messages sent afterwards.
+func (n *SimNetwork) SetLink(from, to peer.ID, lp LinkProfile) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	k := simLinkKey{from, to}
+	n.profiles[k] = lp
+	if l, ok := n.links[k]; ok {
+		l.profile = lp
+	}
+}
+
+// Stats returns what happened on the network so far.
+func (n *SimNetwork) Stats() SimStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// SetOnline takes a peer offline, disconnecting it from everyone, or brings
+// it back and reconnects it to the online peers it was connected to.
+func (n *SimNetwork) SetOnline(p peer.ID, online bool) {
+	n.mu.Lock()
+	if n.offline[p] == !online {
+		n.mu.Unlock()
+		return
+	}
+	n.offline[p] = !online
+
+	c := n.clients[p]
+	var others []*simClient
+	for k := range n.conns {
+		var o peer.ID
+		switch p {
+		case k.from:
+			o = k.to
+		case k.to:
+			o = k.from
+		default:
+			continue
+		}
+		if n.offline[o] {
+			continue
+		}
+		others = append(others, n.clients[o])
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].index < others[j].index })
+	if !online {
+		n.stats.Disconnections += uint64(len(others))
+	}
+	n.mu.Unlock()
+
+	for _, o := range others {
+		if online {
+			o.Receiver.PeerConnected(p)
+			c.Receiver.PeerConnected(o.local)
+		} else {
+			o.Receiver.PeerDisconnected(p)
+			c.Receiver.PeerDisconnected(o.local)
+		}
+	}
+}
+
+// StartChurn takes the given peers offline and back according to the
+// network's ChurnProfile, until ctx is cancelled.
+func (n *SimNetwork) StartChurn(ctx context.Context, peers ...peer.ID) {
+	if n.cfg.Churn.MeanUptime <= 0 {
+		return
+	}
+	for _, p := range peers {
+		n.mu.Lock()
+		c := &churner{
+			network: n,
+			peer:    p,
+			online:  true,
+			rng:     rand.New(rand.NewSource(subSeed(n.cfg.Seed, n.clients[p].index))),
+		}
+		n.mu.Unlock()
+
+		c.schedule()
+		go func() {
+			<-ctx.Done()
+			c.stop()
+		}()
+	}
+}
+
+// churner takes one peer offline and back.
+type churner struct {
+	network *SimNetwork
+	peer    peer.ID
+	rng     *rand.Rand
+
+	mu      sync.Mutex
+	online  bool
+	stopped bool
+}
+
+func (c *churner) schedule() {
+	mean := c.network.cfg.Churn.MeanUptime
+	if !c.online {
+		mean = c.network.cfg.Churn.MeanDowntime
+	}
+	d := time.Duration(c.rng.ExpFloat64() * float64(mean))
+	c.network.clock.AfterFunc(d, c.toggle)
+}
+
+func (c *churner) toggle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	c.online = !c.online
+	c.network.SetOnline(c.peer, c.online)
+	c.schedule()
+}
+
+// stop brings the peer back online for good.
+func (c *churner) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	c.network.SetOnline(c.peer, true)
+}
+
+// subSeed derives the seed of the generator of one peer or link from the
+// network's seed. Peers are identified by the order they joined in, as their
+// IDs are usually random.
+func subSeed(seed int64, peers ...int) int64 {
+	h := fnv.New64a()
+	fmt.Fprint(h, seed)
+	for _, p := range peers {
+		fmt.Fprintf(h, "/%d", p)
+	}
+	return int64(h.Sum64())
+}
+
+func (n *SimNetwork) isOffline(p peer.ID) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.offline[p]
+}
+
+// link returns the link from one peer to another. It must be called with
+// the lock held.
+func (n *SimNetwork) link(from, to peer.ID) *simLink {
+	k := simLinkKey{from, to}
+	l, ok := n.links[k]
+	if !ok {
+		lp, ok := n.profiles[k]
+		if !ok {
+			lp = n.cfg.Link
+		}
+		l = &simLink{
+			profile: lp,
+			rng:     rand.New(rand.NewSource(subSeed(n.cfg.Seed, n.clients[from].index, n.clients[to].index))),
+			to:      n.clients[to],
+		}
+		n.links[k] = l
+	}
+	return l
+}
+
+func (n *SimNetwork) SendMessage(
+	ctx context.Context,
+	from peer.ID,
+	to peer.ID,
+	mes bsmsg.BitSwapMessage) error {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.clients[to]; !ok {
+		return errors.New("Cannot locate peer on network")
+	}
+	if _, ok := n.clients[from]; !ok {
+		return errors.New("Cannot locate peer on network")
+	}
+	if n.offline[from] || n.offline[to] {
+		n.stats.FailedSends++
+		return ErrPeerOffline
+	}
+
+	l := n.link(from, to)
+	lp := l.profile
+	size := messageSize(mes)
+
+	// the message waits for the link to carry the ones sent before it
+	now := n.clock.Now()
+	start := now
+	if l.busyUntil.After(now) {
+		start = l.busyUntil
+	}
+	sent := start
+	if lp.Bandwidth > 0 {
+		sent = start.Add(time.Duration(float64(size) / float64(lp.Bandwidth) * float64(time.Second)))
+	}
+	l.busyUntil = sent
+
+	arrival := sent.Add(lp.Latency)
+	if lp.Jitter > 0 {
+		arrival = arrival.Add(time.Duration(l.rng.Int63n(int64(lp.Jitter) + 1)))
+	}
+	for i := 0; i < maxRetransmissions && lp.Loss > 0 && l.rng.Float64() < lp.Loss; i++ {
+		arrival = arrival.Add(retransmitTimeout(lp))
+		n.stats.Retransmissions++
+	}
+
+	n.stats.MessagesSent++
+	n.stats.BytesSent += uint64(size)
+
+	l.queue = append(l.queue, &message{
+		from:       from,
+		msg:        mes,
+		shouldSend: arrival,
+	})
+	n.scheduleDelivery(l)
+	return nil
+}
+
+// scheduleDelivery schedules the delivery of the first message in flight on
+// l, unless one is scheduled already. Messages are delivered one after the
+// other, no earlier than their arrival time. It must be called with the lock
+// held.
+func (n *SimNetwork) scheduleDelivery(l *simLink) {
+	if l.scheduled || len(l.queue) == 0 {
+		return
+	}
+	l.scheduled = true
+	n.clock.AfterFunc(l.queue[0].shouldSend.Sub(n.clock.Now()), func() {
+		n.mu.Lock()
+		m := l.queue[0]
+		l.queue = l.queue[1:]
+		n.mu.Unlock()
+
+		l.to.ReceiveMessage(context.TODO(), m.from, m.msg)
+
+		n.mu.Lock()
+		l.scheduled = false
+		n.scheduleDelivery(l)
+		n.mu.Unlock()
+	})
+}
+
+func retransmitTimeout(lp LinkProfile) time.Duration {
+	rto := 2 * lp.Latency
+	if rto < minRetransmitTimeout {
+		rto = minRetransmitTimeout
+	}
+	return rto
+}
+
+// messageSize approximates the size of a message on the wire.
+func messageSize(m bsmsg.BitSwapMessage) int {
+	size := (len(m.Wantlist()) + len(m.BlockPresences())) * entryWireSize
+	for _, b := range m.Blocks() {
+		size += len(b.RawData()) + entryWireSize
+	}
+	return size
+}
+
+type simClient struct {
+	local peer.ID
+	// index is the order the peer joined the network in
+	index int
+	bsnet.Receiver
+	network *SimNetwork
+	routing routing.IpfsRouting
+}
+
+// ReceiveMessage drops the messages still in flight when either end went
+// offline.
+func (c *simClient) ReceiveMessage(ctx context.Context, from peer.ID, m bsmsg.BitSwapMessage) {
+	if c.network.isOffline(c.local) || c.network.isOffline(from) {
+		return
+	}
+	c.Receiver.ReceiveMessage(ctx, from, m)
+}
+
+func (c *simClient) SendMessage(ctx context.Context, to peer.ID, m bsmsg.BitSwapMessage) error {
+	return c.network.SendMessage(ctx, c.local, to, m)
+}
+
+// FindProvidersAsync returns a channel of providers for the given key
+func (c *simClient) FindProvidersAsync(ctx context.Context, k *cid.Cid, max int) <-chan peer.ID {
+	out := make(chan peer.ID)
+	go func() {
+		defer close(out)
+		providers := c.routing.FindProvidersAsync(ctx, k, max)
+		for info := range providers {
+			select {
+			case <-ctx.Done():
+			case out <- info.ID:
+			}
+		}
+	}()
+	return out
+}
+
+func (c *simClient) ConnectionManager() ifconnmgr.ConnManager {
+	return &ifconnmgr.NullConnMgr{}
+}
+
+func (c *simClient) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	return &simMessageSender{
+		client: c,
+		target: p,
+	}, nil
+}
+
+// Provide provides the key to the network
+func (c *simClient) Provide(ctx context.Context, k *cid.Cid) error {
+	return c.routing.Provide(ctx, k, true)
+}
+
+func (c *simClient) SetDelegate(r bsnet.Receiver) {
+	c.Receiver = r
+}
+
+func (c *simClient) ConnectTo(_ context.Context, p peer.ID) error {
+	n := c.network
+	n.mu.Lock()
+
+	other, ok := n.clients[p]
+	if !ok {
+		n.mu.Unlock()
+		return errors.New("no such peer in network")
+	}
+	if n.offline[c.local] || n.offline[p] {
+		n.mu.Unlock()
+		return ErrPeerOffline
+	}
+
+	k := simLinkKey{c.local, p}
+	if p < c.local {
+		k = simLinkKey{p, c.local}
+	}
+	if _, ok := n.conns[k]; ok {
+		n.mu.Unlock()
+		return nil
+	}
+	n.conns[k] = struct{}{}
+	n.mu.Unlock()
+
+	other.Receiver.PeerConnected(c.local)
+	c.Receiver.PeerConnected(p)
+	return nil
+}
+
+type simMessageSender struct {
+	client *simClient
+	target peer.ID
+}
+
+func (ms *simMessageSender) SendMsg(ctx context.Context, m bsmsg.BitSwapMessage) error {
+	return ms.client.SendMessage(ctx, ms.target, m)
+}
+
+func (ms *simMessageSender) Close() error {
+	return nil
+}
+
+func (ms *simMessageSender) Reset() error {
+	return nil
+}
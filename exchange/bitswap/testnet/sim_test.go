@@ -0,0 +1,141 @@
+package bitswap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+
+	testutil "gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
+	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+// simRecorder logs what a peer of a simulated network sees, naming peers by
+// the order they joined in as their IDs are random.
+type simRecorder struct {
+	name  int
+	names map[peer.ID]int
+	clock Clock
+	start time.Time
+
+	mu  *sync.Mutex
+	log *[]string
+}
+
+func (r *simRecorder) record(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prefix := fmt.Sprintf("%s peer %d: ", r.clock.Now().Sub(r.start), r.name)
+	*r.log = append(*r.log, prefix+fmt.Sprintf(format, args...))
+}
+
+func (r *simRecorder) ReceiveMessage(ctx context.Context, p peer.ID, m bsmsg.BitSwapMessage) {
+	for _, b := range m.Blocks() {
+		r.record("received %s from %d", b.RawData(), r.names[p])
+	}
+}
+
+func (r *simRecorder) ReceiveError(err error) {}
+
+func (r *simRecorder) PeerConnected(p peer.ID) {
+	r.record("connected to %d", r.names[p])
+}
+
+func (r *simRecorder) PeerDisconnected(p peer.ID) {
+	r.record("disconnected from %d", r.names[p])
+}
+
+// runScriptedSim sends a fixed series of messages between peers of a
+// network driven by a virtual clock, and returns what the peers saw.
+func runScriptedSim(t *testing.T, seed int64) ([]string, SimStats) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Unix(0, 0)
+	clock := NewVirtualClock(start)
+	net := NewSimNetwork(mockrouting.NewServer(), SimConfig{
+		Seed:  seed,
+		Clock: clock,
+		Link: LinkProfile{
+			Latency:   10 * time.Millisecond,
+			Jitter:    20 * time.Millisecond,
+			Bandwidth: 64 << 10,
+			Loss:      0.2,
+		},
+		Churn: ChurnProfile{
+			MeanUptime:   300 * time.Millisecond,
+			MeanDowntime: 100 * time.Millisecond,
+		},
+	})
+
+	var mu sync.Mutex
+	var log []string
+	names := make(map[peer.ID]int)
+	var peers []peer.ID
+	var adapters []*simClient
+	for i := 0; i < 4; i++ {
+		id := testutil.RandIdentityOrFatal(t)
+		names[id.ID()] = i
+		peers = append(peers, id.ID())
+		a := net.Adapter(id).(*simClient)
+		a.SetDelegate(&simRecorder{name: i, names: names, clock: clock, start: start, mu: &mu, log: &log})
+		adapters = append(adapters, a)
+	}
+	for i, a := range adapters {
+		for _, p := range peers[i+1:] {
+			if err := a.ConnectTo(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	net.StartChurn(ctx, peers[2:]...)
+
+	for i := 0; i < 100; i++ {
+		from, to := i%4, (i+1+i/4)%4
+		if from == to {
+			to = (to + 1) % 4
+		}
+		m := bsmsg.New(false)
+		m.AddBlock(blocks.NewBlock([]byte(fmt.Sprintf("block %d", i))))
+		if err := adapters[from].SendMessage(ctx, peers[to], m); err != nil && err != ErrPeerOffline {
+			t.Fatal(err)
+		}
+		clock.Advance(5 * time.Millisecond)
+	}
+	clock.Advance(10 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), log...), net.Stats()
+}
+
+func TestSimNetworkIsDeterministic(t *testing.T) {
+	log1, stats1 := runScriptedSim(t, 3)
+	log2, stats2 := runScriptedSim(t, 3)
+
+	if stats1.MessagesSent == 0 || stats1.Retransmissions == 0 || stats1.Disconnections == 0 {
+		t.Fatalf("the script did not exercise the network: %+v", stats1)
+	}
+	if stats1 != stats2 {
+		t.Fatalf("runs with the same seed differ: %+v and %+v", stats1, stats2)
+	}
+	if !reflect.DeepEqual(log1, log2) {
+		for i := 0; i < len(log1) && i < len(log2); i++ {
+			if log1[i] != log2[i] {
+				t.Fatalf("runs with the same seed differ at event %d: %q and %q", i, log1[i], log2[i])
+			}
+		}
+		t.Fatalf("runs with the same seed saw %d and %d events", len(log1), len(log2))
+	}
+
+	log3, _ := runScriptedSim(t, 4)
+	if reflect.DeepEqual(log1, log3) {
+		t.Fatal("runs with different seeds are identical")
+	}
+}
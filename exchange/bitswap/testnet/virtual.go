@@ -22,9 +22,17 @@ import (
 var log = logging.Logger("bstestnet")
 
 func VirtualNetwork(rs mockrouting.Server, d delay.D) Network {
+	return VirtualNetworkWithPeerDelays(rs, d, nil)
+}
+
+// VirtualNetworkWithPeerDelays creates a virtual network where the messages
+// sent by a peer are delayed by peerDelay(p), or by d if peerDelay is nil or
+// returns nil.
+func VirtualNetworkWithPeerDelays(rs mockrouting.Server, d delay.D, peerDelay func(peer.ID) delay.D) Network {
 	return &network{
 		clients:       make(map[peer.ID]*receiverQueue),
 		delay:         d,
+		peerDelay:     peerDelay,
 		routingserver: rs,
 		conns:         make(map[string]struct{}),
 	}
@@ -35,6 +43,7 @@ type network struct {
 	clients       map[peer.ID]*receiverQueue
 	routingserver mockrouting.Server
 	delay         delay.D
+	peerDelay     func(peer.ID) delay.D
 	conns         map[string]struct{}
 }
 
@@ -97,20 +106,29 @@ func (n *network) SendMessage(
 	msg := &message{
 		from:       from,
 		msg:        mes,
-		shouldSend: time.Now().Add(n.delay.Get()),
+		shouldSend: time.Now().Add(n.delayFor(from).Get()),
 	}
 	receiver.enqueue(msg)
 
 	return nil
 }
 
+func (n *network) delayFor(p peer.ID) delay.D {
+	if n.peerDelay != nil {
+		if d := n.peerDelay(p); d != nil {
+			return d
+		}
+	}
+	return n.delay
+}
+
 func (n *network) deliver(
 	r bsnet.Receiver, from peer.ID, message bsmsg.BitSwapMessage) error {
 	if message == nil || from == "" {
 		return errors.New("Invalid input")
 	}
 
-	n.delay.Wait()
+	n.delayFor(from).Wait()
 
 	r.ReceiveMessage(context.TODO(), from, message)
 	return nil
@@ -42,12 +42,18 @@ func (g *SessionGenerator) Close() error {
 }
 
 func (g *SessionGenerator) Next() Instance {
+	return g.NextWithOptions()
+}
+
+// NextWithOptions creates an instance whose bitswap is configured with the
+// given options.
+func (g *SessionGenerator) NextWithOptions(opts ...Option) Instance {
 	g.seq++
 	p, err := p2ptestutil.RandTestBogusIdentity()
 	if err != nil {
 		panic("FIXME") // TODO change signature
 	}
-	return MkSession(g.ctx, g.net, p)
+	return MkSession(g.ctx, g.net, p, opts...)
 }
 
 func (g *SessionGenerator) Instances(n int) []Instance {
@@ -86,7 +92,7 @@ func (i *Instance) SetBlockstoreLatency(t time.Duration) time.Duration {
 // NB: It's easy make mistakes by providing the same peer ID to two different
 // sessions. To safeguard, use the SessionGenerator to generate sessions. It's
 // just a much better idea.
-func MkSession(ctx context.Context, net tn.Network, p testutil.Identity) Instance {
+func MkSession(ctx context.Context, net tn.Network, p testutil.Identity, opts ...Option) Instance {
 	bsdelay := delay.Fixed(0)
 
 	adapter := net.Adapter(p)
@@ -101,7 +107,7 @@ func MkSession(ctx context.Context, net tn.Network, p testutil.Identity) Instanc
 
 	const alwaysSendToPeer = true
 
-	bs := New(ctx, p.ID(), adapter, bstore, alwaysSendToPeer).(*Bitswap)
+	bs := New(ctx, p.ID(), adapter, bstore, alwaysSendToPeer, opts...).(*Bitswap)
 
 	return Instance{
 		Peer:            p.ID(),
@@ -0,0 +1,199 @@
+// Package replay replays bitswap traces on a test network. It is kept apart
+// from package trace so that nodes recording traces don't link the test
+// network.
+package replay
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
+	trace "github.com/ipfs/go-ipfs/exchange/bitswap/trace"
+
+	delay "gx/ipfs/QmRJVNatYJwTAHgdSM1Xef9QVQ1Ch3XHdmcrykjP5Y4soL/go-ipfs-delay"
+	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+// Options configures Replay.
+type Options struct {
+	// Network is the test network the trace is replayed on. Defaults to a
+	// virtual network without delays.
+	Network tn.Network
+
+	// Speed scales the time between wants: 2 replays twice as fast as the
+	// trace. 0 makes all the wants at once.
+	Speed float64
+}
+
+// Result describes how a replay went.
+type Result struct {
+	Duration time.Duration
+
+	// Fetched is the number of wanted blocks that arrived
+	Fetched int
+
+	// Missing are the wanted blocks, as named in the trace, that no peer
+	// sent in the trace and so couldn't be fetched
+	Missing []string
+
+	DupBlocks uint64
+	DupData   uint64
+}
+
+// Replay recreates the peers of a trace on a test network, each holding a
+// stand-in of the same size for every block it sent the traced node. A fresh
+// node then wants the blocks the traced node wanted, at the same relative
+// times, until all the blocks the peers hold arrived or ctx is cancelled.
+func Replay(ctx context.Context, events []*trace.Event, opts Options) (*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// work out who had which blocks, and what was wanted when
+	var peers []string
+	holds := make(map[string]map[string]int)
+	var wants []*timedWant
+	wanted := make(map[string]bool)
+	var start time.Time
+	for i, ev := range events {
+		if i == 0 || ev.Time.Before(start) {
+			start = ev.Time
+		}
+		if _, ok := holds[ev.Peer]; !ok {
+			peers = append(peers, ev.Peer)
+			holds[ev.Peer] = make(map[string]int)
+		}
+		switch ev.Direction {
+		case trace.In:
+			for _, b := range ev.Blocks {
+				holds[ev.Peer][b.Cid] = b.Size
+			}
+		case trace.Out:
+			for _, w := range ev.Wants {
+				if w.Cancel || wanted[w.Cid] {
+					continue
+				}
+				wanted[w.Cid] = true
+				wants = append(wants, &timedWant{cid: w.Cid, at: ev.Time})
+			}
+		}
+	}
+	sort.SliceStable(wants, func(i, j int) bool {
+		return wants[i].at.Before(wants[j].at)
+	})
+
+	net := opts.Network
+	if net == nil {
+		net = tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(0))
+	}
+	sg := bitswap.NewTestSessionGenerator(net)
+	defer sg.Close()
+	inst := sg.Instances(len(peers) + 1)
+	local := inst[0]
+
+	standIns := make(map[string]blocks.Block)
+	standIn := func(c string, size int) blocks.Block {
+		b, ok := standIns[c]
+		if !ok {
+			data := []byte(c)
+			if size > len(data) {
+				data = append(data, make([]byte, size-len(data))...)
+			}
+			b = blocks.NewBlock(data)
+			standIns[c] = b
+		}
+		return b
+	}
+
+	available := make(map[string]bool)
+	for i, p := range peers {
+		for c, size := range holds[p] {
+			if err := inst[i+1].Blockstore().Put(standIn(c, size)); err != nil {
+				return nil, err
+			}
+			available[c] = true
+		}
+	}
+
+	var expected int
+	for c := range wanted {
+		if available[c] {
+			expected++
+		}
+	}
+
+	var lk sync.Mutex
+	fetched := make(map[string]bool)
+	done := make(chan struct{})
+	if expected == 0 {
+		close(done)
+	}
+
+	ses := local.Exchange.NewSession(ctx)
+	replayStart := time.Now()
+	go func() {
+		for _, w := range wants {
+			if opts.Speed > 0 {
+				at := replayStart.Add(time.Duration(float64(w.at.Sub(start)) / opts.Speed))
+				select {
+				case <-time.After(time.Until(at)):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			b := standIn(w.cid, 0)
+			ch, err := ses.GetBlocks(ctx, []*cid.Cid{b.Cid()})
+			if err != nil {
+				return
+			}
+			go func(c string, ch <-chan blocks.Block) {
+				for range ch {
+					lk.Lock()
+					fetched[c] = true
+					if len(fetched) == expected {
+						close(done)
+					}
+					lk.Unlock()
+				}
+			}(w.cid, ch)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	res := &Result{Duration: time.Since(replayStart)}
+	lk.Lock()
+	res.Fetched = len(fetched)
+	for c := range wanted {
+		if !available[c] {
+			res.Missing = append(res.Missing, c)
+		}
+	}
+	lk.Unlock()
+	sort.Strings(res.Missing)
+
+	st, err := local.Exchange.Stat()
+	if err != nil {
+		return nil, err
+	}
+	res.DupBlocks = st.DupBlksReceived
+	res.DupData = st.DupDataReceived
+
+	if res.Fetched < expected {
+		return res, ctx.Err()
+	}
+	return res, nil
+}
+
+type timedWant struct {
+	cid string
+	at  time.Time
+}
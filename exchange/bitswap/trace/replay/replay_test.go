@@ -0,0 +1,55 @@
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	trace "github.com/ipfs/go-ipfs/exchange/bitswap/trace"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+func TestReplay(t *testing.T) {
+	a, b := peer.ID("peer-a"), peer.ID("peer-b")
+	blks := []blocks.Block{
+		blocks.NewBlock([]byte("one")),
+		blocks.NewBlock([]byte("two")),
+		blocks.NewBlock([]byte("three")),
+	}
+
+	// a node asks a and b for three blocks, a sends two of them and b says
+	// it doesn't have the third
+	now := time.Unix(1000, 0)
+	wants := bsmsg.New(true)
+	for i, blk := range blks {
+		wants.AddEntry(blk.Cid(), len(blks)-i)
+	}
+	events := []*trace.Event{
+		trace.NewEvent(now, a, trace.Out, wants),
+		trace.NewEvent(now, b, trace.Out, wants),
+	}
+	for i, blk := range blks[:2] {
+		m := bsmsg.New(false)
+		m.AddBlock(blk)
+		events = append(events, trace.NewEvent(now.Add(time.Duration(i+1)*100*time.Millisecond), a, trace.In, m))
+	}
+	m := bsmsg.New(false)
+	m.AddDontHave(blks[2].Cid())
+	events = append(events, trace.NewEvent(now.Add(300*time.Millisecond), b, trace.In, m))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := Replay(ctx, events, Options{Speed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Fetched != 2 {
+		t.Fatalf("expected 2 blocks to be fetched, got %d", res.Fetched)
+	}
+	if len(res.Missing) != 1 || res.Missing[0] != blks[2].Cid().String() {
+		t.Fatalf("expected the third block to be missing, got %v", res.Missing)
+	}
+}
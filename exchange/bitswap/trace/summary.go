@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"sort"
+	"time"
+)
+
+// Summary describes a trace from the point of view of the traced node.
+type Summary struct {
+	Start    time.Time
+	End      time.Time
+	Messages int
+
+	// Peers are the peers messages were exchanged with, sorted by ID
+	Peers []*PeerSummary
+
+	// Unanswered are the blocks that were wanted but never arrived, oldest
+	// want first
+	Unanswered []*Stall
+
+	// Slowest are the wanted blocks that took the longest to arrive
+	Slowest []*Fetch
+}
+
+// PeerSummary counts the messages exchanged with a peer.
+type PeerSummary struct {
+	Peer        string
+	MessagesIn  int
+	MessagesOut int
+	WantsIn     int
+	WantsOut    int
+	CancelsIn   int
+	CancelsOut  int
+	BlocksIn    int
+	BlocksOut   int
+	BytesIn     int64
+	BytesOut    int64
+	HavesIn     int
+	DontHavesIn int
+
+	// DupBlocksIn are the blocks received from the peer after they already
+	// arrived from someone else
+	DupBlocksIn int
+}
+
+// Fetch is a wanted block that arrived.
+type Fetch struct {
+	Cid     string
+	Wanted  time.Time
+	Latency time.Duration
+	From    string
+}
+
+// Stall is a wanted block that never arrived.
+type Stall struct {
+	Cid    string
+	Wanted time.Time
+	// Asked are the peers the block was asked from, and DontHaves the ones
+	// that said they don't have it
+	Asked     []string
+	DontHaves []string
+}
+
+// Summarize summarizes a trace, listing at most slowest of the slowest
+// fetches.
+func Summarize(events []*Event, slowest int) *Summary {
+	s := new(Summary)
+	peers := make(map[string]*PeerSummary)
+	wanted := make(map[string]*Stall)
+	received := make(map[string]bool)
+	var fetches []*Fetch
+
+	for _, ev := range events {
+		if s.Messages == 0 || ev.Time.Before(s.Start) {
+			s.Start = ev.Time
+		}
+		if ev.Time.After(s.End) {
+			s.End = ev.Time
+		}
+		s.Messages++
+
+		ps, ok := peers[ev.Peer]
+		if !ok {
+			ps = &PeerSummary{Peer: ev.Peer}
+			peers[ev.Peer] = ps
+		}
+
+		if ev.Direction == Out {
+			ps.MessagesOut++
+			for _, w := range ev.Wants {
+				if w.Cancel {
+					ps.CancelsOut++
+					continue
+				}
+				ps.WantsOut++
+				if received[w.Cid] {
+					continue
+				}
+				st, ok := wanted[w.Cid]
+				if !ok {
+					st = &Stall{Cid: w.Cid, Wanted: ev.Time}
+					wanted[w.Cid] = st
+				}
+				st.Asked = appendUnique(st.Asked, ev.Peer)
+			}
+			for _, b := range ev.Blocks {
+				ps.BlocksOut++
+				ps.BytesOut += int64(b.Size)
+			}
+			continue
+		}
+
+		ps.MessagesIn++
+		for _, w := range ev.Wants {
+			if w.Cancel {
+				ps.CancelsIn++
+			} else {
+				ps.WantsIn++
+			}
+		}
+		ps.HavesIn += len(ev.Haves)
+		ps.DontHavesIn += len(ev.DontHaves)
+		for _, c := range ev.DontHaves {
+			if st, ok := wanted[c]; ok {
+				st.DontHaves = appendUnique(st.DontHaves, ev.Peer)
+			}
+		}
+		for _, b := range ev.Blocks {
+			ps.BlocksIn++
+			ps.BytesIn += int64(b.Size)
+			if received[b.Cid] {
+				ps.DupBlocksIn++
+				continue
+			}
+			received[b.Cid] = true
+			if st, ok := wanted[b.Cid]; ok {
+				fetches = append(fetches, &Fetch{
+					Cid:     b.Cid,
+					Wanted:  st.Wanted,
+					Latency: ev.Time.Sub(st.Wanted),
+					From:    ev.Peer,
+				})
+				delete(wanted, b.Cid)
+			}
+		}
+	}
+
+	for _, ps := range peers {
+		s.Peers = append(s.Peers, ps)
+	}
+	sort.Slice(s.Peers, func(i, j int) bool {
+		return s.Peers[i].Peer < s.Peers[j].Peer
+	})
+
+	for _, st := range wanted {
+		s.Unanswered = append(s.Unanswered, st)
+	}
+	sort.Slice(s.Unanswered, func(i, j int) bool {
+		a, b := s.Unanswered[i], s.Unanswered[j]
+		if a.Wanted.Equal(b.Wanted) {
+			return a.Cid < b.Cid
+		}
+		return a.Wanted.Before(b.Wanted)
+	})
+
+	sort.SliceStable(fetches, func(i, j int) bool {
+		return fetches[i].Latency > fetches[j].Latency
+	})
+	if len(fetches) > slowest {
+		fetches = fetches[:slowest]
+	}
+	s.Slowest = fetches
+
+	return s
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
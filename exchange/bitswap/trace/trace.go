@@ -0,0 +1,148 @@
+// Package trace records the messages a bitswap node exchanges and summarizes
+// the recordings. Package trace/replay replays them on a test network.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
+
+	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+var log = logging.Logger("bitswap/trace")
+
+// Directions of a traced message.
+const (
+	In  = "in"
+	Out = "out"
+)
+
+// Event is a single traced message.
+type Event struct {
+	Time time.Time `json:"time"`
+	Peer string    `json:"peer"`
+	// Direction is In for messages received from Peer, Out for messages
+	// sent to it
+	Direction string `json:"dir"`
+
+	Full      bool     `json:"full,omitempty"`
+	Wants     []Want   `json:"wants,omitempty"`
+	Blocks    []Block  `json:"blocks,omitempty"`
+	Haves     []string `json:"haves,omitempty"`
+	DontHaves []string `json:"dont_haves,omitempty"`
+}
+
+// Want is a wantlist entry of a traced message.
+type Want struct {
+	Cid          string `json:"cid"`
+	Priority     int    `json:"priority,omitempty"`
+	Cancel       bool   `json:"cancel,omitempty"`
+	Have         bool   `json:"have,omitempty"`
+	SendDontHave bool   `json:"send_dont_have,omitempty"`
+}
+
+// Block is a block carried by a traced message.
+type Block struct {
+	Cid  string `json:"cid"`
+	Size int    `json:"size"`
+}
+
+// NewEvent describes a message exchanged with p at time t.
+func NewEvent(t time.Time, p peer.ID, dir string, m bsmsg.BitSwapMessage) *Event {
+	ev := &Event{
+		Time:      t,
+		Peer:      p.Pretty(),
+		Direction: dir,
+		Full:      m.Full(),
+	}
+	for _, e := range m.Wantlist() {
+		ev.Wants = append(ev.Wants, Want{
+			Cid:          e.Cid.String(),
+			Priority:     e.Priority,
+			Cancel:       e.Cancel,
+			Have:         e.WantType == wantlist.WantHave,
+			SendDontHave: e.SendDontHave,
+		})
+	}
+	for _, b := range m.Blocks() {
+		ev.Blocks = append(ev.Blocks, Block{
+			Cid:  b.Cid().String(),
+			Size: len(b.RawData()),
+		})
+	}
+	for _, c := range m.Haves() {
+		ev.Haves = append(ev.Haves, c.String())
+	}
+	for _, c := range m.DontHaves() {
+		ev.DontHaves = append(ev.DontHaves, c.String())
+	}
+	return ev
+}
+
+// Writer writes the messages it is told about as JSON events, one per line.
+// It implements bitswap/network.Tracer.
+type Writer struct {
+	lk  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewWriter creates a Writer writing events to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:   w,
+		enc: json.NewEncoder(w),
+		now: time.Now,
+	}
+}
+
+func (tw *Writer) MessageReceived(from peer.ID, m bsmsg.BitSwapMessage) {
+	tw.write(NewEvent(tw.now(), from, In, m))
+}
+
+func (tw *Writer) MessageSent(to peer.ID, m bsmsg.BitSwapMessage) {
+	tw.write(NewEvent(tw.now(), to, Out, m))
+}
+
+func (tw *Writer) write(ev *Event) {
+	tw.lk.Lock()
+	defer tw.lk.Unlock()
+	if err := tw.enc.Encode(ev); err != nil {
+		log.Errorf("error writing bitswap trace: %s", err)
+	}
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (tw *Writer) Close() error {
+	tw.lk.Lock()
+	defer tw.lk.Unlock()
+	if c, ok := tw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Read reads all the events of a trace.
+func Read(r io.Reader) ([]*Event, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var events []*Event
+	for {
+		ev := new(Event)
+		err := dec.Decode(ev)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+// writeTestTrace traces a node asking a and b for three blocks: a sends two
+// of them, b sends one of those again, and says it doesn't have the third.
+func writeTestTrace(t *testing.T) ([]*Event, []blocks.Block) {
+	a, b := peer.ID("peer-a"), peer.ID("peer-b")
+	blks := []blocks.Block{
+		blocks.NewBlock([]byte("one")),
+		blocks.NewBlock([]byte("two")),
+		blocks.NewBlock([]byte("three")),
+	}
+
+	now := time.Unix(1000, 0)
+	buf := new(bytes.Buffer)
+	tw := NewWriter(buf)
+	tw.now = func() time.Time { return now }
+
+	wants := bsmsg.New(true)
+	for i, blk := range blks {
+		wants.AddEntry(blk.Cid(), len(blks)-i)
+	}
+	tw.MessageSent(a, wants)
+	tw.MessageSent(b, wants)
+
+	now = now.Add(100 * time.Millisecond)
+	m := bsmsg.New(false)
+	m.AddBlock(blks[0])
+	tw.MessageReceived(a, m)
+
+	now = now.Add(400 * time.Millisecond)
+	m = bsmsg.New(false)
+	m.AddBlock(blks[1])
+	tw.MessageReceived(a, m)
+
+	m = bsmsg.New(false)
+	m.AddBlock(blks[0])
+	m.AddDontHave(blks[2].Cid())
+	tw.MessageReceived(b, m)
+
+	events, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events, blks
+}
+
+func TestSummarize(t *testing.T) {
+	events, blks := writeTestTrace(t)
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(events))
+	}
+
+	s := Summarize(events, 1)
+	if s.Messages != 5 || s.End.Sub(s.Start) != 500*time.Millisecond {
+		t.Fatalf("unexpected summary: %d messages over %s", s.Messages, s.End.Sub(s.Start))
+	}
+
+	if len(s.Peers) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(s.Peers))
+	}
+	pa, pb := s.Peers[0], s.Peers[1]
+	if pa.Peer != peer.ID("peer-a").Pretty() {
+		pa, pb = pb, pa
+	}
+	if pa.WantsOut != 3 || pa.BlocksIn != 2 || pa.BytesIn != 6 || pa.DupBlocksIn != 0 {
+		t.Fatalf("unexpected summary for a: %+v", pa)
+	}
+	if pb.BlocksIn != 1 || pb.DupBlocksIn != 1 || pb.DontHavesIn != 1 {
+		t.Fatalf("unexpected summary for b: %+v", pb)
+	}
+
+	if len(s.Slowest) != 1 || s.Slowest[0].Cid != blks[1].Cid().String() || s.Slowest[0].Latency != 500*time.Millisecond {
+		t.Fatalf("unexpected slowest fetch: %+v", s.Slowest)
+	}
+
+	if len(s.Unanswered) != 1 || s.Unanswered[0].Cid != blks[2].Cid().String() {
+		t.Fatalf("expected the third block to be unanswered, got %+v", s.Unanswered)
+	}
+	if st := s.Unanswered[0]; len(st.Asked) != 2 || len(st.DontHaves) != 1 {
+		t.Fatalf("unexpected stall: %+v", st)
+	}
+}
@@ -19,10 +19,27 @@ type Wantlist struct {
 	set map[string]*Entry
 }
 
+// WantType distinguishes requests for a block from requests to be told
+// whether a peer has it.
+type WantType int
+
+const (
+	// WantBlock asks for the block itself.
+	WantBlock WantType = iota
+	// WantHave only asks whether the peer has the block.
+	WantHave
+)
+
 type Entry struct {
 	Cid      *cid.Cid
 	Priority int
 
+	// WantType is the kind of want, WantBlock unless set otherwise.
+	WantType WantType
+	// SendDontHave asks the peer to tell us when it does not have the block,
+	// rather than stay silent.
+	SendDontHave bool
+
 	SesTrk map[uint64]struct{}
 }
 
@@ -79,13 +96,50 @@ func (w *ThreadSafe) Add(c *cid.Cid, priority int, ses uint64) bool {
 	return true
 }
 
-// AddEntry adds given Entry to the wantlist. For more information see Add method.
+// AddTyped adds the given cid like Add does, recording the kind of want. A
+// WantBlock for a cid previously only added as a WantHave upgrades the entry,
+// in which case AddTyped also returns true.
+func (w *ThreadSafe) AddTyped(c *cid.Cid, priority int, wt WantType, sendDontHave bool, ses uint64) bool {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	k := c.KeyString()
+	if e, ok := w.set[k]; ok {
+		e.SesTrk[ses] = struct{}{}
+		if e.WantType == WantHave && wt == WantBlock {
+			e.WantType = WantBlock
+			e.SendDontHave = sendDontHave
+			return true
+		}
+		return false
+	}
+
+	w.set[k] = &Entry{
+		Cid:          c,
+		Priority:     priority,
+		WantType:     wt,
+		SendDontHave: sendDontHave,
+		SesTrk:       map[uint64]struct{}{ses: struct{}{}},
+	}
+
+	return true
+}
+
+// AddEntry adds given Entry to the wantlist. For more information see Add
+// method. Like AddTyped, a WantBlock entry upgrades an existing WantHave one,
+// but AddEntry only returns true for new cids.
 func (w *ThreadSafe) AddEntry(e *Entry, ses uint64) bool {
 	w.lk.Lock()
 	defer w.lk.Unlock()
 	k := e.Cid.KeyString()
 	if ex, ok := w.set[k]; ok {
 		ex.SesTrk[ses] = struct{}{}
+		if ex.WantType == WantHave && e.WantType == WantBlock {
+			// entries may be shared with other wantlists, don't modify ex
+			up := *ex
+			up.WantType = WantBlock
+			up.SendDontHave = e.SendDontHave
+			w.set[k] = &up
+		}
 		return false
 	}
 	w.set[k] = e
@@ -102,3 +102,64 @@ func TestSesRefWantlist(t *testing.T) {
 	}
 	assertNotHasCid(t, wl, testcids[0])
 }
+
+func TestAddTypedUpgradesWantHave(t *testing.T) {
+	wl := NewThreadSafe()
+
+	if !wl.AddTyped(testcids[0], 5, WantHave, true, 1) {
+		t.Fatal("expected true")
+	}
+	if wl.AddTyped(testcids[0], 5, WantHave, true, 2) {
+		t.Fatal("adding the same want-have twice should return false")
+	}
+	if !wl.AddTyped(testcids[0], 5, WantBlock, false, 2) {
+		t.Fatal("upgrading to a want-block should return true")
+	}
+	if wl.AddTyped(testcids[0], 5, WantHave, true, 3) {
+		t.Fatal("a want-have should not downgrade a want-block")
+	}
+
+	e, _ := wl.Contains(testcids[0])
+	if e.WantType != WantBlock || e.SendDontHave {
+		t.Fatal("expected a want-block entry without send-dont-have")
+	}
+
+	if wl.Remove(testcids[0], 1) || wl.Remove(testcids[0], 2) {
+		t.Fatal("entry should still be tracked by a session")
+	}
+	if !wl.Remove(testcids[0], 3) {
+		t.Fatal("expected last remove to return true")
+	}
+}
+
+func TestAddEntryUpgradesWantHave(t *testing.T) {
+	wl := NewThreadSafe()
+	other := NewThreadSafe()
+
+	have := NewRefEntry(testcids[0], 5)
+	have.WantType = WantHave
+	have.SendDontHave = true
+	if !wl.AddEntry(have, 1) || !other.AddEntry(have, 1) {
+		t.Fatal("expected true")
+	}
+
+	block := NewRefEntry(testcids[0], 5)
+	if wl.AddEntry(block, 2) {
+		t.Fatal("AddEntry should only return true for new cids")
+	}
+
+	e, _ := wl.Contains(testcids[0])
+	if e.WantType != WantBlock || e.SendDontHave {
+		t.Fatal("expected the entry to be upgraded to a want-block")
+	}
+	if e, _ := other.Contains(testcids[0]); e.WantType != WantHave {
+		t.Fatal("upgrading an entry should not affect other wantlists sharing it")
+	}
+
+	have2 := NewRefEntry(testcids[0], 5)
+	have2.WantType = WantHave
+	wl.AddEntry(have2, 3)
+	if e, _ := wl.Contains(testcids[0]); e.WantType != WantBlock {
+		t.Fatal("a want-have should not downgrade a want-block")
+	}
+}
@@ -79,12 +79,26 @@ type msgQueue struct {
 // WantBlocks adds the given cids to the wantlist, tracked by the given session
 func (pm *WantManager) WantBlocks(ctx context.Context, ks []*cid.Cid, peers []peer.ID, ses uint64) {
 	log.Infof("want blocks: %s", ks)
-	pm.addEntries(ctx, ks, peers, false, ses)
+	pm.addEntries(ctx, ks, peers, false, wantlist.WantBlock, false, ses)
+}
+
+// WantBlocksOrDontHave is like WantBlocks, but asks peers that don't have a
+// block to tell us so
+func (pm *WantManager) WantBlocksOrDontHave(ctx context.Context, ks []*cid.Cid, peers []peer.ID, ses uint64) {
+	log.Infof("want blocks or dont have: %s", ks)
+	pm.addEntries(ctx, ks, peers, false, wantlist.WantBlock, true, ses)
+}
+
+// WantHaves asks peers whether they have the given cids, tracked by the
+// given session. Peers that don't speak bitswap 1.2.0 receive a plain want.
+func (pm *WantManager) WantHaves(ctx context.Context, ks []*cid.Cid, peers []peer.ID, ses uint64) {
+	log.Infof("want haves: %s", ks)
+	pm.addEntries(ctx, ks, peers, false, wantlist.WantHave, true, ses)
 }
 
 // CancelWants removes the given cids from the wantlist, tracked by the given session
 func (pm *WantManager) CancelWants(ctx context.Context, ks []*cid.Cid, peers []peer.ID, ses uint64) {
-	pm.addEntries(context.Background(), ks, peers, true, ses)
+	pm.addEntries(context.Background(), ks, peers, true, wantlist.WantBlock, false, ses)
 }
 
 type wantSet struct {
@@ -93,12 +107,16 @@ type wantSet struct {
 	from    uint64
 }
 
-func (pm *WantManager) addEntries(ctx context.Context, ks []*cid.Cid, targets []peer.ID, cancel bool, ses uint64) {
+func (pm *WantManager) addEntries(ctx context.Context, ks []*cid.Cid, targets []peer.ID, cancel bool, wt wantlist.WantType, sendDontHave bool, ses uint64) {
+	pc := priorityFromContext(ctx)
 	entries := make([]*bsmsg.Entry, 0, len(ks))
 	for i, k := range ks {
+		e := wantlist.NewRefEntry(k, wantPriority(pc, i))
+		e.WantType = wt
+		e.SendDontHave = sendDontHave
 		entries = append(entries, &bsmsg.Entry{
 			Cancel: cancel,
-			Entry:  wantlist.NewRefEntry(k, kMaxPriority-i),
+			Entry:  e,
 		})
 	}
 	select {
@@ -130,6 +148,22 @@ func (pm *WantManager) SendBlock(ctx context.Context, env *engine.Envelope) {
 	}
 }
 
+// SendBlockPresence tells a peer whether we have the block it asked about
+func (pm *WantManager) SendBlockPresence(ctx context.Context, env *engine.Envelope) {
+	defer env.Sent()
+
+	msg := bsmsg.New(false)
+	if env.Presence.Have {
+		msg.AddHave(env.Presence.Cid)
+	} else {
+		msg.AddDontHave(env.Presence.Cid)
+	}
+	err := pm.network.SendMessage(ctx, env.Peer, msg)
+	if err != nil {
+		log.Infof("send block presence error: %s", err)
+	}
+}
+
 func (pm *WantManager) startPeerHandler(p peer.ID) *msgQueue {
 	mq, ok := pm.peers[p]
 	if ok {
@@ -143,9 +177,9 @@ func (pm *WantManager) startPeerHandler(p peer.ID) *msgQueue {
 	fullwantlist := bsmsg.New(true)
 	for _, e := range pm.bcwl.Entries() {
 		for k := range e.SesTrk {
-			mq.wl.AddEntry(e, k)
+			mq.wl.AddTyped(e.Cid, e.Priority, e.WantType, e.SendDontHave, k)
 		}
-		fullwantlist.AddEntry(e.Cid, e.Priority)
+		fullwantlist.AddWant(e.Cid, e.Priority, e.WantType, e.SendDontHave)
 	}
 	mq.out = fullwantlist
 	mq.work <- struct{}{}
@@ -391,9 +425,9 @@ func (mq *msgQueue) addMessage(entries []*bsmsg.Entry, ses uint64) {
 				mq.out.Cancel(e.Cid)
 			}
 		} else {
-			if mq.wl.Add(e.Cid, e.Priority, ses) {
+			if mq.wl.AddTyped(e.Cid, e.Priority, e.WantType, e.SendDontHave, ses) {
 				work = true
-				mq.out.AddEntry(e.Cid, e.Priority)
+				mq.out.AddWant(e.Cid, e.Priority, e.WantType, e.SendDontHave)
 			}
 		}
 	}
@@ -0,0 +1,100 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
+
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	blocks "gx/ipfs/Qmej7nf81hi2x2tvjRBF3mcp74sQyuDH4VMYDGd1YtXjb2/go-block-format"
+)
+
+// recordingNetwork hands out message senders that pass every message sent
+// to a peer on to sent.
+type recordingNetwork struct {
+	bsnet.BitSwapNetwork
+	sent chan bsmsg.BitSwapMessage
+}
+
+func (n *recordingNetwork) ConnectTo(context.Context, peer.ID) error {
+	return nil
+}
+
+func (n *recordingNetwork) NewMessageSender(context.Context, peer.ID) (bsnet.MessageSender, error) {
+	return &recordingSender{sent: n.sent}, nil
+}
+
+type recordingSender struct {
+	sent chan bsmsg.BitSwapMessage
+}
+
+func (s *recordingSender) SendMsg(ctx context.Context, m bsmsg.BitSwapMessage) error {
+	select {
+	case s.sent <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *recordingSender) Close() error { return nil }
+func (s *recordingSender) Reset() error { return nil }
+
+func waitForWantType(t *testing.T, wl *wantlist.ThreadSafe, c *cid.Cid, wt wantlist.WantType) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if e, ok := wl.Contains(c); ok && e.WantType == wt {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s never became a want of type %d", c, wt)
+}
+
+func TestNewPeerGetsUpgradedWants(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rn := &recordingNetwork{sent: make(chan bsmsg.BitSwapMessage, 1)}
+	pm := NewWantManager(ctx, rn)
+	go pm.Run()
+
+	upgraded := blocks.NewBlock([]byte("upgraded")).Cid()
+	targeted := blocks.NewBlock([]byte("targeted")).Cid()
+
+	pm.WantHaves(ctx, []*cid.Cid{upgraded, targeted}, nil, 1)
+	pm.WantBlocks(ctx, []*cid.Cid{upgraded}, nil, 2)
+	// a want-block sent to specific peers must not be replayed to new ones
+	pm.WantBlocks(ctx, []*cid.Cid{targeted}, []peer.ID{peer.ID("other")}, 3)
+
+	waitForWantType(t, pm.bcwl, upgraded, wantlist.WantBlock)
+	waitForWantType(t, pm.wl, targeted, wantlist.WantBlock)
+
+	pm.Connected(peer.ID("newcomer"))
+
+	var msg bsmsg.BitSwapMessage
+	select {
+	case msg = <-rn.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new peer was never sent our wantlist")
+	}
+
+	if !msg.Full() {
+		t.Fatal("expected a full wantlist")
+	}
+	types := make(map[string]wantlist.WantType)
+	for _, e := range msg.Wantlist() {
+		types[e.Cid.KeyString()] = e.WantType
+	}
+	if wt, ok := types[upgraded.KeyString()]; !ok || wt != wantlist.WantBlock {
+		t.Fatal("the upgraded want should be replayed as a want-block")
+	}
+	if wt, ok := types[targeted.KeyString()]; !ok || wt != wantlist.WantHave {
+		t.Fatal("the broadcast want-have should be replayed as a want-have")
+	}
+}
@@ -0,0 +1,175 @@
+package bitswap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	dsns "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/namespace"
+	dsq "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/query"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
+)
+
+// wantStorePrefix is where persistent wants are kept in the datastore.
+var wantStorePrefix = ds.NewKey("/bitswap/wants")
+
+type persistentWantsKey struct{}
+
+// persistentWants tracks the wants persisted on behalf of one context.
+type persistentWants struct {
+	lk   sync.Mutex
+	bs   *Bitswap
+	keys []*cid.Cid
+}
+
+// ContextWithPersistentWants marks the blocks requested with the returned
+// context as long-lived. If bitswap was given a datastore with
+// WithPersistentWants, they are recorded there until they arrive, so that
+// they are fetched again after a restart even if nobody asks for them anymore.
+//
+// The returned function forgets the recorded wants whose blocks haven't
+// arrived yet. Call it when the blocks aren't needed anymore, e.g. when the
+// operation they were requested for failed or was cancelled. It does nothing
+// while bitswap is shutting down, so that interrupted wants are resumed.
+func ContextWithPersistentWants(ctx context.Context) (context.Context, func()) {
+	pw := &persistentWants{}
+	return context.WithValue(ctx, persistentWantsKey{}, pw), pw.forget
+}
+
+func persistentWantsFrom(ctx context.Context) *persistentWants {
+	pw, _ := ctx.Value(persistentWantsKey{}).(*persistentWants)
+	return pw
+}
+
+func (pw *persistentWants) add(bs *Bitswap, ks []*cid.Cid) {
+	pw.lk.Lock()
+	defer pw.lk.Unlock()
+	pw.bs = bs
+	pw.keys = append(pw.keys, ks...)
+}
+
+func (pw *persistentWants) forget() {
+	pw.lk.Lock()
+	bs, ks := pw.bs, pw.keys
+	pw.keys = nil
+	pw.lk.Unlock()
+
+	if bs == nil || bs.shuttingDown() {
+		return
+	}
+	for _, c := range ks {
+		if err := bs.wantStore.remove(c); err != nil {
+			log.Errorf("error removing persisted want: %s", err)
+		}
+	}
+}
+
+// wantStore records persistent wants along with the time they were first
+// made.
+type wantStore struct {
+	ds ds.Datastore
+
+	lk    sync.Mutex
+	wants map[string]struct{}
+}
+
+func newWantStore(d ds.Datastore) *wantStore {
+	return &wantStore{
+		ds:    dsns.Wrap(d, wantStorePrefix),
+		wants: make(map[string]struct{}),
+	}
+}
+
+// add records the given wants, unless they already are.
+func (ws *wantStore) add(ks []*cid.Cid, now time.Time) error {
+	val, err := now.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	ws.lk.Lock()
+	defer ws.lk.Unlock()
+	for _, c := range ks {
+		if _, ok := ws.wants[c.KeyString()]; ok {
+			continue
+		}
+		if err := ws.ds.Put(dshelp.CidToDsKey(c), val); err != nil {
+			return err
+		}
+		ws.wants[c.KeyString()] = struct{}{}
+	}
+	return nil
+}
+
+// remove forgets a want once its block arrived.
+func (ws *wantStore) remove(c *cid.Cid) error {
+	ws.lk.Lock()
+	defer ws.lk.Unlock()
+	if _, ok := ws.wants[c.KeyString()]; !ok {
+		return nil
+	}
+	delete(ws.wants, c.KeyString())
+
+	err := ws.ds.Delete(dshelp.CidToDsKey(c))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// load returns the recorded wants, and the time the last of them expires.
+// Wants older than maxAge are deleted instead. A maxAge of 0 keeps wants
+// until their block arrives, and load then returns a zero time.
+func (ws *wantStore) load(maxAge time.Duration, now time.Time) ([]*cid.Cid, time.Time, error) {
+	var latest time.Time
+	res, err := ws.ds.Query(dsq.Query{})
+	if err != nil {
+		return nil, latest, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, latest, err
+	}
+
+	ws.lk.Lock()
+	defer ws.lk.Unlock()
+
+	var ks []*cid.Cid
+	for _, e := range entries {
+		dk := ds.RawKey(e.Key)
+		c, err := dshelp.DsKeyToCid(dk)
+		if err != nil {
+			log.Errorf("decoding persisted want %s: %s", e.Key, err)
+			continue
+		}
+
+		var added time.Time
+		data, ok := e.Value.([]byte)
+		if !ok {
+			return nil, latest, fmt.Errorf("persisted want %s was not a []byte", c)
+		}
+		if err := added.UnmarshalBinary(data); err != nil {
+			return nil, latest, err
+		}
+
+		if maxAge > 0 {
+			expiry := added.Add(maxAge)
+			if !now.Before(expiry) {
+				if err := ws.ds.Delete(dk); err != nil {
+					return nil, latest, err
+				}
+				continue
+			}
+			if expiry.After(latest) {
+				latest = expiry
+			}
+		}
+
+		ws.wants[c.KeyString()] = struct{}{}
+		ks = append(ks, c)
+	}
+	return ks, latest, nil
+}
@@ -0,0 +1,98 @@
+package bitswap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
+
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	dssync "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/sync"
+	process "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
+)
+
+func TestWantStoreSurvivesRestart(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bgen := blocksutil.NewBlockGenerator()
+	a, b, c := bgen.Next().Cid(), bgen.Next().Cid(), bgen.Next().Cid()
+
+	start := time.Now()
+	ws := newWantStore(d)
+	if err := ws.add([]*cid.Cid{a, b}, start); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.add([]*cid.Cid{c}, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.remove(b); err != nil {
+		t.Fatal(err)
+	}
+
+	ws = newWantStore(d)
+	keys, until, err := ws.load(0, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !until.IsZero() {
+		t.Fatalf("expected 2 wants kept forever, got %d until %s", len(keys), until)
+	}
+
+	// a expires, c doesn't
+	ws = newWantStore(d)
+	keys, until, err = ws.load(90*time.Minute, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || !keys[0].Equals(c) {
+		t.Fatalf("expected only c to be left, got %v", keys)
+	}
+	if !until.Equal(start.Add(150 * time.Minute)) {
+		t.Fatalf("unexpected expiry %s", until)
+	}
+	if has, _ := d.Has(wantStorePrefix.Child(dshelp.CidToDsKey(a))); has {
+		t.Fatal("expired want should have been deleted")
+	}
+}
+
+func TestPersistentWantsOnlyWithContext(t *testing.T) {
+	if persistentWantsFrom(context.Background()) != nil {
+		t.Fatal("wants should not be persistent by default")
+	}
+	ctx, _ := ContextWithPersistentWants(context.Background())
+	if persistentWantsFrom(ctx) == nil {
+		t.Fatal("expected wants to be persistent")
+	}
+}
+
+func TestForgetPersistentWants(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bgen := blocksutil.NewBlockGenerator()
+	a, b := bgen.Next().Cid(), bgen.Next().Cid()
+
+	bsctx, cancel := context.WithCancel(context.Background())
+	bs := &Bitswap{
+		wantStore: newWantStore(d),
+		ctx:       bsctx,
+		process:   process.WithTeardown(func() error { return nil }),
+	}
+
+	// a cancelled or failed request forgets its wants
+	ctx, forget := ContextWithPersistentWants(context.Background())
+	bs.persistWants(ctx, []*cid.Cid{a})
+	forget()
+	if has, _ := d.Has(wantStorePrefix.Child(dshelp.CidToDsKey(a))); has {
+		t.Fatal("forgotten want should have been deleted")
+	}
+
+	// but not while shutting down, they are resumed on the next start
+	ctx, forget = ContextWithPersistentWants(context.Background())
+	bs.persistWants(ctx, []*cid.Cid{b})
+	cancel()
+	forget()
+	if has, _ := d.Has(wantStorePrefix.Child(dshelp.CidToDsKey(b))); !has {
+		t.Fatal("want should be kept when bitswap shuts down")
+	}
+}
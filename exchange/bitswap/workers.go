@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
 	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 
 	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
@@ -59,6 +60,10 @@ func (bs *Bitswap) taskWorker(ctx context.Context, id int) {
 				if !ok {
 					continue
 				}
+				if envelope.Block == nil {
+					bs.wm.SendBlockPresence(ctx, envelope)
+					continue
+				}
 				log.Event(ctx, "Bitswap.TaskWorker.Work", logging.LoggableF(func() map[string]interface{} {
 					return logging.LoggableMap{
 						"ID":     id,
@@ -67,17 +72,13 @@ func (bs *Bitswap) taskWorker(ctx context.Context, id int) {
 					}
 				}))
 
-				// update the BS ledger to reflect sent message
-				// TODO: Should only track *useful* messages in ledger
-				outgoing := bsmsg.New(false)
-				outgoing.AddBlock(envelope.Block)
-				bs.engine.MessageSent(envelope.Peer, outgoing)
-
-				bs.wm.SendBlock(ctx, envelope)
-				bs.counterLk.Lock()
-				bs.counters.blocksSent++
-				bs.counters.dataSent += uint64(len(envelope.Block.RawData()))
-				bs.counterLk.Unlock()
+				// with upload limits, each peer waits for its allowance in
+				// its own queue rather than in this shared worker
+				if bs.sendLimiter.limited() {
+					bs.sendQueues.push(ctx, envelope)
+					continue
+				}
+				bs.sendBlock(ctx, envelope)
 			case <-ctx.Done():
 				return
 			}
@@ -87,6 +88,27 @@ func (bs *Bitswap) taskWorker(ctx context.Context, id int) {
 	}
 }
 
+// sendBlock sends the block in envelope to its peer, once the upload limits
+// allow it.
+func (bs *Bitswap) sendBlock(ctx context.Context, envelope *decision.Envelope) {
+	if err := bs.sendLimiter.wait(ctx, envelope.Peer, len(envelope.Block.RawData())); err != nil {
+		envelope.Sent()
+		return
+	}
+
+	// update the BS ledger to reflect sent message
+	// TODO: Should only track *useful* messages in ledger
+	outgoing := bsmsg.New(false)
+	outgoing.AddBlock(envelope.Block)
+	bs.engine.MessageSent(envelope.Peer, outgoing)
+
+	bs.wm.SendBlock(ctx, envelope)
+	bs.counterLk.Lock()
+	bs.counters.blocksSent++
+	bs.counters.dataSent += uint64(len(envelope.Block.RawData()))
+	bs.counterLk.Unlock()
+}
+
 func (bs *Bitswap) provideWorker(px process.Process) {
 
 	limit := make(chan struct{}, provideWorkerMax)
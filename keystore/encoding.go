@@ -0,0 +1,160 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+	pb "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto/pb"
+)
+
+// Formats keys can be exported and imported in.
+const (
+	// FormatLibp2p is the protobuf encoding used by libp2p and by the
+	// keystore itself. It can't be password protected.
+	FormatLibp2p = "libp2p-protobuf"
+
+	// FormatPEM is a PEM encoded PKCS#8 key, as used by OpenSSL. With a
+	// password, the key is encrypted with PBES2, using scrypt and AES-256-CBC.
+	// Keys encrypted with PBKDF2 and AES-128-CBC or AES-256-CBC, as OpenSSL
+	// does by default, can be imported too.
+	FormatPEM = "pem-pkcs8"
+)
+
+// EnvKeyPassword is the environment variable holding the password of keys
+// exported or imported by the ipfs command.
+const EnvKeyPassword = "IPFS_KEY_PASSWORD"
+
+const (
+	pemPrivateKey          = "PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	pemRSAPrivateKey       = "RSA PRIVATE KEY"
+)
+
+// EncodeKey encodes a private key in the given format, encrypting it with
+// password if it isn't empty.
+func EncodeKey(k ci.PrivKey, format string, password []byte) ([]byte, error) {
+	// fail early, and with their own error, for keys that can't be
+	// exported, like those held by a signer
+	if _, err := k.Bytes(); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatLibp2p:
+		if len(password) > 0 {
+			return nil, fmt.Errorf("keys in the %s format can't be password protected, use %s", FormatLibp2p, FormatPEM)
+		}
+		return ci.MarshalPrivateKey(k)
+	case FormatPEM:
+		der, err := marshalPKCS8(k)
+		if err != nil {
+			return nil, err
+		}
+
+		typ := pemPrivateKey
+		if len(password) > 0 {
+			der, err = encryptPKCS8(der, password)
+			if err != nil {
+				return nil, err
+			}
+			typ = pemEncryptedPrivateKey
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("unknown key format %q, must be %s or %s", format, FormatLibp2p, FormatPEM)
+	}
+}
+
+// DecodeKey decodes a private key encoded by EncodeKey. If format is empty,
+// it is guessed from the data. PEM encoded PKCS#1 RSA keys are accepted too.
+func DecodeKey(data []byte, format string, password []byte) (ci.PrivKey, error) {
+	if format == "" {
+		format = FormatLibp2p
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+			format = FormatPEM
+		}
+	}
+
+	switch format {
+	case FormatLibp2p:
+		return ci.UnmarshalPrivateKey(data)
+	case FormatPEM:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM data found")
+		}
+
+		switch block.Type {
+		case pemPrivateKey:
+			return unmarshalPKCS8(block.Bytes)
+		case pemEncryptedPrivateKey:
+			if len(password) == 0 {
+				return nil, errors.New("key is encrypted, a password is needed")
+			}
+			der, err := decryptPKCS8(block.Bytes, password)
+			if err != nil {
+				return nil, err
+			}
+			return unmarshalPKCS8(der)
+		case pemRSAPrivateKey:
+			if x509.IsEncryptedPEMBlock(block) {
+				return nil, errors.New("legacy encrypted PEM keys are not supported, convert the key to PKCS#8")
+			}
+			return ci.UnmarshalRsaPrivateKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown key format %q, must be %s or %s", format, FormatLibp2p, FormatPEM)
+	}
+}
+
+func marshalPKCS8(k ci.PrivKey) ([]byte, error) {
+	b, err := ci.MarshalPrivateKey(k)
+	if err != nil {
+		return nil, err
+	}
+	key := new(pb.PrivateKey)
+	if err := proto.Unmarshal(b, key); err != nil {
+		return nil, err
+	}
+
+	data := key.GetData()
+	switch key.GetType() {
+	case pb.KeyType_RSA:
+		// libp2p stores RSA keys in PKCS#1
+		return marshalPKCS8RSA(data)
+	case pb.KeyType_Ed25519:
+		// libp2p stores the seed followed by the public key
+		if len(data) < 64 {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return marshalPKCS8Ed25519(data[:32])
+	default:
+		return nil, fmt.Errorf("%s keys can't be exported as PKCS#8", key.GetType())
+	}
+}
+
+func unmarshalPKCS8(der []byte) (ci.PrivKey, error) {
+	algo, data, err := parsePKCS8(der)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case algo.Equal(oidRSA):
+		return ci.UnmarshalRsaPrivateKey(data)
+	case algo.Equal(oidEd25519):
+		// ed25519 keys are derived from their seed, which is all
+		// GenerateEd25519Key reads
+		sk, _, err := ci.GenerateEd25519Key(bytes.NewReader(data))
+		return sk, err
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %s", algo)
+	}
+}
@@ -0,0 +1,418 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// EnvPassphrase is the environment variable the keystore passphrase can be
+// given in, so daemons can be started unattended.
+const EnvPassphrase = "IPFS_KEYSTORE_PASSPHRASE"
+
+var ErrKeystoreLocked = errors.New("keystore is encrypted and has not been unlocked")
+var ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+
+// paramsFile holds the key derivation parameters of an encrypted keystore.
+// Names starting with a period are never valid key names, so it can't clash
+// with a key.
+const paramsFile = ".encryption"
+
+// identityFile holds the node's private key, when it has been moved out of
+// the config into the keystore.
+const identityFile = ".identity"
+
+// Default scrypt parameters, costing about 32MB and a tenth of a second on
+// current hardware per unlock.
+const (
+	defaultScryptLogN = 15
+	defaultScryptR    = 8
+	defaultScryptP    = 1
+)
+
+// keyCheck is sealed with the derived key to tell a wrong passphrase from a
+// corrupted key file.
+var keyCheck = []byte("ipfs keystore")
+
+type encryptionParams struct {
+	Version int
+	Salt    []byte
+	LogN    uint
+	R       int
+	P       int
+	Check   []byte
+}
+
+// IdentityStore is implemented by keystores that can hold the node's private
+// key in place of the config.
+type IdentityStore interface {
+	// Identity returns the node's private key, or ErrNoSuchKey if the
+	// keystore doesn't hold it.
+	Identity() (ci.PrivKey, error)
+}
+
+// EncryptedKeystore is a keystore backed by files in a given directory, each
+// key encrypted with AES-GCM under a key derived from a passphrase with
+// scrypt. Key names are not encrypted, so Has, List and Delete work before
+// the keystore is unlocked; Get and Put return ErrKeystoreLocked.
+type EncryptedKeystore struct {
+	dir    string
+	params *encryptionParams
+	aead   cipher.AEAD
+}
+
+var _ Keystore = (*EncryptedKeystore)(nil)
+var _ IdentityStore = (*EncryptedKeystore)(nil)
+
+// IsEncrypted returns whether the keystore in dir is encrypted.
+func IsEncrypted(dir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, paramsFile))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// NewEncryptedKeystore creates an encrypted keystore in dir, which must not
+// hold a keystore already, and returns it unlocked with passphrase.
+func NewEncryptedKeystore(dir string, passphrase []byte) (*EncryptedKeystore, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore passphrase must not be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		return nil, fmt.Errorf("cannot create an encrypted keystore in %s: directory is not empty", dir)
+	}
+
+	params := &encryptionParams{
+		Version: 1,
+		Salt:    make([]byte, 32),
+		LogN:    defaultScryptLogN,
+		R:       defaultScryptR,
+		P:       defaultScryptP,
+	}
+	if _, err := io.ReadFull(rand.Reader, params.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := params.deriveAEAD(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	params.Check, err = seal(aead, keyCheck, []byte(paramsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileExclusive(filepath.Join(dir, paramsFile), b); err != nil {
+		return nil, err
+	}
+
+	return &EncryptedKeystore{dir: dir, params: params, aead: aead}, nil
+}
+
+// OpenEncryptedKeystore opens the encrypted keystore in dir. It has to be
+// unlocked before keys can be read or stored.
+func OpenEncryptedKeystore(dir string) (*EncryptedKeystore, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, paramsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	params := new(encryptionParams)
+	if err := json.Unmarshal(b, params); err != nil {
+		return nil, fmt.Errorf("invalid keystore encryption parameters: %s", err)
+	}
+	if params.Version != 1 {
+		return nil, fmt.Errorf("unsupported keystore encryption version %d", params.Version)
+	}
+
+	return &EncryptedKeystore{dir: dir, params: params}, nil
+}
+
+// Unlock derives the keystore's encryption key from passphrase, returning
+// ErrWrongPassphrase if it isn't the one the keystore was created with.
+func (ks *EncryptedKeystore) Unlock(passphrase []byte) error {
+	aead, err := ks.params.deriveAEAD(passphrase)
+	if err != nil {
+		return err
+	}
+
+	check, err := open(aead, ks.params.Check, []byte(paramsFile))
+	if err != nil || !bytes.Equal(check, keyCheck) {
+		return ErrWrongPassphrase
+	}
+
+	ks.aead = aead
+	return nil
+}
+
+// Locked returns whether the keystore still has to be unlocked.
+func (ks *EncryptedKeystore) Locked() bool {
+	return ks.aead == nil
+}
+
+// Has returns whether or not a key exist in the Keystore
+func (ks *EncryptedKeystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Put stores a key in the Keystore, if a key with the same name already exists, returns ErrKeyExists
+func (ks *EncryptedKeystore) Put(name string, k ci.PrivKey) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	return ks.put(name, k)
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns ErrNoSuchKey
+// otherwise.
+func (ks *EncryptedKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	return ks.get(name)
+}
+
+// Delete removes a key from the Keystore
+func (ks *EncryptedKeystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(ks.dir, name))
+}
+
+// List returns a list of key identifier
+func (ks *EncryptedKeystore) List() ([]string, error) {
+	names, err := readDirNames(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == paramsFile || name == identityFile {
+			continue
+		}
+		if err := validateName(name); err == nil {
+			list = append(list, name)
+		} else {
+			log.Warningf("Ignoring the invalid keyfile: %s", name)
+		}
+	}
+
+	return list, nil
+}
+
+// Identity returns the node's private key, or ErrNoSuchKey if it is still
+// kept in the config.
+func (ks *EncryptedKeystore) Identity() (ci.PrivKey, error) {
+	return ks.get(identityFile)
+}
+
+// SetIdentity stores the node's private key in the keystore.
+func (ks *EncryptedKeystore) SetIdentity(k ci.PrivKey) error {
+	return ks.put(identityFile, k)
+}
+
+func (ks *EncryptedKeystore) put(file string, k ci.PrivKey) error {
+	if ks.Locked() {
+		return ErrKeystoreLocked
+	}
+
+	b, err := k.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// the file name is authenticated so keys can't be swapped around
+	sealed, err := seal(ks.aead, b, []byte(file))
+	if err != nil {
+		return err
+	}
+
+	err = writeFileExclusive(filepath.Join(ks.dir, file), sealed)
+	if os.IsExist(err) {
+		return ErrKeyExists
+	}
+	return err
+}
+
+func (ks *EncryptedKeystore) get(file string) (ci.PrivKey, error) {
+	if ks.Locked() {
+		return nil, ErrKeystoreLocked
+	}
+
+	sealed, err := ioutil.ReadFile(filepath.Join(ks.dir, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+
+	b, err := open(ks.aead, sealed, []byte(file))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key %s: %s", file, err)
+	}
+
+	return ci.UnmarshalPrivateKey(b)
+}
+
+// EncryptKeystore moves the keys of the plaintext keystore in dir, and the
+// node's private key if identity isn't nil, into a new encrypted keystore
+// in its place. It returns the new keystore, unlocked with passphrase.
+func EncryptKeystore(dir string, passphrase []byte, identity ci.PrivKey) (*EncryptedKeystore, error) {
+	if enc, err := IsEncrypted(dir); err != nil {
+		return nil, err
+	} else if enc {
+		return nil, errors.New("keystore is already encrypted")
+	}
+
+	plain, err := NewFSKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := plain.List()
+	if err != nil {
+		return nil, err
+	}
+
+	// build the encrypted keystore next to the old one, so an interrupted
+	// migration leaves the old one untouched
+	tmp := dir + ".encrypting"
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	ks, err := NewEncryptedKeystore(tmp, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		k, err := plain.Get(name)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+		if err := ks.Put(name, k); err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+	}
+	if identity != nil {
+		if err := ks.SetIdentity(identity); err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+	}
+
+	old := dir + ".plaintext"
+	if err := os.Rename(dir, old); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(old, dir)
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	ks.dir = dir
+
+	if err := os.RemoveAll(old); err != nil {
+		log.Errorf("failed to remove the plaintext keystore %s: %s", old, err)
+	}
+	return ks, nil
+}
+
+func (p *encryptionParams) deriveAEAD(passphrase []byte) (cipher.AEAD, error) {
+	if p.LogN == 0 || p.LogN > 30 {
+		return nil, fmt.Errorf("invalid scrypt cost 2^%d", p.LogN)
+	}
+
+	key, err := scryptKey(passphrase, p.Salt, 1<<p.LogN, p.R, p.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data, prefixing the result with the random nonce it used.
+func seal(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, ad), nil
+}
+
+func open(aead cipher.AEAD, sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], ad)
+}
+
+func readDirNames(dir string) ([]string, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	return d.Readdirnames(0)
+}
+
+func writeFileExclusive(path string, data []byte) error {
+	fi, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fi.Write(data)
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestScryptVectors(t *testing.T) {
+	// from RFC 7914, section 12
+	vectors := []struct {
+		pass, salt string
+		N, r, p    int
+		out        string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+
+	for _, v := range vectors {
+		out, err := scryptKey([]byte(v.pass), []byte(v.salt), v.N, v.r, v.p, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(out) != v.out {
+			t.Fatalf("scrypt(%q, %q) = %x, expected %s", v.pass, v.salt, out, v.out)
+		}
+	}
+}
+
+func TestEncryptedKeystoreBasics(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	ks, err := NewEncryptedKeystore(tdir, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k1 := privKeyOrFatal(t)
+	k2 := privKeyOrFatal(t)
+
+	if err := ks.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", k2); err != ErrKeyExists {
+		t.Fatalf("expected %s, got %v", ErrKeyExists, err)
+	}
+	if err := ks.SetIdentity(k2); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(tdir, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := k1.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, plain) {
+		t.Fatal("key was stored unencrypted")
+	}
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0] != "foo" {
+		t.Fatalf("expected only foo to be listed, got %v", l)
+	}
+
+	// reopen it, as a restarted node would
+	ks, err = OpenEncryptedKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("foo"); err != ErrKeystoreLocked {
+		t.Fatalf("expected %s, got %v", ErrKeystoreLocked, err)
+	}
+	if has, err := ks.Has("foo"); err != nil || !has {
+		t.Fatal("locked keystore should still know it has foo")
+	}
+
+	if err := ks.Unlock([]byte("hunter3")); err != ErrWrongPassphrase {
+		t.Fatalf("expected %s, got %v", ErrWrongPassphrase, err)
+	}
+	if err := ks.Unlock([]byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertGetKey(ks, "foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ks.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Equals(k2) {
+		t.Fatal("identity didn't match")
+	}
+
+	if _, err := ks.Get("bar"); err != ErrNoSuchKey {
+		t.Fatalf("expected %s, got %v", ErrNoSuchKey, err)
+	}
+	if err := ks.Put(".identity", k1); err == nil {
+		t.Fatal("shouldnt be able to put a key over the identity")
+	}
+
+	// a key file moved to another name must not decrypt
+	if err := os.Rename(filepath.Join(tdir, "foo"), filepath.Join(tdir, "bar")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("bar"); err == nil {
+		t.Fatal("renamed key file should not decrypt")
+	}
+}
+
+func TestEncryptKeystore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+	dir := filepath.Join(tdir, "keystore")
+
+	plain, err := NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1 := privKeyOrFatal(t)
+	k2 := privKeyOrFatal(t)
+	self := privKeyOrFatal(t)
+	if err := plain.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Put("bar", k2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EncryptKeystore(dir, []byte("hunter2"), self); err != nil {
+		t.Fatal(err)
+	}
+
+	if enc, err := IsEncrypted(dir); err != nil || !enc {
+		t.Fatal("keystore should be encrypted")
+	}
+	if _, err := EncryptKeystore(dir, []byte("hunter2"), nil); err == nil {
+		t.Fatal("shouldnt be able to encrypt a keystore twice")
+	}
+
+	// nothing but the keystore should be left
+	if err := assertDirContents(tdir, []string{"keystore"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := OpenEncryptedKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Unlock([]byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	if len(l) != 2 || l[0] != "bar" || l[1] != "foo" {
+		t.Fatalf("wrong entries listed: %v", l)
+	}
+	if err := assertGetKey(ks, "foo", k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertGetKey(ks, "bar", k2); err != nil {
+		t.Fatal(err)
+	}
+	id, err := ks.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Equals(self) {
+		t.Fatal("identity didn't match")
+	}
+}
@@ -0,0 +1,298 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var (
+	oidRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidEd25519   = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidPBES2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidPBKDF2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// ErrWrongPassword is returned when decrypting a key with the wrong password.
+var ErrWrongPassword = errors.New("wrong password, or corrupted key")
+
+// Bounds on the work an encrypted key can make us do.
+const (
+	maxScryptMemory     = 256 << 20
+	maxScryptP          = 16
+	maxPBKDF2Iterations = 10000000
+)
+
+// pkcs8ScryptLogN is the scrypt cost of exported keys. It is lower than the
+// keystore's, as OpenSSL refuses to use more than 32MB by default.
+const pkcs8ScryptLogN = 14
+
+// pkcs8 is a PKCS#8 PrivateKeyInfo, or a OneAsymmetricKey from RFC 5958.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue `asn1:"optional,tag:0"`
+	PublicKey  asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// encryptedPKCS8 is a PKCS#8 EncryptedPrivateKeyInfo.
+type encryptedPKCS8 struct {
+	Algo pkix.AlgorithmIdentifier
+	Data []byte
+}
+
+// pbes2Params are the PBES2 parameters from RFC 8018.
+type pbes2Params struct {
+	KDF    pkix.AlgorithmIdentifier
+	Cipher pkix.AlgorithmIdentifier
+}
+
+// scryptParams are the scrypt parameters from RFC 7914.
+type scryptParams struct {
+	Salt      []byte
+	N         int
+	R         int
+	P         int
+	KeyLength int `asn1:"optional"`
+}
+
+// pbkdf2Params are the PBKDF2 parameters from RFC 8018. The PRF defaults to
+// HMAC-SHA1 when left out.
+type pbkdf2Params struct {
+	Salt      []byte
+	Iter      int
+	KeyLength int                      `asn1:"optional"`
+	PRF       pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// marshalPKCS8RSA wraps a PKCS#1 RSA private key in PKCS#8.
+func marshalPKCS8RSA(pkcs1 []byte) ([]byte, error) {
+	return asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.NullRawValue},
+		PrivateKey: pkcs1,
+	})
+}
+
+// marshalPKCS8Ed25519 encodes an ed25519 private key, given by its 32 byte
+// seed, in PKCS#8 as RFC 8410 describes.
+func marshalPKCS8Ed25519(seed []byte) ([]byte, error) {
+	inner, err := asn1.Marshal(seed)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+		PrivateKey: inner,
+	})
+}
+
+// parsePKCS8 returns the algorithm of a PKCS#8 private key, and the key: a
+// PKCS#1 key for RSA, the seed for ed25519.
+func parsePKCS8(der []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var key pkcs8
+	rest, err := asn1.Unmarshal(der, &key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid PKCS#8 key: %s", err)
+	}
+	if len(rest) > 0 {
+		return nil, nil, errors.New("invalid PKCS#8 key: trailing data")
+	}
+
+	switch {
+	case key.Algo.Algorithm.Equal(oidRSA):
+		return oidRSA, key.PrivateKey, nil
+	case key.Algo.Algorithm.Equal(oidEd25519):
+		var seed []byte
+		if _, err := asn1.Unmarshal(key.PrivateKey, &seed); err != nil {
+			return nil, nil, fmt.Errorf("invalid ed25519 key: %s", err)
+		}
+		if len(seed) != 32 {
+			return nil, nil, fmt.Errorf("invalid ed25519 key: seed is %d bytes long", len(seed))
+		}
+		return oidEd25519, seed, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key algorithm %s", key.Algo.Algorithm)
+	}
+}
+
+// encryptPKCS8 encrypts a PKCS#8 key with PBES2, using scrypt to derive an
+// AES-256-CBC key from password.
+func encryptPKCS8(der, password []byte) ([]byte, error) {
+	sp := scryptParams{
+		Salt:      make([]byte, 16),
+		N:         1 << pkcs8ScryptLogN,
+		R:         defaultScryptR,
+		P:         defaultScryptP,
+		KeyLength: 32,
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, sp.Salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	key, err := scryptKey(password, sp.Salt, sp.N, sp.R, sp.P, sp.KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// PKCS#7 padding
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := make([]byte, len(der), len(der)+pad)
+	copy(data, der)
+	data = append(data, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	spb, err := asn1.Marshal(sp)
+	if err != nil {
+		return nil, err
+	}
+	ivb, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KDF:    pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: spb}},
+		Cipher: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivb}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPKCS8{
+		Algo: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data: data,
+	})
+}
+
+// decryptPKCS8 decrypts a key encrypted by encryptPKCS8, or by other tools
+// like OpenSSL. PBES2 is supported with scrypt, or PBKDF2 with HMAC-SHA1 or
+// HMAC-SHA256, to derive an AES-128-CBC or AES-256-CBC key.
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var enc encryptedPKCS8
+	if _, err := asn1.Unmarshal(der, &enc); err != nil {
+		return nil, fmt.Errorf("invalid encrypted PKCS#8 key: %s", err)
+	}
+	if !enc.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s, only PBES2 is supported", enc.Algo.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(enc.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %s", err)
+	}
+
+	var keyLen int
+	switch {
+	case params.Cipher.Algorithm.Equal(oidAES128CBC):
+		keyLen = 16
+	case params.Cipher.Algorithm.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported key cipher %s, only AES-128-CBC and AES-256-CBC are supported", params.Cipher.Algorithm)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Cipher.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC parameters")
+	}
+	if len(enc.Data) == 0 || len(enc.Data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted key length")
+	}
+
+	key, err := pbes2Key(params.KDF, password, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, len(enc.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, enc.Data)
+
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, ErrWrongPassword
+	}
+	for _, b := range data[len(data)-pad:] {
+		if int(b) != pad {
+			return nil, ErrWrongPassword
+		}
+	}
+	data = data[:len(data)-pad]
+
+	// a wrong password could still give valid padding by chance
+	if _, _, err := parsePKCS8(data); err != nil {
+		return nil, ErrWrongPassword
+	}
+	return data, nil
+}
+
+// pbes2Key derives a keyLen byte key from password with the key derivation
+// function of a PBES2 encrypted key.
+func pbes2Key(kdf pkix.AlgorithmIdentifier, password []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidScrypt):
+		var sp scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &sp); err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameters: %s", err)
+		}
+		if sp.KeyLength != 0 && sp.KeyLength != keyLen {
+			return nil, fmt.Errorf("invalid scrypt key length %d for the cipher", sp.KeyLength)
+		}
+		if sp.N <= 0 || sp.R <= 0 || sp.P <= 0 || sp.P > maxScryptP ||
+			sp.R > maxScryptMemory/128 || sp.N > maxScryptMemory/(128*sp.R) {
+			return nil, fmt.Errorf("scrypt parameters N=%d r=%d p=%d are out of bounds", sp.N, sp.R, sp.P)
+		}
+		return scryptKey(password, sp.Salt, sp.N, sp.R, sp.P, keyLen)
+
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var pp pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &pp); err != nil {
+			return nil, fmt.Errorf("invalid PBKDF2 parameters: %s", err)
+		}
+		if pp.KeyLength != 0 && pp.KeyLength != keyLen {
+			return nil, fmt.Errorf("invalid PBKDF2 key length %d for the cipher", pp.KeyLength)
+		}
+		if pp.Iter <= 0 || pp.Iter > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("PBKDF2 iteration count %d is out of bounds", pp.Iter)
+		}
+
+		var h func() hash.Hash
+		switch {
+		case len(pp.PRF.Algorithm) == 0, pp.PRF.Algorithm.Equal(oidHMACSHA1):
+			h = sha1.New
+		case pp.PRF.Algorithm.Equal(oidHMACSHA2):
+			h = sha256.New
+		default:
+			return nil, fmt.Errorf("unsupported PBKDF2 function %s, only HMAC-SHA1 and HMAC-SHA256 are supported", pp.PRF.Algorithm)
+		}
+		return pbkdf2Key(h, password, pp.Salt, pp.Iter, keyLen), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %s, only scrypt and PBKDF2 are supported", kdf.Algorithm)
+	}
+}
@@ -0,0 +1,160 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// scryptKey derives a keyLen byte key from a passphrase and salt with the
+// scrypt function of RFC 7914. N is the CPU/memory cost and must be a power
+// of two; r is the block size and p the parallelization.
+func scryptKey(passphrase, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of two greater than one")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || N > (1<<30)/(128*r) {
+		return nil, errors.New("scrypt: parameters are too large")
+	}
+
+	b := pbkdf2SHA256(passphrase, salt, p*128*r)
+
+	x := make([]uint32, 32*r)
+	y := make([]uint32, 32*r)
+	v := make([]uint32, 32*r*N)
+	for i := 0; i < p; i++ {
+		smix(b[i*128*r:(i+1)*128*r], r, N, v, x, y)
+	}
+
+	return pbkdf2SHA256(passphrase, b, keyLen), nil
+}
+
+// pbkdf2SHA256 is PBKDF2 with HMAC-SHA256 and a single iteration, which is
+// all scrypt needs.
+func pbkdf2SHA256(passphrase, salt []byte, keyLen int) []byte {
+	return pbkdf2Key(sha256.New, passphrase, salt, 1, keyLen)
+}
+
+// pbkdf2Key derives a keyLen byte key from a passphrase and salt with PBKDF2
+// from RFC 8018, using HMAC with the hash function h.
+func pbkdf2Key(h func() hash.Hash, passphrase, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(h, passphrase)
+	var ctr [4]byte
+	var u []byte
+	out := make([]byte, 0, keyLen+prf.Size())
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(ctr[:], block)
+		prf.Write(ctr[:])
+		n := len(out)
+		out = prf.Sum(out)
+
+		t := out[n:]
+		u = append(u[:0], t...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return out[:keyLen]
+}
+
+// smix mixes the 128*r bytes of b in place, using v as the N blocks of
+// scratch memory that make scrypt memory-hard.
+func smix(b []byte, r, N int, v, x, y []uint32) {
+	blockWords := 32 * r
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+
+	for i := 0; i < N; i++ {
+		copy(v[i*blockWords:], x)
+		blockMix(x, y, r)
+	}
+
+	for i := 0; i < N; i++ {
+		j := int(x[(2*r-1)*16] & uint32(N-1))
+		vj := v[j*blockWords : (j+1)*blockWords]
+		for k := range x {
+			x[k] ^= vj[k]
+		}
+		blockMix(x, y, r)
+	}
+
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+}
+
+// blockMix runs the salsa20/8 core over the 2*r 64 byte chunks of b, using y
+// as scratch space, and leaves the result in b with the even chunks first.
+func blockMix(b, y []uint32, r int) {
+	var t [16]uint32
+	copy(t[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for k := range t {
+			t[k] ^= b[i*16+k]
+		}
+		salsa208(&t)
+
+		// even chunks go to the first half, odd ones to the second
+		dst := (i/2 + (i%2)*r) * 16
+		copy(y[dst:dst+16], t[:])
+	}
+	copy(b, y)
+}
+
+func salsa208(b *[16]uint32) {
+	x := *b
+	for i := 0; i < 8; i += 2 {
+		// columns
+		x[4] ^= rotl(x[0]+x[12], 7)
+		x[8] ^= rotl(x[4]+x[0], 9)
+		x[12] ^= rotl(x[8]+x[4], 13)
+		x[0] ^= rotl(x[12]+x[8], 18)
+		x[9] ^= rotl(x[5]+x[1], 7)
+		x[13] ^= rotl(x[9]+x[5], 9)
+		x[1] ^= rotl(x[13]+x[9], 13)
+		x[5] ^= rotl(x[1]+x[13], 18)
+		x[14] ^= rotl(x[10]+x[6], 7)
+		x[2] ^= rotl(x[14]+x[10], 9)
+		x[6] ^= rotl(x[2]+x[14], 13)
+		x[10] ^= rotl(x[6]+x[2], 18)
+		x[3] ^= rotl(x[15]+x[11], 7)
+		x[7] ^= rotl(x[3]+x[15], 9)
+		x[11] ^= rotl(x[7]+x[3], 13)
+		x[15] ^= rotl(x[11]+x[7], 18)
+
+		// rows
+		x[1] ^= rotl(x[0]+x[3], 7)
+		x[2] ^= rotl(x[1]+x[0], 9)
+		x[3] ^= rotl(x[2]+x[1], 13)
+		x[0] ^= rotl(x[3]+x[2], 18)
+		x[6] ^= rotl(x[5]+x[4], 7)
+		x[7] ^= rotl(x[6]+x[5], 9)
+		x[4] ^= rotl(x[7]+x[6], 13)
+		x[5] ^= rotl(x[4]+x[7], 18)
+		x[11] ^= rotl(x[10]+x[9], 7)
+		x[8] ^= rotl(x[11]+x[10], 9)
+		x[9] ^= rotl(x[8]+x[11], 13)
+		x[10] ^= rotl(x[9]+x[8], 18)
+		x[12] ^= rotl(x[15]+x[14], 7)
+		x[13] ^= rotl(x[12]+x[15], 9)
+		x[14] ^= rotl(x[13]+x[12], 13)
+		x[15] ^= rotl(x[14]+x[13], 18)
+	}
+	for i := range b {
+		b[i] += x[i]
+	}
+}
+
+func rotl(v uint32, n uint) uint32 {
+	return v<<n | v>>(32-n)
+}
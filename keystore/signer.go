@@ -0,0 +1,265 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// The signer protocol lets a separate process hold the private keys. Each
+// request is a connection to the signer's Unix socket, on which the client
+// writes one JSON encoded signerRequest followed by a newline, and reads back
+// one JSON encoded signerResponse. Byte fields are base64 encoded, and public
+// keys are in the libp2p protobuf format.
+const (
+	signerOpList      = "list"
+	signerOpPublicKey = "public-key"
+	signerOpSign      = "sign"
+)
+
+// ErrSignerReadOnly is returned when trying to add or remove keys held by an
+// external signer.
+var ErrSignerReadOnly = errors.New("keys are managed by the external signer")
+
+// ErrKeyNotExportable is returned by Bytes on keys held by an external
+// signer.
+var ErrKeyNotExportable = errors.New("key is held by the external signer and cannot be exported")
+
+// DefaultSignerTimeout is how long a signer has to answer a request. It is
+// long enough for signers asking a human for confirmation.
+const DefaultSignerTimeout = 30 * time.Second
+
+type signerRequest struct {
+	Op   string
+	Key  string `json:",omitempty"`
+	Data []byte `json:",omitempty"`
+}
+
+type signerResponse struct {
+	Keys      []string `json:",omitempty"`
+	PublicKey []byte   `json:",omitempty"`
+	Signature []byte   `json:",omitempty"`
+
+	Error     string `json:",omitempty"`
+	NoSuchKey bool   `json:",omitempty"`
+}
+
+// SignerKeystore is a keystore whose keys are held by an external signer
+// process, listening on a Unix socket. The private keys it returns can sign
+// and give their public key, but can't be exported, and keys can't be added
+// or removed.
+type SignerKeystore struct {
+	socket  string
+	timeout time.Duration
+}
+
+var _ Keystore = (*SignerKeystore)(nil)
+
+// NewSignerKeystore returns a keystore delegating to the signer listening on
+// the Unix socket at path.
+func NewSignerKeystore(path string) *SignerKeystore {
+	return &SignerKeystore{
+		socket:  path,
+		timeout: DefaultSignerTimeout,
+	}
+}
+
+// Has returns whether or not a key exist in the Keystore
+func (ks *SignerKeystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+
+	_, err := ks.call(&signerRequest{Op: signerOpPublicKey, Key: name})
+	switch err {
+	case nil:
+		return true, nil
+	case ErrNoSuchKey:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Put always fails, keys have to be added to the signer itself.
+func (ks *SignerKeystore) Put(name string, k ci.PrivKey) error {
+	return ErrSignerReadOnly
+}
+
+// Get returns a key that signs through the signer if the signer has it, and
+// returns ErrNoSuchKey otherwise.
+func (ks *SignerKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	resp, err := ks.call(&signerRequest{Op: signerOpPublicKey, Key: name})
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := ci.UnmarshalPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("signer sent an invalid public key for %s: %s", name, err)
+	}
+
+	return &signerKey{ks: ks, name: name, pub: pk}, nil
+}
+
+// Delete always fails, keys have to be removed from the signer itself.
+func (ks *SignerKeystore) Delete(name string) error {
+	return ErrSignerReadOnly
+}
+
+// List returns a list of key identifier
+func (ks *SignerKeystore) List() ([]string, error) {
+	resp, err := ks.call(&signerRequest{Op: signerOpList})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(resp.Keys))
+	for _, name := range resp.Keys {
+		if err := validateName(name); err == nil {
+			list = append(list, name)
+		} else {
+			log.Warningf("Ignoring the invalid signer key: %s", name)
+		}
+	}
+	return list, nil
+}
+
+func (ks *SignerKeystore) call(req *signerRequest) (*signerResponse, error) {
+	conn, err := net.DialTimeout("unix", ks.socket, ks.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the signer: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(ks.timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("could not send the signer request: %s", err)
+	}
+
+	resp := new(signerResponse)
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("could not read the signer response: %s", err)
+	}
+
+	if resp.NoSuchKey {
+		return nil, ErrNoSuchKey
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("signer: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// signerKey is a private key held by the signer.
+type signerKey struct {
+	ks   *SignerKeystore
+	name string
+	pub  ci.PubKey
+}
+
+func (k *signerKey) Bytes() ([]byte, error) {
+	return nil, ErrKeyNotExportable
+}
+
+func (k *signerKey) Equals(o ci.Key) bool {
+	sk, ok := o.(ci.PrivKey)
+	if !ok {
+		return false
+	}
+	return k.pub.Equals(sk.GetPublic())
+}
+
+func (k *signerKey) Sign(data []byte) ([]byte, error) {
+	resp, err := k.ks.call(&signerRequest{Op: signerOpSign, Key: k.name, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	// don't hand out bad signatures, in case the key changed under us
+	if ok, err := k.pub.Verify(data, resp.Signature); err != nil || !ok {
+		return nil, fmt.Errorf("signer returned an invalid signature for %s", k.name)
+	}
+	return resp.Signature, nil
+}
+
+func (k *signerKey) GetPublic() ci.PubKey {
+	return k.pub
+}
+
+// ServeSigner answers signer protocol requests on l with the keys of ks,
+// until l is closed. It is a stand-in for a real signer in tests, and a
+// reference for writing one; it keeps the keys no safer than ks does.
+func ServeSigner(l net.Listener, ks Keystore) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(DefaultSignerTimeout))
+
+			req := new(signerRequest)
+			if err := json.NewDecoder(conn).Decode(req); err != nil {
+				log.Debugf("bad signer request: %s", err)
+				return
+			}
+
+			if err := json.NewEncoder(conn).Encode(handleSignerRequest(ks, req)); err != nil {
+				log.Debugf("failed to send signer response: %s", err)
+			}
+		}()
+	}
+}
+
+func handleSignerRequest(ks Keystore, req *signerRequest) *signerResponse {
+	resp := new(signerResponse)
+
+	switch req.Op {
+	case signerOpList:
+		keys, err := ks.List()
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.Keys = keys
+		return resp
+	case signerOpPublicKey, signerOpSign:
+	default:
+		resp.Error = fmt.Sprintf("unknown operation %q", req.Op)
+		return resp
+	}
+
+	sk, err := ks.Get(req.Key)
+	if err == ErrNoSuchKey {
+		resp.NoSuchKey = true
+		return resp
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	if req.Op == signerOpSign {
+		resp.Signature, err = sk.Sign(req.Data)
+	} else {
+		resp.PublicKey, err = ci.MarshalPublicKey(sk.GetPublic())
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
@@ -0,0 +1,108 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func startSigner(t *testing.T, ks Keystore) (string, func()) {
+	tdir, err := ioutil.TempDir("", "signer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(tdir, "signer.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeSigner(l, ks)
+
+	return sock, func() {
+		l.Close()
+		os.RemoveAll(tdir)
+	}
+}
+
+func TestSignerKeystore(t *testing.T) {
+	backing := NewMemKeystore()
+	k1 := privKeyOrFatal(t)
+	if err := backing.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+
+	sock, stop := startSigner(t, backing)
+	defer stop()
+
+	ks := NewSignerKeystore(sock)
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0] != "foo" {
+		t.Fatalf("expected foo to be listed, got %v", l)
+	}
+
+	if has, err := ks.Has("foo"); err != nil || !has {
+		t.Fatal("should know it has a key named foo")
+	}
+	if has, err := ks.Has("bar"); err != nil || has {
+		t.Fatal("should know it doesn't have a key named bar")
+	}
+	if _, err := ks.Get("bar"); err != ErrNoSuchKey {
+		t.Fatalf("expected %s, got %v", ErrNoSuchKey, err)
+	}
+
+	sk, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sk.GetPublic().Equals(k1.GetPublic()) {
+		t.Fatal("got the wrong public key")
+	}
+	if !sk.Equals(k1) {
+		t.Fatal("signer key should equal the key it stands for")
+	}
+
+	data := []byte("sign me")
+	sig, err := sk.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := k1.GetPublic().Verify(data, sig); err != nil || !ok {
+		t.Fatal("signature didn't verify")
+	}
+
+	if _, err := sk.Bytes(); err != ErrKeyNotExportable {
+		t.Fatalf("expected %s, got %v", ErrKeyNotExportable, err)
+	}
+	if err := ks.Put("bar", k1); err != ErrSignerReadOnly {
+		t.Fatalf("expected %s, got %v", ErrSignerReadOnly, err)
+	}
+	if err := ks.Delete("foo"); err != ErrSignerReadOnly {
+		t.Fatalf("expected %s, got %v", ErrSignerReadOnly, err)
+	}
+
+	// keys swapped behind our back must not produce bad signatures
+	backing.Delete("foo")
+	if err := backing.Put("foo", privKeyOrFatal(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sk.Sign(data); err == nil {
+		t.Fatal("expected signature from a different key to be refused")
+	}
+}
+
+func TestSignerUnreachable(t *testing.T) {
+	ks := NewSignerKeystore("/this/is/not/a/real/socket")
+	if _, err := ks.List(); err == nil {
+		t.Fatal("expected an error reaching a missing signer")
+	}
+	if _, err := ks.Get("foo"); err == nil {
+		t.Fatal("expected an error reaching a missing signer")
+	}
+}
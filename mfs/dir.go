@@ -165,15 +165,13 @@ func (d *Directory) cacheNode(name string, nd ipld.Node) (FSNode, error) {
 
 			d.childDirs[name] = ndir
 			return ndir, nil
-		case ufspb.Data_File, ufspb.Data_Raw, ufspb.Data_Symlink:
+		case ufspb.Data_File, ufspb.Data_Raw, ufspb.Data_Symlink, ufspb.Data_Metadata:
 			nfi, err := NewFile(name, nd, d, d.dserv)
 			if err != nil {
 				return nil, err
 			}
 			d.files[name] = nfi
 			return nfi, nil
-		case ufspb.Data_Metadata:
-			return nil, ErrNotYetImplemented
 		default:
 			return nil, ErrInvalidChild
 		}
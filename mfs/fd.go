@@ -127,6 +127,15 @@ func (fi *fileDescriptor) flushUp(fullsync bool) error {
 		return err
 	}
 
+	fi.inode.nodelk.Lock()
+	orig := fi.inode.node
+	fi.inode.nodelk.Unlock()
+
+	nd, err = fi.inode.wrapContent(orig, nd)
+	if err != nil {
+		return err
+	}
+
 	fi.inode.nodelk.Lock()
 	fi.inode.node = nd
 	name := fi.inode.name
@@ -53,23 +53,9 @@ func (fi *File) Open(flags int, sync bool) (FileDescriptor, error) {
 	node := fi.node
 	fi.nodelk.Unlock()
 
-	switch node := node.(type) {
-	case *dag.ProtoNode:
-		fsn, err := ft.FSNodeFromBytes(node.Data())
-		if err != nil {
-			return nil, err
-		}
-
-		switch fsn.Type {
-		default:
-			return nil, fmt.Errorf("unsupported fsnode type for 'file'")
-		case ft.TSymlink:
-			return nil, fmt.Errorf("symlinks not yet supported")
-		case ft.TFile, ft.TRaw:
-			// OK case
-		}
-	case *dag.RawNode:
-		// Ok as well.
+	node, err := fi.contentNode(node)
+	if err != nil {
+		return nil, err
 	}
 
 	switch flags {
@@ -96,11 +82,107 @@ func (fi *File) Open(flags int, sync bool) (FileDescriptor, error) {
 	}, nil
 }
 
+// contentNode returns the node holding the contents of the file node. Files
+// wrapped in a metadata node are unwrapped, see wrapContent for writing them
+// back.
+func (fi *File) contentNode(node ipld.Node) (ipld.Node, error) {
+	switch pn := node.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return nil, err
+		}
+
+		switch fsn.Type {
+		default:
+			return nil, fmt.Errorf("unsupported fsnode type for 'file'")
+		case ft.TSymlink:
+			return nil, fmt.Errorf("symlinks not yet supported")
+		case ft.TMetadata:
+			if len(pn.Links()) == 0 {
+				return nil, fmt.Errorf("incorrectly formatted metadata object")
+			}
+			child, err := pn.Links()[0].GetNode(context.TODO(), fi.dserv)
+			if err != nil {
+				return nil, err
+			}
+			return fi.contentNode(child)
+		case ft.TFile, ft.TRaw:
+			// OK case
+		}
+	case *dag.RawNode:
+		// Ok as well.
+	}
+	return node, nil
+}
+
+// wrapContent returns the node to store for the file node once its contents
+// were replaced by content. The metadata nodes the file was wrapped in are
+// rebuilt around the new contents, so that the MIME type is kept.
+func (fi *File) wrapContent(node, content ipld.Node) (ipld.Node, error) {
+	pn, ok := node.(*dag.ProtoNode)
+	if !ok {
+		return content, nil
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	if fsn.Type != ft.TMetadata {
+		return content, nil
+	}
+	if len(pn.Links()) == 0 {
+		return nil, fmt.Errorf("incorrectly formatted metadata object")
+	}
+
+	child, err := pn.Links()[0].GetNode(context.TODO(), fi.dserv)
+	if err != nil {
+		return nil, err
+	}
+	child, err = fi.wrapContent(child, content)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := ft.MetadataFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+	size, err := nodeSize(child)
+	if err != nil {
+		return nil, err
+	}
+	md.Size = uint64(size)
+	data, err := ft.BytesForMetadata(md)
+	if err != nil {
+		return nil, err
+	}
+
+	lnk, err := ipld.MakeLink(child)
+	if err != nil {
+		return nil, err
+	}
+	lnk.Name = pn.Links()[0].Name
+
+	wrapped := pn.Copy().(*dag.ProtoNode)
+	wrapped.SetLinks(append([]*ipld.Link{lnk}, pn.Links()[1:]...))
+	wrapped.SetData(data)
+	if err := fi.dserv.Add(context.TODO(), wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped, nil
+}
+
 // Size returns the size of this file
 func (fi *File) Size() (int64, error) {
 	fi.nodelk.Lock()
 	defer fi.nodelk.Unlock()
-	switch nd := fi.node.(type) {
+	return nodeSize(fi.node)
+}
+
+// nodeSize returns the size of the file held by nd.
+func nodeSize(nd ipld.Node) (int64, error) {
+	switch nd := nd.(type) {
 	case *dag.ProtoNode:
 		pbd, err := ft.FromBytes(nd.Data())
 		if err != nil {
@@ -1106,3 +1106,99 @@ func TestFileDescriptors(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMfsMetadataFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+
+	rootdir := rt.GetValue().(*Directory)
+
+	data := []byte("<html></html>")
+	fnd := fileNodeFromReader(t, ds, bytes.NewReader(data))
+	mdata, err := ft.BytesForMetadata(&ft.Metadata{MimeType: "text/html", Size: uint64(len(data))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdnode := dag.NodeWithData(mdata)
+	if err := mdnode.AddNodeLinkClean("file", fnd); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Add(ctx, mdnode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rootdir.AddChild("page.html", mdnode); err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := rootdir.Child("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := fsn.(*File)
+
+	rfd, err := fi.Open(OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(rfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfd.Close()
+	if !bytes.Equal(out, data) {
+		t.Fatalf("read %q, expected %q", out, data)
+	}
+
+	// writing keeps the file wrapped in its metadata
+	wfd, err := fi.Open(OpenWriteOnly, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wfd.WriteAt([]byte("<HTML><body></body></HTML>"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := fi.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := ft.MetadataFromBytes(nd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatalf("expected a metadata node after writing: %s", err)
+	}
+	if md.MimeType != "text/html" {
+		t.Fatalf("expected MIME type text/html after writing, got %q", md.MimeType)
+	}
+
+	// the directory links to the rewrapped file
+	dnd, err := rootdir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnk, err := dnd.(*dag.ProtoNode).GetNodeLink("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lnk.Cid.Equals(nd.Cid()) {
+		t.Fatal("the directory doesn't link to the written file")
+	}
+	if size, err := fi.Size(); err != nil || size != 26 {
+		t.Fatalf("expected a size of 26, got %d (%v)", size, err)
+	}
+	rfd, err = fi.Open(OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = ioutil.ReadAll(rfd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rfd.Close()
+	if string(out) != "<HTML><body></body></HTML>" {
+		t.Fatalf("read %q after writing", out)
+	}
+}
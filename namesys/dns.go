@@ -5,8 +5,12 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"time"
 
 	path "github.com/ipfs/go-ipfs/path"
+
+	metrics "gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
+	lru "gx/ipfs/QmVYxfoJQiZijTgPNHCHgHELvQpbsJNTg6Crmc3dQkj3yy/golang-lru"
 	isd "gx/ipfs/QmZmmuAXgX73UQmX1jRKjTGmjzq24Jinqkq8vzkBtno4uX/go-is-domain"
 )
 
@@ -15,8 +19,40 @@ type LookupTXTFunc func(name string) (txt []string, err error)
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
 	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
+
+	// lookups configured for domain suffixes, used instead of lookupTXT
+	upstreams dnsUpstreams
+
+	// TXT records by domain, kept for as long as their TTL says
+	cache       *lru.Cache
+	maxCacheTTL time.Duration
+	cacheHits   metrics.Counter
+	cacheMisses metrics.Counter
+}
+
+// DNSResolverConfig configures a DNSResolver.
+type DNSResolverConfig struct {
+	// Resolvers maps domain suffixes to the resolver used for the domains
+	// ending with them: "system" for the operating system's resolver, an
+	// https:// URL for a DNS-over-HTTPS server, or the address of a
+	// nameserver. http:// URLs are accepted for local DNS-over-HTTPS
+	// servers. The longest matching suffix is used, and "." matches all
+	// domains. Domains matching none use the system resolver.
+	Resolvers map[string]string
+
+	// CacheSize is the number of domains whose TXT records are cached.
+	// Zero disables caching.
+	CacheSize int
+
+	// MaxCacheTTL caps how long TXT records are cached, whatever their TTL.
+	// Zero means no cap.
+	MaxCacheTTL time.Duration
+}
+
+// dnsCacheEntry holds the TXT records of a domain, which can be none.
+type dnsCacheEntry struct {
+	txt []string
+	eol time.Time
 }
 
 // NewDNSResolver constructs a name resolver using DNS TXT records.
@@ -30,6 +66,41 @@ func newDNSResolver() resolver {
 	return &DNSResolver{lookupTXT: net.LookupTXT}
 }
 
+// NewDNSResolverWithConfig constructs a name resolver using DNS TXT records,
+// looked up and cached as cfg says. Cache hits and misses are counted in the
+// metrics scope of ctx.
+func NewDNSResolverWithConfig(ctx context.Context, cfg DNSResolverConfig) (*DNSResolver, error) {
+	r := &DNSResolver{
+		lookupTXT:   net.LookupTXT,
+		upstreams:   make(dnsUpstreams),
+		maxCacheTTL: cfg.MaxCacheTTL,
+	}
+
+	for suffix, spec := range cfg.Resolvers {
+		l, err := parseDNSUpstream(spec)
+		if err != nil {
+			return nil, err
+		}
+		r.upstreams[normalizeDNSSuffix(suffix)] = l
+	}
+
+	if cfg.CacheSize > 0 {
+		cache, err := lru.New(cfg.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		r.cache = cache
+
+		ctx = metrics.CtxSubScope(ctx, "dns")
+		r.cacheHits = metrics.NewCtx(ctx, "cache_hits_total",
+			"Number of TXT lookups answered from the cache").Counter()
+		r.cacheMisses = metrics.NewCtx(ctx, "cache_misses_total",
+			"Number of TXT lookups sent to a resolver").Counter()
+	}
+
+	return r, nil
+}
+
 // Resolve implements Resolver.
 func (r *DNSResolver) Resolve(ctx context.Context, name string) (path.Path, error) {
 	return r.ResolveN(ctx, name, DefaultDepthLimit)
@@ -58,10 +129,10 @@ func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path,
 	log.Debugf("DNSResolver resolving %s", domain)
 
 	rootChan := make(chan lookupRes, 1)
-	go workDomain(r, domain, rootChan)
+	go workDomain(ctx, r, domain, rootChan)
 
 	subChan := make(chan lookupRes, 1)
-	go workDomain(r, "_dnslink."+domain, subChan)
+	go workDomain(ctx, r, "_dnslink."+domain, subChan)
 
 	var subRes lookupRes
 	select {
@@ -93,8 +164,8 @@ func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path,
 	}
 }
 
-func workDomain(r *DNSResolver, name string, res chan lookupRes) {
-	txt, err := r.lookupTXT(name)
+func workDomain(ctx context.Context, r *DNSResolver, name string, res chan lookupRes) {
+	txt, err := r.lookup(ctx, name)
 
 	if err != nil {
 		// Error is != nil
@@ -112,6 +183,69 @@ func workDomain(r *DNSResolver, name string, res chan lookupRes) {
 	res <- lookupRes{"", ErrResolveFailed}
 }
 
+// lookup returns the TXT records of name, from the cache if they are there.
+func (r *DNSResolver) lookup(ctx context.Context, name string) ([]string, error) {
+	name = strings.ToLower(name)
+	if txt, ok := r.cacheGet(name); ok {
+		return txt, nil
+	}
+
+	l := r.upstreams.forDomain(name)
+	if l == nil {
+		l = systemLookup(r.lookupTXT)
+	}
+
+	txt, ttl, err := l.lookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cacheSet(name, txt, ttl)
+	return txt, nil
+}
+
+func (r *DNSResolver) cacheGet(name string) ([]string, bool) {
+	if r.cache == nil {
+		return nil, false
+	}
+
+	ientry, ok := r.cache.Get(name)
+	if ok {
+		entry, ok := ientry.(dnsCacheEntry)
+		if !ok {
+			// should never happen, purely for sanity
+			log.Panicf("unexpected type %T in cache for %q.", ientry, name)
+		}
+
+		if time.Now().Before(entry.eol) {
+			r.cacheHits.Inc()
+			return entry.txt, true
+		}
+		r.cache.Remove(name)
+	}
+
+	r.cacheMisses.Inc()
+	return nil, false
+}
+
+func (r *DNSResolver) cacheSet(name string, txt []string, ttl time.Duration) {
+	if r.cache == nil {
+		return
+	}
+
+	if r.maxCacheTTL > 0 && ttl > r.maxCacheTTL {
+		ttl = r.maxCacheTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	r.cache.Add(name, dnsCacheEntry{
+		txt: txt,
+		eol: time.Now().Add(ttl),
+	})
+}
+
 func parseEntry(txt string) (path.Path, error) {
 	p, err := path.ParseCidToPath(txt) // bare IPFS multihashes
 	if err == nil {
@@ -1,8 +1,17 @@
 package namesys
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type mockDNS struct {
@@ -158,3 +167,377 @@ func TestDNSResolution(t *testing.T) {
 	testResolution(t, r, "double.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 	testResolution(t, r, "conflict.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjE", nil)
 }
+
+// dnsStandIn answers TXT queries in the DNS wire format, like a nameserver or
+// DNS-over-HTTPS server would.
+type dnsStandIn struct {
+	lk      sync.Mutex
+	records map[string][]string
+	ttl     uint32
+	queries int
+
+	// rcode, if set, is the response code of every answer
+	rcode uint16
+}
+
+func (s *dnsStandIn) answer(query []byte) []byte {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.queries++
+
+	var labels []string
+	off := dnsHeaderLen
+	for query[off] != 0 {
+		l := int(query[off])
+		labels = append(labels, string(query[off+1:off+1+l]))
+		off += 1 + l
+	}
+	question := query[dnsHeaderLen : off+5]
+	txt, ok := s.records[strings.Join(labels, ".")]
+
+	msg := make([]byte, dnsHeaderLen)
+	copy(msg, query[:2])
+	flags := uint16(dnsFlagResponse | dnsFlagRecursion)
+	if s.rcode != 0 {
+		txt, ok = nil, true
+		flags |= s.rcode
+	} else if !ok {
+		flags |= dnsRcodeNXDomain
+	}
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(txt)))
+	msg = append(msg, question...)
+
+	rr := func(typ uint16, data []byte) {
+		// the name is a pointer to the question's
+		msg = append(msg, 0xc0, dnsHeaderLen, 0, byte(typ), 0, dnsClassINET)
+		msg = append(msg, byte(s.ttl>>24), byte(s.ttl>>16), byte(s.ttl>>8), byte(s.ttl))
+		msg = append(msg, byte(len(data)>>8), byte(len(data)))
+		msg = append(msg, data...)
+	}
+
+	for _, t := range txt {
+		// split records in character strings, as long ones have to be
+		var data []byte
+		for len(t) > 255 {
+			data = append(append(data, 255), t[:255]...)
+			t = t[255:]
+		}
+		rr(dnsTypeTXT, append(append(data, byte(len(t))), t...))
+	}
+
+	if !ok {
+		// a SOA record with a minimum TTL of half the TTL
+		binary.BigEndian.PutUint16(msg[8:], 1)
+		soa := []byte{2, 'n', 's', 0, 5, 'a', 'd', 'm', 'i', 'n', 0}
+		soa = append(soa, make([]byte, 16)...)
+		min := s.ttl / 2
+		soa = append(soa, byte(min>>24), byte(min>>16), byte(min>>8), byte(min))
+		rr(dnsTypeSOA, soa)
+	}
+	return msg
+}
+
+func (s *dnsStandIn) queryCount() int {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.queries
+}
+
+func (s *dnsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Accept") != "application/dns-message" {
+		http.Error(w, "bad accept header", http.StatusBadRequest)
+		return
+	}
+	query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/dns-message")
+	w.Write(s.answer(query))
+}
+
+func (s *dnsStandIn) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		pc.WriteTo(s.answer(buf[:n]), addr)
+	}
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	s := &dnsStandIn{
+		records: map[string][]string{
+			"_dnslink.example.com": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+		ttl: 60,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	r, err := NewDNSResolverWithConfig(context.Background(), DNSResolverConfig{
+		Resolvers: map[string]string{".": srv.URL},
+		CacheSize: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	queries := s.queryCount()
+	if queries != 2 {
+		t.Fatalf("expected example.com and _dnslink.example.com to be looked up, got %d queries", queries)
+	}
+
+	// both the records and the absence of records are cached
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "EXAMPLE.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	if s.queryCount() != queries {
+		t.Fatal("expected the records to be cached")
+	}
+
+	testResolution(t, r, "nope.example.com", DefaultDepthLimit, "", ErrResolveFailed)
+}
+
+func TestDNSCacheTTL(t *testing.T) {
+	s := &dnsStandIn{
+		records: map[string][]string{
+			"_dnslink.example.com": {"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+		},
+		ttl: 0,
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	r, err := NewDNSResolverWithConfig(context.Background(), DNSResolverConfig{
+		Resolvers: map[string]string{".": srv.URL},
+		CacheSize: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records with a zero TTL aren't cached
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	queries := s.queryCount()
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	if s.queryCount() == queries {
+		t.Fatal("records with a zero TTL shouldn't be cached")
+	}
+
+	// expired records are looked up again
+	s.lk.Lock()
+	s.ttl = 3600
+	s.lk.Unlock()
+	r, err = NewDNSResolverWithConfig(context.Background(), DNSResolverConfig{
+		Resolvers:   map[string]string{".": srv.URL},
+		CacheSize:   16,
+		MaxCacheTTL: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	queries = s.queryCount()
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	if s.queryCount() != queries {
+		t.Fatal("expected the records to be cached")
+	}
+	time.Sleep(100 * time.Millisecond)
+	testResolution(t, r, "example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	if s.queryCount() == queries {
+		t.Fatal("expected expired records to be looked up again")
+	}
+}
+
+func TestDNSNameserver(t *testing.T) {
+	long := "dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/" + strings.Repeat("a", 300)
+	s := &dnsStandIn{
+		records: map[string][]string{
+			"long.example.com": {long, "other"},
+		},
+		ttl: 60,
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go s.serveUDP(pc)
+
+	l, err := parseDNSUpstream(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txt, ttl, err := l.lookupTXT(context.Background(), "long.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 2 || txt[0] != long || txt[1] != "other" {
+		t.Fatalf("unexpected records %q", txt)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("expected a TTL of a minute, got %s", ttl)
+	}
+
+	// missing names are cached for the SOA minimum
+	txt, ttl, err = l.lookupTXT(context.Background(), "nope.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 0 || ttl != 30*time.Second {
+		t.Fatalf("expected no records for 30s, got %q for %s", txt, ttl)
+	}
+}
+
+func TestDNSUpstreamForDomain(t *testing.T) {
+	r, err := NewDNSResolverWithConfig(context.Background(), DNSResolverConfig{
+		Resolvers: map[string]string{
+			"example.com":       "10.0.0.1",
+			"corp.example.com.": "[fd00::1]:5353",
+			"Other.NET":         "https://dns.example.net/dns-query",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for domain, expected := range map[string]txtLookup{
+		"example.com":            nameserverLookup("10.0.0.1:53"),
+		"_dnslink.example.com":   nameserverLookup("10.0.0.1:53"),
+		"a.b.corp.example.com":   nameserverLookup("[fd00::1]:5353"),
+		"badexample.com":         nil,
+		"example.org":            nil,
+		"_dnslink.other.net":     r.upstreams["other.net"],
+		"_dnslink.OTHER.net.":    r.upstreams["other.net"],
+		"not-other.net.example":  nil,
+		"sub.corp.example.com.x": nil,
+	} {
+		if l := r.upstreams.forDomain(domain); l != expected {
+			t.Fatalf("%s: expected %v, got %v", domain, expected, l)
+		}
+	}
+
+	for _, spec := range []string{"udp://10.0.0.1", "10.0.0.1:53:53"} {
+		_, err := NewDNSResolverWithConfig(context.Background(), DNSResolverConfig{
+			Resolvers: map[string]string{".": spec},
+		})
+		if err == nil {
+			t.Fatalf("expected resolver %q to be refused", spec)
+		}
+	}
+}
+
+func TestUnpackMalformedDNSResponse(t *testing.T) {
+	query, err := packTXTQuery(1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsStandIn{
+		records: map[string][]string{"example.com": {"foo", "bar"}},
+		ttl:     60,
+	}
+	msg := s.answer(query)
+
+	if _, err := unpackTXTResponse(1, "example.com", msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unpackTXTResponse(2, "example.com", msg); err != errDNSMismatch {
+		t.Fatalf("expected responses to other queries to be refused, got %v", err)
+	}
+	if _, err := unpackTXTResponse(1, "example.org", msg); err != errDNSMismatch {
+		t.Fatalf("expected responses about other names to be refused, got %v", err)
+	}
+	if _, err := unpackTXTResponse(1, "EXAMPLE.com.", msg); err != nil {
+		t.Fatalf("expected names to be compared regardless of case, got %v", err)
+	}
+	for i := 0; i < len(msg); i++ {
+		if _, err := unpackTXTResponse(1, "example.com", msg[:i]); err == nil {
+			t.Fatalf("expected a response truncated to %d bytes to be refused", i)
+		}
+	}
+}
+
+// dnsTestRecord is a resource record for buildDNSResponse.
+type dnsTestRecord struct {
+	owner string
+	typ   uint16
+	data  []byte
+}
+
+func appendDNSName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+// buildDNSResponse answers a TXT query for qname with the given records,
+// without name compression.
+func buildDNSResponse(id uint16, qname string, answers ...dnsTestRecord) []byte {
+	msg := make([]byte, dnsHeaderLen)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagResponse|dnsFlagRecursion)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+	msg = appendDNSName(msg, qname)
+	msg = append(msg, 0, dnsTypeTXT, 0, dnsClassINET)
+
+	for _, rr := range answers {
+		msg = appendDNSName(msg, rr.owner)
+		msg = append(msg, byte(rr.typ>>8), byte(rr.typ), 0, dnsClassINET, 0, 0, 0, 60)
+		msg = append(msg, byte(len(rr.data)>>8), byte(len(rr.data)))
+		msg = append(msg, rr.data...)
+	}
+	return msg
+}
+
+func TestUnpackDNSResponseOwners(t *testing.T) {
+	txt := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+
+	msg := buildDNSResponse(7, "_dnslink.example.com",
+		dnsTestRecord{"_dnslink.example.com", dnsTypeCNAME, appendDNSName(nil, "_dnslink.alias.net")},
+		dnsTestRecord{"_dnslink.alias.net", dnsTypeTXT, txt("dnslink=/ipfs/alias")},
+		dnsTestRecord{"_dnslink.EXAMPLE.com", dnsTypeTXT, txt("dnslink=/ipfs/direct")},
+		dnsTestRecord{"_dnslink.evil.org", dnsTypeTXT, txt("dnslink=/ipfs/evil")},
+	)
+
+	res, err := unpackTXTResponse(7, "_dnslink.example.com", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.txt) != 2 || res.txt[0] != "dnslink=/ipfs/alias" || res.txt[1] != "dnslink=/ipfs/direct" {
+		t.Fatalf("expected only the records of the name and its alias, got %q", res.txt)
+	}
+}
+
+func TestDNSNameserverFailure(t *testing.T) {
+	s := &dnsStandIn{rcode: 2} // SERVFAIL
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go s.serveUDP(pc)
+
+	l, err := parseDNSUpstream(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, _, err = l.lookupTXT(context.Background(), "example.com")
+	if err == nil || !strings.Contains(err.Error(), "response code 2") {
+		t.Fatalf("expected the server failure to be reported, got %v", err)
+	}
+	if time.Since(start) > dnsQueryTimeout/2 {
+		t.Fatal("expected the server failure to be reported right away")
+	}
+}
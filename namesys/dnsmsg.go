@@ -0,0 +1,334 @@
+package namesys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Just enough of the DNS wire format (RFC 1035) to look up TXT records from
+// nameservers and DNS-over-HTTPS servers.
+const (
+	dnsTypeTXT   = 16
+	dnsTypeSOA   = 6
+	dnsTypeCNAME = 5
+	dnsClassINET = 1
+
+	dnsHeaderLen = 12
+
+	dnsFlagResponse  = 1 << 15
+	dnsFlagTruncated = 1 << 9
+	dnsFlagRecursion = 1 << 8
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeNXDomain = 3
+)
+
+var errDNSMessage = errors.New("malformed DNS message")
+
+// errDNSMismatch is returned for responses to another query than ours, which
+// can be stray packets on UDP.
+var errDNSMismatch = errors.New("DNS response doesn't match the query")
+
+// packTXTQuery builds a recursive query for the TXT records of name.
+func packTXTQuery(id uint16, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 {
+		return nil, fmt.Errorf("domain name %q is too long", name)
+	}
+
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRecursion)
+	binary.BigEndian.PutUint16(msg[4:], 1) // one question
+
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, dnsTypeTXT, 0, dnsClassINET)
+	return msg, nil
+}
+
+// txtResponse is what a DNS response says about the TXT records of a name.
+type txtResponse struct {
+	txt []string
+	ttl time.Duration
+
+	// truncated is set when the response didn't fit in a UDP packet, and
+	// should be asked for again over TCP
+	truncated bool
+}
+
+// unpackTXTResponse reads the answer to a query for name made with
+// packTXTQuery. A name with no TXT records, or no name at all, is not an
+// error: the response then has no records, and its ttl is how long that can
+// be cached for. Responses with another ID or question return errDNSMismatch.
+func unpackTXTResponse(id uint16, name string, msg []byte) (*txtResponse, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, errDNSMessage
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if binary.BigEndian.Uint16(msg[0:]) != id || flags&dnsFlagResponse == 0 {
+		return nil, errDNSMismatch
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	nscount := int(binary.BigEndian.Uint16(msg[8:]))
+
+	rcode := flags & 0xf
+	rcodeErr := func() error {
+		if rcode != dnsRcodeSuccess && rcode != dnsRcodeNXDomain {
+			return fmt.Errorf("DNS server failed with response code %d", rcode)
+		}
+		return nil
+	}
+
+	// servers echo the question, which must be ours, except some failing
+	// ones which leave it out
+	if qdcount == 0 {
+		if err := rcodeErr(); err != nil {
+			return nil, err
+		}
+	}
+	if qdcount != 1 {
+		return nil, errDNSMismatch
+	}
+	qname, off, err := readDNSName(msg, dnsHeaderLen)
+	if err != nil {
+		return nil, err
+	}
+	if off+4 > len(msg) {
+		return nil, errDNSMessage
+	}
+	if !sameDNSName(qname, name) ||
+		binary.BigEndian.Uint16(msg[off:]) != dnsTypeTXT ||
+		binary.BigEndian.Uint16(msg[off+2:]) != dnsClassINET {
+		return nil, errDNSMismatch
+	}
+	off += 4 // type and class
+
+	if flags&dnsFlagTruncated != 0 {
+		return &txtResponse{truncated: true}, nil
+	}
+
+	if err := rcodeErr(); err != nil {
+		return nil, err
+	}
+
+	// the names whose records answer the query: the name itself, and those
+	// it is an alias of
+	owners := []string{qname}
+	owned := func(n string) bool {
+		for _, o := range owners {
+			if sameDNSName(n, o) {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := new(txtResponse)
+	minTTL := time.Duration(-1)
+	for i := 0; i < ancount+nscount; i++ {
+		rr, next, err := unpackDNSRecord(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next
+
+		if rr.class != dnsClassINET {
+			continue
+		}
+		if i < ancount && !owned(rr.name) {
+			// not about the name we asked for
+			continue
+		}
+
+		ttl := rr.ttl
+		switch {
+		case i < ancount && rr.typ == dnsTypeTXT:
+			txt, err := unpackTXT(rr.data)
+			if err != nil {
+				return nil, err
+			}
+			res.txt = append(res.txt, txt)
+		case i < ancount && rr.typ == dnsTypeCNAME:
+			target, _, err := readDNSName(msg, rr.dataOff)
+			if err != nil {
+				return nil, err
+			}
+			owners = append(owners, target)
+		case i >= ancount && rr.typ == dnsTypeSOA:
+			// negative answers are cached for as long as the SOA record
+			// says, see RFC 2308
+			soaMin, err := unpackSOAMinimum(msg, rr.dataOff)
+			if err != nil {
+				return nil, err
+			}
+			if soaMin < ttl {
+				ttl = soaMin
+			}
+		default:
+			continue
+		}
+
+		if minTTL < 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+
+	// negative answers without a SOA record can't be cached
+	if minTTL > 0 {
+		res.ttl = minTTL
+	}
+	return res, nil
+}
+
+type dnsRecord struct {
+	name    string
+	typ     uint16
+	class   uint16
+	ttl     time.Duration
+	data    []byte
+	dataOff int
+}
+
+func unpackDNSRecord(msg []byte, off int) (*dnsRecord, int, error) {
+	name, off, err := readDNSName(msg, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if off+10 > len(msg) {
+		return nil, 0, errDNSMessage
+	}
+
+	rr := &dnsRecord{
+		name:  name,
+		typ:   binary.BigEndian.Uint16(msg[off:]),
+		class: binary.BigEndian.Uint16(msg[off+2:]),
+		ttl:   time.Duration(binary.BigEndian.Uint32(msg[off+4:])&0x7fffffff) * time.Second,
+	}
+	rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+rdlen > len(msg) {
+		return nil, 0, errDNSMessage
+	}
+	rr.data = msg[off : off+rdlen]
+	rr.dataOff = off
+	return rr, off + rdlen, nil
+}
+
+// readDNSName returns the, possibly compressed, domain name at off, without
+// its trailing dot, and the offset just past it.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	// each pointer must go back, so that they can't loop
+	limit := off
+	for {
+		if off >= len(msg) {
+			return "", 0, errDNSMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case l&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return "", 0, errDNSMessage
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			ptr := int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			if ptr >= limit {
+				return "", 0, errDNSMessage
+			}
+			off, limit = ptr, ptr
+		case l&0xc0 != 0:
+			return "", 0, errDNSMessage
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, errDNSMessage
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
+
+// sameDNSName compares domain names the way DNS does, ignoring case and a
+// trailing dot.
+func sameDNSName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// skipDNSName returns the offset just past the, possibly compressed, domain
+// name at off.
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errDNSMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			// a pointer ends the name
+			if off+2 > len(msg) {
+				return 0, errDNSMessage
+			}
+			return off + 2, nil
+		case l&0xc0 != 0:
+			return 0, errDNSMessage
+		default:
+			off += 1 + l
+		}
+	}
+}
+
+// unpackTXT joins the character strings of a TXT record, like
+// net.LookupTXT does.
+func unpackTXT(data []byte) (string, error) {
+	var txt []byte
+	for len(data) > 0 {
+		l := int(data[0])
+		if 1+l > len(data) {
+			return "", errDNSMessage
+		}
+		txt = append(txt, data[1:1+l]...)
+		data = data[1+l:]
+	}
+	return string(txt), nil
+}
+
+// unpackSOAMinimum returns the minimum TTL field of the SOA record whose data
+// starts at off.
+func unpackSOAMinimum(msg []byte, off int) (time.Duration, error) {
+	off, err := skipDNSName(msg, off) // primary nameserver
+	if err != nil {
+		return 0, err
+	}
+	off, err = skipDNSName(msg, off) // admin mailbox
+	if err != nil {
+		return 0, err
+	}
+	// serial, refresh, retry and expire come before the minimum
+	off += 16
+	if off+4 > len(msg) {
+		return 0, errDNSMessage
+	}
+	return time.Duration(binary.BigEndian.Uint32(msg[off:])&0x7fffffff) * time.Second, nil
+}
@@ -0,0 +1,248 @@
+package namesys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DNSUpstreamSystem is the resolver spec for the operating system's resolver.
+const DNSUpstreamSystem = "system"
+
+// DefaultDNSCacheTTL is how long TXT records looked up with the system
+// resolver are cached for, as it doesn't tell their TTL.
+const DefaultDNSCacheTTL = time.Minute
+
+// dnsQueryTimeout bounds a query to a nameserver or DNS-over-HTTPS server
+// when the context doesn't.
+const dnsQueryTimeout = 10 * time.Second
+
+// maxDNSMessage is the largest DNS message there can be.
+const maxDNSMessage = 65535
+
+// txtLookup looks up the TXT records of a name. It also returns how long the
+// result can be cached for, zero meaning it can't.
+type txtLookup interface {
+	lookupTXT(ctx context.Context, name string) (txt []string, ttl time.Duration, err error)
+}
+
+// parseDNSUpstream returns the TXT lookup described by spec: "system", or
+// nothing, for the operating system's resolver, an https:// URL for a
+// DNS-over-HTTPS server, http:// being accepted for local ones, or the address
+// of a nameserver, with an optional port.
+func parseDNSUpstream(spec string) (txtLookup, error) {
+	switch {
+	case spec == DNSUpstreamSystem || spec == "":
+		return systemLookup(net.LookupTXT), nil
+	case strings.HasPrefix(spec, "https://"), strings.HasPrefix(spec, "http://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS-over-HTTPS URL %q: %s", spec, err)
+		}
+		return &dohLookup{url: u, client: http.DefaultClient}, nil
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("invalid DNS resolver %q: only https:// and http:// URLs are supported", spec)
+	default:
+		addr := spec
+		if _, _, err := net.SplitHostPort(spec); err != nil {
+			addr = net.JoinHostPort(strings.Trim(spec, "[]"), "53")
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || strings.Contains(host, ":") && net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid nameserver address %q", spec)
+		}
+		return nameserverLookup(addr), nil
+	}
+}
+
+// systemLookup looks up records with the operating system's resolver.
+type systemLookup LookupTXTFunc
+
+func (l systemLookup) lookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, err := l(name)
+	return txt, DefaultDNSCacheTTL, err
+}
+
+// dohLookup looks up records with a DNS-over-HTTPS server, as in RFC 8484.
+type dohLookup struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func (l *dohLookup) lookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	// RFC 8484 asks for a zero ID, to help HTTP caches
+	query, err := packTXTQuery(0, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	u := *l.url
+	q := u.Query()
+	q.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	ctx, cancel := withDNSTimeout(ctx)
+	defer cancel()
+
+	resp, err := l.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS-over-HTTPS server answered %s", resp.Status)
+	}
+
+	msg, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDNSMessage))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := unpackTXTResponse(0, name, msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.truncated {
+		return nil, 0, errors.New("DNS-over-HTTPS server sent a truncated response")
+	}
+	return res.txt, res.ttl, nil
+}
+
+// nameserverLookup looks up records with the nameserver at the given address,
+// over UDP, and over TCP if the answer doesn't fit in a UDP packet.
+type nameserverLookup string
+
+func (l nameserverLookup) lookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	var idb [2]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idb[:])
+
+	query, err := packTXTQuery(id, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := withDNSTimeout(ctx)
+	defer cancel()
+
+	res, err := l.exchange(ctx, "udp", id, name, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.truncated {
+		res, err = l.exchange(ctx, "tcp", id, name, query)
+		if err != nil {
+			return nil, 0, err
+		}
+		if res.truncated {
+			return nil, 0, errors.New("nameserver sent a truncated response over TCP")
+		}
+	}
+	return res.txt, res.ttl, nil
+}
+
+func (l nameserverLookup) exchange(ctx context.Context, network string, id uint16, name string, query []byte) (*txtResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, string(l))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, maxDNSMessage)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			// ignore stray packets, like answers to earlier queries, but
+			// not errors in the answer to this one
+			res, err := unpackTXTResponse(id, name, buf[:n])
+			if err != errDNSMismatch {
+				return res, err
+			}
+			log.Debugf("ignoring DNS response from %s: %s", l, err)
+		}
+	}
+
+	// over TCP, messages are prefixed with their length
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+
+	var lenb [2]byte
+	if _, err := io.ReadFull(conn, lenb[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(lenb[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return unpackTXTResponse(id, name, msg)
+}
+
+func withDNSTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, dnsQueryTimeout)
+}
+
+// dnsUpstreams picks the lookup for a domain from the ones configured for
+// domain suffixes.
+type dnsUpstreams map[string]txtLookup
+
+// forDomain returns the lookup configured for the longest suffix of domain,
+// with "." matching every domain, and nil if none is.
+func (u dnsUpstreams) forDomain(domain string) txtLookup {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for {
+		if l, ok := u[domain]; ok {
+			return l
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return u["."]
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// normalizeDNSSuffix lowercases a domain suffix and strips its dots, except
+// for ".", the suffix of all domains.
+func normalizeDNSSuffix(suffix string) string {
+	if suffix == "." {
+		return suffix
+	}
+	return strings.ToLower(strings.Trim(suffix, "."))
+}
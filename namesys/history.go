@@ -0,0 +1,79 @@
+package namesys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	path "github.com/ipfs/go-ipfs/path"
+
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+)
+
+// HistoryLength is how many of the records published for a key are kept in
+// its history.
+var HistoryLength = 32
+
+// HistoryEntry is a record published by this node, as kept in the history of
+// its key.
+type HistoryEntry struct {
+	Value     path.Path
+	Sequence  uint64
+	EOL       time.Time
+	Published time.Time
+}
+
+// historyLk serializes updates to histories, which are read, modified and
+// written back.
+var historyLk sync.Mutex
+
+func historyKey(id peer.ID) ds.Key {
+	return ds.NewKey("/ipns-history/" + id.Pretty())
+}
+
+// History returns the records published for id, newest first.
+func History(d ds.Datastore, id peer.ID) ([]HistoryEntry, error) {
+	v, err := d.Get(historyKey(id))
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type returned from datastore: %#v", v)
+	}
+
+	var history []HistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("corrupted IPNS history for %s: %s", id.Pretty(), err)
+	}
+	return history, nil
+}
+
+// addToHistory records a record published for id, dropping the oldest ones
+// past HistoryLength.
+func addToHistory(d ds.Datastore, id peer.ID, e HistoryEntry) error {
+	historyLk.Lock()
+	defer historyLk.Unlock()
+
+	history, err := History(d, id)
+	if err != nil {
+		return err
+	}
+
+	history = append([]HistoryEntry{e}, history...)
+	if len(history) > HistoryLength {
+		history = history[:HistoryLength]
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return d.Put(historyKey(id), data)
+}
@@ -25,12 +25,14 @@ import (
 // (a) IPFS routing naming: SFS-like PKI names.
 // (b) dns domains: resolves using links in DNS TXT records
 // (c) proquints: interprets string as the raw byte data.
+// (d) the name schemes added by plugins, for names of the form <scheme>:<name>.
 //
 // It can only publish to: (a) IPFS routing naming.
 //
 type mpns struct {
 	resolvers  map[string]resolver
 	publishers map[string]Publisher
+	schemes    SchemeResolvers
 }
 
 // NewNameSystem will construct the IPFS naming system based on Routing
@@ -44,6 +46,7 @@ func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSys
 		publishers: map[string]Publisher{
 			"dht": NewRoutingPublisher(r, ds),
 		},
+		schemes: DefaultSchemeResolvers,
 	}
 }
 
@@ -59,11 +62,23 @@ func AddPubsubNameSystem(ctx context.Context, ns NameSystem, host p2phost.Host,
 		return errors.New("unexpected IpfsRouting; not a PubKeyFetcher instance")
 	}
 
-	mpns.resolvers["pubsub"] = NewPubsubResolver(ctx, host, r, pkf, ps)
+	mpns.resolvers["pubsub"] = NewPubsubResolver(ctx, host, ds, r, pkf, ps)
 	mpns.publishers["pubsub"] = NewPubsubPublisher(ctx, host, ds, r, ps)
 	return nil
 }
 
+// SetDNSResolver replaces the resolver a name system made by NewNameSystem
+// uses for DNS domains.
+func SetDNSResolver(ns NameSystem, r *DNSResolver) error {
+	mpns, ok := ns.(*mpns)
+	if !ok {
+		return errors.New("unexpected NameSystem; not an mpns instance")
+	}
+
+	mpns.resolvers["dns"] = r
+	return nil
+}
+
 const DefaultResolverCacheTTL = time.Minute
 
 // Resolve implements Resolver.
@@ -107,7 +122,8 @@ func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error)
 	// 1. if it is a multihash resolve through "pubsub" (if available),
 	//    with fallback to "dht"
 	// 2. if it is a domain name, resolve through "dns"
-	// 3. otherwise resolve through the "proquint" resolver
+	// 3. if it has a scheme, resolve through the resolver registered for it
+	// 4. otherwise resolve through the "proquint" resolver
 	key := segments[2]
 
 	_, err := mh.FromB58String(key)
@@ -143,6 +159,21 @@ func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error)
 		return "", ErrResolveFailed
 	}
 
+	if scheme, rest, ok := splitScheme(key); ok && ns.schemes != nil {
+		res, ok := ns.schemes.Get(scheme)
+		if !ok {
+			log.Debugf("no resolver registered for the %s name scheme", scheme)
+			return "", ErrResolveFailed
+		}
+
+		p, err := res.ResolveOnce(ctx, rest)
+		if err != nil {
+			log.Debugf("failed to resolve %s: %s", key, err)
+			return "", ErrResolveFailed
+		}
+		return makePath(p)
+	}
+
 	res, ok := ns.resolvers["proquint"]
 	if ok {
 		p, err := res.resolveOnce(ctx, key)
@@ -191,6 +222,36 @@ func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.
 	return dhtErr
 }
 
+// PublishAll publishes value under all the keys, or under none of them, with
+// a name system made by NewNameSystem. See ipnsPublisher.PublishAll for what
+// happens when publishing fails part way.
+func PublishAll(ctx context.Context, ns NameSystem, keys []ci.PrivKey, value path.Path, eol time.Time) error {
+	mpns, ok := ns.(*mpns)
+	if !ok {
+		return errors.New("unexpected NameSystem; not an mpns instance")
+	}
+	dht, ok := mpns.publishers["dht"].(*ipnsPublisher)
+	if !ok {
+		return errors.New("unexpected Publisher; not an ipnsPublisher instance")
+	}
+
+	if err := dht.PublishAll(ctx, keys, value, eol); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		mpns.addToDHTCache(k, value, eol)
+	}
+
+	if pub, ok := mpns.publishers["pubsub"]; ok {
+		for _, k := range keys {
+			if err := pub.PublishWithEOL(ctx, k, value, eol); err != nil {
+				log.Warningf("error publishing %s with pubsub: %s", k, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
 func (ns *mpns) addToDHTCache(key ci.PrivKey, value path.Path, eol time.Time) {
 	rr, ok := ns.resolvers["dht"].(*routingResolver)
 	if !ok {
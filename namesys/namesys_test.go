@@ -91,3 +91,48 @@ func TestPublishWithCache0(t *testing.T) {
 	}
 	nsys.Publish(context.Background(), priv, p)
 }
+
+type mockSchemeResolver map[string]string
+
+func (r mockSchemeResolver) ResolveOnce(ctx context.Context, name string) (path.Path, error) {
+	p, ok := r[name]
+	if !ok {
+		return "", ErrResolveFailed
+	}
+	return path.ParsePath(p)
+}
+
+func TestNamesysSchemeResolution(t *testing.T) {
+	schemes := NewSchemeResolvers()
+	err := schemes.Register("registry", mockSchemeResolver{
+		"site":  "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj",
+		"alias": "/ipns/registry:site",
+		"peer":  "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schemes.Register("registry", mockSchemeResolver{}); err == nil {
+		t.Fatal("expected registering a scheme twice to fail")
+	}
+	for _, s := range []string{"", "Registry", "1reg", "reg/istry"} {
+		if err := schemes.Register(s, mockSchemeResolver{}); err == nil {
+			t.Fatalf("expected the invalid scheme %q to be refused", s)
+		}
+	}
+
+	r := &mpns{
+		resolvers: map[string]resolver{
+			"dht": mockResolverOne(),
+		},
+		schemes: schemes,
+	}
+
+	testResolution(t, r, "/ipns/registry:site", DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	testResolution(t, r, "/ipns/registry:site/a/b", DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj/a/b", nil)
+	testResolution(t, r, "/ipns/registry:alias", DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	testResolution(t, r, "/ipns/registry:alias", 1, "/ipns/registry:site", ErrResolveRecursion)
+	testResolution(t, r, "/ipns/registry:peer", DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	testResolution(t, r, "/ipns/registry:nope", DefaultDepthLimit, "", ErrResolveFailed)
+	testResolution(t, r, "/ipns/other:site", DefaultDepthLimit, "", ErrResolveFailed)
+}
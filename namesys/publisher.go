@@ -3,7 +3,10 @@ package namesys
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	pb "github.com/ipfs/go-ipfs/namesys/pb"
@@ -66,49 +69,228 @@ func (p *ipnsPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value
 	// increment it
 	seqnum++
 
-	return PutRecordToRouting(ctx, k, value, seqnum, eol, p.routing, id)
+	err = PutRecordToRouting(ctx, k, value, seqnum, eol, p.routing, id)
+	if err != nil {
+		return err
+	}
+
+	// the record is out, failing to remember it is no reason to fail
+	err = addToHistory(p.ds, id, HistoryEntry{
+		Value:     value,
+		Sequence:  seqnum,
+		EOL:       eol,
+		Published: time.Now(),
+	})
+	if err != nil {
+		log.Errorf("failed to add the record for %s to its history: %s", id.Pretty(), err)
+	}
+	return nil
 }
 
 func (p *ipnsPublisher) getPreviousSeqNo(ctx context.Context, ipnskey string) (uint64, error) {
-	prevrec, err := p.ds.Get(dshelp.NewKeyFromBinary([]byte(ipnskey)))
-	if err != nil && err != ds.ErrNotFound {
-		// None found, lets start at zero!
+	e, err := p.getPreviousEntry(ctx, ipnskey)
+	if err != nil {
 		return 0, err
 	}
-	var val []byte
-	if err == nil {
-		prbytes, ok := prevrec.([]byte)
-		if !ok {
-			return 0, fmt.Errorf("unexpected type returned from datastore: %#v", prevrec)
-		}
-		dhtrec := new(dhtpb.Record)
-		err := proto.Unmarshal(prbytes, dhtrec)
+	return e.GetSequence(), nil
+}
+
+// getPreviousEntry returns the last record published for ipnskey, from the
+// local datastore or else from routing, or nil if there is none.
+func (p *ipnsPublisher) getPreviousEntry(ctx context.Context, ipnskey string) (*pb.IpnsEntry, error) {
+	e, err := localEntry(p.ds, ipnskey)
+	if err != nil || e != nil {
+		return e, err
+	}
+
+	// try and check the dht for a record
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	rv, err := p.routing.GetValue(ctx, ipnskey)
+	if err != nil {
+		// no such record found, start at zero!
+		return nil, nil
+	}
+
+	e = new(pb.IpnsEntry)
+	err = proto.Unmarshal(rv, e)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// PublishAll publishes value under all the given keys, or under none of
+// them. Every record is signed before any is sent, so that a key failing to
+// sign stops the whole publication. If sending a record fails, the keys that
+// had a record are published again with their previous value, valid until
+// eol, under a sequence number above the one that may have gone out. Keys
+// without a previous record can't be rolled back, and keep the new one. The
+// keys that keep the new record are listed in a *RollbackError.
+func (p *ipnsPublisher) PublishAll(ctx context.Context, keys []ci.PrivKey, value path.Path, eol time.Time) error {
+	type pending struct {
+		key   ci.PrivKey
+		id    peer.ID
+		prev  *pb.IpnsEntry
+		entry *pb.IpnsEntry
+		err   error
+	}
+
+	ttl, hasTTL := checkCtxTTL(ctx)
+	seen := make(map[peer.ID]bool)
+	pend := make([]*pending, len(keys))
+	for i, k := range keys {
+		id, err := peer.IDFromPrivateKey(k)
 		if err != nil {
-			return 0, err
+			return err
+		}
+		if seen[id] {
+			return fmt.Errorf("key %s is given more than once", id.Pretty())
 		}
+		seen[id] = true
 
-		val = dhtrec.GetValue()
-	} else {
-		// try and check the dht for a record
-		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-		defer cancel()
+		_, ipnskey := IpnsKeysForID(id)
+		prev, err := p.getPreviousEntry(ctx, ipnskey)
+		if err != nil {
+			return err
+		}
 
-		rv, err := p.routing.GetValue(ctx, ipnskey)
+		entry, err := CreateRoutingEntryData(k, value, prev.GetSequence()+1, eol)
 		if err != nil {
-			// no such record found, start at zero!
-			return 0, nil
+			return fmt.Errorf("signing the record for %s: %s", id.Pretty(), err)
+		}
+		if hasTTL {
+			entry.Ttl = proto.Uint64(uint64(ttl.Nanoseconds()))
+		}
+		pend[i] = &pending{key: k, id: id, prev: prev, entry: entry}
+	}
+
+	var wg sync.WaitGroup
+	for _, pd := range pend {
+		wg.Add(1)
+		go func(pd *pending) {
+			defer wg.Done()
+			pd.err = putEntry(ctx, p.routing, pd.id, pd.key.GetPublic(), pd.entry)
+		}(pd)
+	}
+	wg.Wait()
+
+	var failed error
+	for _, pd := range pend {
+		if pd.err != nil {
+			failed = fmt.Errorf("publishing to %s failed: %s", pd.id.Pretty(), pd.err)
+			break
+		}
+	}
+
+	if failed == nil {
+		for _, pd := range pend {
+			err := addToHistory(p.ds, pd.id, HistoryEntry{
+				Value:     value,
+				Sequence:  pd.entry.GetSequence(),
+				EOL:       eol,
+				Published: time.Now(),
+			})
+			if err != nil {
+				log.Errorf("failed to add the record for %s to its history: %s", pd.id.Pretty(), err)
+			}
 		}
+		return nil
+	}
+
+	// even a record that failed to be sent may have reached some peers, so
+	// all of them are rolled back, even if ctx is what failed. That's why
+	// ctx isn't used, but every rollback gets as long as a publication.
+	for _, pd := range pend {
+		if pd.prev == nil {
+			pd.err = errors.New("no previous record")
+			continue
+		}
+
+		wg.Add(1)
+		go func(pd *pending) {
+			defer wg.Done()
+			rctx, cancel := context.WithTimeout(context.Background(), PublishPutValTimeout)
+			defer cancel()
+			pd.err = PutRecordToRouting(rctx, pd.key, path.Path(pd.prev.GetValue()), pd.entry.GetSequence()+1, eol, p.routing, pd.id)
+			if pd.err != nil {
+				log.Errorf("failed to restore the record for %s: %s", pd.id.Pretty(), pd.err)
+			}
+		}(pd)
+	}
+	wg.Wait()
+
+	var unrestored []peer.ID
+	for _, pd := range pend {
+		if pd.err != nil {
+			unrestored = append(unrestored, pd.id)
+		}
+	}
+	if len(unrestored) > 0 {
+		return &RollbackError{Err: failed, Unrestored: unrestored}
+	}
+	return failed
+}
+
+// RollbackError is returned by PublishAll when publishing failed and the
+// previous records of some keys could not be restored, so that these keys
+// keep the new value.
+type RollbackError struct {
+	// Err is why publishing failed
+	Err error
+
+	// Unrestored are the keys that still point to the new value
+	Unrestored []peer.ID
+}
+
+func (e *RollbackError) Error() string {
+	ids := make([]string, len(e.Unrestored))
+	for i, id := range e.Unrestored {
+		ids[i] = id.Pretty()
+	}
+	return fmt.Sprintf("%s, and the previous records of %s could not be restored", e.Err, strings.Join(ids, ", "))
+}
+
+// localSeqNo returns the sequence number of the record for ipnskey kept in
+// the local datastore, if there is one.
+func localSeqNo(d ds.Datastore, ipnskey string) (uint64, bool, error) {
+	e, err := localEntry(d, ipnskey)
+	if err != nil || e == nil {
+		return 0, false, err
+	}
+	return e.GetSequence(), true, nil
+}
+
+// localEntry returns the record for ipnskey kept in the local datastore, or
+// nil if there is none.
+func localEntry(d ds.Datastore, ipnskey string) (*pb.IpnsEntry, error) {
+	prevrec, err := d.Get(dshelp.NewKeyFromBinary([]byte(ipnskey)))
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		val = rv
+	prbytes, ok := prevrec.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type returned from datastore: %#v", prevrec)
+	}
+	dhtrec := new(dhtpb.Record)
+	err = proto.Unmarshal(prbytes, dhtrec)
+	if err != nil {
+		return nil, err
 	}
 
 	e := new(pb.IpnsEntry)
-	err = proto.Unmarshal(val, e)
+	err = proto.Unmarshal(dhtrec.GetValue(), e)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return e.GetSequence(), nil
+	return e, nil
 }
 
 // setting the TTL on published records is an experimental feature.
@@ -125,10 +307,6 @@ func checkCtxTTL(ctx context.Context) (time.Duration, bool) {
 }
 
 func PutRecordToRouting(ctx context.Context, k ci.PrivKey, value path.Path, seqnum uint64, eol time.Time, r routing.ValueStore, id peer.ID) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	namekey, ipnskey := IpnsKeysForID(id)
 	entry, err := CreateRoutingEntryData(k, value, seqnum, eol)
 	if err != nil {
 		return err
@@ -139,27 +317,7 @@ func PutRecordToRouting(ctx context.Context, k ci.PrivKey, value path.Path, seqn
 		entry.Ttl = proto.Uint64(uint64(ttl.Nanoseconds()))
 	}
 
-	errs := make(chan error, 2) // At most two errors (IPNS, and public key)
-
-	// Attempt to extract the public key from the ID
-	extractedPublicKey := id.ExtractPublicKey()
-
-	go func() {
-		errs <- PublishEntry(ctx, r, ipnskey, entry)
-	}()
-
-	// Publish the public key if a public key cannot be extracted from the ID
-	if extractedPublicKey == nil {
-		go func() {
-			errs <- PublishPublicKey(ctx, r, namekey, k.GetPublic())
-		}()
-
-		if err := waitOnErrChan(ctx, errs); err != nil {
-			return err
-		}
-	}
-
-	return waitOnErrChan(ctx, errs)
+	return putEntry(ctx, r, id, k.GetPublic(), entry)
 }
 
 func waitOnErrChan(ctx context.Context, errs chan error) error {
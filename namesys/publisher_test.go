@@ -3,6 +3,9 @@ package namesys
 import (
 	"context"
 	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,9 +13,11 @@ import (
 
 	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
 	dssync "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/sync"
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
 	testutil "gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
 	ma "gx/ipfs/QmWWQ2Txc2c6tqjsBpzg5Ar652cHPGNsQQp2SejkNmkUMb/go-multiaddr"
 	mockrouting "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/mock"
+	offroute "gx/ipfs/QmZRcGYvxdauCd7hHnMYLYqcZRaDjv24c7eUNyJojAcdBb/go-ipfs-routing/offline"
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
 	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
@@ -113,3 +118,119 @@ func TestRSAPublisher(t *testing.T) {
 func TestEd22519Publisher(t *testing.T) {
 	testNamekeyPublisher(t, ci.Ed25519, ds.ErrNotFound, false)
 }
+
+// failingStore fails the next put of a key once.
+type failingStore struct {
+	routing.ValueStore
+
+	lk   sync.Mutex
+	fail map[string]bool
+}
+
+func (f *failingStore) PutValue(ctx context.Context, key string, value []byte) error {
+	f.lk.Lock()
+	fail := f.fail[key]
+	delete(f.fail, key)
+	f.lk.Unlock()
+
+	if fail {
+		return errors.New("put failed")
+	}
+	return f.ValueStore.PutValue(ctx, key, value)
+}
+
+func TestPublishAll(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+
+	var keys []ci.PrivKey
+	var ids []peer.ID
+	for i := 0; i < 3; i++ {
+		sk, _, err := ci.GenerateKeyPairWithReader(ci.Ed25519, 0, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, sk)
+		ids = append(ids, id)
+	}
+
+	r := &failingStore{
+		ValueStore: offroute.NewOfflineRouter(dstore, keys[0]),
+		fail:       make(map[string]bool),
+	}
+	pub := NewRoutingPublisher(r, dstore)
+	eol := time.Now().Add(time.Hour)
+
+	checkRecord := func(id peer.ID, value path.Path, seq uint64) {
+		t.Helper()
+		_, ipnskey := IpnsKeysForID(id)
+		e, err := localEntry(dstore, ipnskey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			t.Fatalf("no record for %s", id.Pretty())
+		}
+		if path.Path(e.GetValue()) != value || e.GetSequence() != seq {
+			t.Fatalf("expected %s at %d for %s, got %s at %d", value, seq, id.Pretty(), e.GetValue(), e.GetSequence())
+		}
+	}
+
+	// the first two keys have a record already, not the third
+	for _, k := range keys[:2] {
+		if err := pub.PublishWithEOL(ctx, k, "/ipfs/old", eol); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pub.PublishAll(ctx, keys[:2], "/ipfs/new", eol); err != nil {
+		t.Fatal(err)
+	}
+	checkRecord(ids[0], "/ipfs/new", 2)
+	checkRecord(ids[1], "/ipfs/new", 2)
+
+	// when one record fails to go out, the other is rolled back
+	_, ipnskey := IpnsKeysForID(ids[1])
+	r.fail[ipnskey] = true
+	if err := pub.PublishAll(ctx, keys[:2], "/ipfs/newer", eol); err == nil {
+		t.Fatal("expected publishing to fail")
+	}
+	checkRecord(ids[0], "/ipfs/new", 4)
+	checkRecord(ids[1], "/ipfs/new", 4)
+
+	history, err := History(dstore, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Value != "/ipfs/new" {
+		t.Fatalf("failed publications shouldn't be in the history: %v", history)
+	}
+
+	// keys without a previous record can't be rolled back, which is reported
+	r.fail[ipnskey] = true
+	err = pub.PublishAll(ctx, []ci.PrivKey{keys[1], keys[2]}, "/ipfs/newer", eol)
+	if err == nil {
+		t.Fatal("expected publishing to fail")
+	}
+	rerr, ok := err.(*RollbackError)
+	if !ok {
+		t.Fatalf("expected a RollbackError, got %s", err)
+	}
+	if len(rerr.Unrestored) != 1 || rerr.Unrestored[0] != ids[2] {
+		t.Fatalf("expected only %s to be left unrestored, got %v", ids[2].Pretty(), rerr.Unrestored)
+	}
+	if !strings.Contains(err.Error(), ids[2].Pretty()) {
+		t.Fatalf("error should name the key that couldn't be restored: %s", err)
+	}
+	checkRecord(ids[1], "/ipfs/new", 6)
+
+	// nothing is sent when the keys are wrong
+	if err := pub.PublishAll(ctx, []ci.PrivKey{keys[0], keys[0]}, "/ipfs/newer", eol); err == nil {
+		t.Fatal("expected duplicate keys to be refused")
+	}
+	checkRecord(ids[0], "/ipfs/new", 4)
+}
@@ -14,7 +14,8 @@ import (
 	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
 	p2phost "gx/ipfs/QmNmJZL7FQySMtE2BQuLMuZg2EB2CLEunJJUSVSc9YnnbV/go-libp2p-host"
 	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
-	dssync "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/sync"
+	dsns "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/namespace"
+	dsq "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/query"
 	floodsub "gx/ipfs/QmSFihvoND3eDaAYRCeLgLPt62yCPgMZs1NSZmKFEtJQQw/go-libp2p-floodsub"
 	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
 	record "gx/ipfs/QmUpttFinNDmNPgFwKN8sZK6BUtBmA68Y4KdSBDXa8t9sJ/go-libp2p-record"
@@ -28,6 +29,21 @@ import (
 	dshelp "gx/ipfs/QmdQTPWduSeyveSxeCAte33M592isSW5Z979g81aJphrgn/go-ipfs-ds-help"
 )
 
+// PubsubRebroadcastInterval is how often the pubsub resolver looks for peers
+// that joined the topics it is subscribed to, and sends them the latest record
+// it has for the topic.
+var PubsubRebroadcastInterval = time.Minute
+
+var (
+	// pubsubRecordsPrefix is where the pubsub resolver keeps the records it
+	// received in the datastore
+	pubsubRecordsPrefix = ds.NewKey("/ipns-pubsub/records")
+
+	// pubsubSubsPrefix is where the pubsub resolver keeps the names it is
+	// subscribed to, to subscribe to them again after a restart
+	pubsubSubsPrefix = ds.NewKey("/ipns-pubsub/subs")
+)
+
 // PubsubPublisher is a publisher that distributes IPNS records through pubsub
 type PubsubPublisher struct {
 	ctx  context.Context
@@ -42,12 +58,15 @@ type PubsubPublisher struct {
 
 // PubsubResolver is a resolver that receives IPNS records through pubsub
 type PubsubResolver struct {
-	ctx  context.Context
-	ds   ds.Datastore
-	host p2phost.Host
-	cr   routing.ContentRouting
-	pkf  routing.PubKeyFetcher
-	ps   *floodsub.PubSub
+	ctx    context.Context
+	ds     ds.Datastore
+	subsds ds.Datastore
+	host   p2phost.Host
+	cr     routing.ContentRouting
+	pkf    routing.PubKeyFetcher
+	ps     *floodsub.PubSub
+
+	rebroadcastInterval time.Duration
 
 	mx   sync.Mutex
 	subs map[string]*floodsub.Subscription
@@ -69,16 +88,30 @@ func NewPubsubPublisher(ctx context.Context, host p2phost.Host, ds ds.Datastore,
 
 // NewPubsubResolver constructs a new Resolver that resolves IPNS records through pubsub.
 // same as above for pubsub bootstrap dependencies
-func NewPubsubResolver(ctx context.Context, host p2phost.Host, cr routing.ContentRouting, pkf routing.PubKeyFetcher, ps *floodsub.PubSub) *PubsubResolver {
-	return &PubsubResolver{
-		ctx:  ctx,
-		ds:   dssync.MutexWrap(ds.NewMapDatastore()),
-		host: host, // needed for pubsub bootstrap
-		cr:   cr,   // needed for pubsub bootstrap
-		pkf:  pkf,
-		ps:   ps,
-		subs: make(map[string]*floodsub.Subscription),
+// The names it is subscribed to and the records it received are kept in ds;
+// it subscribes again to the names it was subscribed to when it was last
+// running, and rebroadcasts their records until ctx is done.
+func NewPubsubResolver(ctx context.Context, host p2phost.Host, ds ds.Datastore, cr routing.ContentRouting, pkf routing.PubKeyFetcher, ps *floodsub.PubSub) *PubsubResolver {
+	r := &PubsubResolver{
+		ctx:    ctx,
+		ds:     dsns.Wrap(ds, pubsubRecordsPrefix),
+		subsds: dsns.Wrap(ds, pubsubSubsPrefix),
+		host:   host, // needed for pubsub bootstrap
+		cr:     cr,   // needed for pubsub bootstrap
+		pkf:    pkf,
+		ps:     ps,
+		subs:   make(map[string]*floodsub.Subscription),
+
+		rebroadcastInterval: PubsubRebroadcastInterval,
+	}
+
+	err := r.resubscribe()
+	if err != nil {
+		log.Errorf("PubsubResolve: error resubscribing to names: %s", err.Error())
 	}
+
+	go r.rebroadcastLoop()
+	return r
 }
 
 // Publish publishes an IPNS record through pubsub with default TTL
@@ -197,52 +230,22 @@ func (r *PubsubResolver) ResolveN(ctx context.Context, name string, depth int) (
 func (r *PubsubResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
 	log.Debugf("PubsubResolve: resolve '%s'", name)
 
-	// retrieve the public key once (for verifying messages)
-	xname := strings.TrimPrefix(name, "/ipns/")
-	hash, err := mh.FromB58String(xname)
+	id, name, err := r.parseName(name)
 	if err != nil {
-		log.Warningf("PubsubResolve: bad input hash: [%s]", xname)
 		return "", err
 	}
 
-	id := peer.ID(hash)
-	if r.host.Peerstore().PrivKey(id) != nil {
-		return "", errors.New("Cannot resolve own name through pubsub")
-	}
-
-	pubk := id.ExtractPublicKey()
-	if pubk == nil {
-		pubk, err = r.pkf.GetPublicKey(ctx, id)
-		if err != nil {
-			log.Warningf("PubsubResolve: error fetching public key: %s [%s]", err.Error(), xname)
-			return "", err
-		}
-	}
-
-	// the topic is /ipns/Qmhash
-	if !strings.HasPrefix(name, "/ipns/") {
-		name = "/ipns/" + name
+	// retrieve the public key once (for verifying messages)
+	pubk, err := r.publicKey(ctx, id)
+	if err != nil {
+		return "", err
 	}
 
-	r.mx.Lock()
 	// see if we already have a pubsub subscription; if not, subscribe
-	sub, ok := r.subs[name]
-	if !ok {
-		sub, err = r.ps.Subscribe(name)
-		if err != nil {
-			r.mx.Unlock()
-			return "", err
-		}
-
-		log.Debugf("PubsubResolve: subscribed to %s", name)
-
-		r.subs[name] = sub
-
-		ctx, cancel := context.WithCancel(r.ctx)
-		go r.handleSubscription(sub, name, pubk, cancel)
-		go bootstrapPubsub(ctx, r.cr, r.host, name)
+	err = r.subscribe(name, pubk)
+	if err != nil {
+		return "", err
 	}
-	r.mx.Unlock()
 
 	// resolve to what we may already have in the datastore
 	dsval, err := r.ds.Get(dshelp.NewKeyFromBinary([]byte(name)))
@@ -276,6 +279,103 @@ func (r *PubsubResolver) resolveOnce(ctx context.Context, name string) (path.Pat
 	return value, err
 }
 
+// parseName returns the peer ID of an IPNS name, and the name of its topic,
+// /ipns/Qmhash.
+func (r *PubsubResolver) parseName(name string) (peer.ID, string, error) {
+	xname := strings.TrimPrefix(name, "/ipns/")
+	hash, err := mh.FromB58String(xname)
+	if err != nil {
+		log.Warningf("PubsubResolve: bad input hash: [%s]", xname)
+		return "", "", err
+	}
+
+	id := peer.ID(hash)
+	if r.host.Peerstore().PrivKey(id) != nil {
+		return "", "", errors.New("Cannot resolve own name through pubsub")
+	}
+
+	return id, "/ipns/" + xname, nil
+}
+
+func (r *PubsubResolver) publicKey(ctx context.Context, id peer.ID) (ci.PubKey, error) {
+	pubk := id.ExtractPublicKey()
+	if pubk != nil {
+		return pubk, nil
+	}
+
+	pubk, err := r.pkf.GetPublicKey(ctx, id)
+	if err != nil {
+		log.Warningf("PubsubResolve: error fetching public key: %s [%s]", err.Error(), id.Pretty())
+		return nil, err
+	}
+	return pubk, nil
+}
+
+// Subscribe subscribes to the topic of an IPNS name, so that its records are
+// received before it is first resolved
+func (r *PubsubResolver) Subscribe(name string) error {
+	_, name, err := r.parseName(name)
+	if err != nil {
+		return err
+	}
+
+	return r.subscribe(name, nil)
+}
+
+// subscribe subscribes to the topic of name, unless it already is, and
+// records the subscription in the datastore. If pubk is nil, the public key
+// of name is fetched when its first record arrives.
+func (r *PubsubResolver) subscribe(name string, pubk ci.PubKey) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.subs[name]; ok {
+		return nil
+	}
+
+	sub, err := r.ps.Subscribe(name)
+	if err != nil {
+		return err
+	}
+
+	err = r.subsds.Put(ds.NewKey(name), []byte{})
+	if err != nil {
+		sub.Cancel()
+		return err
+	}
+
+	log.Debugf("PubsubResolve: subscribed to %s", name)
+
+	r.subs[name] = sub
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	go r.handleSubscription(sub, name, pubk, cancel)
+	go bootstrapPubsub(ctx, r.cr, r.host, name)
+	return nil
+}
+
+// resubscribe subscribes to the names recorded in the datastore
+func (r *PubsubResolver) resubscribe() error {
+	res, err := r.subsds.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		err := r.subscribe(e.Key, nil)
+		if err != nil {
+			log.Warningf("PubsubResolve: error resubscribing to %s: %s", e.Key, err.Error())
+		}
+	}
+
+	return nil
+}
+
 // GetSubscriptions retrieves a list of active topic subscriptions
 func (r *PubsubResolver) GetSubscriptions() []string {
 	r.mx.Lock()
@@ -292,6 +392,10 @@ func (r *PubsubResolver) GetSubscriptions() []string {
 // Cancel cancels a topic subscription; returns true if an active
 // subscription was canceled
 func (r *PubsubResolver) Cancel(name string) bool {
+	if !strings.HasPrefix(name, "/ipns/") {
+		name = "/ipns/" + name
+	}
+
 	r.mx.Lock()
 	defer r.mx.Unlock()
 
@@ -299,6 +403,11 @@ func (r *PubsubResolver) Cancel(name string) bool {
 	if ok {
 		sub.Cancel()
 		delete(r.subs, name)
+
+		err := r.subsds.Delete(ds.NewKey(name))
+		if err != nil {
+			log.Warningf("PubsubResolve: error forgetting subscription to %s: %s", name, err.Error())
+		}
 	}
 
 	return ok
@@ -317,6 +426,19 @@ func (r *PubsubResolver) handleSubscription(sub *floodsub.Subscription, name str
 			return
 		}
 
+		if pubk == nil {
+			id, _, err := r.parseName(name)
+			if err != nil {
+				log.Warningf("PubsubResolve: error processing update for %s: %s", name, err.Error())
+				return
+			}
+
+			pubk, err = r.publicKey(r.ctx, id)
+			if err != nil {
+				continue
+			}
+		}
+
 		err = r.receive(msg, name, pubk)
 		if err != nil {
 			log.Warningf("PubsubResolve: error proessing update for %s: %s", name, err.Error())
@@ -362,7 +484,12 @@ func (r *PubsubResolver) receive(msg *floodsub.Message, name string, pubk ci.Pub
 			return err
 		}
 
-		if entry.GetSequence() <= oentry.GetSequence() {
+		// rebroadcasts bring records we already have
+		if entry.GetSequence() == oentry.GetSequence() {
+			return nil
+		}
+
+		if entry.GetSequence() < oentry.GetSequence() {
 			return errors.New("stale update; sequence number too small")
 		}
 	}
@@ -372,6 +499,69 @@ func (r *PubsubResolver) receive(msg *floodsub.Message, name string, pubk ci.Pub
 	return r.ds.Put(dshelp.NewKeyFromBinary([]byte(name)), data)
 }
 
+func (r *PubsubResolver) rebroadcastLoop() {
+	var seen map[string]map[peer.ID]struct{}
+	for {
+		select {
+		case <-time.After(r.rebroadcastInterval):
+			seen = r.rebroadcast(seen)
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// rebroadcast publishes the record we have for each topic peers joined since
+// the last time, as they may have missed it. It returns the peers of each
+// topic, for the next time.
+func (r *PubsubResolver) rebroadcast(seen map[string]map[peer.ID]struct{}) map[string]map[peer.ID]struct{} {
+	peers := make(map[string]map[peer.ID]struct{})
+	for _, name := range r.GetSubscriptions() {
+		joined := false
+		peers[name] = make(map[peer.ID]struct{})
+		for _, pid := range r.ps.ListPeers(name) {
+			if _, ok := seen[name][pid]; !ok {
+				joined = true
+			}
+			peers[name][pid] = struct{}{}
+		}
+
+		if !joined {
+			continue
+		}
+
+		dsval, err := r.ds.Get(dshelp.NewKeyFromBinary([]byte(name)))
+		if err != nil {
+			if err != ds.ErrNotFound {
+				log.Warningf("PubsubResolve: error getting the record for %s: %s", name, err.Error())
+			}
+			continue
+		}
+
+		data := dsval.([]byte)
+		entry := new(pb.IpnsEntry)
+
+		err = proto.Unmarshal(data, entry)
+		if err != nil {
+			log.Warningf("PubsubResolve: error decoding the record for %s: %s", name, err.Error())
+			continue
+		}
+
+		eol, ok := checkEOL(entry)
+		if ok && eol.Before(time.Now()) {
+			continue
+		}
+
+		log.Debugf("PubsubResolve: rebroadcast IPNS record for %s (%d)", name, entry.GetSequence())
+		err = r.ps.Publish(name, data)
+		if err != nil {
+			log.Warningf("PubsubResolve: error rebroadcasting the record for %s: %s", name, err.Error())
+		}
+	}
+
+	return peers
+}
+
 // rendezvous with peers in the name topic through provider records
 // Note: rendezbous/boostrap should really be handled by the pubsub implementation itself!
 func bootstrapPubsub(ctx context.Context, cr routing.ContentRouting, host p2phost.Host, name string) {
@@ -10,6 +10,7 @@ import (
 
 	p2phost "gx/ipfs/QmNmJZL7FQySMtE2BQuLMuZg2EB2CLEunJJUSVSc9YnnbV/go-libp2p-host"
 	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	dssync "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore/sync"
 	bhost "gx/ipfs/QmQr1j6UvdhpponAaqSdswqRpdzsFwNop2N8kXLNw8afem/go-libp2p-blankhost"
 	floodsub "gx/ipfs/QmSFihvoND3eDaAYRCeLgLPt62yCPgMZs1NSZmKFEtJQQw/go-libp2p-floodsub"
 	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
@@ -120,7 +121,7 @@ func TestPubsubPublishSubscribe(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		res[i] = NewPubsubResolver(ctx, reshosts[i], resmrs[i], ks, fs)
+		res[i] = NewPubsubResolver(ctx, reshosts[i], dssync.MutexWrap(ds.NewMapDatastore()), resmrs[i], ks, fs)
 		if err := reshosts[i].Connect(ctx, pubpinfo); err != nil {
 			t.Fatal(err)
 		}
@@ -179,6 +180,110 @@ func TestPubsubPublishSubscribe(t *testing.T) {
 	}
 }
 
+func TestPubsubPersistentSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interval := PubsubRebroadcastInterval
+	PubsubRebroadcastInterval = time.Millisecond * 100
+	defer func() { PubsubRebroadcastInterval = interval }()
+
+	ms := mockrouting.NewServer()
+	ks := newMockKeyStore()
+
+	pubhost := newNetHost(ctx, t)
+	pubmr := newMockRouting(ms, ks, pubhost)
+	fs, err := floodsub.NewFloodSub(ctx, pubhost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := NewPubsubPublisher(ctx, pubhost, ds.NewMapDatastore(), pubmr, fs)
+	privk := pubhost.Peerstore().PrivKey(pubhost.ID())
+	pubpinfo := pstore.PeerInfo{ID: pubhost.ID(), Addrs: pubhost.Addrs()}
+
+	name := "/ipns/" + pubhost.ID().Pretty()
+
+	newResolver := func(rctx context.Context, d ds.Datastore) (*PubsubResolver, p2phost.Host) {
+		h := newNetHost(ctx, t)
+		mr := newMockRouting(ms, ks, h)
+		fs, err := floodsub.NewFloodSub(rctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewPubsubResolver(rctx, h, d, mr, ks, fs), h
+	}
+
+	// subscribe a resolver, and let it get a record
+	rds := dssync.MutexWrap(ds.NewMapDatastore())
+	octx, ocancel := context.WithCancel(ctx)
+	old, oldhost := newResolver(octx, rds)
+	if err := oldhost.Connect(ctx, pubpinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	checkResolveNotFound(ctx, t, 0, old, name)
+
+	// let the bootstrap finish
+	time.Sleep(time.Second * 1)
+
+	val := path.Path("/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY")
+	err = pub.Publish(ctx, privk, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// let the flood propagate
+	time.Sleep(time.Second * 1)
+	checkResolve(ctx, t, 0, old, name, val)
+
+	// restart it, with the same datastore
+	ocancel()
+	oldhost.Close()
+
+	res, reshost := newResolver(ctx, rds)
+	subs := res.GetSubscriptions()
+	if len(subs) != 1 || subs[0] != name {
+		t.Fatalf("expected a subscription to %s after the restart, got %v", name, subs)
+	}
+	checkResolve(ctx, t, 1, res, name, val)
+
+	if err := reshost.Connect(ctx, pubpinfo); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 500)
+
+	val = path.Path("/ipfs/QmP1wMAqk6aZYRZirbaAwmrNeqFRgQrwBt3orUtvSa1UYD")
+	err = pub.Publish(ctx, privk, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second * 1)
+	checkResolve(ctx, t, 1, res, name, val)
+
+	// a resolver joining the topic later gets the record rebroadcast
+	late, latehost := newResolver(ctx, dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := late.Subscribe(name); err != nil {
+		t.Fatal(err)
+	}
+	respinfo := pstore.PeerInfo{ID: reshost.ID(), Addrs: reshost.Addrs()}
+	if err := latehost.Connect(ctx, respinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second * 1)
+	checkResolve(ctx, t, 2, late, name, val)
+
+	// canceled subscriptions are forgotten
+	if !res.Cancel(name) {
+		t.Fatal("expected an active subscription to cancel")
+	}
+	if _, err := rds.Get(pubsubSubsPrefix.Child(ds.NewKey(name))); err != ds.ErrNotFound {
+		t.Fatalf("expected the subscription to be forgotten, got %v", err)
+	}
+}
+
 func checkResolveNotFound(ctx context.Context, t *testing.T, i int, resolver Resolver, name string) {
 	_, err := resolver.Resolve(ctx, name)
 	if err != ErrResolveFailed {
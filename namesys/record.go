@@ -0,0 +1,107 @@
+package namesys
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/namesys/pb"
+
+	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
+	ds "gx/ipfs/QmPpegoMqhAEqjncrzArm7KVWAkCm78rqL2DPuNjhPrshg/go-datastore"
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// ErrStaleRecord is returned when publishing a record with a lower sequence
+// number than the name's current one, which would never be resolved.
+var ErrStaleRecord = errors.New("record is older than the current one")
+
+// EntryEOL returns the time an IPNS entry stops being valid.
+func EntryEOL(e *pb.IpnsEntry) (time.Time, error) {
+	switch e.GetValidityType() {
+	case pb.IpnsEntry_EOL:
+		return u.ParseRFC3339(string(e.GetValidity()))
+	default:
+		return time.Time{}, ErrUnrecognizedValidity
+	}
+}
+
+// VerifyEntrySignature checks that an IPNS entry was signed with the private
+// key of pk.
+func VerifyEntrySignature(pk ci.PubKey, e *pb.IpnsEntry) error {
+	if ok, err := pk.Verify(ipnsEntryDataForSig(e), e.GetSignature()); err != nil || !ok {
+		return ErrSignature
+	}
+	return nil
+}
+
+// VerifyEntry checks that an IPNS entry was signed with the private key of
+// pk and hasn't expired.
+func VerifyEntry(pk ci.PubKey, e *pb.IpnsEntry) error {
+	if err := VerifyEntrySignature(pk, e); err != nil {
+		return err
+	}
+
+	eol, err := EntryEOL(e)
+	if err != nil {
+		return err
+	}
+	if time.Now().After(eol) {
+		return ErrExpiredRecord
+	}
+	return nil
+}
+
+// PublishSignedEntry puts an IPNS entry signed elsewhere, for instance on an
+// offline machine, into routing under the name id. The entry is checked
+// against pk, the public key of id, which is published too if it can't be
+// extracted from id. Entries older than the record for id in the local
+// datastore d are refused.
+func PublishSignedEntry(ctx context.Context, r routing.ValueStore, d ds.Datastore, id peer.ID, pk ci.PubKey, e *pb.IpnsEntry) error {
+	if err := VerifyEntry(pk, e); err != nil {
+		return err
+	}
+
+	_, ipnskey := IpnsKeysForID(id)
+	seq, found, err := localSeqNo(d, ipnskey)
+	if err != nil {
+		return err
+	}
+	if found && e.GetSequence() < seq {
+		return ErrStaleRecord
+	}
+
+	return putEntry(ctx, r, id, pk, e)
+}
+
+// putEntry publishes an entry along with the public key needed to verify it.
+func putEntry(ctx context.Context, r routing.ValueStore, id peer.ID, pk ci.PubKey, entry *pb.IpnsEntry) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	namekey, ipnskey := IpnsKeysForID(id)
+
+	errs := make(chan error, 2) // At most two errors (IPNS, and public key)
+
+	// Attempt to extract the public key from the ID
+	extractedPublicKey := id.ExtractPublicKey()
+
+	go func() {
+		errs <- PublishEntry(ctx, r, ipnskey, entry)
+	}()
+
+	// Publish the public key if a public key cannot be extracted from the ID
+	if extractedPublicKey == nil {
+		go func() {
+			errs <- PublishPublicKey(ctx, r, namekey, pk)
+		}()
+
+		if err := waitOnErrChan(ctx, errs); err != nil {
+			return err
+		}
+	}
+
+	return waitOnErrChan(ctx, errs)
+}
@@ -3,6 +3,8 @@ package republisher
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	keystore "github.com/ipfs/go-ipfs/keystore"
@@ -26,6 +28,9 @@ var errNoEntry = errors.New("no previous entry")
 
 var log = logging.Logger("ipns-repub")
 
+// selfKeyName is the name the node's own key goes by, as in 'ipfs key list'.
+const selfKeyName = "self"
+
 // DefaultRebroadcastInterval is the default interval at which we rebroadcast IPNS records
 var DefaultRebroadcastInterval = time.Hour * 4
 
@@ -48,6 +53,47 @@ type Republisher struct {
 
 	// how long records that are republished should be valid for
 	RecordLifetime time.Duration
+
+	// names of the keys that are only republished on demand, with
+	// RepublishKey. The node's own key is named "self".
+	Exclude map[string]bool
+
+	statusLk sync.Mutex
+	status   map[peer.ID]*republishState
+}
+
+// republishState is what the republisher remembers of its last attempt at
+// republishing a key.
+type republishState struct {
+	last time.Time
+	err  error
+}
+
+// KeyStatus describes the record of a key, and how republishing it last went.
+type KeyStatus struct {
+	Name string
+	ID   string
+
+	// Excluded is true for keys that aren't republished automatically
+	Excluded bool
+
+	// Published is false when the key has no record to republish, in which
+	// case Value, Sequence and EOL are unset
+	Published bool
+	Value     string
+	Sequence  uint64
+	EOL       time.Time
+
+	// LastPublish is when a new record was last published for the key, with
+	// 'ipfs name publish' or by another publisher keeping the history of the
+	// key. It is unset if no record was published by this node.
+	LastPublish time.Time
+
+	// LastRepublish is when the record was last republished, and LastError
+	// why the last attempt failed, if it did. Both are unset if the key
+	// wasn't republished since the node started.
+	LastRepublish time.Time
+	LastError     string `json:",omitempty"`
 }
 
 // NewRepublisher creates a new Republisher
@@ -59,6 +105,7 @@ func NewRepublisher(r routing.ValueStore, ds ds.Datastore, self ic.PrivKey, ks k
 		ks:             ks,
 		Interval:       DefaultRebroadcastInterval,
 		RecordLifetime: DefaultRecordLifetime,
+		status:         make(map[peer.ID]*republishState),
 	}
 }
 
@@ -86,34 +133,133 @@ func (rp *Republisher) Run(proc goprocess.Process) {
 	}
 }
 
+// RepublishKey republishes the record of the key with the given name right
+// away, whether or not it is excluded from automatic republishing.
+func (rp *Republisher) RepublishKey(ctx context.Context, name string) error {
+	priv, err := rp.getKey(name)
+	if err != nil {
+		return err
+	}
+
+	err = rp.republishEntry(ctx, priv)
+	if err == errNoEntry {
+		return fmt.Errorf("key %s has no record to republish", name)
+	}
+	return err
+}
+
+// Status returns the republishing status of every key, starting with the
+// node's own.
+func (rp *Republisher) Status() ([]KeyStatus, error) {
+	names := []string{selfKeyName}
+	if rp.ks != nil {
+		keyNames, err := rp.ks.List()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, keyNames...)
+	}
+
+	out := make([]KeyStatus, 0, len(names))
+	for _, name := range names {
+		priv, err := rp.getKey(name)
+		if err != nil {
+			return nil, err
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+
+		st := KeyStatus{
+			Name:     name,
+			ID:       id.Pretty(),
+			Excluded: rp.Exclude[name],
+		}
+
+		_, ipnskey := namesys.IpnsKeysForID(id)
+		e, err := rp.getLastVal(ipnskey)
+		switch err {
+		case nil:
+			st.Published = true
+			st.Value = string(e.GetValue())
+			st.Sequence = e.GetSequence()
+			st.EOL, _ = namesys.EntryEOL(e)
+		case errNoEntry:
+		default:
+			return nil, err
+		}
+
+		history, err := namesys.History(rp.ds, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) > 0 {
+			st.LastPublish = history[0].Published
+		}
+
+		rp.statusLk.Lock()
+		if s, ok := rp.status[id]; ok {
+			st.LastRepublish = s.last
+			if s.err != nil {
+				st.LastError = s.err.Error()
+			}
+		}
+		rp.statusLk.Unlock()
+
+		out = append(out, st)
+	}
+	return out, nil
+}
+
 func (rp *Republisher) republishEntries(p goprocess.Process) error {
 	ctx, cancel := context.WithCancel(gpctx.OnClosingContext(p))
 	defer cancel()
 
-	err := rp.republishEntry(ctx, rp.self)
-	if err != nil {
-		return err
-	}
+	return rp.Republish(ctx)
+}
 
+// Republish republishes the records of all the keys that aren't excluded
+// right away. It doesn't stop at failing keys, and returns the last error.
+func (rp *Republisher) Republish(ctx context.Context) error {
+	names := []string{selfKeyName}
 	if rp.ks != nil {
 		keyNames, err := rp.ks.List()
 		if err != nil {
 			return err
 		}
-		for _, name := range keyNames {
-			priv, err := rp.ks.Get(name)
-			if err != nil {
-				return err
-			}
-			err = rp.republishEntry(ctx, priv)
-			if err != nil {
-				return err
-			}
+		names = append(names, keyNames...)
+	}
+
+	var lastErr error
+	for _, name := range names {
+		if rp.Exclude[name] {
+			log.Debugf("not republishing excluded key %s", name)
+			continue
+		}
 
+		priv, err := rp.getKey(name)
+		if err != nil {
+			return err
+		}
+		err = rp.republishEntry(ctx, priv)
+		if err != nil && err != errNoEntry {
+			log.Errorf("failed to republish key %s: %s", name, err)
+			lastErr = err
 		}
 	}
 
-	return nil
+	return lastErr
+}
+
+func (rp *Republisher) getKey(name string) (ic.PrivKey, error) {
+	if name == selfKeyName {
+		return rp.self, nil
+	}
+	if rp.ks == nil {
+		return nil, keystore.ErrNoSuchKey
+	}
+	return rp.ks.Get(name)
 }
 
 func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) error {
@@ -126,43 +272,55 @@ func (rp *Republisher) republishEntry(ctx context.Context, priv ic.PrivKey) erro
 
 	// Look for it locally only
 	_, ipnskey := namesys.IpnsKeysForID(id)
-	p, seq, err := rp.getLastVal(ipnskey)
+	e, err := rp.getLastVal(ipnskey)
 	if err != nil {
-		if err == errNoEntry {
-			return nil
+		if err != errNoEntry {
+			rp.setStatus(id, err)
 		}
 		return err
 	}
 
 	// update record with same sequence number
 	eol := time.Now().Add(rp.RecordLifetime)
-	err = namesys.PutRecordToRouting(ctx, priv, p, seq, eol, rp.r, id)
-	if err != nil {
-		return err
-	}
+	err = namesys.PutRecordToRouting(ctx, priv, path.Path(e.GetValue()), e.GetSequence(), eol, rp.r, id)
+	rp.setStatus(id, err)
+	return err
+}
+
+func (rp *Republisher) setStatus(id peer.ID, err error) {
+	rp.statusLk.Lock()
+	defer rp.statusLk.Unlock()
 
-	return nil
+	s, ok := rp.status[id]
+	if !ok {
+		s = new(republishState)
+		rp.status[id] = s
+	}
+	if err == nil {
+		s.last = time.Now()
+	}
+	s.err = err
 }
 
-func (rp *Republisher) getLastVal(k string) (path.Path, uint64, error) {
+func (rp *Republisher) getLastVal(k string) (*pb.IpnsEntry, error) {
 	ival, err := rp.ds.Get(dshelp.NewKeyFromBinary([]byte(k)))
 	if err != nil {
 		// not found means we dont have a previously published entry
-		return "", 0, errNoEntry
+		return nil, errNoEntry
 	}
 
 	val := ival.([]byte)
 	dhtrec := new(recpb.Record)
 	err = proto.Unmarshal(val, dhtrec)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
 
 	// extract published data from record
 	e := new(pb.IpnsEntry)
 	err = proto.Unmarshal(dhtrec.GetValue(), e)
 	if err != nil {
-		return "", 0, err
+		return nil, err
 	}
-	return path.Path(e.Value), e.GetSequence(), nil
+	return e, nil
 }
@@ -121,3 +121,90 @@ func verifyResolutionFails(nodes []*core.IpfsNode, key string) error {
 	}
 	return nil
 }
+
+func TestRepublishStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	var nodes []*core.IpfsNode
+	for i := 0; i < 2; i++ {
+		nd, err := core.NewNode(ctx, &core.BuildCfg{
+			Online: true,
+			Host:   mock.MockHostOption(mn),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, nd)
+	}
+	mn.LinkAll()
+
+	bsinf := core.BootstrapConfigWithPeers(
+		[]pstore.PeerInfo{
+			nodes[0].Peerstore.PeerInfo(nodes[0].Identity),
+		},
+	)
+	if err := nodes[1].Bootstrap(bsinf); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := nodes[1]
+	p := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	rp := namesys.NewRoutingPublisher(publisher.Routing, publisher.Repo.Datastore())
+	if err := rp.Publish(ctx, publisher.PrivateKey, p); err != nil {
+		t.Fatal(err)
+	}
+
+	repub := NewRepublisher(publisher.Routing, publisher.Repo.Datastore(), publisher.PrivateKey, publisher.Repo.Keystore())
+	repub.Exclude = map[string]bool{"self": true}
+
+	status, err := repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 {
+		t.Fatalf("expected the status of one key, got %d", len(status))
+	}
+	st := status[0]
+	if st.Name != "self" || st.ID != publisher.Identity.Pretty() {
+		t.Fatalf("unexpected key %s (%s)", st.Name, st.ID)
+	}
+	if !st.Published || st.Value != p.String() || !st.Excluded {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if st.LastPublish.IsZero() {
+		t.Fatal("the record published should be reported")
+	}
+	if !st.LastRepublish.IsZero() {
+		t.Fatal("key shouldn't have been republished yet")
+	}
+
+	// excluded keys are skipped...
+	if err := repub.Republish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[0].LastRepublish.IsZero() {
+		t.Fatal("excluded key shouldn't have been republished")
+	}
+
+	// ...unless asked for
+	if err := repub.RepublishKey(ctx, "self"); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repub.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status[0].LastRepublish.IsZero() || status[0].LastError != "" {
+		t.Fatalf("key should have been republished, got %+v", status[0])
+	}
+
+	if err := repub.RepublishKey(ctx, "nope"); err == nil {
+		t.Fatal("expected an error republishing a missing key")
+	}
+}
@@ -0,0 +1,95 @@
+package namesys
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// SchemeResolver resolves the names of a name scheme added by a plugin. Names
+// of a scheme are written <scheme>:<name>, as in /ipns/registry:my-site.
+type SchemeResolver interface {
+	// ResolveOnce looks up name, given without its scheme, once. The path it
+	// returns is either an /ipfs/ path, or an /ipns/ path which is then
+	// resolved further.
+	ResolveOnce(ctx context.Context, name string) (path.Path, error)
+}
+
+// SchemeResolvers holds the resolvers of the name schemes added by plugins.
+type SchemeResolvers interface {
+	// Register adds a resolver for scheme. A scheme can only be registered
+	// once.
+	Register(scheme string, r SchemeResolver) error
+
+	// Get returns the resolver of scheme, if there is one.
+	Get(scheme string) (SchemeResolver, bool)
+}
+
+// DefaultSchemeResolvers are the scheme resolvers used by the name systems
+// built with NewNameSystem.
+var DefaultSchemeResolvers = NewSchemeResolvers()
+
+type schemeResolvers struct {
+	lk        sync.RWMutex
+	resolvers map[string]SchemeResolver
+}
+
+// NewSchemeResolvers returns an empty set of scheme resolvers.
+func NewSchemeResolvers() SchemeResolvers {
+	return &schemeResolvers{
+		resolvers: make(map[string]SchemeResolver),
+	}
+}
+
+func (s *schemeResolvers) Register(scheme string, r SchemeResolver) error {
+	if err := validateScheme(scheme); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if _, ok := s.resolvers[scheme]; ok {
+		return fmt.Errorf("a resolver for the %s name scheme is already registered", scheme)
+	}
+	s.resolvers[scheme] = r
+	return nil
+}
+
+func (s *schemeResolvers) Get(scheme string) (SchemeResolver, bool) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	r, ok := s.resolvers[scheme]
+	return r, ok
+}
+
+// validateScheme checks that scheme is made of the characters URI schemes
+// are, and starts with a letter.
+func validateScheme(scheme string) error {
+	if scheme == "" {
+		return fmt.Errorf("name scheme can't be empty")
+	}
+	for i, c := range scheme {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return fmt.Errorf("invalid name scheme %q: only lowercase letters, digits, '+', '-' and '.' are allowed, starting with a letter", scheme)
+		}
+	}
+	return nil
+}
+
+// splitScheme splits a name of the form <scheme>:<name>. ok is false if name
+// has no scheme.
+func splitScheme(name string) (scheme, rest string, ok bool) {
+	i := strings.IndexByte(name, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
@@ -8,7 +8,6 @@ import (
 	pstore "gx/ipfs/QmXauCuJzmzapetmC6W4TuDJLL1yFFrVzSHoWv8YdbmnxH/go-libp2p-peerstore"
 	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
 
-	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
 	record "gx/ipfs/QmUpttFinNDmNPgFwKN8sZK6BUtBmA68Y4KdSBDXa8t9sJ/go-libp2p-record"
 	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 )
@@ -75,24 +74,21 @@ func NewIpnsRecordValidator(kbook pstore.KeyBook) *record.ValidChecker {
 		}
 
 		// Check the ipns record signature with the public key
-		if ok, err := pubk.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
+		if err := VerifyEntrySignature(pubk, entry); err != nil {
 			log.Debugf("failed to verify signature for ipns record %s", r.Key)
-			return ErrSignature
+			return err
 		}
 
 		// Check that record has not expired
-		switch entry.GetValidityType() {
-		case pb.IpnsEntry_EOL:
-			t, err := u.ParseRFC3339(string(entry.GetValidity()))
-			if err != nil {
+		t, err := EntryEOL(entry)
+		if err != nil {
+			if err != ErrUnrecognizedValidity {
 				log.Debugf("failed parsing time for ipns record EOL in record %s", r.Key)
-				return err
-			}
-			if time.Now().After(t) {
-				return ErrExpiredRecord
 			}
-		default:
-			return ErrUnrecognizedValidity
+			return err
+		}
+		if time.Now().After(t) {
+			return ErrExpiredRecord
 		}
 		return nil
 	}
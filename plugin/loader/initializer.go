@@ -2,6 +2,7 @@ package loader
 
 import (
 	"github.com/ipfs/go-ipfs/core/coredag"
+	"github.com/ipfs/go-ipfs/namesys"
 	"github.com/ipfs/go-ipfs/plugin"
 
 	ipld "gx/ipfs/Qme5bWv7wtjUNGsK2BNGVUFPKiuxWrsqrtvYwCLRw8YFES/go-ipld-format"
@@ -24,6 +25,11 @@ func run(plugins []plugin.Plugin) error {
 		if err != nil {
 			return err
 		}
+
+		err = runNamesysPlugin(pl)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -41,3 +47,12 @@ func runIPLDPlugin(pl plugin.Plugin) error {
 
 	return ipldpl.RegisterInputEncParsers(coredag.DefaultInputEncParsers)
 }
+
+func runNamesysPlugin(pl plugin.Plugin) error {
+	nspl, ok := pl.(plugin.PluginNamesys)
+	if !ok {
+		return nil
+	}
+
+	return nspl.RegisterResolvers(namesys.DefaultSchemeResolvers)
+}
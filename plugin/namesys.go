@@ -0,0 +1,13 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/namesys"
+)
+
+// PluginNamesys is an interface that can be implemented to add resolvers
+// for new name schemes, resolving /ipns/<scheme>:<name> paths
+type PluginNamesys interface {
+	Plugin
+
+	RegisterResolvers(r namesys.SchemeResolvers) error
+}
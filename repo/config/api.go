@@ -2,4 +2,6 @@ package config
 
 type API struct {
 	HTTPHeaders map[string][]string // HTTP headers to return with the API.
+	TLS         TLS                 // serve the API over TLS when enabled
+	ClientTLS   ClientTLS           // certificate the command line client presents to the API
 }
@@ -0,0 +1,52 @@
+package config
+
+// Bitswap configures the bitswap exchange
+type Bitswap struct {
+	// Strategy decides which peers are sent blocks first: "round-robin"
+	// (the default), "debt-ratio" or "priority-peers"
+	Strategy string
+
+	// MaxDebtRatio is the highest ratio of bytes sent to bytes received a
+	// peer may reach before the debt-ratio strategy stops serving it. 0
+	// means no limit
+	MaxDebtRatio float64
+
+	// DebtGraceBytes is how much the debt-ratio strategy sends a peer before
+	// enforcing MaxDebtRatio
+	DebtGraceBytes uint64
+
+	// PriorityPeers are the peer IDs served first by the priority-peers
+	// strategy
+	PriorityPeers []string
+
+	// SendRateLimit caps the bytes per second of blocks sent to all peers
+	// together. 0 means no limit
+	SendRateLimit int64
+
+	// PeerSendRateLimit caps the bytes per second of blocks sent to any
+	// single peer. 0 means no limit
+	PeerSendRateLimit int64
+
+	// Private only serves blocks to the peers in AllowedPeers, and to the
+	// peers carrying AllowedPeerTag. Blocks are still fetched from anyone
+	Private bool
+
+	// AllowedPeers are the peer IDs served in private mode
+	AllowedPeers []string
+
+	// AllowedPeerTag, if set, also serves in private mode the peers that
+	// carry this connection manager tag
+	AllowedPeerTag string
+
+	// PersistWants records pins and the blocks they want in the datastore,
+	// and resumes them after a restart
+	PersistWants bool
+
+	// PersistedWantsMaxAge is how long persisted wants and pins are kept if
+	// they don't complete. Defaults to 24h, "0" keeps them forever
+	PersistedWantsMaxAge string
+
+	// TraceFile, if set, is where every bitswap message is recorded. Relative
+	// paths are resolved against the repo root
+	TraceFile string
+}
@@ -20,10 +20,14 @@ type Config struct {
 	Mounts    Mounts    // local node's mount points
 	Discovery Discovery // local node's discovery mechanisms
 	Ipns      Ipns      // Ipns settings
+	DNS       DNS       // how DNSLink records are looked up
+	Keystore  Keystore  // where IPNS keys are kept
 	Bootstrap []string  // local nodes's bootstrap peer addresses
 	Gateway   Gateway   // local node's gateway server options
 	API       API       // local node's API settings
 	Swarm     SwarmConfig
+	Bitswap   Bitswap // bitswap exchange settings
+	Routing   Routing // how content, peers and values are looked up
 
 	Reprovider   Reprovider
 	Experimental Experiments
@@ -0,0 +1,12 @@
+package config
+
+// DNS configures how DNSLink records are looked up.
+type DNS struct {
+	// Resolvers maps domain suffixes to the resolver used for the domains
+	// ending with them: "system", an https:// DNS-over-HTTPS URL, or the
+	// address of a nameserver. "." matches all domains.
+	Resolvers map[string]string `json:",omitempty"`
+
+	// MaxCacheTTL caps how long DNS records are cached, whatever their TTL
+	MaxCacheTTL string `json:",omitempty"`
+}
@@ -6,4 +6,17 @@ type Gateway struct {
 	RootRedirect string
 	Writable     bool
 	PathPrefixes []string
+	TLS          TLS // serve the gateway over TLS when enabled
+	RateLimit    GatewayRateLimit
+	AccessLog    string // file to append a JSON line to for every request
+}
+
+// GatewayRateLimit bounds how much work gateway clients can make the node do.
+// Clients are identified by their remote IP address. A zero value disables
+// the corresponding limit.
+type GatewayRateLimit struct {
+	RequestsPerSecond      float64 // sustained request rate allowed per client
+	Burst                  int     // requests a client may make at once before being held to the rate
+	MaxConcurrentPerClient int     // requests a single client may have in flight
+	MaxInFlightFetches     int     // /ipfs and /ipns requests in flight across all clients
 }
@@ -4,5 +4,8 @@ type Ipns struct {
 	RepublishPeriod string
 	RecordLifetime  string
 
+	// RepublishExclude lists keys that are only republished on demand
+	RepublishExclude []string `json:",omitempty"`
+
 	ResolveCacheSize int
 }
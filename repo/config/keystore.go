@@ -0,0 +1,5 @@
+package config
+
+type Keystore struct {
+	Signer string // Unix socket of an external signer holding the keys
+}
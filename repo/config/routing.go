@@ -0,0 +1,25 @@
+package config
+
+// Routing configures how content, peers and values are looked up.
+type Routing struct {
+	// Type is the routing the daemon uses unless given --routing: "dht", the
+	// default, "dhtclient", "none" or "delegated".
+	Type string `json:",omitempty"`
+
+	// Delegated configures the "delegated" routing
+	Delegated DelegatedRouting
+}
+
+// DelegatedRouting configures routing delegated to an HTTP endpoint.
+type DelegatedRouting struct {
+	// Endpoint is the URL of the server lookups are delegated to
+	Endpoint string `json:",omitempty"`
+
+	// Compose is how a DHT client is used along with the endpoint: "" not at
+	// all, "parallel" asking both at once, or "fallback" asking the DHT when
+	// the endpoint fails or finds nothing.
+	Compose string `json:",omitempty"`
+
+	// Timeout bounds requests to the endpoint, "30s" by default
+	Timeout string `json:",omitempty"`
+}
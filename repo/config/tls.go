@@ -0,0 +1,49 @@
+package config
+
+import "errors"
+
+// TLS contains options for serving an HTTP endpoint over TLS. Relative paths
+// are interpreted relative to the repo root.
+type TLS struct {
+	CertFile     string // PEM encoded certificate (chain) to present to clients
+	KeyFile      string // PEM encoded private key matching CertFile
+	ClientCAFile string // if set, clients must present a certificate signed by one of these CAs
+}
+
+// Enabled returns true when any TLS option has been configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.ClientCAFile != ""
+}
+
+// Validate returns an error if TLS is only partially configured, which would
+// otherwise fall back to plain HTTP.
+func (t TLS) Validate() error {
+	if !t.Enabled() {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return errors.New("TLS needs both a CertFile and a KeyFile")
+	}
+	return nil
+}
+
+// ClientTLS contains the certificate a client presents to a TLS endpoint that
+// requires client certificates. Relative paths are interpreted relative to the
+// repo root.
+type ClientTLS struct {
+	CertFile string // PEM encoded client certificate (chain)
+	KeyFile  string // PEM encoded private key matching CertFile
+}
+
+// Enabled returns true when a client certificate has been configured.
+func (t ClientTLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Validate returns an error if only one of CertFile and KeyFile is set.
+func (t ClientTLS) Validate() error {
+	if t.Enabled() && (t.CertFile == "" || t.KeyFile == "") {
+		return errors.New("client TLS needs both a CertFile and a KeyFile")
+	}
+	return nil
+}
@@ -27,6 +27,7 @@ import (
 	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
 	measure "gx/ipfs/QmRhjB5Mnha4k6VH6qRFNabAVkxpbqC7bVw2daMKLHPXXN/go-ds-measure"
 	ma "gx/ipfs/QmWWQ2Txc2c6tqjsBpzg5Ar652cHPGNsQQp2SejkNmkUMb/go-multiaddr"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
 )
 
 var log = logging.Logger("fsrepo")
@@ -370,7 +371,30 @@ func (r *FSRepo) openConfig() error {
 }
 
 func (r *FSRepo) openKeystore() error {
+	if sock := r.config.Keystore.Signer; sock != "" {
+		if !filepath.IsAbs(sock) {
+			sock = filepath.Join(r.path, sock)
+		}
+		r.keystore = keystore.NewSignerKeystore(sock)
+		return nil
+	}
+
 	ksp := filepath.Join(r.path, "keystore")
+
+	encrypted, err := keystore.IsEncrypted(ksp)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		// left locked until the passphrase is given to UnlockKeystore
+		ks, err := keystore.OpenEncryptedKeystore(ksp)
+		if err != nil {
+			return err
+		}
+		r.keystore = ks
+		return nil
+	}
+
 	ks, err := keystore.NewFSKeystore(ksp)
 	if err != nil {
 		return err
@@ -381,6 +405,62 @@ func (r *FSRepo) openKeystore() error {
 	return nil
 }
 
+// KeystoreLocked returns whether the keystore is encrypted and still has to
+// be unlocked with UnlockKeystore.
+func (r *FSRepo) KeystoreLocked() bool {
+	ks, ok := r.keystore.(*keystore.EncryptedKeystore)
+	return ok && ks.Locked()
+}
+
+// UnlockKeystore unlocks an encrypted keystore with its passphrase.
+func (r *FSRepo) UnlockKeystore(passphrase []byte) error {
+	ks, ok := r.keystore.(*keystore.EncryptedKeystore)
+	if !ok {
+		return errors.New("keystore is not encrypted")
+	}
+	return ks.Unlock(passphrase)
+}
+
+// EncryptKeystore replaces the plaintext keystore with an encrypted one
+// holding the same keys, protected by passphrase. The node's private key is
+// moved from the config into the encrypted keystore.
+func (r *FSRepo) EncryptKeystore(passphrase []byte) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if r.closed {
+		return errors.New("repo is closed")
+	}
+	if _, ok := r.keystore.(*keystore.EncryptedKeystore); ok {
+		return errors.New("keystore is already encrypted")
+	}
+
+	var identity ci.PrivKey
+	if r.config.Identity.PrivKey != "" {
+		sk, err := r.config.Identity.DecodePrivateKey("")
+		if err != nil {
+			return err
+		}
+		identity = sk
+	}
+
+	ks, err := keystore.EncryptKeystore(filepath.Join(r.path, "keystore"), passphrase, identity)
+	if err != nil {
+		return err
+	}
+	r.keystore = ks
+
+	// only drop the key from the config once it is safely in the keystore
+	if identity != nil {
+		updated := *r.config
+		updated.Identity.PrivKey = ""
+		if err := r.setConfigUnsynced(&updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	if r.config.Datastore.Type != "" || r.config.Datastore.Path != "" {
@@ -583,11 +663,9 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 
 	// Load private key to guard against it being overwritten.
 	// NOTE: this is a temporary measure to secure this field until we move
-	// keys out of the config file.
-	pkval, err := common.MapGetKV(mapconf, config.PrivKeySelector)
-	if err != nil {
-		return err
-	}
+	// keys out of the config file. It is absent once the keystore has been
+	// encrypted, as the key then lives in the keystore.
+	pkval, pkerr := common.MapGetKV(mapconf, config.PrivKeySelector)
 
 	// Get the type of the value associated with the key
 	oldValue, err := common.MapGetKV(mapconf, key)
@@ -631,8 +709,14 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	}
 
 	// replace private key, in case it was overwritten.
-	if err := common.MapSetKV(mapconf, config.PrivKeySelector, pkval); err != nil {
-		return err
+	if pkerr == nil {
+		if err := common.MapSetKV(mapconf, config.PrivKeySelector, pkval); err != nil {
+			return err
+		}
+	} else if identity, ok := mapconf[config.IdentityTag].(map[string]interface{}); ok {
+		// the key lives in the encrypted keystore, don't let a plaintext
+		// one back into the config
+		delete(identity, config.PrivKeyTag)
 	}
 
 	// This step doubles as to validate the map against the struct
@@ -117,3 +117,34 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestSetConfigKeyKeepsPrivKeyOutOnceRemoved(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	defer Remove(path)
+
+	// the key is out of the config, as after the keystore was encrypted
+	assert.Nil(Init(path, &config.Config{
+		Identity:  config.Identity{PeerID: "QmPeer"},
+		Datastore: config.DefaultDatastoreConfig(),
+	}), t)
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	assert.Nil(r.SetConfigKey(config.PrivKeySelector, "CAESIAAAAAAA"), t)
+	assert.Nil(r.SetConfigKey(config.IdentityTag, map[string]interface{}{
+		"PeerID":  "QmPeer",
+		"PrivKey": "CAESIAAAAAAA",
+	}), t)
+
+	filename, err := config.Filename(path)
+	assert.Nil(err, t)
+	b, err := ioutil.ReadFile(filename)
+	assert.Nil(err, t)
+	assert.True(!bytes.Contains(b, []byte(config.PrivKeyTag)), t, "private key should not be written back to the config")
+
+	cfg, err := r.Config()
+	assert.Nil(err, t)
+	assert.True(cfg.Identity.PrivKey == "", t, "private key should not be set in the loaded config")
+}
@@ -0,0 +1,340 @@
+// Package compose combines routing systems, to use a DHT along with
+// delegated routing for instance.
+package compose
+
+import (
+	"context"
+	"sync"
+
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	pstore "gx/ipfs/QmXauCuJzmzapetmC6W4TuDJLL1yFFrVzSHoWv8YdbmnxH/go-libp2p-peerstore"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+// SelectorFunc picks the best of several values found for key and returns
+// its index, like the selectors of the DHT do.
+type SelectorFunc func(key string, vals [][]byte) (int, error)
+
+// Parallel queries all its routers at once. Lookups return the first answer
+// found, except for GetValue when a Selector is set; announcements and puts
+// go to all routers, and only fail if they fail on all of them.
+type Parallel struct {
+	Routers []routing.IpfsRouting
+
+	// Selector, if set, makes GetValue wait for the value of every router
+	// and return the best one. Without it, GetValue returns the first value
+	// found, which may be an older IPNS record than another router has.
+	Selector SelectorFunc
+}
+
+// Fallback tries its routers in order for lookups, moving on to the next
+// one when a router fails or finds nothing. Announcements and puts go to all
+// routers, like with Parallel, so that nodes only using one of them still
+// find what we announce.
+type Fallback []routing.IpfsRouting
+
+var _ routing.IpfsRouting = Parallel{}
+var _ routing.PubKeyFetcher = Parallel{}
+var _ routing.IpfsRouting = Fallback(nil)
+var _ routing.PubKeyFetcher = Fallback(nil)
+
+// all calls f for each router concurrently, and returns nil if any call
+// succeeded, or else the first error.
+func (p Parallel) all(f func(r routing.IpfsRouting) error) error {
+	errs := make([]error, len(p.Routers))
+	var wg sync.WaitGroup
+	for i, r := range p.Routers {
+		wg.Add(1)
+		go func(i int, r routing.IpfsRouting) {
+			defer wg.Done()
+			errs[i] = f(r)
+		}(i, r)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if len(errs) == 0 {
+		return routing.ErrNotFound
+	}
+	return errs[0]
+}
+
+// first calls f for each router concurrently, and returns the result of the
+// first call that succeeds, or else the first error.
+func (p Parallel) first(ctx context.Context, f func(ctx context.Context, r routing.IpfsRouting) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		val interface{}
+		err error
+	}
+	results := make(chan result, len(p.Routers))
+	for _, r := range p.Routers {
+		go func(r routing.IpfsRouting) {
+			val, err := f(ctx, r)
+			results <- result{val, err}
+		}(r)
+	}
+
+	var firstErr error = routing.ErrNotFound
+	for i := range p.Routers {
+		res := <-results
+		if res.err == nil {
+			return res.val, nil
+		}
+		// not found is the least interesting of errors
+		if i == 0 || firstErr == routing.ErrNotFound {
+			firstErr = res.err
+		}
+	}
+	return nil, firstErr
+}
+
+func (p Parallel) Provide(ctx context.Context, k *cid.Cid, brdcst bool) error {
+	return p.all(func(r routing.IpfsRouting) error {
+		return r.Provide(ctx, k, brdcst)
+	})
+}
+
+func (p Parallel) FindProvidersAsync(ctx context.Context, k *cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		found := make(chan pstore.PeerInfo)
+		var wg sync.WaitGroup
+		for _, r := range p.Routers {
+			wg.Add(1)
+			go func(r routing.IpfsRouting) {
+				defer wg.Done()
+				for pi := range r.FindProvidersAsync(ctx, k, count) {
+					select {
+					case found <- pi:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(r)
+		}
+		go func() {
+			wg.Wait()
+			close(found)
+		}()
+
+		sendProviders(ctx, found, out, count)
+	}()
+	return out
+}
+
+func (p Parallel) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	v, err := p.first(ctx, func(ctx context.Context, r routing.IpfsRouting) (interface{}, error) {
+		return r.FindPeer(ctx, id)
+	})
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	return v.(pstore.PeerInfo), nil
+}
+
+func (p Parallel) PutValue(ctx context.Context, key string, value []byte) error {
+	return p.all(func(r routing.IpfsRouting) error {
+		return r.PutValue(ctx, key, value)
+	})
+}
+
+func (p Parallel) GetValue(ctx context.Context, key string) ([]byte, error) {
+	if p.Selector != nil {
+		return p.bestValue(ctx, key)
+	}
+
+	v, err := p.first(ctx, func(ctx context.Context, r routing.IpfsRouting) (interface{}, error) {
+		return r.GetValue(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// bestValue asks every router for the value of key, and returns the one
+// Selector prefers.
+func (p Parallel) bestValue(ctx context.Context, key string) ([]byte, error) {
+	var mx sync.Mutex
+	var vals [][]byte
+	err := p.all(func(r routing.IpfsRouting) error {
+		val, err := r.GetValue(ctx, key)
+		if err != nil {
+			return err
+		}
+		mx.Lock()
+		vals = append(vals, val)
+		mx.Unlock()
+		return nil
+	})
+	if len(vals) == 0 {
+		return nil, err
+	}
+	if len(vals) == 1 {
+		return vals[0], nil
+	}
+
+	i, err := p.Selector(key, vals)
+	if err != nil {
+		return nil, err
+	}
+	return vals[i], nil
+}
+
+// GetValues returns the values all routers found for key.
+func (p Parallel) GetValues(ctx context.Context, key string, count int) ([]routing.RecvdVal, error) {
+	var mx sync.Mutex
+	var vals []routing.RecvdVal
+	err := p.all(func(r routing.IpfsRouting) error {
+		rvals, err := r.GetValues(ctx, key, count)
+		mx.Lock()
+		vals = append(vals, rvals...)
+		mx.Unlock()
+		return err
+	})
+	if len(vals) > 0 {
+		return vals, nil
+	}
+	return nil, err
+}
+
+func (p Parallel) GetPublicKey(ctx context.Context, id peer.ID) (ci.PubKey, error) {
+	v, err := p.first(ctx, func(ctx context.Context, r routing.IpfsRouting) (interface{}, error) {
+		return routing.GetPublicKey(r, ctx, []byte(id))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(ci.PubKey), nil
+}
+
+func (p Parallel) Bootstrap(ctx context.Context) error {
+	return p.all(func(r routing.IpfsRouting) error {
+		return r.Bootstrap(ctx)
+	})
+}
+
+// each calls f with each router in turn, until a call succeeds, and returns
+// the first error otherwise.
+func (f Fallback) each(do func(r routing.IpfsRouting) error) error {
+	var firstErr error = routing.ErrNotFound
+	for i, r := range f {
+		err := do(r)
+		if err == nil {
+			return nil
+		}
+		// not found is the least interesting of errors
+		if i == 0 || firstErr == routing.ErrNotFound {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Provide announces k on all routers.
+func (f Fallback) Provide(ctx context.Context, k *cid.Cid, brdcst bool) error {
+	return Parallel{Routers: f}.Provide(ctx, k, brdcst)
+}
+
+// FindProvidersAsync moves on to the next router if one finds no providers.
+func (f Fallback) FindProvidersAsync(ctx context.Context, k *cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+		for _, r := range f {
+			rctx, cancel := context.WithCancel(ctx)
+			n := sendProviders(rctx, r.FindProvidersAsync(rctx, k, count), out, count)
+			cancel()
+			if n > 0 {
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (f Fallback) FindPeer(ctx context.Context, id peer.ID) (pi pstore.PeerInfo, err error) {
+	err = f.each(func(r routing.IpfsRouting) error {
+		pi, err = r.FindPeer(ctx, id)
+		return err
+	})
+	return pi, err
+}
+
+// PutValue puts the value on all routers.
+func (f Fallback) PutValue(ctx context.Context, key string, value []byte) error {
+	return Parallel{Routers: f}.PutValue(ctx, key, value)
+}
+
+func (f Fallback) GetValue(ctx context.Context, key string) (val []byte, err error) {
+	err = f.each(func(r routing.IpfsRouting) error {
+		val, err = r.GetValue(ctx, key)
+		return err
+	})
+	return val, err
+}
+
+func (f Fallback) GetValues(ctx context.Context, key string, count int) (vals []routing.RecvdVal, err error) {
+	err = f.each(func(r routing.IpfsRouting) error {
+		vals, err = r.GetValues(ctx, key, count)
+		if err == nil && len(vals) == 0 {
+			err = routing.ErrNotFound
+		}
+		return err
+	})
+	return vals, err
+}
+
+func (f Fallback) GetPublicKey(ctx context.Context, id peer.ID) (pk ci.PubKey, err error) {
+	err = f.each(func(r routing.IpfsRouting) error {
+		pk, err = routing.GetPublicKey(r, ctx, []byte(id))
+		return err
+	})
+	return pk, err
+}
+
+// Bootstrap bootstraps all routers, as any of them can end up being used.
+func (f Fallback) Bootstrap(ctx context.Context) error {
+	return Parallel{Routers: f}.Bootstrap(ctx)
+}
+
+// sendProviders forwards the providers found on in to out, skipping
+// duplicates, until in is closed, count providers were sent, or ctx is done.
+// It returns how many providers it sent.
+func sendProviders(ctx context.Context, in <-chan pstore.PeerInfo, out chan<- pstore.PeerInfo, count int) int {
+	seen := make(map[peer.ID]struct{})
+	for pi := range in {
+		if _, ok := seen[pi.ID]; ok {
+			continue
+		}
+		seen[pi.ID] = struct{}{}
+
+		select {
+		case out <- pi:
+		case <-ctx.Done():
+			return len(seen) - 1
+		}
+
+		if count > 0 && len(seen) >= count {
+			return len(seen)
+		}
+	}
+	return len(seen)
+}
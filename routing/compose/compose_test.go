@@ -0,0 +1,291 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	pstore "gx/ipfs/QmXauCuJzmzapetmC6W4TuDJLL1yFFrVzSHoWv8YdbmnxH/go-libp2p-peerstore"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+var errDown = errors.New("router is down")
+
+// testRouter keeps values and providers in memory, failing every call with
+// err when it is set.
+type testRouter struct {
+	err       error
+	providers []pstore.PeerInfo
+
+	mx     sync.Mutex
+	values map[string][]byte
+	calls  int
+}
+
+func newTestRouter(err error, providers ...peer.ID) *testRouter {
+	r := &testRouter{
+		err:    err,
+		values: make(map[string][]byte),
+	}
+	for _, id := range providers {
+		r.providers = append(r.providers, pstore.PeerInfo{ID: id})
+	}
+	return r
+}
+
+func (r *testRouter) call() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.calls++
+	return r.err
+}
+
+func (r *testRouter) Provide(ctx context.Context, k *cid.Cid, brdcst bool) error {
+	return r.call()
+}
+
+func (r *testRouter) FindProvidersAsync(ctx context.Context, k *cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+		if r.call() != nil {
+			return
+		}
+		for _, pi := range r.providers {
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (r *testRouter) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	if err := r.call(); err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	for _, pi := range r.providers {
+		if pi.ID == id {
+			return pi, nil
+		}
+	}
+	return pstore.PeerInfo{}, routing.ErrNotFound
+}
+
+func (r *testRouter) PutValue(ctx context.Context, key string, value []byte) error {
+	if err := r.call(); err != nil {
+		return err
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.values[key] = value
+	return nil
+}
+
+func (r *testRouter) GetValue(ctx context.Context, key string) ([]byte, error) {
+	if err := r.call(); err != nil {
+		return nil, err
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	val, ok := r.values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return val, nil
+}
+
+func (r *testRouter) GetValues(ctx context.Context, key string, count int) ([]routing.RecvdVal, error) {
+	val, err := r.GetValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return []routing.RecvdVal{{Val: val}}, nil
+}
+
+func (r *testRouter) Bootstrap(ctx context.Context) error {
+	return r.call()
+}
+
+func collectProviders(ch <-chan pstore.PeerInfo) map[peer.ID]int {
+	found := make(map[peer.ID]int)
+	for pi := range ch {
+		found[pi.ID]++
+	}
+	return found
+}
+
+func TestParallelValues(t *testing.T) {
+	ctx := context.Background()
+	down := newTestRouter(errDown)
+	empty := newTestRouter(nil)
+	full := newTestRouter(nil)
+	full.values["/key"] = []byte("value")
+
+	val, err := Parallel{Routers: []routing.IpfsRouting{down, empty, full}}.GetValue(ctx, "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "value" {
+		t.Fatalf("unexpected value %q", val)
+	}
+
+	if _, err := (Parallel{Routers: []routing.IpfsRouting{empty, down}}).GetValue(ctx, "/key"); err != errDown {
+		t.Fatalf("expected the error of the router that is down, got %v", err)
+	}
+	if _, err := (Parallel{Routers: []routing.IpfsRouting{empty}}).GetValue(ctx, "/key"); err != routing.ErrNotFound {
+		t.Fatalf("expected routing.ErrNotFound, got %v", err)
+	}
+
+	if err := (Parallel{Routers: []routing.IpfsRouting{down, empty}}).PutValue(ctx, "/other", []byte("other")); err != nil {
+		t.Fatalf("expected puts to succeed if they succeed somewhere, got %v", err)
+	}
+	if string(empty.values["/other"]) != "other" {
+		t.Fatal("expected the value to be put")
+	}
+	if err := (Parallel{Routers: []routing.IpfsRouting{down}}).PutValue(ctx, "/other", nil); err != errDown {
+		t.Fatalf("expected puts to fail if they fail everywhere, got %v", err)
+	}
+}
+
+func TestParallelSelectsBestValue(t *testing.T) {
+	ctx := context.Background()
+	older := newTestRouter(nil)
+	older.values["/key"] = []byte("1")
+	newer := newTestRouter(nil)
+	newer.values["/key"] = []byte("2")
+	down := newTestRouter(errDown)
+
+	highest := func(key string, vals [][]byte) (int, error) {
+		best := 0
+		for i, v := range vals {
+			if string(v) > string(vals[best]) {
+				best = i
+			}
+		}
+		return best, nil
+	}
+
+	for i := 0; i < 10; i++ {
+		val, err := Parallel{
+			Routers:  []routing.IpfsRouting{older, down, newer},
+			Selector: highest,
+		}.GetValue(ctx, "/key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "2" {
+			t.Fatalf("expected the newest value, got %q", val)
+		}
+	}
+
+	_, err := Parallel{
+		Routers:  []routing.IpfsRouting{down, newTestRouter(nil)},
+		Selector: highest,
+	}.GetValue(ctx, "/key")
+	if err != errDown {
+		t.Fatalf("expected the error of the router that is down, got %v", err)
+	}
+}
+
+func TestParallelProviders(t *testing.T) {
+	ctx := context.Background()
+	p := Parallel{Routers: []routing.IpfsRouting{
+		newTestRouter(nil, "a", "b"),
+		newTestRouter(errDown, "c"),
+		newTestRouter(nil, "b", "d"),
+	}}
+
+	found := collectProviders(p.FindProvidersAsync(ctx, nil, 0))
+	if len(found) != 3 || found["a"] != 1 || found["b"] != 1 || found["d"] != 1 {
+		t.Fatalf("expected each provider once, got %v", found)
+	}
+
+	found = collectProviders(p.FindProvidersAsync(ctx, nil, 2))
+	if len(found) != 2 {
+		t.Fatalf("expected 2 providers, got %v", found)
+	}
+
+	pi, err := p.FindPeer(ctx, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ID != "d" {
+		t.Fatalf("unexpected peer %s", pi.ID)
+	}
+}
+
+func TestFallbackOrder(t *testing.T) {
+	ctx := context.Background()
+	first := newTestRouter(nil)
+	second := newTestRouter(nil)
+	second.values["/key"] = []byte("second")
+	f := Fallback{first, second}
+
+	val, err := f.GetValue(ctx, "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "second" {
+		t.Fatalf("expected the value of the second router, got %q", val)
+	}
+
+	first.values["/key"] = []byte("first")
+	second.calls = 0
+	val, err = f.GetValue(ctx, "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "first" || second.calls != 0 {
+		t.Fatal("expected the second router not to be asked when the first one answers")
+	}
+
+	if err := f.PutValue(ctx, "/put", []byte("put")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := first.values["/put"]; !ok {
+		t.Fatal("expected puts to go to the first router")
+	}
+	if _, ok := second.values["/put"]; !ok {
+		t.Fatal("expected puts to go to the second router too")
+	}
+
+	second.calls = 0
+	if err := f.Provide(ctx, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if second.calls != 1 {
+		t.Fatal("expected content to be announced on every router")
+	}
+
+	if err := (Fallback{newTestRouter(errDown), second}).PutValue(ctx, "/put2", []byte("put")); err != nil {
+		t.Fatalf("expected puts to succeed if they succeed somewhere, got %v", err)
+	}
+	if err := (Fallback{newTestRouter(errDown)}).PutValue(ctx, "/put2", nil); err != errDown {
+		t.Fatalf("expected puts to fail if they fail everywhere, got %v", err)
+	}
+}
+
+func TestFallbackProviders(t *testing.T) {
+	ctx := context.Background()
+
+	found := collectProviders(Fallback{
+		newTestRouter(errDown, "a"),
+		newTestRouter(nil),
+		newTestRouter(nil, "b", "c"),
+		newTestRouter(nil, "d"),
+	}.FindProvidersAsync(ctx, nil, 0))
+	if len(found) != 2 || found["b"] != 1 || found["c"] != 1 {
+		t.Fatalf("expected the providers of the first router finding some, got %v", found)
+	}
+
+	_, err := Fallback{newTestRouter(errDown), newTestRouter(nil)}.FindPeer(ctx, "a")
+	if err != errDown {
+		t.Fatalf("expected the most interesting error, got %v", err)
+	}
+}
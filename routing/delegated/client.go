@@ -0,0 +1,307 @@
+// Package delegated implements a routing system delegating all its lookups to
+// an HTTP endpoint, for nodes that shouldn't run a DHT.
+//
+// The endpoint answers the following requests, under /routing/v1:
+//
+//	GET /providers/<cid>   {"Providers": [{"ID": "<peer id>", "Addrs": ["<multiaddr>"]}]}
+//	PUT /providers/<cid>   same body, announcing the peers provide <cid>
+//	GET /peers/<peer id>   {"ID": "<peer id>", "Addrs": ["<multiaddr>"]}
+//	GET /values/<key>      the value of <key>, as application/octet-stream
+//	PUT /values/<key>      sets the value of <key> to the body
+//
+// Keys are encoded with unpadded URL-safe base64. Unknown providers, peers
+// and values are answered with 404 Not Found.
+package delegated
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	p2phost "gx/ipfs/QmNmJZL7FQySMtE2BQuLMuZg2EB2CLEunJJUSVSc9YnnbV/go-libp2p-host"
+	logging "gx/ipfs/QmRb5jh8z2E8hMGN2tkvs1yHynUanqnZ3UeKwgN1i9P1F8/go-log"
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	ma "gx/ipfs/QmWWQ2Txc2c6tqjsBpzg5Ar652cHPGNsQQp2SejkNmkUMb/go-multiaddr"
+	pstore "gx/ipfs/QmXauCuJzmzapetmC6W4TuDJLL1yFFrVzSHoWv8YdbmnxH/go-libp2p-peerstore"
+	peer "gx/ipfs/QmZoWKhxUmZ2seW4BzX6fJkNR8hh9PsGModr7q171yq2SS/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+var log = logging.Logger("routing/delegated")
+
+// DefaultTimeout bounds the requests made to the endpoint when the context
+// doesn't.
+const DefaultTimeout = 30 * time.Second
+
+// maxResponseSize is the largest response read from the endpoint.
+const maxResponseSize = 4 << 20
+
+// PeerRecord is how peers are described to and by the endpoint.
+type PeerRecord struct {
+	ID    string
+	Addrs []string
+}
+
+// ProvidersResponse lists the providers of a CID.
+type ProvidersResponse struct {
+	Providers []PeerRecord
+}
+
+// Client is a routing.IpfsRouting delegating to an HTTP endpoint.
+type Client struct {
+	endpoint *url.URL
+	host     p2phost.Host
+	client   *http.Client
+}
+
+var _ routing.IpfsRouting = (*Client)(nil)
+var _ routing.PubKeyFetcher = (*Client)(nil)
+
+// NewClient returns a client of the endpoint at the given URL. Content
+// provided by host is announced with its addresses. A zero timeout means
+// DefaultTimeout.
+func NewClient(endpoint string, host p2phost.Host, timeout time.Duration) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegated routing endpoint %q: %s", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid delegated routing endpoint %q: only http:// and https:// URLs are supported", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Client{
+		endpoint: u,
+		host:     host,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Provide announces to the endpoint that our node provides k. Nothing is
+// kept locally, so nothing is done unless brdcst is set.
+func (c *Client) Provide(ctx context.Context, k *cid.Cid, brdcst bool) error {
+	if !brdcst {
+		return nil
+	}
+
+	body, err := json.Marshal(&ProvidersResponse{
+		Providers: []PeerRecord{peerRecord(pstore.PeerInfo{
+			ID:    c.host.ID(),
+			Addrs: c.host.Addrs(),
+		})},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, "PUT", "/providers/"+k.String(), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// FindProvidersAsync asks the endpoint for the providers of k, and sends up
+// to count of them on the returned channel.
+func (c *Client) FindProvidersAsync(ctx context.Context, k *cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo, count)
+	go func() {
+		defer close(out)
+
+		var res ProvidersResponse
+		err := c.getJSON(ctx, "/providers/"+k.String(), &res)
+		if err != nil {
+			if err != routing.ErrNotFound {
+				log.Warningf("error finding providers of %s: %s", k, err)
+			}
+			return
+		}
+
+		for i, rec := range res.Providers {
+			if count > 0 && i >= count {
+				return
+			}
+
+			pi, err := rec.peerInfo()
+			if err != nil {
+				log.Warningf("skipping provider of %s: %s", k, err)
+				continue
+			}
+
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FindPeer asks the endpoint for the addresses of id.
+func (c *Client) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	var rec PeerRecord
+	err := c.getJSON(ctx, "/peers/"+id.Pretty(), &rec)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+
+	pi, err := rec.peerInfo()
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	if pi.ID != id {
+		return pstore.PeerInfo{}, fmt.Errorf("asked for peer %s, got %s", id.Pretty(), pi.ID.Pretty())
+	}
+	return pi, nil
+}
+
+// PutValue stores value under key at the endpoint.
+func (c *Client) PutValue(ctx context.Context, key string, value []byte) error {
+	resp, err := c.do(ctx, "PUT", valuePath(key), value)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// GetValue asks the endpoint for the value of key. Values aren't validated:
+// callers check them, as namesys does IPNS records.
+func (c *Client) GetValue(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, "GET", valuePath(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// GetValues returns the single value the endpoint has for key.
+func (c *Client) GetValues(ctx context.Context, key string, count int) ([]routing.RecvdVal, error) {
+	val, err := c.GetValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return []routing.RecvdVal{{Val: val}}, nil
+}
+
+// GetPublicKey asks the endpoint for the public key of id, and checks it
+// matches id.
+func (c *Client) GetPublicKey(ctx context.Context, id peer.ID) (ci.PubKey, error) {
+	if pk := id.ExtractPublicKey(); pk != nil {
+		return pk, nil
+	}
+
+	val, err := c.GetValue(ctx, "/pk/"+string(id))
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := ci.UnmarshalPublicKey(val)
+	if err != nil {
+		return nil, err
+	}
+	if !id.MatchesPublicKey(pk) {
+		return nil, fmt.Errorf("public key sent for %s doesn't match it", id.Pretty())
+	}
+	return pk, nil
+}
+
+// Bootstrap does nothing, there being nobody to connect to.
+func (c *Client) Bootstrap(ctx context.Context) error {
+	return nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.do(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// do makes a request to the endpoint, and returns the response if it
+// succeeded. 404 Not Found is routing.ErrNotFound.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path += "/routing/v1" + path
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(path, "/values/") {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, routing.ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("delegated routing endpoint answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func valuePath(key string) string {
+	return "/values/" + base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func peerRecord(pi pstore.PeerInfo) PeerRecord {
+	rec := PeerRecord{ID: pi.ID.Pretty()}
+	for _, a := range pi.Addrs {
+		rec.Addrs = append(rec.Addrs, a.String())
+	}
+	return rec
+}
+
+func (rec PeerRecord) peerInfo() (pstore.PeerInfo, error) {
+	id, err := peer.IDB58Decode(rec.ID)
+	if err != nil {
+		return pstore.PeerInfo{}, fmt.Errorf("invalid peer ID %q: %s", rec.ID, err)
+	}
+
+	pi := pstore.PeerInfo{ID: id}
+	for _, s := range rec.Addrs {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			log.Debugf("skipping invalid address %q of %s: %s", s, rec.ID, err)
+			continue
+		}
+		pi.Addrs = append(pi.Addrs, a)
+	}
+	return pi, nil
+}
@@ -0,0 +1,244 @@
+package delegated
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	u "gx/ipfs/QmNiJuT8Ja3hMVpBHXv3Q6dwmperaQ6JjLtpMQgMCD7xvx/go-ipfs-util"
+	bhost "gx/ipfs/QmQr1j6UvdhpponAaqSdswqRpdzsFwNop2N8kXLNw8afem/go-libp2p-blankhost"
+	routing "gx/ipfs/QmTiWLZ6Fo5j4KcTVutZJ5KWRRJrbxzmxA4td8NfEdrPh7/go-libp2p-routing"
+	testutil "gx/ipfs/QmVvkK7s5imCiq3JVbL3pGfnhcCnf3LrFJPF4GE2sAoGZf/go-testutil"
+	ma "gx/ipfs/QmWWQ2Txc2c6tqjsBpzg5Ar652cHPGNsQQp2SejkNmkUMb/go-multiaddr"
+	pstore "gx/ipfs/QmXauCuJzmzapetmC6W4TuDJLL1yFFrVzSHoWv8YdbmnxH/go-libp2p-peerstore"
+	netutil "gx/ipfs/QmYVR3C8DWPHdHxvLtNFYfjsXgaRAdh6hPMNH3KiwCgu4o/go-libp2p-netutil"
+	cid "gx/ipfs/QmcZfnkapfECQGcLZaf9B79NRg7cRa9EnZh4LSbkCzwNvY/go-cid"
+)
+
+// routingStandIn is a delegated routing endpoint keeping everything in
+// memory.
+type routingStandIn struct {
+	mx        sync.Mutex
+	providers map[string][]PeerRecord
+	peers     map[string]PeerRecord
+	values    map[string][]byte
+}
+
+func newRoutingStandIn() *routingStandIn {
+	return &routingStandIn{
+		providers: make(map[string][]PeerRecord),
+		peers:     make(map[string]PeerRecord),
+		values:    make(map[string][]byte),
+	}
+}
+
+func (s *routingStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/routing/v1/"), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "unknown path", http.StatusBadRequest)
+		return
+	}
+	kind, arg := parts[0], parts[1]
+
+	switch {
+	case kind == "providers" && r.Method == "GET":
+		provs, ok := s.providers[arg]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&ProvidersResponse{provs})
+	case kind == "providers" && r.Method == "PUT":
+		var req ProvidersResponse
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.providers[arg] = append(s.providers[arg], req.Providers...)
+	case kind == "peers" && r.Method == "GET":
+		rec, ok := s.peers[arg]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&rec)
+	case kind == "values" && r.Method == "GET":
+		val, ok := s.values[arg]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(val)
+	case kind == "values" && r.Method == "PUT":
+		val, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.values[arg] = val
+	default:
+		http.Error(w, "unsupported request", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestClient(ctx context.Context, t *testing.T) (*Client, *routingStandIn) {
+	s := newRoutingStandIn()
+	srv := httptest.NewServer(s)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	h := bhost.NewBlankHost(netutil.GenSwarmNetwork(t, ctx))
+	c, err := NewClient(srv.URL+"/", h, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestDelegatedProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, _ := newTestClient(ctx, t)
+	k := cid.NewCidV0(u.Hash([]byte("delegated routing")))
+
+	for range c.FindProvidersAsync(ctx, k, 10) {
+		t.Fatal("expected no providers before providing")
+	}
+
+	if err := c.Provide(ctx, k, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var provs []pstore.PeerInfo
+	for pi := range c.FindProvidersAsync(ctx, k, 10) {
+		provs = append(provs, pi)
+	}
+	if len(provs) != 1 || provs[0].ID != c.host.ID() {
+		t.Fatalf("expected to be the provider of %s, got %v", k, provs)
+	}
+	if len(provs[0].Addrs) != len(c.host.Addrs()) {
+		t.Fatalf("expected the addresses of the provider, got %v", provs[0].Addrs)
+	}
+}
+
+func TestDelegatedFindPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, s := newTestClient(ctx, t)
+	id := testutil.RandIdentityOrFatal(t)
+
+	if _, err := c.FindPeer(ctx, id.ID()); err != routing.ErrNotFound {
+		t.Fatalf("expected routing.ErrNotFound, got %v", err)
+	}
+
+	s.mx.Lock()
+	s.peers[id.ID().Pretty()] = peerRecord(pstore.PeerInfo{ID: id.ID(), Addrs: []ma.Multiaddr{id.Address()}})
+	s.mx.Unlock()
+
+	pi, err := c.FindPeer(ctx, id.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ID != id.ID() || len(pi.Addrs) != 1 || !pi.Addrs[0].Equal(id.Address()) {
+		t.Fatalf("unexpected peer info: %v", pi)
+	}
+}
+
+func TestDelegatedValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, s := newTestClient(ctx, t)
+	key := "/ipns/" + string(u.Hash([]byte("a name")))
+
+	if _, err := c.GetValue(ctx, key); err != routing.ErrNotFound {
+		t.Fatalf("expected routing.ErrNotFound, got %v", err)
+	}
+
+	if err := c.PutValue(ctx, key, []byte("a record")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mx.Lock()
+	_, ok := s.values[base64.RawURLEncoding.EncodeToString([]byte(key))]
+	s.mx.Unlock()
+	if !ok {
+		t.Fatal("expected the value to be stored under its encoded key")
+	}
+
+	val, err := c.GetValue(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "a record" {
+		t.Fatalf("unexpected value %q", val)
+	}
+}
+
+func TestDelegatedPublicKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, _ := newTestClient(ctx, t)
+	id := testutil.RandIdentityOrFatal(t)
+	other := testutil.RandIdentityOrFatal(t)
+
+	pkb, err := other.PublicKey().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutValue(ctx, "/pk/"+string(id.ID()), pkb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPublicKey(ctx, id.ID()); err == nil {
+		t.Fatal("expected a public key that doesn't match to be refused")
+	}
+
+	pkb, err = id.PublicKey().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutValue(ctx, "/pk/"+string(id.ID()), pkb); err != nil {
+		t.Fatal(err)
+	}
+	pk, err := c.GetPublicKey(ctx, id.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pk.Equals(id.PublicKey()) {
+		t.Fatal("unexpected public key")
+	}
+}
+
+func TestDelegatedEndpointErrors(t *testing.T) {
+	if _, err := NewClient("ftp://example.com", nil, 0); err == nil {
+		t.Fatal("expected ftp:// endpoints to be refused")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetValue(context.Background(), "/ipns/foo")
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("expected the endpoint's error, got %v", err)
+	}
+}
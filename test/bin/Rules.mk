@@ -26,6 +26,10 @@ $(d)/ma-pipe-unidir: test/dependencies/ma-pipe-unidir
 	$(go-build)
 TGTS_$(d) += $(d)/ma-pipe-unidir
 
+$(d)/ipfs-test-signer: test/dependencies/ipfs-test-signer
+	$(go-build)
+TGTS_$(d) += $(d)/ipfs-test-signer
+
 TGTS_GX_$(d) := hang-fds iptb
 TGTS_GX_$(d) := $(addprefix $(d)/,$(TGTS_GX_$(d)))
 
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+)
+
+// ipfs-test-signer is a stand-in external signer for the sharness tests. It
+// serves the keys of a plain keystore directory over the signer protocol.
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s <socket> <keystore-dir>\n", os.Args[0])
+		os.Exit(1)
+	}
+	sock, dir := os.Args[1], os.Args[2]
+
+	ks, err := keystore.NewFSKeystore(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open keystore: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Remove(sock)
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not listen: %s\n", err)
+		os.Exit(1)
+	}
+
+	stopped := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stopped)
+		l.Close()
+	}()
+
+	err = keystore.ServeSigner(l, ks)
+	os.Remove(sock)
+	select {
+	case <-stopped:
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
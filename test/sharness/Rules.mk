@@ -6,7 +6,8 @@ T_$(d) = $(sort $(wildcard $(d)/t[0-9][0-9][0-9][0-9]-*.sh))
 
 DEPS_$(d) := test/bin/random test/bin/multihash test/bin/pollEndpoint \
 	   test/bin/iptb test/bin/go-sleep test/bin/random-files \
-	   test/bin/go-timeout test/bin/hang-fds test/bin/ma-pipe-unidir
+	   test/bin/go-timeout test/bin/hang-fds test/bin/ma-pipe-unidir \
+	   test/bin/ipfs-test-signer
 DEPS_$(d) += cmd/ipfs/ipfs
 DEPS_$(d) += $(d)/clean-test-results
 DEPS_$(d) += $(SHARNESS_$(d))
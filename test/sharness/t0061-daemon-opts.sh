@@ -58,4 +58,24 @@ test_expect_success 'output contains info about supernode dht option' '
   test_fsh cat daemon_output2
 '
 
+test_expect_success 'daemon should not start with delegated routing and no endpoint' '
+  test_must_fail ipfs daemon --routing=delegated > daemon_output3 2>&1
+'
+
+test_expect_success 'output says the endpoint is missing' '
+  grep "Routing.Delegated.Endpoint" daemon_output3 ||
+  test_fsh cat daemon_output3
+'
+
+test_expect_success 'daemon should not start with an unknown Routing.Type' '
+  ipfs config Routing.Type fdsfdsfds &&
+  test_must_fail ipfs daemon > daemon_output4 2>&1 &&
+  ipfs config Routing.Type dht
+'
+
+test_expect_success 'output contains info about Routing.Type' '
+  grep "unknown Routing.Type" daemon_output4 ||
+  test_fsh cat daemon_output4
+'
+
 test_done
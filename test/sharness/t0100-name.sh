@@ -90,4 +90,81 @@ test_expect_success "publish an explicit node ID as key name looks good" '
   test_cmp expected_node_id_publish actual_node_id_publish
 '
 
+
+# sign a record without publishing it, then publish it
+
+test_expect_success "'ipfs name export' succeeds" '
+  ipfs name export --key=keyname --sequence=5 "/ipfs/$HASH_WELCOME_DOCS/help" >record
+'
+
+test_expect_success "'ipfs name inspect' shows the record" '
+  ipfs name inspect --verify="$NEWID" record >inspect_out &&
+  grep "/ipfs/$HASH_WELCOME_DOCS/help" inspect_out &&
+  grep "Sequence:.5" inspect_out &&
+  grep "Signature:.valid for $NEWID" inspect_out
+'
+
+test_expect_success "'ipfs name inspect' spots records signed with another key" '
+  ipfs name inspect --verify="$PEERID" record >inspect_out &&
+  grep "Signature:.INVALID for $PEERID" inspect_out
+'
+
+test_expect_success "'ipfs name import' succeeds" '
+  ipfs name import "$NEWID" record >import_out &&
+  echo "Published to ${NEWID}: /ipfs/$HASH_WELCOME_DOCS/help" >expected_import &&
+  test_cmp expected_import import_out
+'
+
+test_expect_success "imported record resolves" '
+  ipfs name resolve --nocache "$NEWID" >output &&
+  printf "/ipfs/%s/help\n" "$HASH_WELCOME_DOCS" >expected5 &&
+  test_cmp expected5 output
+'
+
+test_expect_success "'ipfs name import' refuses older records" '
+  ipfs name export --key=keyname --sequence=1 "/ipfs/$HASH_WELCOME_DOCS" >old_record &&
+  test_must_fail ipfs name import "$NEWID" old_record 2>import_err &&
+  grep "older than the current one" import_err
+'
+
+test_expect_success "'ipfs name import' refuses records for another name" '
+  test_must_fail ipfs name import "$PEERID" record
+'
+
+# test history and rollback
+
+test_expect_success "'ipfs name history' lists published records" '
+  ipfs name history >history_out &&
+  grep "^2 *\/ipfs\/$HASH_WELCOME_DOCS\/help " history_out &&
+  grep "^1 *\/ipfs\/$HASH_WELCOME_DOCS " history_out
+'
+
+test_expect_success "'ipfs name rollback' goes back to the previous value" '
+  ipfs name rollback >rollback_out &&
+  echo "Published to ${PEERID}: /ipfs/$HASH_WELCOME_DOCS" >expected_rollback &&
+  test_cmp expected_rollback rollback_out
+'
+
+test_expect_success "rolled back name resolves" '
+  ipfs name resolve --nocache "$PEERID" >output &&
+  printf "/ipfs/%s\n" "$HASH_WELCOME_DOCS" >expected_rollback_resolve &&
+  test_cmp expected_rollback_resolve output
+'
+
+test_expect_success "rollback got a higher sequence number" '
+  ipfs name history >history_out &&
+  head -n 2 history_out | grep "^3 *\/ipfs\/$HASH_WELCOME_DOCS "
+'
+
+test_expect_success "'ipfs name rollback --sequence' picks the record" '
+  ipfs name rollback --sequence=2 >rollback_out &&
+  echo "Published to ${PEERID}: /ipfs/$HASH_WELCOME_DOCS/help" >expected_rollback &&
+  test_cmp expected_rollback rollback_out
+'
+
+test_expect_success "'ipfs name rollback' fails on unknown sequence numbers" '
+  test_must_fail ipfs name rollback --sequence=42 2>rollback_err &&
+  grep "no record with sequence number 42" rollback_err
+'
+
 test_done
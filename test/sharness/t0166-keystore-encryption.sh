@@ -0,0 +1,96 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test encrypting the keystore"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a key" '
+  edhash=$(ipfs key gen bazed --type=ed25519) &&
+  PEERID=$(ipfs config Identity.PeerID)
+'
+
+test_expect_success "keystore is not encrypted yet" '
+  test ! -f "$IPFS_PATH/keystore/.encryption"
+'
+
+test_expect_success "'ipfs repo encrypt-keystore' succeeds" '
+  echo "correct horse" >passfile &&
+  ipfs repo encrypt-keystore --passphrase-file=passfile >encrypt_out &&
+  echo "Keystore encrypted." >encrypt_exp &&
+  test_cmp encrypt_exp encrypt_out
+'
+
+test_expect_success "private key is gone from the config" '
+  test_must_fail grep PrivKey "$IPFS_PATH/config"
+'
+
+test_expect_success "keys are no longer stored in plaintext" '
+  test -f "$IPFS_PATH/keystore/.encryption" &&
+  test -f "$IPFS_PATH/keystore/.identity" &&
+  test -f "$IPFS_PATH/keystore/bazed"
+'
+
+test_expect_success "encrypting it twice fails" '
+  test_must_fail ipfs repo encrypt-keystore --passphrase-file=passfile
+'
+
+test_expect_success "commands fail without the passphrase" '
+  test_must_fail ipfs key list </dev/null 2>locked_err &&
+  grep "keystore is encrypted" locked_err
+'
+
+test_expect_success "commands fail with the wrong passphrase" '
+  test_must_fail env IPFS_KEYSTORE_PASSPHRASE=wrong ipfs key list -l 2>wrong_err &&
+  grep "wrong keystore passphrase" wrong_err
+'
+
+test_expect_success "keys are listed with the passphrase" '
+  IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs key list -l >list_out &&
+  grep "$edhash bazed" list_out &&
+  grep "$PEERID self" list_out
+'
+
+test_expect_success "node identity is loaded from the keystore" '
+  ID=$(IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs id -f="<id>") &&
+  test "$ID" = "$PEERID"
+'
+
+test_expect_success "'ipfs config' can set keys after encryption" '
+  IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config Datastore.StorageGCWatermark 91 &&
+  IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config Datastore.StorageGCWatermark >watermark_out &&
+  echo 91 >watermark_exp &&
+  test_cmp watermark_exp watermark_out
+'
+
+test_expect_success "'ipfs config replace' works after encryption" '
+  IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config show >replaced_config &&
+  IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config replace replaced_config &&
+  test_must_fail grep PrivKey "$IPFS_PATH/config" &&
+  ID=$(IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs id -f="<id>") &&
+  test "$ID" = "$PEERID"
+'
+
+test_expect_success "'ipfs config' can't put a private key back after encryption" '
+  test_must_fail env IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config Identity.PrivKey CAESIAAAAAAA &&
+  test_must_fail env IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs config --json Identity "{\"PeerID\": \"$PEERID\", \"PrivKey\": \"CAESIAAAAAAA\"}" &&
+  test_must_fail grep PrivKey "$IPFS_PATH/config" &&
+  ID=$(IPFS_KEYSTORE_PASSPHRASE="correct horse" ipfs id -f="<id>") &&
+  test "$ID" = "$PEERID"
+'
+
+test_launch_ipfs_daemon --offline --keystore-passphrase-file=passfile
+
+test_expect_success "daemon can sign with keystore keys" '
+  HASH=$(echo "hello" | ipfs add -q) &&
+  ipfs name publish --key=bazed "/ipfs/$HASH" >publish_out &&
+  grep "$edhash" publish_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,71 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test publishing with keys held by an external signer"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "move a key to the signer" '
+  KEYID=$(ipfs key gen signed --type=ed25519) &&
+  mkdir signer-keys &&
+  mv "$IPFS_PATH/keystore/signed" signer-keys/
+'
+
+test_expect_success "start the signer" '
+  ipfs-test-signer "$(pwd)/signer.sock" signer-keys &
+  SIGNER_PID=$! &&
+  fwaitc=0 &&
+  while ! test -S signer.sock; do
+    test $fwaitc -lt 50 &&
+    go-sleep 100ms &&
+    fwaitc=$(expr $fwaitc + 1) || return 1
+  done
+'
+
+test_expect_success "configure the signer" '
+  ipfs config Keystore.Signer "$(pwd)/signer.sock"
+'
+
+test_expect_success "signer keys are listed" '
+  ipfs key list -l >list_out &&
+  grep "$KEYID signed" list_out
+'
+
+test_expect_success "publishing with a signer key succeeds" '
+  HASH=$(echo "signed content" | ipfs add -q) &&
+  ipfs name publish --key=signed "/ipfs/$HASH" >publish_out &&
+  echo "Published to ${KEYID}: /ipfs/$HASH" >publish_exp &&
+  test_cmp publish_exp publish_out
+'
+
+test_expect_success "the record resolves" '
+  ipfs name resolve --nocache "$KEYID" >resolve_out &&
+  echo "/ipfs/$HASH" >resolve_exp &&
+  test_cmp resolve_exp resolve_out
+'
+
+test_expect_success "signer keys can't be exported" '
+  test_must_fail ipfs key export signed 2>export_err &&
+  grep "cannot be exported" export_err
+'
+
+test_expect_success "keys can't be generated with a signer" '
+  test_must_fail ipfs key gen other --type=ed25519 2>gen_err &&
+  grep "managed by the external signer" gen_err
+'
+
+test_expect_success "stop the signer" '
+  kill $SIGNER_PID &&
+  wait $SIGNER_PID
+'
+
+test_expect_success "publishing fails without the signer" '
+  test_must_fail ipfs name publish --key=signed "/ipfs/$HASH" 2>publish_err &&
+  grep "could not reach the signer" publish_err
+'
+
+test_done
@@ -75,6 +75,30 @@ test_expect_success 'check subscriptions' '
     test_cmp expected subs2
 '
 
+test_expect_success 'subscribe to the publisher topic with add' '
+    ipfsi 1 name pubsub add /ipns/$PEERID_0 &&
+    echo /ipns/$PEERID_0 > expected &&
+    ipfsi 1 name pubsub subs > subs1 &&
+    test_cmp expected subs1
+'
+
+test_expect_success 'restart the subscriber node' '
+    iptb stop 1 &&
+    iptb start 1 --args --enable-namesys-pubsub
+'
+
+test_expect_success 'subscriptions survive the restart' '
+    echo /ipns/$PEERID_0 > expected &&
+    ipfsi 1 name pubsub subs > subs1 &&
+    test_cmp expected subs1
+'
+
+test_expect_success 'records survive the restart' '
+    echo "/ipfs/$HASH_FILE" > expected &&
+    ipfsi 1 name resolve /ipns/$PEERID_0 > name1 &&
+    test_cmp expected name1
+'
+
 test_expect_success "shut down iptb" '
     iptb stop
 '
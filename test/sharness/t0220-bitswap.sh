@@ -25,6 +25,8 @@ bitswap status
   data sent: 0
   dup blocks received: 0
   dup data received: 0 B
+  throttled sends: 0
+  throttled time: 0s
   wantlist [0 keys]
   partners [0]
 EOF
@@ -49,6 +51,16 @@ test_expect_success "hash was removed from wantlist" '
   test_must_be_empty wantlist_out
 '
 
+test_expect_success "'ipfs bitswap wantlist -v' works" '
+  ipfs bitswap wantlist -v >wantlist_v_out &&
+  test_must_be_empty wantlist_v_out
+'
+
+test_expect_success "'ipfs cat' rejects unknown priority classes" '
+  test_must_fail ipfs cat --priority=urgent QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn 2>cat_priority_err &&
+  grep "unknown priority class" cat_priority_err
+'
+
 test_expect_success "'ipfs bitswap stat' succeeds" '
   ipfs bitswap stat >stat_out
 '
@@ -63,6 +75,8 @@ bitswap status
   data sent: 0
   dup blocks received: 0
   dup data received: 0 B
+  throttled sends: 0
+  throttled time: 0s
   wantlist [0 keys]
   partners [0]
 EOF
@@ -77,6 +91,31 @@ test_expect_success "'ipfs bitswap wantlist -p' output looks good" '
   test_cmp wantlist_out wantlist_p_out
 '
 
+test_expect_success "'ipfs bitswap allowlist ls' is disabled by default" '
+  ipfs bitswap allowlist ls >allowlist_out &&
+  printf "private mode: disabled\nallowed peers [0]\n" >expected &&
+  test_cmp expected allowlist_out
+'
+
+test_expect_success "'ipfs bitswap allowlist' can be changed at runtime" '
+  ipfs bitswap allowlist enable >/dev/null &&
+  ipfs bitswap allowlist add "$PEERID" >/dev/null &&
+  ipfs bitswap allowlist tag friends >allowlist_out &&
+  printf "private mode: enabled\nallowed tag: friends\nallowed peers [1]\n\t$PEERID\n" >expected &&
+  test_cmp expected allowlist_out
+'
+
+test_expect_success "'ipfs bitswap allowlist rm' removes peers" '
+  ipfs bitswap allowlist rm "$PEERID" >/dev/null &&
+  ipfs bitswap allowlist disable >allowlist_out &&
+  printf "private mode: disabled\nallowed tag: friends\nallowed peers [0]\n" >expected &&
+  test_cmp expected allowlist_out
+'
+
+test_expect_success "'ipfs bitswap allowlist add' rejects invalid peer IDs" '
+  test_must_fail ipfs bitswap allowlist add foo
+'
+
 test_kill_ipfs_daemon
 
 test_done
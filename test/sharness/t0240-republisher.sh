@@ -117,6 +117,62 @@ verify_can_resolve "$num_test_nodes" "$KEY2" "$HASH" "new key can resolve again
 
 #
 
+test_expect_success "republish status lists the keys" '
+  ipfsi 1 name republish status > status &&
+  grep "^self  *$id " status &&
+  grep "^beepboop  *$KEY2 " status
+'
+
+test_expect_success "republish status shows the republished records" '
+  grep "^beepboop .* ok$" status &&
+  test_expect_code 1 grep "never" status
+'
+
+test_expect_success "unpublished keys are reported" '
+  KEY3=`ipfsi 1 key gen unpublished --type ed25519` &&
+  ipfsi 1 name republish status > status &&
+  grep "^unpublished  *$KEY3 .* never  *not published$" status
+'
+
+test_expect_success "republishing a key on demand succeeds" '
+  ipfsi 1 name republish --key=beepboop > republish &&
+  grep "^beepboop  *$KEY2 " republish &&
+  test_expect_code 1 grep "^self " republish
+'
+
+verify_can_resolve "$num_test_nodes" "$KEY2" "$HASH" "new key after republishing on demand"
+
+test_expect_success "republishing a key without a record fails" '
+  test_expect_code 1 ipfsi 1 name republish --key=unpublished 2> republish_err &&
+  grep "has no record to republish" republish_err
+'
+
+test_expect_success "republishing all keys skips unpublished ones" '
+  ipfsi 1 name republish > republish &&
+  grep "^self " republish &&
+  grep "^beepboop " republish &&
+  test_expect_code 1 grep "^unpublished " republish
+'
+
+test_expect_success "publishing to several keys at once succeeds" '
+  HASH=$(echo "bazbar" | ipfsi 1 add -q) &&
+  ipfsi 1 name publish -k self,beepboop $HASH > publish_out &&
+  grep "^Published to $id: /ipfs/$HASH$" publish_out &&
+  grep "^Published to $KEY2: /ipfs/$HASH$" publish_out
+'
+
+verify_can_resolve "$num_test_nodes" "$id" "$HASH" "first key after publishing to several"
+verify_can_resolve "$num_test_nodes" "$KEY2" "$HASH" "second key after publishing to several"
+
+test_expect_success "publishing to several keys publishes nothing if a key is missing" '
+  HASH2=$(echo "quxbar" | ipfsi 1 add -q) &&
+  test_must_fail ipfsi 1 name publish -k self,nope $HASH2
+'
+
+verify_can_resolve "$num_test_nodes" "$id" "$HASH" "key after failing to publish to several"
+
+#
+
 teardown_iptb
 
 test_done
@@ -0,0 +1,83 @@
+// Package passphrase reads passphrases from files, the environment or the
+// terminal.
+package passphrase
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoTerminal is returned when a passphrase has to be prompted for, but
+// stdin is not a terminal.
+var ErrNoTerminal = errors.New("no passphrase given and stdin is not a terminal")
+
+// Read returns the passphrase in the file at path if path isn't empty, else
+// the value of the environment variable env if it is set, and otherwise
+// prompts for it on the terminal.
+func Read(path, env, prompt string) ([]byte, error) {
+	if path != "" {
+		return FromFile(path)
+	}
+	if p := os.Getenv(env); p != "" {
+		return []byte(p), nil
+	}
+	return Prompt(prompt)
+}
+
+// FromFile reads a passphrase from the first line of a file.
+func FromFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	b = bytes.TrimSuffix(b, []byte("\r"))
+	if len(b) == 0 {
+		return nil, fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return b, nil
+}
+
+// Prompt asks for a passphrase on the terminal, without echoing it where the
+// terminal supports it.
+func Prompt(prompt string) ([]byte, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return nil, ErrNoTerminal
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	return []byte(line), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
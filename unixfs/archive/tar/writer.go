@@ -5,6 +5,7 @@ package tar
 import (
 	"archive/tar"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"path"
@@ -82,7 +83,15 @@ func (w *Writer) WriteNode(nd ipld.Node, fpath string) error {
 
 		switch pb.GetType() {
 		case upb.Data_Metadata:
-			fallthrough
+			// write the wrapped file in place of the metadata node
+			if len(nd.Links()) == 0 {
+				return errors.New("incorrectly formatted metadata object")
+			}
+			child, err := nd.Links()[0].GetNode(w.ctx, w.Dag)
+			if err != nil {
+				return err
+			}
+			return w.WriteNode(child, fpath)
 		case upb.Data_Directory:
 			return w.writeDir(nd, fpath)
 		case upb.Data_Raw:
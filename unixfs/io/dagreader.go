@@ -30,6 +30,23 @@ type DagReader interface {
 	Offset() int64
 }
 
+// MetadataReader is implemented by the DagReaders returned for files wrapped
+// in a unixfs Metadata node.
+type MetadataReader interface {
+	DagReader
+	// Metadata returns the metadata the file was wrapped with.
+	Metadata() *ft.Metadata
+}
+
+type metadataDagReader struct {
+	DagReader
+	md *ft.Metadata
+}
+
+func (r *metadataDagReader) Metadata() *ft.Metadata {
+	return r.md
+}
+
 // A ReadSeekCloser implements interfaces to read, copy, seek and close.
 type ReadSeekCloser interface {
 	io.Reader
@@ -60,16 +77,20 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (DagRe
 			if len(n.Links()) == 0 {
 				return nil, errors.New("incorrectly formatted metadata object")
 			}
+			md, err := ft.MetadataFromBytes(n.Data())
+			if err != nil {
+				return nil, err
+			}
 			child, err := n.Links()[0].GetNode(ctx, serv)
 			if err != nil {
 				return nil, err
 			}
 
-			childpb, ok := child.(*mdag.ProtoNode)
-			if !ok {
-				return nil, mdag.ErrNotProtobuf
+			r, err := NewDagReader(ctx, child, serv)
+			if err != nil {
+				return nil, err
 			}
-			return NewDagReader(ctx, childpb, serv)
+			return &metadataDagReader{DagReader: r, md: md}, nil
 		case ftpb.Data_Symlink:
 			return nil, ErrCantReadSymlinks
 		default:
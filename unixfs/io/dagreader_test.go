@@ -249,6 +249,47 @@ func TestMetadataNode(t *testing.T) {
 	if err := testu.ArrComp(rdata, readdata); err != nil {
 		t.Fatal(err)
 	}
+
+	mr, ok := reader.(MetadataReader)
+	if !ok {
+		t.Fatal("expected reader for metadata node to implement MetadataReader")
+	}
+	if mt := mr.Metadata().MimeType; mt != "text" {
+		t.Fatalf("expected mime type text, got %q", mt)
+	}
+}
+
+func TestMetadataNodeRawLeaf(t *testing.T) {
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	dserv := testu.GetDAGServ()
+	leaf := mdag.NewRawNode([]byte("hello world"))
+	if err := dserv.Add(ctx, leaf); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := unixfs.BytesForMetadata(&unixfs.Metadata{MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := mdag.NodeWithData(data)
+	node.AddNodeLink("", leaf)
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readdata, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(readdata) != "hello world" {
+		t.Fatalf("unexpected content %q", readdata)
+	}
+	if mt := reader.(MetadataReader).Metadata().MimeType; mt != "text/plain" {
+		t.Fatalf("expected mime type text/plain, got %q", mt)
+	}
 }
 
 func TestWriteTo(t *testing.T) {